@@ -205,7 +205,7 @@ func (e *escape) callCommon(ks []hole, call ir.Node, init *ir.Nodes, wrapper *ir
 //	defer func() { f(x1, y1) }()
 func (e *escape) goDeferStmt(n *ir.GoDeferStmt) {
 	k := e.heapHole()
-	if n.Op() == ir.ODEFER && e.loopDepth == 1 {
+	if n.Op() == ir.ODEFER && e.loopDepth == 1 && n.DeferAt == nil {
 		// Top-level defer arguments don't escape to the heap,
 		// but they do need to last until they're invoked.
 		k = e.later(e.discardHole())
@@ -221,6 +221,12 @@ func (e *escape) goDeferStmt(n *ir.GoDeferStmt) {
 	init.Append(ir.TakeInit(call)...)
 	e.stmts(*init)
 
+	if n.DeferAt != nil {
+		// The defer record is attached to another frame, which
+		// outlives the current one.
+		e.expr(e.heapHole(), n.DeferAt)
+	}
+
 	// If the function is already a zero argument/result function call,
 	// just escape analyze it normally.
 	if call, ok := call.(*ir.CallExpr); ok && call.Op() == ir.OCALLFUNC {
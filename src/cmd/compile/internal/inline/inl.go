@@ -283,6 +283,12 @@ func (v *hairyVisitor) doNode(n ir.Node) bool {
 					break
 				}
 			}
+			// Functions that call runtime.deferrangefunc can not be inlined
+			// because the defers it collects belong to the caller's frame.
+			if name.Class == ir.PFUNC && name.Sym().Pkg == ir.Pkgs.Runtime && name.Sym().Name == "deferrangefunc" {
+				v.reason = "call to deferrangefunc"
+				return true
+			}
 		}
 		if n.X.Op() == ir.OMETHEXPR {
 			if meth := ir.MethodExprName(n.X); meth != nil {
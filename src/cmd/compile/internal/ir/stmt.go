@@ -241,7 +241,8 @@ func (n *ForStmt) SetOp(op Op) {
 // in a different context (a separate goroutine or a later time).
 type GoDeferStmt struct {
 	miniStmt
-	Call Node
+	Call    Node
+	DeferAt Node // if non-nil, the defer is attached to this frame (for range-over-func loop bodies)
 }
 
 func NewGoDeferStmt(pos src.XPos, op Op, call Node) *GoDeferStmt {
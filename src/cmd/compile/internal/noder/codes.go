@@ -58,6 +58,7 @@ const (
 	exprNil
 	exprFuncInst
 	exprRecv
+	exprRuntimeBuiltin // a reference to a runtime function from transformed syntax. Followed by string name, e.g., "panicrangeexit"
 )
 
 type codeAssign int
@@ -1434,7 +1434,11 @@ func (r *reader) stmt1(tag codeStmt, out *ir.Nodes) ir.Node {
 		pos := r.pos()
 		op := r.op()
 		call := r.expr()
-		return ir.NewGoDeferStmt(pos, op, call)
+		stmt := ir.NewGoDeferStmt(pos, op, call)
+		if op == ir.ODEFER && r.Bool() {
+			stmt.DeferAt = r.expr()
+		}
+		return stmt
 
 	case stmtExpr:
 		return r.expr()
@@ -1799,6 +1803,10 @@ func (r *reader) expr() (res ir.Node) {
 	case exprFuncInst:
 		return r.obj()
 
+	case exprRuntimeBuiltin:
+		name := r.String()
+		return typecheck.Callee(typecheck.LookupRuntime(name))
+
 	case exprConst:
 		pos := r.pos()
 		typ := r.typ()
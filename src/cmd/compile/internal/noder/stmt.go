@@ -10,6 +10,7 @@ import (
 	"cmd/compile/internal/syntax"
 	"cmd/compile/internal/typecheck"
 	"cmd/compile/internal/types"
+	"cmd/compile/internal/types2"
 	"cmd/internal/src"
 )
 
@@ -244,6 +245,9 @@ func unpackTwo(list []ir.Node) (fst, snd ir.Node) {
 
 func (g *irgen) forStmt(stmt *syntax.ForStmt) ir.Node {
 	if r, ok := stmt.Init.(*syntax.RangeClause); ok {
+		if _, ok := types2.CoreType(g.info.TypeOf(r.X)).(*types2.Signature); ok {
+			base.ErrorfAt(g.pos(r), "range over function requires unified IR")
+		}
 		names, lhs := g.assignList(r.Lhs, r.Def)
 		key, value := unpackTwo(lhs)
 		n := ir.NewRangeStmt(g.pos(r), key, value, g.expr(r.X), g.blockStmt(stmt.Body))
@@ -16,6 +16,8 @@ import (
 	"cmd/compile/internal/base"
 	"cmd/compile/internal/inline"
 	"cmd/compile/internal/ir"
+	"cmd/compile/internal/rangefunc"
+	"cmd/compile/internal/syntax"
 	"cmd/compile/internal/typecheck"
 	"cmd/compile/internal/types"
 	"cmd/compile/internal/types2"
@@ -148,6 +150,16 @@ func readBodies(target *ir.Package) {
 func writePkgStub(noders []*noder) string {
 	m, pkg, info := checkFiles(noders)
 
+	// Rewrite range over function to explicit function calls
+	// with the loop bodies converted into new implicit closures.
+	// We do this now, before serialization to unified IR, so that if the
+	// implicit closures are inlined, we will have the unified IR form.
+	files := make([]*syntax.File, len(noders))
+	for i, p := range noders {
+		files[i] = p.file
+	}
+	rangefunc.Rewrite(pkg, info, files)
+
 	pw := newPkgWriter(m, pkg, info)
 
 	pw.collectDecls(noders)
@@ -10,6 +10,7 @@ import (
 
 	"cmd/compile/internal/base"
 	"cmd/compile/internal/ir"
+	"cmd/compile/internal/rangefunc"
 	"cmd/compile/internal/syntax"
 	"cmd/compile/internal/types2"
 )
@@ -1081,6 +1082,9 @@ func (w *writer) stmt1(stmt syntax.Stmt) {
 		w.pos(stmt)
 		w.op(callOps[stmt.Tok])
 		w.expr(stmt.Call)
+		if stmt.Tok == syntax.Defer {
+			w.optExpr(stmt.DeferAt)
+		}
 
 	case *syntax.DeclStmt:
 		for _, decl := range stmt.DeclList {
@@ -1499,6 +1503,12 @@ func (w *writer) expr(expr syntax.Expr) {
 		}
 
 		if isGlobal(obj) {
+			if rangefunc.IsRuntimeFunc(obj) {
+				w.Code(exprRuntimeBuiltin)
+				w.String(obj.Name())
+				return
+			}
+
 			w.Code(exprGlobal)
 			w.obj(obj, nil)
 			return
@@ -0,0 +1,251 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build goexperiment.rangefunc
+
+package rangefunc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func count(n int) func(func(int) bool) {
+	return func(yield func(int) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func pairs(yield func(int, string) bool) {
+	for i, s := range []string{"a", "b", "c"} {
+		if !yield(i, s) {
+			return
+		}
+	}
+}
+
+type myBool bool
+
+func countMyBool(n int) func(func(int) myBool) {
+	return func(yield func(int) myBool) {
+		for i := 0; i < n; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	var got []int
+	for i := range count(4) {
+		got = append(got, i)
+	}
+	if fmt.Sprint(got) != "[0 1 2 3]" {
+		t.Errorf("got %v, want [0 1 2 3]", got)
+	}
+
+	var s string
+	for i, v := range pairs {
+		s += fmt.Sprintf("%d %s;", i, v)
+	}
+	if s != "0 a;1 b;2 c;" {
+		t.Errorf("got %q, want %q", s, "0 a;1 b;2 c;")
+	}
+
+	n := 0
+	for range pairs {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("got %d iterations, want 3", n)
+	}
+
+	got = got[:0]
+	for i := range countMyBool(3) {
+		got = append(got, i)
+	}
+	if fmt.Sprint(got) != "[0 1 2]" {
+		t.Errorf("got %v, want [0 1 2]", got)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	var k int
+	var v string
+	for k, v = range pairs {
+	}
+	if k != 2 || v != "c" {
+		t.Errorf("got %d, %q, want 2, %q", k, v, "c")
+	}
+}
+
+func find(x int) (int, bool) {
+	for v := range count(10) {
+		if v == x {
+			return v * 10, true
+		}
+	}
+	return -1, false
+}
+
+func findNamed(x int) (r int) {
+	r = -1
+	for v := range count(10) {
+		for w := range count(10) {
+			if v*w == x {
+				r = v*10 + w
+				return
+			}
+		}
+	}
+	return
+}
+
+func TestReturn(t *testing.T) {
+	if v, ok := find(4); v != 40 || !ok {
+		t.Errorf("find(4) = %d, %v, want 40, true", v, ok)
+	}
+	if v, ok := find(40); v != -1 || ok {
+		t.Errorf("find(40) = %d, %v, want -1, false", v, ok)
+	}
+	if r := findNamed(6); r != 16 {
+		t.Errorf("findNamed(6) = %d, want 16", r)
+	}
+	if r := findNamed(100); r != -1 {
+		t.Errorf("findNamed(100) = %d, want -1", r)
+	}
+}
+
+func TestBreakContinue(t *testing.T) {
+	var got []int
+outer:
+	for i := range count(4) {
+		for j := range count(4) {
+			if j > i {
+				continue outer
+			}
+			if i == 3 {
+				break outer
+			}
+			got = append(got, i*10+j)
+		}
+	}
+	if fmt.Sprint(got) != "[0 10 11 20 21 22]" {
+		t.Errorf("got %v, want [0 10 11 20 21 22]", got)
+	}
+
+	// Branches to an ordinary loop enclosing a range-over-func loop.
+	got = got[:0]
+	for i := 0; i < 3; i++ {
+		for j := range count(3) {
+			if j == 1 {
+				break
+			}
+			if i == 1 {
+				continue
+			}
+			got = append(got, i*10+j)
+		}
+	}
+	if fmt.Sprint(got) != "[0 20]" {
+		t.Errorf("got %v, want [0 20]", got)
+	}
+
+	got = got[:0]
+L:
+	for i := 0; i < 3; i++ {
+		switch i {
+		case 1:
+			for j := range count(3) {
+				if j == 1 {
+					continue L
+				}
+			}
+		case 2:
+			for range count(3) {
+				break L
+			}
+		}
+		got = append(got, i)
+	}
+	if fmt.Sprint(got) != "[0]" {
+		t.Errorf("got %v, want [0]", got)
+	}
+}
+
+func TestGoto(t *testing.T) {
+	n := 0
+again:
+	for i := range count(5) {
+		n++
+		if n == 3 {
+			goto again
+		}
+		if i == 2 {
+			break
+		}
+	}
+	if n != 6 {
+		t.Errorf("got %d iterations, want 6", n)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	var b strings.Builder
+	func() {
+		defer b.WriteString("outer;")
+		for i := range count(3) {
+			defer fmt.Fprintf(&b, "loop %d;", i)
+		}
+		b.WriteString("end;")
+	}()
+	const want = "end;loop 2;loop 1;loop 0;outer;"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDeferPanic(t *testing.T) {
+	var b strings.Builder
+	func() {
+		defer func() {
+			b.WriteString(fmt.Sprint(recover()))
+		}()
+		for i := range count(3) {
+			defer fmt.Fprintf(&b, "loop %d;", i)
+			if i == 1 {
+				panic("boom")
+			}
+		}
+	}()
+	const want = "loop 1;loop 0;boom"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestYieldAfterExit(t *testing.T) {
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !strings.Contains(err.Error(), "range function continued iteration after exit") {
+			t.Errorf("recovered %v, want range function continued iteration after exit", r)
+		}
+	}()
+	var saved func(int) bool
+	for range func(yield func(int) bool) {
+		saved = yield
+		yield(1)
+	} {
+		break
+	}
+	saved(2)
+	t.Fatal("yield after loop exit did not panic")
+}
@@ -0,0 +1,814 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package rangefunc rewrites range-over-func to code that doesn't use range-over-funcs.
+Rewriting the construct in the front end, before noder, means the functions generated during
+the rewrite are available in a noder-generated representation for inlining by the back end.
+
+# Theory of Operation
+
+The basic idea is to rewrite
+
+	for x := range f {
+		...
+	}
+
+into
+
+	f(func(x T) bool {
+		...
+	})
+
+But it's not usually that easy.
+
+# Range variables
+
+For a range not using :=, the assigned variables cannot be function parameters
+in the generated body function. Instead, we allocate fake parameters and
+start the body with an assignment. For example:
+
+	for expr1, expr2 = range f {
+		...
+	}
+
+becomes
+
+	f(func(#p1 T1, #p2 T2) bool {
+		expr1, expr2 = #p1, #p2
+		...
+	})
+
+(All the generated variables have a # at the start to signal that they
+are internal variables when looking at the generated code in a
+debugger. Because variables have all been resolved to the specific
+objects they represent, there is no danger of using plain "p1" and
+colliding with a Go variable named "p1"; the # is just nice to have,
+not for correctness.)
+
+It can also happen that there are fewer range variables than function
+arguments, in which case we end up with something like
+
+	f(func(x T1, _ T2) bool {
+		...
+	})
+
+or
+
+	f(func(#p1 T1, #p2 T2, _ T3) bool {
+		expr1, expr2 = #p1, #p2
+		...
+	})
+
+# Return
+
+If the body contains a "break", that break turns into "return false",
+to tell f to stop. And if the body contains a "continue", that turns
+into "return true", to tell f to proceed with the next value.
+Those are the easy cases.
+
+If the body contains a return or a break/continue/goto L, then we need
+to rewrite that into code that breaks out of the loop and then
+triggers that control flow. In general we rewrite
+
+	for x := range f {
+		...
+	}
+
+into
+
+	{
+		var #next int
+		f(func(x T1) bool {
+			...
+			return true
+		})
+		... check #next ...
+	}
+
+The variable #next is an integer code that says what to do when f
+returns. Each difficult statement sets #next and then returns false to
+stop f.
+
+A plain "return" rewrites to {#next = -1; return false}.
+The return false breaks the loop. Then when f returns, the "check
+#next" section includes
+
+	if #next == -1 { return }
+
+which causes the return we want.
+
+Return with arguments is more involved. We need somewhere to store the
+arguments while we break out of the loop, so we allocate a separate
+result variable for each result, #r1, #r2, and so on. Then
+
+	return x, y
+
+rewrites to {#r1, #r2 = x, y; #next = -2; return false}
+and the "check #next" section includes
+
+	if #next == -2 { return #r1, #r2 }
+
+# Checking
+
+To permit checking that an iterator is well-behaved -- that is, that
+it does not call the loop body again after it has returned false or
+after the entire loop has exited (it might retain a copy of the body
+function, or pass it to another goroutine) -- each generated loop has
+its own #exitK flag that is checked at the start of the body and set
+to true when the loop body returns false or the iterator returns:
+
+	{
+		var #exit1 bool
+		f(func(x T1) bool {
+			if #exit1 { runtime.panicrangeexit() }
+			...
+		})
+		#exit1 = true
+	}
+
+# Nested Loops
+
+So far we've only considered a single loop. If a function contains a
+sequence of loops, each can be translated individually. But loops can
+be nested. It would work to translate the innermost loop and then
+translate the loop around it, and so on, except that there'd be
+repeated rewriting of the same code and the overall cost could be
+quadratic. Instead the rewrite is done in a single pass over the
+function body, with a stack of the range-over-func loops enclosing the
+current statement.
+
+A break, continue or goto that leaves more than one loop body is
+assigned its own positive #next code. The innermost body sets #next
+and returns false; after each enclosing loop call, the "check #next"
+section either executes the branch, if its target is reachable from
+there, or passes it on to the next enclosing loop by returning false
+again:
+
+	if #next != 0 { #exitK = true; return false }
+
+A continue or break of an enclosing range-over-func loop is executed
+by returning true or false from that loop's body, as usual.
+
+# Defers
+
+The last wrinkle is handling defer statements. If we have
+
+	for range f {
+		defer print("A")
+	}
+
+we cannot rewrite that into
+
+	f(func() bool {
+		defer print("A")
+		return true
+	})
+
+because the deferred code will run at the end of the iteration, not
+the end of the containing function. To fix that, the runtime provides
+a special hook that lets us obtain a "token" representing the outer
+function and then use it in a later defer to attach the deferred code
+to that outer function.
+
+Normally,
+
+	defer print("A")
+
+compiles to
+
+	runtime.deferproc(func() { print("A") })
+
+This changes in a range-over-func. For example:
+
+	for range f {
+		defer print("A")
+	}
+
+compiles to
+
+	var #defers = runtime.deferrangefunc()
+	f(func() bool {
+		runtime.deferprocat(func() { print("A") }, #defers)
+		return true
+	})
+
+For this rewriting phase, we insert the explicit initialization of
+#defers and then attach the #defers variable to the CallStmt
+representing the defer. That variable will be propagated to the
+backend and will cause the backend to compile the defer using
+deferprocat instead of an ordinary deferproc.
+*/
+package rangefunc
+
+import (
+	"cmd/compile/internal/base"
+	"cmd/compile/internal/syntax"
+	"cmd/compile/internal/types2"
+	"fmt"
+	"go/constant"
+	"strconv"
+)
+
+// nopos is the zero syntax.Pos.
+var nopos syntax.Pos
+
+// A rewriter implements rewriting the range-over-funcs in a given function.
+type rewriter struct {
+	pkg  *types2.Package
+	info *types2.Info
+	sig  *types2.Signature // signature of the function being rewritten
+
+	// depth records, for each for, switch, select and labeled
+	// statement in the function, the number of range-over-func
+	// loops enclosing it.
+	depth map[syntax.Stmt]int
+
+	// forStack is the stack of range-over-func loops enclosing
+	// the statement being rewritten, outermost first.
+	forStack []*forLoop
+
+	// Variables shared by a nest of loops, created as needed.
+	next    *types2.Var   // #next
+	retVars []*types2.Var // #r1, #r2, ...
+	defers  *types2.Var   // #defers
+
+	codes map[branch]int // #next codes for branches leaving a loop nest
+	nexit int            // number of #exitK variables allocated
+}
+
+// A branch identifies the control flow of a break, continue or goto.
+type branch struct {
+	target syntax.Stmt
+	cont   bool // continue, rather than break or goto
+}
+
+// A forLoop describes a single range-over-func loop being processed.
+type forLoop struct {
+	nfor  *syntax.ForStmt
+	depth int         // index in forStack
+	exit  *types2.Var // #exitK
+
+	// Control flow to resume after the loop call returns.
+	checkRet     bool                 // bare return
+	checkRetArgs bool                 // return with results in retVars
+	checkBranch  []*syntax.BranchStmt // branches whose targets are reachable after this loop
+	checkCodes   map[int]bool
+	propagate    bool // pass remaining #next codes to the enclosing loop
+}
+
+// Rewrite rewrites all the range-over-funcs in the files.
+func Rewrite(pkg *types2.Package, info *types2.Info, files []*syntax.File) {
+	type fn struct {
+		typ  *types2.Signature
+		body *syntax.BlockStmt
+	}
+	var funcs []fn
+	for _, file := range files {
+		syntax.Inspect(file, func(n syntax.Node) bool {
+			switch n := n.(type) {
+			case *syntax.FuncDecl:
+				if n.Body != nil {
+					sig, _ := info.Defs[n.Name].Type().(*types2.Signature)
+					funcs = append(funcs, fn{sig, n.Body})
+				}
+			case *syntax.FuncLit:
+				sig, _ := info.Types[n].Type.(*types2.Signature)
+				funcs = append(funcs, fn{sig, n.Body})
+			}
+			return true
+		})
+	}
+
+	// Each function body, including the bodies of function literals,
+	// is rewritten separately: the rewrite of one function never looks
+	// inside the function literals it contains.
+	for _, f := range funcs {
+		r := &rewriter{pkg: pkg, info: info, sig: f.typ}
+		if r.scan(f.body) {
+			r.stmts(f.body.List)
+		}
+	}
+}
+
+// scan records the depth of the loops, switches, selects and labeled
+// statements in body and reports whether body contains any
+// range-over-func loops.
+func (r *rewriter) scan(body *syntax.BlockStmt) bool {
+	found := false
+	depth := 0
+	var stack []syntax.Node
+	syntax.Inspect(body, func(n syntax.Node) bool {
+		if n == nil {
+			if nfor, ok := stack[len(stack)-1].(*syntax.ForStmt); ok && r.isRangeFunc(nfor) {
+				depth--
+			}
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		switch n := n.(type) {
+		case *syntax.FuncLit:
+			return false
+		case *syntax.ForStmt:
+			r.setDepth(n, depth)
+			if r.isRangeFunc(n) {
+				found = true
+				depth++
+			}
+		case *syntax.SwitchStmt, *syntax.SelectStmt, *syntax.LabeledStmt:
+			r.setDepth(n.(syntax.Stmt), depth)
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return found
+}
+
+func (r *rewriter) setDepth(s syntax.Stmt, depth int) {
+	if r.depth == nil {
+		r.depth = make(map[syntax.Stmt]int)
+	}
+	r.depth[s] = depth
+}
+
+// isRangeFunc reports whether nfor is a range over a function.
+func (r *rewriter) isRangeFunc(nfor *syntax.ForStmt) bool {
+	rclause, ok := nfor.Init.(*syntax.RangeClause)
+	if !ok {
+		return false
+	}
+	tv, ok := r.info.Types[rclause.X]
+	if !ok {
+		base.Fatalf("range expression %v has no type", syntax.String(rclause.X))
+	}
+	_, ok = types2.CoreType(tv.Type).(*types2.Signature)
+	return ok
+}
+
+// stmts rewrites the statements in list, in place.
+func (r *rewriter) stmts(list []syntax.Stmt) {
+	for i, s := range list {
+		list[i] = r.stmt(s)
+	}
+}
+
+// stmt rewrites s, returning the statement to use in its place.
+func (r *rewriter) stmt(s syntax.Stmt) syntax.Stmt {
+	switch s := s.(type) {
+	case *syntax.BlockStmt:
+		r.stmts(s.List)
+
+	case *syntax.LabeledStmt:
+		s.Stmt = r.stmt(s.Stmt)
+
+	case *syntax.IfStmt:
+		r.stmts(s.Then.List)
+		if s.Else != nil {
+			s.Else = r.stmt(s.Else)
+		}
+
+	case *syntax.SwitchStmt:
+		for _, cc := range s.Body {
+			r.stmts(cc.Body)
+		}
+
+	case *syntax.SelectStmt:
+		for _, cc := range s.Body {
+			r.stmts(cc.Body)
+		}
+
+	case *syntax.ForStmt:
+		if r.isRangeFunc(s) {
+			return r.rangeFunc(s)
+		}
+		r.stmts(s.Body.List)
+
+	case *syntax.BranchStmt:
+		if len(r.forStack) > 0 {
+			return r.branchStmt(s)
+		}
+
+	case *syntax.ReturnStmt:
+		if len(r.forStack) > 0 {
+			return r.returnStmt(s)
+		}
+
+	case *syntax.CallStmt:
+		if s.Tok == syntax.Defer && len(r.forStack) > 0 {
+			if r.defers == nil {
+				r.defers = r.newVar(s.Pos(), "#defers", runtimeSig("deferrangefunc").Results().At(0).Type())
+			}
+			s.DeferAt = r.useVar(s.Pos(), r.defers)
+		}
+	}
+	return s
+}
+
+// rangeFunc rewrites the range-over-func loop nfor, returning
+// the block statement that replaces it.
+func (r *rewriter) rangeFunc(nfor *syntax.ForStmt) syntax.Stmt {
+	if len(r.forStack) == 0 {
+		// Start of a new nest of loops.
+		r.next, r.retVars, r.defers = nil, nil, nil
+	}
+	r.nexit++
+	loop := &forLoop{
+		nfor:  nfor,
+		depth: len(r.forStack),
+		exit:  r.newVar(nfor.Pos(), fmt.Sprintf("#exit%d", r.nexit), types2.Typ[types2.Bool]),
+	}
+
+	r.forStack = append(r.forStack, loop)
+	r.stmts(nfor.Body.List)
+	r.forStack = r.forStack[:len(r.forStack)-1]
+
+	return r.endLoop(loop)
+}
+
+// endLoop builds the replacement for loop, whose body has already been rewritten.
+func (r *rewriter) endLoop(loop *forLoop) syntax.Stmt {
+	nfor := loop.nfor
+	pos := nfor.Pos()
+	rclause := nfor.Init.(*syntax.RangeClause)
+	ftyp := types2.CoreType(r.info.Types[rclause.X].Type).(*types2.Signature)
+	ytyp := types2.CoreType(ftyp.Params().At(0).Type()).(*types2.Signature)
+	btyp := ytyp.Results().At(0).Type()
+
+	// Parameters of the body function.
+	var lhs []syntax.Expr
+	if rclause.Lhs != nil {
+		lhs = unpackListExpr(rclause.Lhs)
+	}
+	var params []*types2.Var
+	var assignLhs, assignRhs []syntax.Expr
+	for i := 0; i < ytyp.Params().Len(); i++ {
+		typ := ytyp.Params().At(i).Type()
+		var param *types2.Var
+		if i < len(lhs) {
+			if rclause.Def {
+				if name, ok := lhs[i].(*syntax.Name); ok {
+					param, _ = r.info.Defs[name].(*types2.Var)
+				}
+			} else if name, ok := lhs[i].(*syntax.Name); !ok || name.Value != "_" {
+				param = types2.NewParam(lhs[i].Pos(), r.pkg, fmt.Sprintf("#p%d", i+1), typ)
+				assignLhs = append(assignLhs, lhs[i])
+				assignRhs = append(assignRhs, r.useVar(lhs[i].Pos(), param))
+			}
+		}
+		if param == nil {
+			param = types2.NewParam(pos, r.pkg, "", typ)
+		}
+		params = append(params, param)
+	}
+	results := types2.NewTuple(types2.NewParam(pos, r.pkg, "", btyp))
+	sig := types2.NewSignatureType(nil, nil, nil, types2.NewTuple(params...), results, false)
+
+	// Body function.
+	body := nfor.Body
+	prefix := []syntax.Stmt{r.ifStmt(pos, r.useVar(pos, loop.exit), r.callStmt(pos, r.runtimeFunc(pos, "panicrangeexit")))}
+	if len(assignLhs) > 0 {
+		prefix = append(prefix, r.assignStmt(pos, assignLhs, assignRhs))
+	}
+	body.List = append(prefix, body.List...)
+	body.List = append(body.List, r.ret(body.Rbrace, r.boolConst(body.Rbrace, btyp, true)))
+
+	lit := &syntax.FuncLit{Type: &syntax.FuncType{}, Body: body}
+	lit.SetPos(pos)
+	lit.Type.SetPos(pos)
+	r.setType(lit, sig, nil)
+
+	call := &syntax.CallExpr{Fun: rclause.X, ArgList: []syntax.Expr{lit}}
+	call.SetPos(pos)
+
+	// Replacement block.
+	block := &syntax.BlockStmt{Rbrace: body.Rbrace}
+	block.SetPos(pos)
+	if loop.depth == 0 {
+		if r.next != nil {
+			block.List = append(block.List, r.varDecl(pos, r.next))
+		}
+		for _, v := range r.retVars {
+			block.List = append(block.List, r.varDecl(pos, v))
+		}
+		if r.defers != nil {
+			def := &syntax.AssignStmt{Op: syntax.Def, Lhs: r.defName(pos, r.defers), Rhs: r.runtimeCall(pos, "deferrangefunc")}
+			def.SetPos(pos)
+			block.List = append(block.List, def)
+		}
+	}
+	block.List = append(block.List,
+		r.varDecl(pos, loop.exit),
+		exprStmt(pos, call),
+		r.setExit(body.Rbrace, loop.exit),
+	)
+
+	// Check #next.
+	epos := body.Rbrace
+	if loop.checkRet {
+		block.List = append(block.List, r.ifNext(epos, -1, r.ret(epos, nil)))
+	}
+	if loop.checkRetArgs {
+		var results []syntax.Expr
+		for _, v := range r.retVars {
+			results = append(results, r.useVar(epos, v))
+		}
+		block.List = append(block.List, r.ifNext(epos, -2, r.ret(epos, listExpr(epos, results))))
+	}
+	for _, b := range loop.checkBranch {
+		code := r.codes[branch{b.Target, b.Tok == syntax.Continue}]
+		s := &syntax.BranchStmt{Tok: b.Tok, Target: b.Target}
+		s.SetPos(epos)
+		if b.Label != nil {
+			s.Label = syntax.NewName(epos, b.Label.Value)
+		}
+		block.List = append(block.List, r.ifNext(epos, code, r.setNext(epos, 0), r.stmt(s)))
+	}
+	if loop.propagate {
+		outer := r.forStack[len(r.forStack)-1]
+		cond := r.binary(epos, syntax.Neq, r.useVar(epos, r.next), r.intConst(epos, 0), types2.Typ[types2.Bool])
+		block.List = append(block.List, r.ifStmt(epos, cond, r.exitLoop(epos, outer)...))
+	}
+
+	return block
+}
+
+// branchStmt rewrites a break, continue or goto inside a
+// range-over-func loop body.
+func (r *rewriter) branchStmt(s *syntax.BranchStmt) syntax.Stmt {
+	if s.Tok == syntax.Fallthrough {
+		return s
+	}
+	top := r.forStack[len(r.forStack)-1]
+
+	// d is the number of enclosing range-over-func loops that
+	// control flow does not leave.
+	d, ok := r.depth[s.Target]
+	if !ok {
+		base.Fatalf("%v: %v target not found", s.Pos(), s.Tok)
+	}
+	if s.Tok != syntax.Goto {
+		if nfor, ok := s.Target.(*syntax.ForStmt); ok && r.isRangeFunc(nfor) {
+			if d == top.depth {
+				// Branch to the innermost loop itself.
+				if s.Tok == syntax.Continue {
+					return r.ret(s.Pos(), r.boolConst(s.Pos(), r.bodyResult(top), true))
+				}
+				return r.block(s.Pos(), r.exitLoop(s.Pos(), top)...)
+			}
+			d++
+		}
+	}
+	if d == len(r.forStack) {
+		return s
+	}
+
+	b := branch{s.Target, s.Tok == syntax.Continue}
+	code, ok := r.codes[b]
+	if !ok {
+		if r.codes == nil {
+			r.codes = make(map[branch]int)
+		}
+		code = len(r.codes) + 1
+		r.codes[b] = code
+	}
+	loop := r.forStack[d]
+	if loop.checkCodes == nil {
+		loop.checkCodes = make(map[int]bool)
+	}
+	if !loop.checkCodes[code] {
+		loop.checkCodes[code] = true
+		loop.checkBranch = append(loop.checkBranch, s)
+	}
+	for _, l := range r.forStack[d+1:] {
+		l.propagate = true
+	}
+	return r.block(s.Pos(), append([]syntax.Stmt{r.setNext(s.Pos(), code)}, r.exitLoop(s.Pos(), top)...)...)
+}
+
+// returnStmt rewrites a return statement inside a range-over-func loop body.
+func (r *rewriter) returnStmt(s *syntax.ReturnStmt) syntax.Stmt {
+	pos := s.Pos()
+	top := r.forStack[len(r.forStack)-1]
+	var list []syntax.Stmt
+	code := -1
+	if s.Results == nil {
+		r.forStack[0].checkRet = true
+	} else {
+		code = -2
+		r.forStack[0].checkRetArgs = true
+		if r.retVars == nil {
+			results := r.sig.Results()
+			for i := 0; i < results.Len(); i++ {
+				r.retVars = append(r.retVars, r.newVar(pos, fmt.Sprintf("#r%d", i+1), results.At(i).Type()))
+			}
+		}
+		var lhs []syntax.Expr
+		for _, v := range r.retVars {
+			lhs = append(lhs, r.useVar(pos, v))
+		}
+		list = append(list, r.assignStmt(pos, lhs, unpackListExpr(s.Results)))
+	}
+	for _, l := range r.forStack[1:] {
+		l.propagate = true
+	}
+	list = append(list, r.setNext(pos, code))
+	list = append(list, r.exitLoop(pos, top)...)
+	return r.block(pos, list...)
+}
+
+// exitLoop returns the statements that stop loop:
+// "#exitK = true; return false".
+func (r *rewriter) exitLoop(pos syntax.Pos, loop *forLoop) []syntax.Stmt {
+	return []syntax.Stmt{
+		r.setExit(pos, loop.exit),
+		r.ret(pos, r.boolConst(pos, r.bodyResult(loop), false)),
+	}
+}
+
+// bodyResult returns the result type of loop's body function.
+func (r *rewriter) bodyResult(loop *forLoop) types2.Type {
+	rclause := loop.nfor.Init.(*syntax.RangeClause)
+	ftyp := types2.CoreType(r.info.Types[rclause.X].Type).(*types2.Signature)
+	ytyp := types2.CoreType(ftyp.Params().At(0).Type()).(*types2.Signature)
+	return ytyp.Results().At(0).Type()
+}
+
+// setNext returns "#next = code", allocating #next if needed.
+func (r *rewriter) setNext(pos syntax.Pos, code int) syntax.Stmt {
+	if r.next == nil {
+		r.next = r.newVar(pos, "#next", types2.Typ[types2.Int])
+	}
+	return r.assignStmt(pos, []syntax.Expr{r.useVar(pos, r.next)}, []syntax.Expr{r.intConst(pos, code)})
+}
+
+// setExit returns "#exitK = true".
+func (r *rewriter) setExit(pos syntax.Pos, exit *types2.Var) syntax.Stmt {
+	return r.assignStmt(pos, []syntax.Expr{r.useVar(pos, exit)}, []syntax.Expr{r.boolConst(pos, types2.Typ[types2.Bool], true)})
+}
+
+// ifNext returns "if #next == code { list }".
+func (r *rewriter) ifNext(pos syntax.Pos, code int, list ...syntax.Stmt) syntax.Stmt {
+	if r.next == nil {
+		r.next = r.newVar(pos, "#next", types2.Typ[types2.Int])
+	}
+	cond := r.binary(pos, syntax.Eql, r.useVar(pos, r.next), r.intConst(pos, code), types2.Typ[types2.Bool])
+	return r.ifStmt(pos, cond, list...)
+}
+
+// Syntax construction helpers. Each records the types of the
+// expressions it creates, so that the noder can write them out
+// as if they had been type-checked.
+
+func (r *rewriter) newVar(pos syntax.Pos, name string, typ types2.Type) *types2.Var {
+	return types2.NewVar(pos, r.pkg, name, typ)
+}
+
+func (r *rewriter) setType(x syntax.Expr, typ types2.Type, val constant.Value) {
+	tv := types2.TypeAndValue{Type: typ, Value: val}
+	tv.SetIsValue()
+	r.info.Types[x] = tv
+}
+
+func (r *rewriter) useVar(pos syntax.Pos, obj *types2.Var) *syntax.Name {
+	n := syntax.NewName(pos, obj.Name())
+	r.info.Uses[n] = obj
+	r.setType(n, obj.Type(), nil)
+	return n
+}
+
+func (r *rewriter) defName(pos syntax.Pos, obj *types2.Var) *syntax.Name {
+	n := syntax.NewName(pos, obj.Name())
+	r.info.Defs[n] = obj
+	return n
+}
+
+func (r *rewriter) intConst(pos syntax.Pos, v int) syntax.Expr {
+	x := &syntax.BasicLit{Value: strconv.Itoa(v), Kind: syntax.IntLit}
+	x.SetPos(pos)
+	r.setType(x, types2.Typ[types2.Int], constant.MakeInt64(int64(v)))
+	return x
+}
+
+func (r *rewriter) boolConst(pos syntax.Pos, typ types2.Type, v bool) syntax.Expr {
+	x := syntax.NewName(pos, strconv.FormatBool(v))
+	r.setType(x, typ, constant.MakeBool(v))
+	return x
+}
+
+func (r *rewriter) binary(pos syntax.Pos, op syntax.Operator, x, y syntax.Expr, typ types2.Type) syntax.Expr {
+	e := &syntax.Operation{Op: op, X: x, Y: y}
+	e.SetPos(pos)
+	r.setType(e, typ, nil)
+	return e
+}
+
+func (r *rewriter) runtimeFunc(pos syntax.Pos, name string) *syntax.Name {
+	obj := runtimePkg.Scope().Lookup(name)
+	n := syntax.NewName(pos, name)
+	r.info.Uses[n] = obj
+	r.setType(n, obj.Type(), nil)
+	return n
+}
+
+func (r *rewriter) runtimeCall(pos syntax.Pos, name string) syntax.Expr {
+	call := &syntax.CallExpr{Fun: r.runtimeFunc(pos, name)}
+	call.SetPos(pos)
+	if results := runtimeSig(name).Results(); results.Len() == 1 {
+		r.setType(call, results.At(0).Type(), nil)
+	}
+	return call
+}
+
+func (r *rewriter) callStmt(pos syntax.Pos, fun syntax.Expr) syntax.Stmt {
+	call := &syntax.CallExpr{Fun: fun}
+	call.SetPos(pos)
+	return exprStmt(pos, call)
+}
+
+func (r *rewriter) varDecl(pos syntax.Pos, obj *types2.Var) syntax.Stmt {
+	d := &syntax.VarDecl{NameList: []*syntax.Name{r.defName(pos, obj)}}
+	d.SetPos(pos)
+	s := &syntax.DeclStmt{DeclList: []syntax.Decl{d}}
+	s.SetPos(pos)
+	return s
+}
+
+func (r *rewriter) assignStmt(pos syntax.Pos, lhs, rhs []syntax.Expr) syntax.Stmt {
+	s := &syntax.AssignStmt{Lhs: listExpr(pos, lhs), Rhs: listExpr(pos, rhs)}
+	s.SetPos(pos)
+	return s
+}
+
+func (r *rewriter) ifStmt(pos syntax.Pos, cond syntax.Expr, list ...syntax.Stmt) syntax.Stmt {
+	s := &syntax.IfStmt{Cond: cond, Then: r.block(pos, list...).(*syntax.BlockStmt)}
+	s.SetPos(pos)
+	return s
+}
+
+func (r *rewriter) block(pos syntax.Pos, list ...syntax.Stmt) syntax.Stmt {
+	s := &syntax.BlockStmt{List: list, Rbrace: pos}
+	s.SetPos(pos)
+	return s
+}
+
+func (r *rewriter) ret(pos syntax.Pos, results syntax.Expr) syntax.Stmt {
+	s := &syntax.ReturnStmt{Results: results}
+	s.SetPos(pos)
+	return s
+}
+
+func exprStmt(pos syntax.Pos, x syntax.Expr) syntax.Stmt {
+	s := &syntax.ExprStmt{X: x}
+	s.SetPos(pos)
+	return s
+}
+
+// listExpr returns list as a single expression,
+// or nil if list is empty.
+func listExpr(pos syntax.Pos, list []syntax.Expr) syntax.Expr {
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	x := &syntax.ListExpr{ElemList: list}
+	x.SetPos(pos)
+	return x
+}
+
+func unpackListExpr(x syntax.Expr) []syntax.Expr {
+	if list, ok := x.(*syntax.ListExpr); ok {
+		return list.ElemList
+	}
+	return []syntax.Expr{x}
+}
+
+// runtimePkg is a fake runtime package that contains what we need to
+// refer to in package runtime.
+var runtimePkg = func() *types2.Package {
+	pkg := types2.NewPackage("runtime", "runtime")
+	anyType := types2.Universe.Lookup("any").Type()
+
+	// func deferrangefunc() any
+	obj := types2.NewFunc(nopos, pkg, "deferrangefunc", types2.NewSignatureType(nil, nil, nil, nil, types2.NewTuple(types2.NewParam(nopos, pkg, "extra", anyType)), false))
+	pkg.Scope().Insert(obj)
+
+	// func panicrangeexit()
+	obj = types2.NewFunc(nopos, pkg, "panicrangeexit", types2.NewSignatureType(nil, nil, nil, nil, nil, false))
+	pkg.Scope().Insert(obj)
+
+	return pkg
+}()
+
+func runtimeSig(name string) *types2.Signature {
+	return runtimePkg.Scope().Lookup(name).Type().(*types2.Signature)
+}
+
+// IsRuntimeFunc reports whether obj is one of the runtime functions
+// that the rewritten code calls. The noder writes references to such
+// functions as runtime builtins.
+func IsRuntimeFunc(obj types2.Object) bool {
+	return obj.Pkg() == runtimePkg
+}
@@ -23,10 +23,12 @@ func panicmakeslicelen()
 func panicmakeslicecap()
 func throwinit()
 func panicwrap()
+func panicrangeexit()
 
 func gopanic(interface{})
 func gorecover(*int32) interface{}
 func goschedguarded()
+func deferrangefunc() interface{}
 
 // Note: these declarations are just for wasm port.
 // Other ports call assembly stubs instead.
@@ -370,6 +370,18 @@ func (tv TypeAndValue) HasOk() bool {
 	return tv.mode == commaok || tv.mode == mapindex
 }
 
+// SetIsValue marks tv as describing a value expression, or a constant
+// expression if tv.Value is set. It allows compiler passes that
+// synthesize syntax after type checking to record the types of the
+// expressions they create.
+func (tv *TypeAndValue) SetIsValue() {
+	if tv.Value != nil {
+		tv.mode = constant_
+	} else {
+		tv.mode = value
+	}
+}
+
 // Instance reports the type arguments and instantiated type for type and
 // function instantiations. For type instantiations, Type will be of dynamic
 // type *Named. For function instantiations, Type will be of dynamic type
@@ -27,10 +27,12 @@ import (
 	"cmd/compile/internal/syntax"
 	"flag"
 	"fmt"
+	"internal/buildcfg"
 	"internal/testenv"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"testing"
@@ -131,10 +133,23 @@ func testFiles(t *testing.T, filenames []string, colDelta uint, manual bool) {
 	flags := flag.NewFlagSet("", flag.PanicOnError)
 	flags.StringVar(&conf.GoVersion, "lang", "", "")
 	flags.BoolVar(&conf.FakeImportC, "fakeImportC", false, "")
+	goexperiment := flags.String("goexperiment", "", "")
 	if err := parseFlags(filenames[0], nil, flags); err != nil {
 		t.Fatal(err)
 	}
 
+	if *goexperiment != "" {
+		exp, err := buildcfg.ParseGOEXPERIMENT(runtime.GOOS, runtime.GOARCH, *goexperiment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := buildcfg.Experiment
+		defer func() {
+			buildcfg.Experiment = old
+		}()
+		buildcfg.Experiment = *exp
+	}
+
 	files, errlist := parseFiles(t, filenames, 0)
 
 	pkgName := "<no package>"
@@ -0,0 +1,80 @@
+// -goexperiment=rangefunc
+
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package range_
+
+type MyBool bool
+type MyInt int
+
+func f0(func() bool)                           {}
+func f1(func(int) bool)                        {}
+func f2(func(int, string) bool)                {}
+func f3(func(int, string, error) bool)         {}
+func f4(func(MyInt) MyBool)                    {}
+func f5(func(...int) bool)                     {}
+func f6(func(int) int)                         {}
+func f7(func(int))                             {}
+func f8(int)                                   {}
+func f9(func(int) bool) bool                   { return false }
+func f10(func(int) bool, int)                  {}
+func f11[K comparable, V any](func(K, V) bool) {}
+
+type Seq[V any] func(yield func(V) bool)
+
+func _() {
+	for range f0 {
+	}
+	for _ /* ERROR "permits no iteration variables" */ = range f0 {
+	}
+	for x := range f1 {
+		_ = x + 1
+	}
+	for x, _ /* ERROR "permits only one iteration variable" */ := range f1 {
+		_ = x
+	}
+	for k, v := range f2 {
+		_, _ = k+1, v+""
+	}
+	for range f3 /* ERROR "yield func has too many parameters" */ {
+	}
+	for k := range f4 {
+		var _ MyInt = k
+	}
+	for range f5 /* ERROR "yield func is variadic" */ {
+	}
+	for range f6 /* ERROR "yield func does not return bool" */ {
+	}
+	for range f7 /* ERROR "yield func does not return bool" */ {
+	}
+	for range f8 /* ERROR "argument is not func" */ {
+	}
+	for range f9 /* ERROR "wrong result count" */ {
+	}
+	for range f10 /* ERROR "wrong argument count" */ {
+	}
+	for k, v := range f11[string, int] {
+		_, _ = k+"", v+1
+	}
+
+	var s Seq[string]
+	for v := range s {
+		_ = v + ""
+	}
+
+	var k int
+	var v string
+	for k, v = range f2 {
+	}
+	for v /* ERROR "cannot use .* in assignment" */ = range f1 {
+	}
+	_, _ = k, v
+}
+
+func _[T ~func(func(int) bool)](x T) {
+	for v := range x {
+		_ = v + 1
+	}
+}
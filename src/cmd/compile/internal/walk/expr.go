@@ -524,6 +524,17 @@ func walkCall(n *ir.CallExpr, init *ir.Nodes) ir.Node {
 		directClosureCall(n)
 	}
 
+	if name, ok := n.X.(*ir.Name); ok && name.Class == ir.PFUNC {
+		if sym := name.Sym(); sym.Pkg == ir.Pkgs.Runtime && sym.Name == "deferrangefunc" {
+			// The result of runtime.deferrangefunc is shared with a
+			// range-over-func loop body that may add defers to this
+			// frame, so we cannot use open-coded defers and we need to
+			// call deferreturn even if there are no other defers.
+			ir.CurFunc.SetHasDefer(true)
+			ir.CurFunc.SetOpenCodedDeferDisallowed(true)
+		}
+	}
+
 	if isFuncPCIntrinsic(n) {
 		// For internal/abi.FuncPCABIxxx(fn), if fn is a defined function, rewrite
 		// it to the address of the function of the ABI fn is defined.
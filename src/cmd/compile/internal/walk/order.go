@@ -805,6 +805,9 @@ func (o *orderState) stmt(n ir.Node) {
 		t := o.markTemp()
 		o.init(n.Call)
 		o.call(n.Call)
+		if n.DeferAt != nil {
+			n.DeferAt = o.expr(n.DeferAt, nil)
+		}
 		o.out = append(o.out, n)
 		o.cleanTemp(t)
 
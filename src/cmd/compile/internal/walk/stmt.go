@@ -108,10 +108,11 @@ func walkStmt(n ir.Node) ir.Node {
 		n := n.(*ir.GoDeferStmt)
 		ir.CurFunc.SetHasDefer(true)
 		ir.CurFunc.NumDefers++
-		if ir.CurFunc.NumDefers > maxOpenDefers {
+		if ir.CurFunc.NumDefers > maxOpenDefers || n.DeferAt != nil {
 			// Don't allow open-coded defers if there are more than
 			// 8 defers in the function, since we use a single
 			// byte to record active defers.
+			// Also don't allow if we need to use deferprocat.
 			ir.CurFunc.SetOpenCodedDeferDisallowed(true)
 		}
 		if n.Esc() != ir.EscNever {
@@ -216,6 +217,9 @@ func walkGoDefer(n *ir.GoDeferStmt) ir.Node {
 
 	call := n.Call.(*ir.CallExpr)
 	call.X = walkExpr(call.X, &init)
+	if n.DeferAt != nil {
+		n.DeferAt = walkExpr(n.DeferAt, &init)
+	}
 
 	if len(init) > 0 {
 		init.Append(n)
@@ -0,0 +1,38 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap_test
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+)
+
+// This example builds a priority queue of tasks using a Heap,
+// without writing any heap.Interface methods.
+func ExampleHeap() {
+	type task struct {
+		name     string
+		priority int
+	}
+
+	// Order by decreasing priority, so that Pop returns the
+	// most urgent task.
+	h := heap.NewFunc(func(a, b task) int {
+		return cmp.Compare(b.priority, a.priority)
+	})
+	h.Push(task{"write docs", 1})
+	h.Push(task{"fix outage", 5})
+	h.Push(task{"review code", 3})
+
+	h.Drain()(func(t task) bool {
+		fmt.Printf("%d %s\n", t.priority, t.name)
+		return true
+	})
+	// Output:
+	// 5 fix outage
+	// 3 review code
+	// 1 write docs
+}
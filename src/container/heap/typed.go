@@ -0,0 +1,155 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !compiler_bootstrap
+
+package heap
+
+import (
+	"cmp"
+	"iter"
+)
+
+// A Heap is a min-heap of elements of type E, ordered by a comparison
+// function. Unlike the functions in this package that operate on an
+// Interface, a Heap stores its elements itself, so no methods need to
+// be written to use it.
+//
+// A Heap does not track the positions of its elements. Priority queues
+// that need to change the priority of elements already in the queue
+// should implement Interface and use Fix instead.
+//
+// A Heap must be created with New or NewFunc; the zero Heap has no
+// comparison function and is not usable.
+type Heap[E any] struct {
+	data []E
+	cmp  func(a, b E) int
+}
+
+// New returns a new, empty Heap whose minimum element is determined
+// by cmp.Compare.
+func New[E cmp.Ordered]() *Heap[E] {
+	return NewFunc(cmp.Compare[E])
+}
+
+// NewFunc returns a new, empty Heap whose minimum element is determined
+// by cmp, which must return a negative number when a < b, a positive
+// number when a > b and zero when a == b. To obtain a max-heap,
+// reverse the comparison.
+func NewFunc[E any](cmp func(a, b E) int) *Heap[E] {
+	return &Heap[E]{cmp: cmp}
+}
+
+// Len returns the number of elements in h.
+func (h *Heap[E]) Len() int {
+	return len(h.data)
+}
+
+// Init replaces the elements of h with the elements of s and
+// establishes the heap ordering. The Heap takes ownership of s:
+// the caller must not use s after the call.
+// The complexity is O(n) where n = len(s).
+func (h *Heap[E]) Init(s []E) {
+	h.data = s
+	n := len(s)
+	for i := n/2 - 1; i >= 0; i-- {
+		h.down(i, n)
+	}
+}
+
+// Push pushes the element x onto h.
+// The complexity is O(log n) where n = h.Len().
+func (h *Heap[E]) Push(x E) {
+	h.data = append(h.data, x)
+	h.up(len(h.data) - 1)
+}
+
+// Pop removes and returns the minimum element of h.
+// It panics if h is empty.
+// The complexity is O(log n) where n = h.Len().
+func (h *Heap[E]) Pop() E {
+	if len(h.data) == 0 {
+		panic("heap: Pop called on empty Heap")
+	}
+	n := len(h.data) - 1
+	h.data[0], h.data[n] = h.data[n], h.data[0]
+	h.down(0, n)
+	x := h.data[n]
+	var zero E
+	h.data[n] = zero // avoid retaining a reference
+	h.data = h.data[:n]
+	return x
+}
+
+// Min returns the minimum element of h without removing it.
+// It panics if h is empty.
+func (h *Heap[E]) Min() E {
+	if len(h.data) == 0 {
+		panic("heap: Min called on empty Heap")
+	}
+	return h.data[0]
+}
+
+// Clear removes all the elements from h.
+func (h *Heap[E]) Clear() {
+	var zero E
+	for i := range h.data {
+		h.data[i] = zero
+	}
+	h.data = h.data[:0]
+}
+
+// All returns an iterator over the elements of h, in no particular order.
+// The effect of modifying h during the iteration is unspecified.
+func (h *Heap[E]) All() iter.Seq[E] {
+	return func(yield func(E) bool) {
+		for _, x := range h.data {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
+
+// Drain returns an iterator that removes the elements of h
+// and yields them in increasing order. Stopping the iteration
+// early leaves the remaining elements in h.
+func (h *Heap[E]) Drain() iter.Seq[E] {
+	return func(yield func(E) bool) {
+		for len(h.data) > 0 {
+			if !yield(h.Pop()) {
+				return
+			}
+		}
+	}
+}
+
+func (h *Heap[E]) up(j int) {
+	for {
+		i := (j - 1) / 2 // parent
+		if i == j || h.cmp(h.data[j], h.data[i]) >= 0 {
+			break
+		}
+		h.data[i], h.data[j] = h.data[j], h.data[i]
+		j = i
+	}
+}
+
+func (h *Heap[E]) down(i, n int) {
+	for {
+		j1 := 2*i + 1
+		if j1 >= n || j1 < 0 { // j1 < 0 after int overflow
+			break
+		}
+		j := j1 // left child
+		if j2 := j1 + 1; j2 < n && h.cmp(h.data[j2], h.data[j1]) < 0 {
+			j = j2 // = 2*i + 2  // right child
+		}
+		if h.cmp(h.data[j], h.data[i]) >= 0 {
+			break
+		}
+		h.data[i], h.data[j] = h.data[j], h.data[i]
+		i = j
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func (h *Heap[E]) verify(t *testing.T, i int) {
+	t.Helper()
+	n := h.Len()
+	j1 := 2*i + 1
+	j2 := 2*i + 2
+	if j1 < n {
+		if h.cmp(h.data[j1], h.data[i]) < 0 {
+			t.Errorf("heap invariant invalidated [%d] = %v > [%d] = %v", i, h.data[i], j1, h.data[j1])
+			return
+		}
+		h.verify(t, j1)
+	}
+	if j2 < n {
+		if h.cmp(h.data[j2], h.data[i]) < 0 {
+			t.Errorf("heap invariant invalidated [%d] = %v > [%d] = %v", i, h.data[i], j2, h.data[j2])
+			return
+		}
+		h.verify(t, j2)
+	}
+}
+
+func TestHeap(t *testing.T) {
+	h := New[int]()
+	h.verify(t, 0)
+
+	for i := 20; i > 10; i-- {
+		h.Push(i)
+	}
+	h.verify(t, 0)
+
+	for i := 10; i > 0; i-- {
+		h.Push(i)
+		h.verify(t, 0)
+	}
+
+	for i := 1; h.Len() > 0; i++ {
+		if x := h.Min(); x != i {
+			t.Errorf("Min() = %d, want %d", x, i)
+		}
+		x := h.Pop()
+		if i < 20 {
+			h.Push(20 + i)
+		}
+		h.verify(t, 0)
+		if x != i {
+			t.Errorf("%d.th pop got %d; want %d", i, x, i)
+		}
+	}
+}
+
+func TestHeapInit(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := make([]int, 100)
+	for i := range s {
+		s[i] = r.Intn(50)
+	}
+	want := slices.Clone(s)
+	slices.Sort(want)
+
+	h := New[int]()
+	h.Init(s)
+	h.verify(t, 0)
+
+	var got []int
+	h.Drain()(func(x int) bool {
+		got = append(got, x)
+		return true
+	})
+	if !slices.Equal(got, want) {
+		t.Errorf("Drain() = %v, want %v", got, want)
+	}
+	if h.Len() != 0 {
+		t.Errorf("Len() after Drain = %d, want 0", h.Len())
+	}
+}
+
+func TestHeapFunc(t *testing.T) {
+	// A max-heap of strings, ignoring case.
+	h := NewFunc(func(a, b string) int {
+		return strings.Compare(strings.ToLower(b), strings.ToLower(a))
+	})
+	for _, s := range []string{"b", "D", "a", "C"} {
+		h.Push(s)
+	}
+	h.verify(t, 0)
+
+	var all []string
+	h.All()(func(s string) bool {
+		all = append(all, s)
+		return true
+	})
+	slices.Sort(all)
+	if want := []string{"C", "D", "a", "b"}; !slices.Equal(all, want) {
+		t.Errorf("All() = %v, want %v in some order", all, want)
+	}
+
+	var got []string
+	h.Drain()(func(s string) bool {
+		got = append(got, s)
+		if len(got) == 2 {
+			return false
+		}
+		return true
+	})
+	if want := []string{"D", "C"}; !slices.Equal(got, want) {
+		t.Errorf("Drain() = %v, want %v", got, want)
+	}
+	if h.Len() != 2 {
+		t.Errorf("Len() after stopping Drain = %d, want 2", h.Len())
+	}
+
+	h.Clear()
+	if h.Len() != 0 {
+		t.Errorf("Len() after Clear = %d, want 0", h.Len())
+	}
+}
+
+func TestHeapEmpty(t *testing.T) {
+	h := New[int]()
+	for _, f := range []func(){func() { h.Pop() }, func() { h.Min() }} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("operation on empty Heap did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func BenchmarkHeap(b *testing.B) {
+	h := New[int]()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 10000; j++ {
+			h.Push(0)
+		}
+		for h.Len() > 0 {
+			h.Pop()
+		}
+	}
+}
@@ -6,11 +6,19 @@
 //
 // To iterate over a list (where l is a *List):
 //
+//	for e := range l.All() {
+//		// do something with e.Value
+//	}
+//
+// or, equivalently:
+//
 //	for e := l.Front(); e != nil; e = e.Next() {
 //		// do something with e.Value
 //	}
 package list
 
+import "iter"
+
 // Element is an element of a linked list.
 type Element struct {
 	// Next and previous pointers in the doubly-linked list of elements.
@@ -233,3 +241,33 @@ func (l *List) PushFrontList(other *List) {
 		l.insertValue(e.Value, &l.root)
 	}
 }
+
+// All returns an iterator over the elements of list l, from front to back.
+// The element being yielded may be removed from l during the iteration;
+// the effect of other changes to l during the iteration is unspecified.
+func (l *List) All() iter.Seq[*Element] {
+	return func(yield func(*Element) bool) {
+		for e := l.Front(); e != nil; {
+			next := e.Next()
+			if !yield(e) {
+				return
+			}
+			e = next
+		}
+	}
+}
+
+// Backward returns an iterator over the elements of list l, from back to front.
+// The element being yielded may be removed from l during the iteration;
+// the effect of other changes to l during the iteration is unspecified.
+func (l *List) Backward() iter.Seq[*Element] {
+	return func(yield func(*Element) bool) {
+		for e := l.Back(); e != nil; {
+			prev := e.Prev()
+			if !yield(e) {
+				return
+			}
+			e = prev
+		}
+	}
+}
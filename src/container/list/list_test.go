@@ -340,3 +340,74 @@ func TestMoveUnknownMark(t *testing.T) {
 	checkList(t, &l1, []any{1})
 	checkList(t, &l2, []any{2})
 }
+
+func TestAll(t *testing.T) {
+	var l List
+	for i := 1; i <= 5; i++ {
+		l.PushBack(i)
+	}
+
+	var got []any
+	l.All()(func(e *Element) bool {
+		got = append(got, e.Value)
+		return true
+	})
+	checkValues(t, got, []any{1, 2, 3, 4, 5})
+
+	got = nil
+	l.Backward()(func(e *Element) bool {
+		got = append(got, e.Value)
+		return true
+	})
+	checkValues(t, got, []any{5, 4, 3, 2, 1})
+
+	// Stop early.
+	got = nil
+	l.All()(func(e *Element) bool {
+		if e.Value == 3 {
+			return false
+		}
+		got = append(got, e.Value)
+		return true
+	})
+	checkValues(t, got, []any{1, 2})
+
+	// Remove the yielded element during iteration.
+	l.All()(func(e *Element) bool {
+		if e.Value.(int)%2 == 0 {
+			l.Remove(e)
+		}
+		return true
+	})
+	checkList(t, &l, []any{1, 3, 5})
+	l.Backward()(func(e *Element) bool {
+		if e.Value != 3 {
+			l.Remove(e)
+		}
+		return true
+	})
+	checkList(t, &l, []any{3})
+
+	// Empty list.
+	var empty List
+	empty.All()(func(*Element) bool {
+		t.Fatal("All yielded an element of an empty list")
+		return true
+	})
+	empty.Backward()(func(*Element) bool {
+		t.Fatal("Backward yielded an element of an empty list")
+		return true
+	})
+}
+
+func checkValues(t *testing.T, got, want []any) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list_test
+
+import (
+	"container/list/v2"
+	"fmt"
+)
+
+func Example() {
+	// Create a new list of ints and put some numbers in it.
+	l := list.New[int]()
+	e4 := l.PushBack(4)
+	e1 := l.PushFront(1)
+	l.InsertBefore(3, e4)
+	l.InsertAfter(2, e1)
+
+	// Iterate through list and print its contents.
+	l.Values()(func(v int) bool {
+		fmt.Println(v)
+		return true
+	})
+
+	// Output:
+	// 1
+	// 2
+	// 3
+	// 4
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ordered_test
+
+import (
+	"container/ordered"
+	"fmt"
+)
+
+func ExampleMap() {
+	temps := ordered.NewMap[int, string]()
+	temps.Set(1990, "cold")
+	temps.Set(2010, "warm")
+	temps.Set(2000, "mild")
+	temps.Set(2020, "hot")
+
+	temps.All()(func(year int, t string) bool {
+		fmt.Println(year, t)
+		return true
+	})
+
+	// Find the nearest entries at or around 2005.
+	year, t, _ := temps.Floor(2005)
+	fmt.Println("floor:", year, t)
+	year, t, _ = temps.Ceiling(2005)
+	fmt.Println("ceiling:", year, t)
+	// Output:
+	// 1990 cold
+	// 2000 mild
+	// 2010 warm
+	// 2020 hot
+	// floor: 2000 mild
+	// ceiling: 2010 warm
+}
+
+func ExampleMap_Scan() {
+	m := ordered.NewMap[string, int]()
+	for i, k := range []string{"kiwi", "apple", "lime", "date", "cherry", "banana"} {
+		m.Set(k, i)
+	}
+	m.Scan("b", "d")(func(k string, _ int) bool {
+		fmt.Println(k)
+		return true
+	})
+	// Output:
+	// banana
+	// cherry
+}
+
+func ExampleSet() {
+	s := ordered.NewSet[float64]()
+	for _, x := range []float64{2.5, -1, 3.75, 0} {
+		s.Add(x)
+	}
+	s.Backward()(func(x float64) bool {
+		fmt.Println(x)
+		return true
+	})
+	// Output:
+	// 3.75
+	// 2.5
+	// 0
+	// -1
+}
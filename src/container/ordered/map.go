@@ -0,0 +1,172 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ordered implements ordered maps and sets, which keep
+// their keys sorted according to a comparison function.
+//
+// In addition to the usual lookups, ordered maps and sets can find
+// the nearest key at or below a given key (Floor) or at or above it
+// (Ceiling), and iterate over their keys in order, either in full or
+// restricted to a range of keys:
+//
+//	m := ordered.NewMap[string, int]()
+//	m.Set("b", 2)
+//	m.Set("a", 1)
+//	m.Set("c", 3)
+//	for k, v := range m.Scan("a", "b") {
+//		fmt.Println(k, v) // prints a 1, then b 2
+//	}
+//
+// The maps and sets are implemented as balanced binary trees, so
+// lookups, insertions and deletions take O(log n) time, where n is
+// the number of keys.
+//
+// The effect of modifying a map or set while iterating over it is
+// unspecified. Maps and sets are not safe for concurrent use
+// without additional synchronization.
+package ordered
+
+import (
+	"cmp"
+	"iter"
+)
+
+// A Map is a map from keys of type K to values of type V that keeps
+// its keys in increasing order, as defined by its comparison function.
+//
+// A Map must be created with NewMap or NewMapFunc; the zero Map
+// has no comparison function and is not usable.
+type Map[K, V any] struct {
+	t tree[K, V]
+}
+
+// NewMap returns a new, empty Map whose keys are ordered by cmp.Compare.
+func NewMap[K cmp.Ordered, V any]() *Map[K, V] {
+	return NewMapFunc[K, V](cmp.Compare[K])
+}
+
+// NewMapFunc returns a new, empty Map whose keys are ordered by cmp.
+// The comparison function must return a negative number when a < b,
+// a positive number when a > b and zero when a == b, and it must be
+// a strict weak ordering. Keys that compare as equal are the same key.
+func NewMapFunc[K, V any](cmp func(a, b K) int) *Map[K, V] {
+	return &Map[K, V]{t: tree[K, V]{cmp: cmp}}
+}
+
+// Len returns the number of keys in m.
+func (m *Map[K, V]) Len() int {
+	return m.t.len
+}
+
+// Get returns the value for key k and reports whether k is in m.
+// If k is not in m, Get returns the zero value for V.
+func (m *Map[K, V]) Get(k K) (v V, ok bool) {
+	if n := m.t.find(k); n != nil {
+		return n.val, true
+	}
+	return v, false
+}
+
+// Contains reports whether key k is in m.
+func (m *Map[K, V]) Contains(k K) bool {
+	return m.t.find(k) != nil
+}
+
+// Set sets the value for key k to v, adding k to m if needed.
+// It reports whether k was added.
+func (m *Map[K, V]) Set(k K, v V) (added bool) {
+	return m.t.insert(k, v)
+}
+
+// Delete deletes key k and its value from m,
+// and reports whether k was in m.
+func (m *Map[K, V]) Delete(k K) (deleted bool) {
+	return m.t.delete(k)
+}
+
+// Clear deletes all the keys from m.
+func (m *Map[K, V]) Clear() {
+	m.t.root = nil
+	m.t.len = 0
+}
+
+// Min returns the smallest key in m and its value.
+// If m is empty, ok is false.
+func (m *Map[K, V]) Min() (k K, v V, ok bool) {
+	return entry(m.t.first())
+}
+
+// Max returns the largest key in m and its value.
+// If m is empty, ok is false.
+func (m *Map[K, V]) Max() (k K, v V, ok bool) {
+	return entry(m.t.last())
+}
+
+// Floor returns the largest key in m that is less than or equal to k,
+// and its value. If there is no such key, ok is false.
+func (m *Map[K, V]) Floor(k K) (key K, v V, ok bool) {
+	return entry(m.t.floor(k))
+}
+
+// Ceiling returns the smallest key in m that is greater than or equal to k,
+// and its value. If there is no such key, ok is false.
+func (m *Map[K, V]) Ceiling(k K) (key K, v V, ok bool) {
+	return entry(m.t.ceiling(k))
+}
+
+func entry[K, V any](n *node[K, V]) (k K, v V, ok bool) {
+	if n == nil {
+		return k, v, false
+	}
+	return n.key, n.val, true
+}
+
+// All returns an iterator over the keys and values in m,
+// in increasing key order.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.t.ascend(m.t.root, nil, nil, func(n *node[K, V]) bool {
+			return yield(n.key, n.val)
+		})
+	}
+}
+
+// Backward returns an iterator over the keys and values in m,
+// in decreasing key order.
+func (m *Map[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.t.descend(m.t.root, nil, nil, func(n *node[K, V]) bool {
+			return yield(n.key, n.val)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys in m, in increasing order.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.t.ascend(m.t.root, nil, nil, func(n *node[K, V]) bool {
+			return yield(n.key)
+		})
+	}
+}
+
+// Values returns an iterator over the values in m,
+// in increasing order of their keys.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.t.ascend(m.t.root, nil, nil, func(n *node[K, V]) bool {
+			return yield(n.val)
+		})
+	}
+}
+
+// Scan returns an iterator over the key-value pairs in m
+// with min ≤ key ≤ max, in increasing key order.
+func (m *Map[K, V]) Scan(min, max K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.t.ascend(m.t.root, &min, &max, func(n *node[K, V]) bool {
+			return yield(n.key, n.val)
+		})
+	}
+}
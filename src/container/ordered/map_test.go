@@ -0,0 +1,276 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ordered
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// check verifies the ordering and balance invariants of t.
+func check[K, V any](t *testing.T, tr *tree[K, V]) {
+	t.Helper()
+	n := checkNode(t, tr, tr.root, nil, nil)
+	if n != tr.len {
+		t.Fatalf("tree has %d nodes, len is %d", n, tr.len)
+	}
+}
+
+func checkNode[K, V any](t *testing.T, tr *tree[K, V], n *node[K, V], lo, hi *K) int {
+	t.Helper()
+	if n == nil {
+		return 0
+	}
+	if lo != nil && tr.cmp(*lo, n.key) >= 0 || hi != nil && tr.cmp(n.key, *hi) >= 0 {
+		t.Fatalf("key %v out of order", n.key)
+	}
+	if want := max(n.left.h(), n.right.h()) + 1; n.height != want {
+		t.Fatalf("node %v has height %d, want %d", n.key, n.height, want)
+	}
+	if d := n.left.h() - n.right.h(); d < -1 || d > 1 {
+		t.Fatalf("node %v is unbalanced: subtree heights %d and %d", n.key, n.left.h(), n.right.h())
+	}
+	return checkNode(t, tr, n.left, lo, &n.key) + 1 + checkNode(t, tr, n.right, &n.key, hi)
+}
+
+func TestMapRandom(t *testing.T) {
+	m := NewMap[int, int]()
+	want := make(map[int]int)
+	r := rand.New(rand.NewSource(1))
+	n := 2000
+	if testing.Short() {
+		n = 500
+	}
+	for i := 0; i < n; i++ {
+		k := r.Intn(n / 2)
+		switch r.Intn(3) {
+		case 0, 1:
+			_, had := want[k]
+			if added := m.Set(k, i); added == had {
+				t.Fatalf("Set(%d) = %v, want %v", k, added, !had)
+			}
+			want[k] = i
+		case 2:
+			_, had := want[k]
+			if deleted := m.Delete(k); deleted != had {
+				t.Fatalf("Delete(%d) = %v, want %v", k, deleted, had)
+			}
+			delete(want, k)
+		}
+		if i%50 == 0 {
+			check(t, &m.t)
+		}
+	}
+	check(t, &m.t)
+
+	if m.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", m.Len(), len(want))
+	}
+	var keys []int
+	for k, v := range want {
+		keys = append(keys, k)
+		if got, ok := m.Get(k); !ok || got != v {
+			t.Fatalf("Get(%d) = %d, %v, want %d, true", k, got, ok, v)
+		}
+	}
+	slices.Sort(keys)
+
+	var got []int
+	m.All()(func(k, v int) bool {
+		if v != want[k] {
+			t.Fatalf("All yielded %d, %d, want %d, %d", k, v, k, want[k])
+		}
+		got = append(got, k)
+		return true
+	})
+	if !slices.Equal(got, keys) {
+		t.Fatalf("All() keys = %v, want %v", got, keys)
+	}
+
+	got = got[:0]
+	m.Backward()(func(k, _ int) bool {
+		got = append(got, k)
+		return true
+	})
+	slices.Reverse(got)
+	if !slices.Equal(got, keys) {
+		t.Fatalf("Backward() keys = %v, want reverse of %v", got, keys)
+	}
+
+	for i := 0; i < 100; i++ {
+		lo, hi := r.Intn(n/2+10)-5, r.Intn(n/2+10)-5
+		var want []int
+		for _, k := range keys {
+			if lo <= k && k <= hi {
+				want = append(want, k)
+			}
+		}
+		got = got[:0]
+		m.Scan(lo, hi)(func(k, _ int) bool {
+			got = append(got, k)
+			return true
+		})
+		if !slices.Equal(got, want) {
+			t.Fatalf("Scan(%d, %d) = %v, want %v", lo, hi, got, want)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		k := r.Intn(n/2+10) - 5
+		i, found := slices.BinarySearch(keys, k)
+
+		fk, _, ok := m.Floor(k)
+		switch {
+		case found:
+			if !ok || fk != k {
+				t.Fatalf("Floor(%d) = %d, %v, want %d, true", k, fk, ok, k)
+			}
+		case i == 0:
+			if ok {
+				t.Fatalf("Floor(%d) = %d, true, want false", k, fk)
+			}
+		default:
+			if !ok || fk != keys[i-1] {
+				t.Fatalf("Floor(%d) = %d, %v, want %d, true", k, fk, ok, keys[i-1])
+			}
+		}
+
+		ck, _, ok := m.Ceiling(k)
+		switch {
+		case found:
+			if !ok || ck != k {
+				t.Fatalf("Ceiling(%d) = %d, %v, want %d, true", k, ck, ok, k)
+			}
+		case i == len(keys):
+			if ok {
+				t.Fatalf("Ceiling(%d) = %d, true, want false", k, ck)
+			}
+		default:
+			if !ok || ck != keys[i] {
+				t.Fatalf("Ceiling(%d) = %d, %v, want %d, true", k, ck, ok, keys[i])
+			}
+		}
+	}
+
+	if k, _, ok := m.Min(); !ok || k != keys[0] {
+		t.Fatalf("Min() = %d, %v, want %d, true", k, ok, keys[0])
+	}
+	if k, _, ok := m.Max(); !ok || k != keys[len(keys)-1] {
+		t.Fatalf("Max() = %d, %v, want %d, true", k, ok, keys[len(keys)-1])
+	}
+
+	m.Clear()
+	check(t, &m.t)
+	if m.Len() != 0 {
+		t.Fatalf("Len() after Clear = %d, want 0", m.Len())
+	}
+	if _, _, ok := m.Min(); ok {
+		t.Fatal("Min() of empty map returned ok")
+	}
+	m.All()(func(int, int) bool {
+		t.Fatal("All() of empty map yielded a value")
+		return true
+	})
+}
+
+func TestMapIterStop(t *testing.T) {
+	m := NewMap[int, string]()
+	for i := 0; i < 100; i++ {
+		m.Set(i, "")
+	}
+	n := 0
+	m.Keys()(func(k int) bool {
+		if k == 10 {
+			return false
+		}
+		n++
+		return true
+	})
+	if n != 10 {
+		t.Errorf("Keys() yielded %d keys before break, want 10", n)
+	}
+	n = 0
+	m.Scan(20, 80)(func(int, string) bool {
+		n++
+		if n == 5 {
+			return false
+		}
+		return true
+	})
+	if n != 5 {
+		t.Errorf("Scan() yielded %d keys before break, want 5", n)
+	}
+}
+
+func TestMapFunc(t *testing.T) {
+	m := NewMapFunc[string, int](func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	m.Set("b", 1)
+	m.Set("A", 2)
+	if added := m.Set("B", 3); added {
+		t.Errorf("Set(%q) added a key equal to %q", "B", "b")
+	}
+	var got []string
+	m.All()(func(k string, v int) bool {
+		got = append(got, k+"="+string(rune('0'+v)))
+		return true
+	})
+	if want := []string{"A=2", "b=3"}; !slices.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+	if !m.Contains("a") {
+		t.Errorf("Contains(%q) = false, want true", "a")
+	}
+	var vals []int
+	m.Values()(func(v int) bool {
+		vals = append(vals, v)
+		return true
+	})
+	if want := []int{2, 3}; !slices.Equal(vals, want) {
+		t.Errorf("Values() = %v, want %v", vals, want)
+	}
+}
+
+func TestMapSequential(t *testing.T) {
+	// Sequential insertions and deletions are the worst case
+	// for an unbalanced tree.
+	m := NewMap[int, struct{}]()
+	for i := 0; i < 1000; i++ {
+		m.Set(i, struct{}{})
+	}
+	check(t, &m.t)
+	if h := m.t.root.h(); h > 15 {
+		t.Errorf("height of tree with 1000 keys is %d, want at most 15", h)
+	}
+	for i := 0; i < 1000; i += 2 {
+		m.Delete(i)
+	}
+	check(t, &m.t)
+	if m.Len() != 500 {
+		t.Errorf("Len() = %d, want 500", m.Len())
+	}
+}
+
+func BenchmarkMapSet(b *testing.B) {
+	m := NewMap[int, int]()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		m.Set(r.Intn(1<<16), i)
+	}
+}
+
+func BenchmarkMapGet(b *testing.B) {
+	m := NewMap[int, int]()
+	for i := 0; i < 1<<16; i++ {
+		m.Set(i, i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(i & (1<<16 - 1))
+	}
+}
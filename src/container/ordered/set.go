@@ -0,0 +1,117 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ordered
+
+import (
+	"cmp"
+	"iter"
+)
+
+// A Set is a set of keys of type K that keeps its keys in increasing
+// order, as defined by its comparison function.
+//
+// A Set must be created with NewSet or NewSetFunc; the zero Set
+// has no comparison function and is not usable.
+type Set[K any] struct {
+	t tree[K, struct{}]
+}
+
+// NewSet returns a new, empty Set whose keys are ordered by cmp.Compare.
+func NewSet[K cmp.Ordered]() *Set[K] {
+	return NewSetFunc(cmp.Compare[K])
+}
+
+// NewSetFunc returns a new, empty Set whose keys are ordered by cmp.
+// The comparison function must satisfy the same requirements as
+// for NewMapFunc.
+func NewSetFunc[K any](cmp func(a, b K) int) *Set[K] {
+	return &Set[K]{t: tree[K, struct{}]{cmp: cmp}}
+}
+
+// Len returns the number of keys in s.
+func (s *Set[K]) Len() int {
+	return s.t.len
+}
+
+// Contains reports whether key k is in s.
+func (s *Set[K]) Contains(k K) bool {
+	return s.t.find(k) != nil
+}
+
+// Add adds key k to s and reports whether it was added,
+// that is, whether k was not already in s.
+func (s *Set[K]) Add(k K) (added bool) {
+	return s.t.insert(k, struct{}{})
+}
+
+// Delete deletes key k from s and reports whether k was in s.
+func (s *Set[K]) Delete(k K) (deleted bool) {
+	return s.t.delete(k)
+}
+
+// Clear deletes all the keys from s.
+func (s *Set[K]) Clear() {
+	s.t.root = nil
+	s.t.len = 0
+}
+
+// Min returns the smallest key in s.
+// If s is empty, ok is false.
+func (s *Set[K]) Min() (k K, ok bool) {
+	return keyOf(s.t.first())
+}
+
+// Max returns the largest key in s.
+// If s is empty, ok is false.
+func (s *Set[K]) Max() (k K, ok bool) {
+	return keyOf(s.t.last())
+}
+
+// Floor returns the largest key in s that is less than or equal to k.
+// If there is no such key, ok is false.
+func (s *Set[K]) Floor(k K) (key K, ok bool) {
+	return keyOf(s.t.floor(k))
+}
+
+// Ceiling returns the smallest key in s that is greater than or equal to k.
+// If there is no such key, ok is false.
+func (s *Set[K]) Ceiling(k K) (key K, ok bool) {
+	return keyOf(s.t.ceiling(k))
+}
+
+func keyOf[K any](n *node[K, struct{}]) (k K, ok bool) {
+	if n == nil {
+		return k, false
+	}
+	return n.key, true
+}
+
+// All returns an iterator over the keys in s, in increasing order.
+func (s *Set[K]) All() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		s.t.ascend(s.t.root, nil, nil, func(n *node[K, struct{}]) bool {
+			return yield(n.key)
+		})
+	}
+}
+
+// Backward returns an iterator over the keys in s, in decreasing order.
+func (s *Set[K]) Backward() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		s.t.descend(s.t.root, nil, nil, func(n *node[K, struct{}]) bool {
+			return yield(n.key)
+		})
+	}
+}
+
+// Scan returns an iterator over the keys in s with min ≤ key ≤ max,
+// in increasing order.
+func (s *Set[K]) Scan(min, max K) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		s.t.ascend(s.t.root, &min, &max, func(n *node[K, struct{}]) bool {
+			return yield(n.key)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ordered
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	s := NewSet[string]()
+	for _, k := range []string{"pear", "apple", "fig", "banana", "apple"} {
+		s.Add(k)
+	}
+	check(t, &s.t)
+	if s.Len() != 4 {
+		t.Fatalf("Len() = %d, want 4", s.Len())
+	}
+	if s.Add("fig") {
+		t.Errorf("Add(%q) of existing key reported true", "fig")
+	}
+	if !s.Contains("banana") || s.Contains("cherry") {
+		t.Errorf("Contains reports wrong membership")
+	}
+
+	var got []string
+	s.All()(func(k string) bool {
+		got = append(got, k)
+		return true
+	})
+	if want := []string{"apple", "banana", "fig", "pear"}; !slices.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+
+	got = got[:0]
+	s.Backward()(func(k string) bool {
+		got = append(got, k)
+		return true
+	})
+	if want := []string{"pear", "fig", "banana", "apple"}; !slices.Equal(got, want) {
+		t.Errorf("Backward() = %v, want %v", got, want)
+	}
+
+	got = got[:0]
+	s.Scan("b", "g")(func(k string) bool {
+		got = append(got, k)
+		return true
+	})
+	if want := []string{"banana", "fig"}; !slices.Equal(got, want) {
+		t.Errorf("Scan(%q, %q) = %v, want %v", "b", "g", got, want)
+	}
+
+	if k, ok := s.Floor("cherry"); !ok || k != "banana" {
+		t.Errorf("Floor(%q) = %q, %v, want %q, true", "cherry", k, ok, "banana")
+	}
+	if k, ok := s.Ceiling("cherry"); !ok || k != "fig" {
+		t.Errorf("Ceiling(%q) = %q, %v, want %q, true", "cherry", k, ok, "fig")
+	}
+	if k, ok := s.Floor("a"); ok {
+		t.Errorf("Floor(%q) = %q, true, want false", "a", k)
+	}
+	if k, ok := s.Ceiling("q"); ok {
+		t.Errorf("Ceiling(%q) = %q, true, want false", "q", k)
+	}
+	if k, ok := s.Min(); !ok || k != "apple" {
+		t.Errorf("Min() = %q, %v, want %q, true", k, ok, "apple")
+	}
+	if k, ok := s.Max(); !ok || k != "pear" {
+		t.Errorf("Max() = %q, %v, want %q, true", k, ok, "pear")
+	}
+
+	if !s.Delete("banana") || s.Delete("banana") {
+		t.Errorf("Delete(%q) reported wrong result", "banana")
+	}
+	check(t, &s.t)
+	s.Clear()
+	if s.Len() != 0 || s.Contains("apple") {
+		t.Errorf("Clear did not empty the set")
+	}
+}
+
+func TestSetFunc(t *testing.T) {
+	// Order by decreasing value.
+	s := NewSetFunc(func(a, b int) int { return b - a })
+	for i := 0; i < 10; i++ {
+		s.Add(i)
+	}
+	check(t, &s.t)
+	var got []int
+	s.All()(func(k int) bool {
+		got = append(got, k)
+		return true
+	})
+	if want := []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}; !slices.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+	if k, ok := s.Min(); !ok || k != 9 {
+		t.Errorf("Min() = %d, %v, want 9, true", k, ok)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ordered
+
+// The trees in this package are AVL trees: for every node, the
+// heights of its two subtrees differ by at most one, so the height
+// of a tree holding n keys is at most about 1.44*log2(n).
+
+// A node is a node in an AVL tree.
+type node[K, V any] struct {
+	key         K
+	val         V
+	left, right *node[K, V]
+	height      int8 // height of the subtree rooted at this node; a leaf has height 1
+}
+
+func (n *node[K, V]) h() int8 {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// fix recomputes n.height from the heights of its children.
+func (n *node[K, V]) fix() {
+	n.height = max(n.left.h(), n.right.h()) + 1
+}
+
+func max(x, y int8) int8 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// rotateLeft rotates n's right child into n's position
+// and returns the new root of the subtree.
+func (n *node[K, V]) rotateLeft() *node[K, V] {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	n.fix()
+	r.fix()
+	return r
+}
+
+// rotateRight rotates n's left child into n's position
+// and returns the new root of the subtree.
+func (n *node[K, V]) rotateRight() *node[K, V] {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	n.fix()
+	l.fix()
+	return l
+}
+
+// balance restores the AVL invariant at n, whose subtrees are
+// balanced and differ in height by at most two, and returns the
+// new root of the subtree.
+func (n *node[K, V]) balance() *node[K, V] {
+	n.fix()
+	switch d := n.left.h() - n.right.h(); {
+	case d > 1:
+		if n.left.left.h() < n.left.right.h() {
+			n.left = n.left.rotateLeft()
+		}
+		return n.rotateRight()
+	case d < -1:
+		if n.right.right.h() < n.right.left.h() {
+			n.right = n.right.rotateRight()
+		}
+		return n.rotateLeft()
+	}
+	return n
+}
+
+// A tree is an AVL tree ordered by cmp.
+type tree[K, V any] struct {
+	root *node[K, V]
+	len  int
+	cmp  func(a, b K) int
+}
+
+// find returns the node with key k, or nil.
+func (t *tree[K, V]) find(k K) *node[K, V] {
+	n := t.root
+	for n != nil {
+		switch c := t.cmp(k, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+// insert sets the value for key k to v. It reports whether k was
+// newly added; if k was already present, only its value is replaced.
+func (t *tree[K, V]) insert(k K, v V) bool {
+	var added bool
+	t.root = t.insertAt(t.root, k, v, &added)
+	if added {
+		t.len++
+	}
+	return added
+}
+
+func (t *tree[K, V]) insertAt(n *node[K, V], k K, v V, added *bool) *node[K, V] {
+	if n == nil {
+		*added = true
+		return &node[K, V]{key: k, val: v, height: 1}
+	}
+	switch c := t.cmp(k, n.key); {
+	case c < 0:
+		n.left = t.insertAt(n.left, k, v, added)
+	case c > 0:
+		n.right = t.insertAt(n.right, k, v, added)
+	default:
+		n.val = v
+		return n
+	}
+	return n.balance()
+}
+
+// delete removes the key k and reports whether it was present.
+func (t *tree[K, V]) delete(k K) bool {
+	var deleted bool
+	t.root = t.deleteAt(t.root, k, &deleted)
+	if deleted {
+		t.len--
+	}
+	return deleted
+}
+
+func (t *tree[K, V]) deleteAt(n *node[K, V], k K, deleted *bool) *node[K, V] {
+	if n == nil {
+		return nil
+	}
+	switch c := t.cmp(k, n.key); {
+	case c < 0:
+		n.left = t.deleteAt(n.left, k, deleted)
+	case c > 0:
+		n.right = t.deleteAt(n.right, k, deleted)
+	default:
+		*deleted = true
+		if n.left == nil {
+			return n.right
+		}
+		if n.right == nil {
+			return n.left
+		}
+		// Replace n by its successor, the minimum of its right subtree.
+		var succ *node[K, V]
+		right := deleteMin(n.right, &succ)
+		succ.left, succ.right = n.left, right
+		n = succ
+	}
+	return n.balance()
+}
+
+// deleteMin removes the minimum node from the subtree rooted at n,
+// stores it in *min and returns the new root of the subtree.
+func deleteMin[K, V any](n *node[K, V], min **node[K, V]) *node[K, V] {
+	if n.left == nil {
+		*min = n
+		return n.right
+	}
+	n.left = deleteMin(n.left, min)
+	return n.balance()
+}
+
+// first returns the node with the smallest key, or nil.
+func (t *tree[K, V]) first() *node[K, V] {
+	n := t.root
+	if n == nil {
+		return nil
+	}
+	for n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+// last returns the node with the largest key, or nil.
+func (t *tree[K, V]) last() *node[K, V] {
+	n := t.root
+	if n == nil {
+		return nil
+	}
+	for n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// floor returns the node with the largest key less than or equal to k, or nil.
+func (t *tree[K, V]) floor(k K) *node[K, V] {
+	var best *node[K, V]
+	for n := t.root; n != nil; {
+		switch c := t.cmp(k, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			best = n
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return best
+}
+
+// ceiling returns the node with the smallest key greater than or equal to k, or nil.
+func (t *tree[K, V]) ceiling(k K) *node[K, V] {
+	var best *node[K, V]
+	for n := t.root; n != nil; {
+		switch c := t.cmp(k, n.key); {
+		case c < 0:
+			best = n
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return best
+}
+
+// ascend calls yield for each node in the subtree rooted at n whose
+// key is within [lo, hi], in increasing key order. A nil lo or hi
+// leaves that end of the range unbounded. ascend returns false if
+// yield returned false.
+func (t *tree[K, V]) ascend(n *node[K, V], lo, hi *K, yield func(*node[K, V]) bool) bool {
+	for n != nil {
+		if lo != nil && t.cmp(n.key, *lo) < 0 {
+			// n and its left subtree are below the range.
+			n = n.right
+			continue
+		}
+		if hi != nil && t.cmp(n.key, *hi) > 0 {
+			// n and its right subtree are above the range.
+			n = n.left
+			continue
+		}
+		if !t.ascend(n.left, lo, nil, yield) || !yield(n) {
+			return false
+		}
+		// The keys in n's right subtree are all greater than lo.
+		n, lo = n.right, nil
+	}
+	return true
+}
+
+// descend is like ascend but visits the nodes in decreasing key order.
+func (t *tree[K, V]) descend(n *node[K, V], lo, hi *K, yield func(*node[K, V]) bool) bool {
+	for n != nil {
+		if lo != nil && t.cmp(n.key, *lo) < 0 {
+			n = n.right
+			continue
+		}
+		if hi != nil && t.cmp(n.key, *hi) > 0 {
+			n = n.left
+			continue
+		}
+		if !t.descend(n.right, nil, hi, yield) || !yield(n) {
+			return false
+		}
+		n, hi = n.left, nil
+	}
+	return true
+}
@@ -191,3 +191,25 @@ func ExampleRing_Unlink() {
 	// 4
 	// 5
 }
+
+func ExampleRing_All() {
+	// Create a new ring of size 3
+	r := ring.New(3)
+
+	// Initialize the ring with some integer values
+	for i := 0; i < 3; i++ {
+		r.Value = i
+		r = r.Next()
+	}
+
+	// Iterate through the ring and print its contents
+	r.All()(func(v any) bool {
+		fmt.Println(v)
+		return true
+	})
+
+	// Output:
+	// 0
+	// 1
+	// 2
+}
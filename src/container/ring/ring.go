@@ -5,6 +5,8 @@
 // Package ring implements operations on circular lists.
 package ring
 
+import "iter"
+
 // A Ring is an element of a circular list, or ring.
 // Rings do not have a beginning or end; a pointer to any ring element
 // serves as reference to the entire ring. Empty rings are represented
@@ -134,3 +136,22 @@ func (r *Ring) Do(f func(any)) {
 		}
 	}
 }
+
+// All returns an iterator over the values of the ring, in forward order,
+// starting with r.Value. The effect of changing *r during the iteration
+// is unspecified.
+func (r *Ring) All() iter.Seq[any] {
+	return func(yield func(any) bool) {
+		if r == nil {
+			return
+		}
+		if !yield(r.Value) {
+			return
+		}
+		for p := r.Next(); p != r; p = p.next {
+			if !yield(p.Value) {
+				return
+			}
+		}
+	}
+}
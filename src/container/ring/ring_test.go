@@ -226,3 +226,51 @@ func TestMoveEmptyRing(t *testing.T) {
 	r.Move(1)
 	verify(t, &r, 1, 0)
 }
+
+func TestAll(t *testing.T) {
+	var nilRing *Ring
+	nilRing.All()(func(any) bool {
+		t.Fatal("All yielded a value of a nil ring")
+		return true
+	})
+
+	r := New(5)
+	for i := 0; i < 5; i++ {
+		r.Value = i
+		r = r.Next()
+	}
+	r = r.Move(2)
+
+	var got []int
+	r.All()(func(v any) bool {
+		got = append(got, v.(int))
+		return true
+	})
+	if want := []int{2, 3, 4, 0, 1}; !equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+
+	got = got[:0]
+	r.All()(func(v any) bool {
+		if v == 4 {
+			return false
+		}
+		got = append(got, v.(int))
+		return true
+	})
+	if want := []int{2, 3}; !equal(got, want) {
+		t.Errorf("All() with break = %v, want %v", got, want)
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
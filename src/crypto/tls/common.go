@@ -99,6 +99,7 @@ const (
 	extensionCertificateAuthorities  uint16 = 47
 	extensionSignatureAlgorithmsCert uint16 = 50
 	extensionKeyShare                uint16 = 51
+	extensionQUICTransportParameters uint16 = 57
 	extensionRenegotiationInfo       uint16 = 0xff01
 )
 
@@ -342,6 +343,10 @@ type ClientSessionState struct {
 	nonce  []byte    // Ticket nonce sent by the server, to derive PSK
 	useBy  time.Time // Expiration of the ticket lifetime as set by the server
 	ageAdd uint32    // Random obfuscation factor for sending the ticket age
+
+	// QUIC fields.
+	earlyData    bool   // Whether the ticket may be used for 0-RTT
+	alpnProtocol string // ALPN protocol negotiated for the session, checked for 0-RTT
 }
 
 // ClientSessionCache is a cache of ClientSessionState objects that can be used
@@ -217,7 +217,7 @@ func (hs *serverHandshakeState) processClientHello() error {
 		c.serverName = hs.clientHello.serverName
 	}
 
-	selectedProto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols)
+	selectedProto, err := negotiateALPN(c.config.NextProtos, hs.clientHello.alpnProtocols, false)
 	if err != nil {
 		c.sendAlert(alertNoApplicationProtocol)
 		return err
@@ -277,9 +277,14 @@ func (hs *serverHandshakeState) processClientHello() error {
 
 // negotiateALPN picks a shared ALPN protocol that both sides support in server
 // preference order. If ALPN is not configured or the peer doesn't support it,
-// it returns "" and no error.
-func negotiateALPN(serverProtos, clientProtos []string) (string, error) {
+// it returns "" and no error, unless quic is set, in which case ALPN is
+// mandatory if the server is configured with protocols.
+func negotiateALPN(serverProtos, clientProtos []string, quic bool) (string, error) {
 	if len(serverProtos) == 0 || len(clientProtos) == 0 {
+		if quic && len(serverProtos) != 0 {
+			// RFC 9001, Section 8.1
+			return "", fmt.Errorf("tls: client did not request an application protocol")
+		}
 		return "", nil
 	}
 	var http11fallback bool
@@ -297,7 +302,7 @@ func negotiateALPN(serverProtos, clientProtos []string) (string, error) {
 	// didn't support ALPN. We used not to enforce protocol overlap, so over
 	// time a number of HTTP servers were configured with only "h2", but
 	// expected to accept connections from "http/1.1" clients. See Issue 46310.
-	if http11fallback {
+	if http11fallback && !quic {
 		return "", nil
 	}
 	return "", fmt.Errorf("tls: client requested unsupported application protocols (%s)", clientProtos)
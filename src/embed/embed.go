@@ -236,6 +236,16 @@ func (f *file) Sys() any                   { return nil }
 func (f *file) Type() fs.FileMode          { return f.Mode().Type() }
 func (f *file) Info() (fs.FileInfo, error) { return f, nil }
 
+// ContentHash returns a hash of the file's contents, computed when the
+// file was embedded. It is used by net/http's FileServer for ETags.
+func (f *file) ContentHash() []byte {
+	if f.IsDir() {
+		return nil
+	}
+	h := f.hash
+	return h[:]
+}
+
 func (f *file) Mode() fs.FileMode {
 	if f.IsDir() {
 		return fs.ModeDir | 0555
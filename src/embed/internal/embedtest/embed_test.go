@@ -5,7 +5,9 @@
 package embedtest
 
 import (
+	"bytes"
 	"embed"
+	"io/fs"
 	"reflect"
 	"testing"
 	"testing/fstest"
@@ -176,3 +178,31 @@ func TestAliases(t *testing.T) {
 	check(helloBytes)
 	check(helloString)
 }
+
+func TestContentHash(t *testing.T) {
+	hash := func(f embed.FS, name string) []byte {
+		t.Helper()
+		info, err := fs.Stat(f, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, ok := info.(interface{ ContentHash() []byte })
+		if !ok {
+			t.Fatalf("FileInfo of %s has no ContentHash method", name)
+		}
+		return h.ContentHash()
+	}
+	hello := hash(global, "testdata/hello.txt")
+	if len(hello) != 16 {
+		t.Errorf("ContentHash of hello.txt has length %d, want 16", len(hello))
+	}
+	if h := hash(testDirAll, "testdata/hello.txt"); !bytes.Equal(h, hello) {
+		t.Errorf("ContentHash of hello.txt differs between embedded file systems")
+	}
+	if h := hash(global, "testdata/glass.txt"); bytes.Equal(h, hello) {
+		t.Errorf("ContentHash of glass.txt and hello.txt are equal")
+	}
+	if h := hash(testDirAll, "testdata/i"); h != nil {
+		t.Errorf("ContentHash of directory = %x, want nil", h)
+	}
+}
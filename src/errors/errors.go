@@ -13,8 +13,15 @@
 //
 // If e.Unwrap() returns a non-nil error w, then we say that e wraps w.
 //
+// An error may also wrap multiple errors if its type has the method
+//
+//	Unwrap() []error
+//
+// The Join function returns an error wrapping a set of errors.
+//
 // Unwrap unpacks wrapped errors. If its argument's type has an
-// Unwrap method, it calls the method once. Otherwise, it returns nil.
+// Unwrap method returning error, it calls the method once.
+// Otherwise, it returns nil.
 //
 // A simple way to create wrapped errors is to call fmt.Errorf and apply the %w verb
 // to the error argument:
@@ -23,9 +30,9 @@
 //
 // returns err.
 //
-// Is unwraps its first argument sequentially looking for an error that matches the
-// second. It reports whether it finds a match. It should be used in preference to
-// simple equality checks:
+// Is examines the tree of errors rooted at its first argument, looking for an
+// error that matches the second. It reports whether it finds a match. It should
+// be used in preference to simple equality checks:
 //
 //	if errors.Is(err, fs.ErrExist)
 //
@@ -35,8 +42,8 @@
 //
 // because the former will succeed if err wraps fs.ErrExist.
 //
-// As unwraps its first argument sequentially looking for an error that can be
-// assigned to its second argument, which must be a pointer. If it succeeds, it
+// As examines the tree of errors rooted at its first argument, looking for an
+// error that can be assigned to its second argument, which must be a pointer. If it succeeds, it
 // performs the assignment and returns true. Otherwise, it returns false. The form
 //
 //	var perr *fs.PathError
@@ -39,10 +39,10 @@ import (
 var depsRules = `
 	# No dependencies allowed for any of these packages.
 	NONE
-	< constraints, container/list, container/ring,
+	< cmp, constraints,
 	  internal/cfg, internal/cpu, internal/goarch,
 	  internal/goexperiment, internal/goos,
-	  internal/goversion, internal/nettrace,
+	  internal/goversion, internal/nettrace, log/internal,
 	  unicode/utf8, unicode/utf16, unicode,
 	  unsafe;
 
@@ -70,8 +70,20 @@ var depsRules = `
 	< RUNTIME;
 
 	RUNTIME
-	< sort
-	< container/heap;
+	< sort;
+
+	RUNTIME
+	< iter
+	< container/list, container/ring;
+
+	cmp, iter, sort
+	< container/heap, container/list/v2, container/ordered;
+
+	cmp, math/bits, unsafe
+	< slices;
+
+	unsafe
+	< maps;
 
 	RUNTIME
 	< io;
@@ -268,12 +280,12 @@ var depsRules = `
 	math/big, go/token
 	< go/constant;
 
-	container/heap, go/constant, go/parser, regexp
-	< go/types;
-
 	FMT, internal/goexperiment
 	< internal/buildcfg;
 
+	container/heap, go/constant, go/parser, internal/buildcfg, regexp
+	< go/types;
+
 	go/build/constraint, go/doc, go/parser, internal/buildcfg, internal/goroot, internal/goversion
 	< go/build;
 
@@ -354,13 +366,19 @@ var depsRules = `
 	< NET;
 
 	# logging - most packages should not import; http and up is allowed
-	FMT
+	FMT, log/internal
 	< log;
 
 	log !< crypto/tls, database/sql, go/importer, testing;
 
-	FMT, log, net
-	< log/syslog;
+	# slog
+	FMT
+	< log/slog/internal/buffer;
+
+	FMT, encoding/json, log, log/slog/internal/buffer
+	< log/slog;
+
+	log/slog !< time/tzdata;
 
 	NET, log
 	< net/mail;
@@ -413,7 +431,7 @@ var depsRules = `
 
 	# TLS, Prince of Dependencies.
 	CRYPTO-MATH, NET, container/list, encoding/hex, encoding/pem
-	< golang.org/x/crypto/internal/subtle
+	< golang.org/x/crypto/internal/alias
 	< golang.org/x/crypto/chacha20
 	< golang.org/x/crypto/internal/poly1305
 	< golang.org/x/crypto/chacha20poly1305
@@ -438,11 +456,18 @@ var depsRules = `
 	crypto/tls
 	< net/smtp;
 
+	log, crypto/tls
+	< log/syslog;
+
+	crypto/tls, golang.org/x/crypto/chacha20
+	< internal/quic;
+
 	# HTTP, King of Dependencies.
 
 	FMT
 	< golang.org/x/net/http2/hpack
-	< net/http/internal, net/http/internal/ascii, net/http/internal/testcert;
+	< net/http/internal, net/http/internal/ascii, net/http/internal/testcert,
+	  net/http/internal/qpack;
 
 	FMT, NET, container/list, encoding/binary, log
 	< golang.org/x/text/transform
@@ -462,7 +487,9 @@ var depsRules = `
 	net/http/internal,
 	net/http/internal/ascii,
 	net/http/internal/testcert,
+	net/http/internal/qpack,
 	net/http/httptrace,
+	internal/quic,
 	mime/multipart,
 	log
 	< net/http;
@@ -473,11 +500,17 @@ var depsRules = `
 	< expvar;
 
 	net/http, net/http/internal/ascii
-	< net/http/cookiejar, net/http/httputil;
+	< net/http/httpcache, net/http/httputil, net/http/websocket;
+
+	encoding/json, net/http, net/http/internal/ascii
+	< net/http/cookiejar;
 
 	net/http, flag
 	< net/http/httptest;
 
+	net/http
+	< net/securedns;
+
 	net/http, regexp
 	< net/http/cgi
 	< net/http/fcgi;
@@ -31,10 +31,12 @@ import (
 	"go/parser"
 	"go/scanner"
 	"go/token"
+	"internal/buildcfg"
 	"internal/testenv"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -231,10 +233,23 @@ func testFiles(t *testing.T, sizes Sizes, filenames []string, srcs [][]byte, man
 	flags := flag.NewFlagSet("", flag.PanicOnError)
 	flags.StringVar(&conf.GoVersion, "lang", "", "")
 	flags.BoolVar(&conf.FakeImportC, "fakeImportC", false, "")
+	goexperiment := flags.String("goexperiment", "", "")
 	if err := parseFlags(filenames[0], srcs[0], flags); err != nil {
 		t.Fatal(err)
 	}
 
+	if *goexperiment != "" {
+		exp, err := buildcfg.ParseGOEXPERIMENT(runtime.GOOS, runtime.GOARCH, *goexperiment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := buildcfg.Experiment
+		defer func() {
+			buildcfg.Experiment = old
+		}()
+		buildcfg.Experiment = *exp
+	}
+
 	if manual && *goVersion != "" {
 		// goVersion overrides -lang for manual tests.
 		conf.GoVersion = *goVersion
@@ -10,6 +10,7 @@ import (
 	"go/ast"
 	"go/constant"
 	"go/token"
+	"internal/buildcfg"
 	"sort"
 )
 
@@ -848,14 +849,33 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 					cause = "receive from send-only channel"
 				}
 			}
-			key, val = rangeKeyVal(u)
-			if key == nil || cause != "" {
+			var ok bool
+			var fcause string
+			key, val, fcause, ok = rangeKeyVal(u)
+			if cause == "" {
+				cause = fcause
+			}
+			if !ok || cause != "" {
 				if cause == "" {
 					check.softErrorf(&x, _InvalidRangeExpr, "cannot range over %s", &x)
 				} else {
 					check.softErrorf(&x, _InvalidRangeExpr, "cannot range over %s (%s)", &x, cause)
 				}
 				// ok to continue
+			} else if _, isFunc := u.(*Signature); isFunc {
+				if !check.allowVersion(check.pkg, 1, 20) {
+					check.versionErrorf(&x, _UnsupportedFeature, "go1.20", "range over %s", &x)
+					// ok to continue
+				}
+				// The parameters of the yield function determine
+				// how many iteration variables are permitted.
+				switch {
+				case key == nil && s.Key != nil:
+					check.softErrorf(s.Key, _InvalidIterVar, "range over %s permits no iteration variables", &x)
+				case val == nil && s.Value != nil:
+					check.softErrorf(s.Value, _InvalidIterVar, "range over %s permits only one iteration variable", &x)
+				}
+				// ok to continue
 			}
 		}
 
@@ -939,22 +959,55 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 }
 
 // rangeKeyVal returns the key and value type produced by a range clause
-// over an expression of type typ. If the range clause is not permitted
-// the results are nil.
-func rangeKeyVal(typ Type) (key, val Type) {
+// over an expression of type typ, and reports whether the range clause
+// is permitted. If it is not, cause may describe the reason. For range
+// clauses over functions, key and val are nil if the yield function
+// does not accept the respective iteration value.
+func rangeKeyVal(typ Type) (key, val Type, cause string, ok bool) {
 	switch typ := arrayPtrDeref(typ).(type) {
 	case *Basic:
 		if isString(typ) {
-			return Typ[Int], universeRune // use 'rune' name
+			return Typ[Int], universeRune, "", true // use 'rune' name
 		}
 	case *Array:
-		return Typ[Int], typ.elem
+		return Typ[Int], typ.elem, "", true
 	case *Slice:
-		return Typ[Int], typ.elem
+		return Typ[Int], typ.elem, "", true
 	case *Map:
-		return typ.key, typ.elem
+		return typ.key, typ.elem, "", true
 	case *Chan:
-		return typ.elem, Typ[Invalid]
+		return typ.elem, Typ[Invalid], "", true
+	case *Signature:
+		// A range-over-func iterator must have the form
+		// func(yield func(...) bool), with at most two
+		// yield parameters.
+		const form = "func must be func(yield func(...) bool)"
+		switch {
+		case !buildcfg.Experiment.RangeFunc:
+			return nil, nil, "requires GOEXPERIMENT=rangefunc", false
+		case typ.Params().Len() != 1:
+			return nil, nil, form + ": wrong argument count", false
+		case typ.Results().Len() != 0:
+			return nil, nil, form + ": wrong result count", false
+		}
+		cb, _ := coreType(typ.Params().At(0).Type()).(*Signature)
+		switch {
+		case cb == nil:
+			return nil, nil, form + ": argument is not func", false
+		case cb.Params().Len() > 2:
+			return nil, nil, form + ": yield func has too many parameters", false
+		case cb.variadic:
+			return nil, nil, form + ": yield func is variadic", false
+		case cb.Results().Len() != 1 || !isBoolean(cb.Results().At(0).Type()):
+			return nil, nil, form + ": yield func does not return bool", false
+		}
+		if cb.Params().Len() >= 1 {
+			key = cb.Params().At(0).Type()
+		}
+		if cb.Params().Len() >= 2 {
+			val = cb.Params().At(1).Type()
+		}
+		return key, val, "", true
 	}
 	return
 }
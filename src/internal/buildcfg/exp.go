@@ -135,6 +135,10 @@ func ParseGOEXPERIMENT(goos, goarch, goexp string) (*ExperimentFlags, error) {
 		flags.RegabiWrappers = false
 		flags.RegabiArgs = false
 	}
+	// Range over func is only implemented by unified IR.
+	if flags.RangeFunc {
+		flags.Unified = true
+	}
 	// Check regabi dependencies.
 	if flags.RegabiArgs && !flags.RegabiWrappers {
 		return nil, fmt.Errorf("GOEXPERIMENT regabiargs requires regabiwrappers")
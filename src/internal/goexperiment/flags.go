@@ -86,4 +86,9 @@ type Flags struct {
 	// has been broken out to its own experiment that is disabled
 	// by default.
 	HeapMinimum512KiB bool
+
+	// RangeFunc enables range over func, which the compiler
+	// implements only with unified IR. Enabling it also enables
+	// Unified.
+	RangeFunc bool
 }
@@ -0,0 +1,193 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// A recvBuffer reassembles a byte stream from data received out of order,
+// as in STREAM and CRYPTO frames.
+type recvBuffer struct {
+	off    int64 // offset of the next byte to be read
+	chunks []recvChunk
+}
+
+type recvChunk struct {
+	off int64
+	b   []byte
+}
+
+func (c recvChunk) end() int64 { return c.off + int64(len(c.b)) }
+
+// write adds data at offset off. Data already received is ignored.
+func (r *recvBuffer) write(off int64, b []byte) {
+	if off+int64(len(b)) <= r.off {
+		return
+	}
+	if off < r.off {
+		b = b[r.off-off:]
+		off = r.off
+	}
+	i := 0
+	for len(b) > 0 {
+		for i < len(r.chunks) && r.chunks[i].end() <= off {
+			i++
+		}
+		if i < len(r.chunks) && r.chunks[i].off <= off {
+			// The start of b overlaps an existing chunk.
+			skip := r.chunks[i].end() - off
+			if skip >= int64(len(b)) {
+				return
+			}
+			b = b[skip:]
+			off += skip
+			i++
+			continue
+		}
+		n := int64(len(b))
+		if i < len(r.chunks) && r.chunks[i].off < off+n {
+			n = r.chunks[i].off - off
+		}
+		r.chunks = append(r.chunks, recvChunk{})
+		copy(r.chunks[i+1:], r.chunks[i:])
+		r.chunks[i] = recvChunk{off, append([]byte(nil), b[:n]...)}
+		i++
+		b = b[n:]
+		off += n
+	}
+}
+
+// available returns the number of contiguous bytes ready to be read.
+func (r *recvBuffer) available() int64 {
+	n := int64(0)
+	off := r.off
+	for _, c := range r.chunks {
+		if c.off != off {
+			break
+		}
+		n += int64(len(c.b))
+		off = c.end()
+	}
+	return n
+}
+
+// read reads contiguous data into p.
+func (r *recvBuffer) read(p []byte) int {
+	n := 0
+	for len(p) > 0 && len(r.chunks) > 0 && r.chunks[0].off == r.off {
+		c := &r.chunks[0]
+		m := copy(p, c.b)
+		p = p[m:]
+		n += m
+		r.off += int64(m)
+		c.b = c.b[m:]
+		c.off += int64(m)
+		if len(c.b) == 0 {
+			r.chunks = r.chunks[1:]
+		}
+	}
+	return n
+}
+
+// discard drops all buffered data.
+func (r *recvBuffer) discard() {
+	r.chunks = nil
+}
+
+// A sendBuffer holds data written to a stream that has not yet been
+// acknowledged by the peer, as in STREAM and CRYPTO frames.
+type sendBuffer struct {
+	base  int64    // offset of buf[0]; all data before base is acknowledged
+	buf   []byte   // unacknowledged data
+	next  int64    // offset of the first byte never sent
+	lost  rangeset // sent data that must be retransmitted
+	acked rangeset // acknowledged data after base
+}
+
+// end returns the offset of the end of the written data.
+func (s *sendBuffer) end() int64 { return s.base + int64(len(s.buf)) }
+
+// buffered returns the amount of unacknowledged data.
+func (s *sendBuffer) buffered() int64 { return int64(len(s.buf)) }
+
+func (s *sendBuffer) write(b []byte) {
+	s.buf = append(s.buf, b...)
+}
+
+// ack records the acknowledgement of the range [off, off+n).
+func (s *sendBuffer) ack(off, n int64) {
+	s.acked.add(off, off+n)
+	s.lost.sub(off, off+n)
+	if len(s.acked) > 0 && s.acked[0].start <= s.base {
+		end := s.acked[0].end
+		if end > s.end() {
+			end = s.end()
+		}
+		if end > s.base {
+			s.buf = s.buf[end-s.base:]
+			if len(s.buf) == 0 {
+				s.buf = nil
+			}
+			s.base = end
+		}
+		s.acked.removeBefore(s.base)
+	}
+}
+
+// markLost records that the range [off, off+n) must be retransmitted.
+func (s *sendBuffer) markLost(off, n int64) {
+	end := off + n
+	if off < s.base {
+		off = s.base
+	}
+	if end <= off {
+		return
+	}
+	s.lost.add(off, end)
+	for _, r := range s.acked {
+		s.lost.sub(r.start, r.end)
+	}
+}
+
+// markAllLost records that all sent, unacknowledged data
+// must be retransmitted.
+func (s *sendBuffer) markAllLost() {
+	s.markLost(s.base, s.next-s.base)
+}
+
+// hasLost reports whether there is data to retransmit.
+func (s *sendBuffer) hasLost() bool { return len(s.lost) > 0 }
+
+// hasUnsent reports whether there is data that has never been sent.
+func (s *sendBuffer) hasUnsent() bool { return s.next < s.end() }
+
+// nextLost returns up to max bytes of data to retransmit,
+// and removes it from the lost set.
+func (s *sendBuffer) nextLost(max int64) (off int64, b []byte) {
+	r := s.lost[0]
+	if r.size() > max {
+		r.end = r.start + max
+	}
+	s.lost.sub(r.start, r.end)
+	return r.start, s.buf[r.start-s.base : r.end-s.base]
+}
+
+// nextUnsent returns up to max bytes of data that has never been sent,
+// and marks it as sent.
+func (s *sendBuffer) nextUnsent(max int64) (off int64, b []byte) {
+	off = s.next
+	n := s.end() - off
+	if n > max {
+		n = max
+	}
+	s.next += n
+	return off, s.buf[off-s.base : off-s.base+n]
+}
+
+// reset discards all data.
+func (s *sendBuffer) reset() {
+	s.base = s.end()
+	s.next = s.base
+	s.buf = nil
+	s.lost = nil
+	s.acked = nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRangeset(t *testing.T) {
+	var s rangeset
+	s.add(10, 20)
+	s.add(30, 40)
+	s.add(20, 25) // adjacent ranges merge
+	s.add(0, 5)
+	if want := (rangeset{{0, 5}, {10, 25}, {30, 40}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("after add: %v, want %v", s, want)
+	}
+	s.add(4, 31)
+	if want := (rangeset{{0, 40}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("after overlapping add: %v, want %v", s, want)
+	}
+	s.sub(10, 20)
+	s.sub(35, 50)
+	if want := (rangeset{{0, 10}, {20, 35}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("after sub: %v, want %v", s, want)
+	}
+	for _, test := range []struct {
+		v    int64
+		want bool
+	}{{-1, false}, {0, true}, {9, true}, {10, false}, {20, true}, {34, true}, {35, false}} {
+		if got := s.contains(test.v); got != test.want {
+			t.Errorf("contains(%v) = %v, want %v", test.v, got, test.want)
+		}
+	}
+	if !s.containsRange(21, 35) || s.containsRange(5, 21) {
+		t.Errorf("containsRange is wrong for %v", s)
+	}
+	if s.min() != 0 || s.max() != 34 {
+		t.Errorf("min, max = %v, %v; want 0, 34", s.min(), s.max())
+	}
+	s.removeBefore(25)
+	if want := (rangeset{{25, 35}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("after removeBefore: %v, want %v", s, want)
+	}
+}
+
+func TestRecvBufferReassembly(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.Read(data)
+	for seed := int64(0); seed < 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		var r recvBuffer
+		var got []byte
+		for len(got) < len(data) {
+			off := rng.Intn(len(data))
+			end := off + 1 + rng.Intn(200)
+			if end > len(data) {
+				end = len(data)
+			}
+			r.write(int64(off), data[off:end])
+			buf := make([]byte, rng.Intn(300)+1)
+			n := r.read(buf)
+			got = append(got, buf[:n]...)
+			if r.off != int64(len(got)) {
+				t.Fatalf("seed %v: off = %v after reading %v bytes", seed, r.off, len(got))
+			}
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("seed %v: reassembled data does not match", seed)
+		}
+		if len(r.chunks) != 0 {
+			t.Fatalf("seed %v: %v chunks left after reading all data", seed, len(r.chunks))
+		}
+	}
+}
+
+func TestSendBuffer(t *testing.T) {
+	var s sendBuffer
+	s.write([]byte("0123456789"))
+	off, b := s.nextUnsent(4)
+	if off != 0 || string(b) != "0123" {
+		t.Fatalf("nextUnsent = %v, %q", off, b)
+	}
+	off, b = s.nextUnsent(100)
+	if off != 4 || string(b) != "456789" || s.hasUnsent() {
+		t.Fatalf("nextUnsent = %v, %q", off, b)
+	}
+
+	// Acknowledging data after a gap does not release the buffer.
+	s.ack(4, 6)
+	if s.base != 0 || s.buffered() != 10 {
+		t.Fatalf("after out of order ack: base = %v, buffered = %v", s.base, s.buffered())
+	}
+	s.markAllLost()
+	if !s.hasLost() {
+		t.Fatalf("hasLost = false after markAllLost")
+	}
+	off, b = s.nextLost(100)
+	if off != 0 || string(b) != "0123" || s.hasLost() {
+		t.Fatalf("nextLost = %v, %q; acknowledged data must not be retransmitted", off, b)
+	}
+	s.ack(0, 4)
+	if s.base != 10 || s.buffered() != 0 {
+		t.Fatalf("after ack: base = %v, buffered = %v", s.base, s.buffered())
+	}
+	s.markLost(0, 10)
+	if s.hasLost() {
+		t.Fatalf("acknowledged data marked lost")
+	}
+}
@@ -0,0 +1,570 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// A numberSpace is a packet number space. See RFC 9000, Section 12.3.
+type numberSpace int
+
+const (
+	initialSpace numberSpace = iota
+	handshakeSpace
+	appDataSpace
+	numberSpaceCount
+)
+
+func (s numberSpace) String() string {
+	switch s {
+	case initialSpace:
+		return "Initial"
+	case handshakeSpace:
+		return "Handshake"
+	case appDataSpace:
+		return "AppData"
+	}
+	return "unknown"
+}
+
+// spaceForLevel returns the packet number space used for data at
+// a TLS encryption level. 0-RTT is not supported.
+func spaceForLevel(l tls.QUICEncryptionLevel) (numberSpace, bool) {
+	switch l {
+	case tls.QUICEncryptionLevelInitial:
+		return initialSpace, true
+	case tls.QUICEncryptionLevelHandshake:
+		return handshakeSpace, true
+	case tls.QUICEncryptionLevelApplication:
+		return appDataSpace, true
+	}
+	return 0, false
+}
+
+func levelForSpace(s numberSpace) tls.QUICEncryptionLevel {
+	switch s {
+	case initialSpace:
+		return tls.QUICEncryptionLevelInitial
+	case handshakeSpace:
+		return tls.QUICEncryptionLevelHandshake
+	}
+	return tls.QUICEncryptionLevelApplication
+}
+
+// Stream types, indexed by the direction bit of a stream ID.
+const (
+	bidiStream = 0
+	uniStream  = 1
+)
+
+// connState is the lifecycle state of a connection.
+type connState int
+
+const (
+	stateOpen     connState = iota
+	stateClosing            // we sent CONNECTION_CLOSE
+	stateDraining           // the peer sent CONNECTION_CLOSE
+	stateDone               // the connection is gone
+)
+
+// A Conn is a QUIC connection.
+//
+// Multiple goroutines may invoke methods on a Conn simultaneously.
+type Conn struct {
+	endpoint *Endpoint
+	config   *Config
+	isClient bool
+	peerAddr net.Addr
+	tls      *tls.QUICConn
+	timer    *time.Timer
+
+	mu   sync.Mutex
+	wake chan struct{} // closed and replaced when the state changes
+
+	localConnID   []byte
+	peerConnID    []byte // destination of packets we send
+	peerConnIDSeq int64  // sequence number of peerConnID
+
+	// Connection IDs issued by the peer with NEW_CONNECTION_ID frames,
+	// by sequence number, and ones we must retire.
+	peerConnIDs       map[int64][]byte
+	peerConnIDRetired int64 // all sequence numbers below this are retired
+	retireConnIDs     []int64
+	origDstConnID     []byte // the client's first destination connection ID
+	gotPeerConnID     bool   // the client has seen the server's connection ID
+
+	peerParams    transportParameters
+	gotPeerParams bool
+	idleTimeout   time.Duration
+
+	readKeys    [numberSpaceCount]*packetKey
+	writeKeys   [numberSpaceCount]*packetKey
+	nextReadKey *packetKey // 1-RTT key for the next key phase
+	keyPhase    bool
+	discarded   [numberSpaceCount]bool
+	crypto      [numberSpaceCount]cryptoStream
+	spaces      [numberSpaceCount]spaceState
+
+	rtt      rttState
+	cc       congestionState
+	ptoCount int
+	probes   [numberSpaceCount]int // number of probe packets to send
+
+	handshakeComplete    bool
+	handshakeConfirmed   bool
+	handshakeDonePending bool // server must send HANDSHAKE_DONE
+	addressValidated     bool
+	bytesRecv, bytesSent int64 // for the anti-amplification limit
+
+	streams           map[int64]*Stream
+	localStreams      [2]int64 // number of streams we have opened, per type
+	peerMaxStreams    [2]int64
+	peerStreams       [2]int64 // number of streams the peer has opened, per type
+	localMaxStreams   [2]int64
+	maxStreamsPending [2]bool
+	acceptQueue       []*Stream
+
+	localMaxData   int64 // MAX_DATA we have sent
+	recvData       int64 // sum of the highest offsets received on each stream
+	readData       int64 // sum of data consumed on each stream
+	maxDataPending bool
+	peerMaxData    int64
+	sentData       int64 // sum of the highest offsets sent on each stream
+
+	frameErr      error // error from the frame being processed
+	pingPending   bool
+	pathResponses [][8]byte
+	lastActivity  time.Time
+	lastAckElicit time.Time // last time an ack-eliciting packet was sent
+	state         connState
+	err           error // returned by operations on a closed connection
+	closeCode     uint64
+	closeReason   string
+	closeIsApp    bool
+	closePending  bool
+	closeDeadline time.Time
+}
+
+// A cryptoStream carries TLS handshake data in CRYPTO frames.
+type cryptoStream struct {
+	in  recvBuffer
+	out sendBuffer
+}
+
+// maxCryptoBuffer is the maximum amount of out-of-order
+// handshake data buffered in each packet number space.
+const maxCryptoBuffer = 64 << 10
+
+func newConn(e *Endpoint, config *Config, isClient bool, peerAddr net.Addr, origDstConnID, peerConnID []byte) (*Conn, error) {
+	if config == nil || config.TLSConfig == nil {
+		return nil, errors.New("quic: Config.TLSConfig is required")
+	}
+	c := &Conn{
+		endpoint:      e,
+		config:        config,
+		isClient:      isClient,
+		peerAddr:      peerAddr,
+		wake:          make(chan struct{}),
+		localConnID:   newConnID(),
+		peerConnID:    peerConnID,
+		origDstConnID: origDstConnID,
+		streams:       make(map[int64]*Stream),
+		localMaxData:  config.maxConnReadBufferSize(),
+		lastActivity:  time.Now(),
+	}
+	c.localMaxStreams[bidiStream] = config.maxBidiRemoteStreams()
+	c.localMaxStreams[uniStream] = config.maxUniRemoteStreams()
+	for i := range c.spaces {
+		c.spaces[i].largestAcked = -1
+		c.spaces[i].largestRecv = -1
+	}
+	c.rtt.init()
+	c.cc.init()
+	c.idleTimeout = config.maxIdleTimeout()
+	c.readKeys[initialSpace], c.writeKeys[initialSpace] = initialKeys(origDstConnID, isClient)
+
+	tlsConfig := config.TLSConfig.Clone()
+	tlsConfig.MinVersion = tls.VersionTLS13
+	qconfig := &tls.QUICConfig{TLSConfig: tlsConfig}
+	if isClient {
+		c.tls = tls.QUICClient(qconfig)
+	} else {
+		c.tls = tls.QUICServer(qconfig)
+	}
+	params := transportParameters{
+		maxIdleTimeout:                 c.idleTimeout,
+		maxUDPPayloadSize:              maxUDPPayloadSize,
+		initialMaxData:                 c.localMaxData,
+		initialMaxStreamDataBidiLocal:  config.maxStreamReadBufferSize(),
+		initialMaxStreamDataBidiRemote: config.maxStreamReadBufferSize(),
+		initialMaxStreamDataUni:        config.maxStreamReadBufferSize(),
+		initialMaxStreamsBidi:          c.localMaxStreams[bidiStream],
+		initialMaxStreamsUni:           c.localMaxStreams[uniStream],
+		ackDelayExponent:               ackDelayExponent,
+		maxAckDelay:                    maxAckDelay,
+		disableActiveMigration:         true,
+		activeConnIDLimit:              activeConnIDLimit,
+		initialSrcConnID:               c.localConnID,
+	}
+	if !isClient {
+		params.originalDstConnID = origDstConnID
+	}
+	c.tls.SetTransportParameters(params.marshal())
+	c.timer = time.AfterFunc(time.Hour, c.onTimer)
+	c.timer.Stop()
+	return c, nil
+}
+
+func newConnID() []byte {
+	id := make([]byte, connIDLen)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// start starts the TLS handshake.
+func (c *Conn) startLocked() error {
+	if err := c.tls.Start(context.Background()); err != nil {
+		return err
+	}
+	return c.handleTLSEventsLocked()
+}
+
+// wakeLocked wakes all goroutines blocked in waitLocked.
+func (c *Conn) wakeLocked() {
+	close(c.wake)
+	c.wake = make(chan struct{})
+}
+
+// waitLocked waits until cond returns true or ctx is done.
+// The conn's mutex is released while waiting.
+func (c *Conn) waitLocked(ctx context.Context, cond func() bool) error {
+	for !cond() {
+		wake := c.wake
+		c.mu.Unlock()
+		var err error
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		c.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitHandshake waits for the handshake to complete.
+func (c *Conn) waitHandshake(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.waitLocked(ctx, func() bool {
+		return c.handshakeComplete || c.err != nil
+	}); err != nil {
+		return err
+	}
+	return c.err
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.endpoint.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.peerAddr
+}
+
+// ConnectionState returns basic TLS details about the connection.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+// Close closes the connection, sending the peer an application
+// error code of 0.
+//
+// Close does not wait for the peer to acknowledge the closure.
+func (c *Conn) Close() error {
+	c.Abort(nil)
+	return nil
+}
+
+// Abort closes the connection and returns an error to the peer.
+// If err is an *ApplicationError, its code and reason are sent to the peer.
+// Otherwise, the peer receives an application error code of 0.
+func (c *Conn) Abort(err error) {
+	var code uint64
+	var reason string
+	var ae *ApplicationError
+	if errors.As(err, &ae) {
+		code, reason = ae.Code, ae.Reason
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.abortLocked(time.Now(), true, code, reason, errConnClosed)
+}
+
+// closeWithErrorLocked closes the connection due to a local error.
+func (c *Conn) closeWithErrorLocked(now time.Time, err error) {
+	var te localTransportError
+	switch {
+	case errors.As(err, &te):
+	default:
+		var alert tls.AlertError
+		if errors.As(err, &alert) {
+			te = localTransportError{errTLSBase + transportError(alert), err.Error()}
+		} else {
+			te = localTransportError{errInternal, err.Error()}
+		}
+	}
+	c.abortLocked(now, false, uint64(te.code), te.reason, err)
+}
+
+// abortLocked starts closing the connection, sending a CONNECTION_CLOSE
+// frame to the peer. Operations on the connection return err.
+func (c *Conn) abortLocked(now time.Time, isApp bool, code uint64, reason string, err error) {
+	if c.state != stateOpen {
+		return
+	}
+	c.state = stateClosing
+	c.err = err
+	c.closeIsApp = isApp
+	c.closeCode = code
+	c.closeReason = reason
+	c.closePending = true
+	c.closeDeadline = now.Add(3 * c.rtt.pto(c.peerParams.maxAckDelay))
+	c.tls.Close()
+	c.flushLocked(now)
+	c.wakeLocked()
+}
+
+// enterDrainingLocked handles a CONNECTION_CLOSE frame from the peer.
+func (c *Conn) enterDrainingLocked(now time.Time, err error) {
+	if c.state == stateOpen || c.state == stateClosing {
+		if c.state == stateOpen {
+			c.err = err
+		}
+		c.state = stateDraining
+		c.closeDeadline = now.Add(3 * c.rtt.pto(c.peerParams.maxAckDelay))
+		c.tls.Close()
+		c.wakeLocked()
+	}
+}
+
+// finishLocked removes the connection from its endpoint.
+func (c *Conn) finishLocked(err error) {
+	if c.state == stateDone {
+		return
+	}
+	if c.err == nil {
+		c.err = err
+	}
+	if c.state == stateOpen {
+		c.tls.Close()
+	}
+	c.state = stateDone
+	c.timer.Stop()
+	c.endpoint.removeConn(c)
+	c.wakeLocked()
+}
+
+// handleTLSEventsLocked processes events produced by the TLS handshake.
+func (c *Conn) handleTLSEventsLocked() error {
+	for {
+		e := c.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret:
+			space, ok := spaceForLevel(e.Level)
+			if !ok {
+				continue
+			}
+			k, err := newPacketKey(e.Suite, append([]byte(nil), e.Data...))
+			if err != nil {
+				return err
+			}
+			c.readKeys[space] = k
+		case tls.QUICSetWriteSecret:
+			space, ok := spaceForLevel(e.Level)
+			if !ok {
+				continue
+			}
+			k, err := newPacketKey(e.Suite, append([]byte(nil), e.Data...))
+			if err != nil {
+				return err
+			}
+			c.writeKeys[space] = k
+		case tls.QUICWriteData:
+			space, ok := spaceForLevel(e.Level)
+			if !ok {
+				return localTransportError{errInternal, "handshake data at unexpected level"}
+			}
+			c.crypto[space].out.write(e.Data)
+		case tls.QUICTransportParameters:
+			if err := c.handlePeerTransportParameters(e.Data); err != nil {
+				return err
+			}
+		case tls.QUICHandshakeDone:
+			c.handshakeComplete = true
+			if !c.isClient {
+				// The server's handshake is confirmed as soon as it
+				// completes. See RFC 9001, Section 4.1.2.
+				c.handshakeConfirmed = true
+				c.handshakeDonePending = true
+				c.discardKeysLocked(handshakeSpace)
+				if err := c.tls.SendSessionTicket(tls.QUICSessionTicketOptions{}); err != nil {
+					return err
+				}
+				c.endpoint.queueAccept(c)
+			}
+		}
+	}
+}
+
+func (c *Conn) handlePeerTransportParameters(b []byte) error {
+	p, err := unmarshalTransportParameters(b)
+	if err != nil {
+		return err
+	}
+	if c.isClient {
+		if !bytes.Equal(p.originalDstConnID, c.origDstConnID) {
+			return localTransportError{errTransportParameter, "original_destination_connection_id mismatch"}
+		}
+		if p.retrySrcConnID != nil {
+			return localTransportError{errTransportParameter, "unexpected retry_source_connection_id"}
+		}
+	} else if p.originalDstConnID != nil || p.retrySrcConnID != nil {
+		return localTransportError{errTransportParameter, "client sent server-only transport parameter"}
+	}
+	if p.initialSrcConnID == nil || !bytes.Equal(p.initialSrcConnID, c.peerConnID) {
+		return localTransportError{errTransportParameter, "initial_source_connection_id mismatch"}
+	}
+	c.peerParams = p
+	c.gotPeerParams = true
+	c.peerMaxData = p.initialMaxData
+	c.peerMaxStreams[bidiStream] = p.initialMaxStreamsBidi
+	c.peerMaxStreams[uniStream] = p.initialMaxStreamsUni
+	if p.maxIdleTimeout > 0 && (c.idleTimeout == 0 || p.maxIdleTimeout < c.idleTimeout) {
+		c.idleTimeout = p.maxIdleTimeout
+	}
+	return nil
+}
+
+// discardKeysLocked discards the keys and state of a packet number space.
+// See RFC 9001, Section 4.9.
+func (c *Conn) discardKeysLocked(space numberSpace) {
+	if c.discarded[space] {
+		return
+	}
+	c.discarded[space] = true
+	c.readKeys[space] = nil
+	c.writeKeys[space] = nil
+	for _, p := range c.spaces[space].sent {
+		c.cc.discard(p)
+	}
+	c.spaces[space] = spaceState{largestAcked: -1, largestRecv: -1}
+	c.crypto[space] = cryptoStream{}
+	c.probes[space] = 0
+	c.ptoCount = 0
+}
+
+// onTimer handles the expiration of the connection's timer.
+func (c *Conn) onTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	switch c.state {
+	case stateDone:
+		return
+	case stateClosing, stateDraining:
+		if !now.Before(c.closeDeadline) {
+			c.finishLocked(errConnClosed)
+			return
+		}
+		c.resetTimerLocked(now)
+		return
+	}
+	if t := c.idleDeadline(); !t.IsZero() && !now.Before(t) {
+		c.finishLocked(errIdleTimeout)
+		return
+	}
+	if t, space := c.lossDetectionTimer(); !t.IsZero() && !now.Before(t) {
+		c.onLossDetectionTimeout(now, space)
+	}
+	s := &c.spaces[appDataSpace]
+	if !s.ackDeadline.IsZero() && !now.Before(s.ackDeadline) {
+		s.ackPending = true
+	}
+	if t := c.keepAliveDeadline(); !t.IsZero() && !now.Before(t) {
+		c.pingPending = true
+	}
+	c.flushLocked(now)
+	c.wakeLocked()
+}
+
+func (c *Conn) idleDeadline() time.Time {
+	if c.idleTimeout <= 0 {
+		return time.Time{}
+	}
+	// The idle timeout is at least three times the PTO.
+	// See RFC 9000, Section 10.1.
+	d := c.idleTimeout
+	if pto := 3 * c.rtt.pto(c.peerParams.maxAckDelay); d < pto {
+		d = pto
+	}
+	return c.lastActivity.Add(d)
+}
+
+func (c *Conn) keepAliveDeadline() time.Time {
+	if c.config.KeepAlivePeriod <= 0 || !c.handshakeComplete {
+		return time.Time{}
+	}
+	return c.lastActivity.Add(c.config.KeepAlivePeriod)
+}
+
+// resetTimerLocked arms the connection timer for the next deadline.
+func (c *Conn) resetTimerLocked(now time.Time) {
+	var next time.Time
+	consider := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	switch c.state {
+	case stateDone:
+		c.timer.Stop()
+		return
+	case stateClosing, stateDraining:
+		consider(c.closeDeadline)
+	default:
+		consider(c.idleDeadline())
+		t, _ := c.lossDetectionTimer()
+		consider(t)
+		consider(c.spaces[appDataSpace].ackDeadline)
+		consider(c.keepAliveDeadline())
+	}
+	if next.IsZero() {
+		c.timer.Stop()
+		return
+	}
+	d := next.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	c.timer.Reset(d)
+}
@@ -0,0 +1,682 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// Frame types. See RFC 9000, Section 19.
+const (
+	frameTypePadding                    = 0x00
+	frameTypePing                       = 0x01
+	frameTypeAck                        = 0x02
+	frameTypeAckECN                     = 0x03
+	frameTypeResetStream                = 0x04
+	frameTypeStopSending                = 0x05
+	frameTypeCrypto                     = 0x06
+	frameTypeNewToken                   = 0x07
+	frameTypeStreamBase                 = 0x08 // 0x08-0x0f
+	frameTypeMaxData                    = 0x10
+	frameTypeMaxStreamData              = 0x11
+	frameTypeMaxStreamsBidi             = 0x12
+	frameTypeMaxStreamsUni              = 0x13
+	frameTypeDataBlocked                = 0x14
+	frameTypeStreamDataBlocked          = 0x15
+	frameTypeStreamsBlockedBidi         = 0x16
+	frameTypeStreamsBlockedUni          = 0x17
+	frameTypeNewConnectionID            = 0x18
+	frameTypeRetireConnectionID         = 0x19
+	frameTypePathChallenge              = 0x1a
+	frameTypePathResponse               = 0x1b
+	frameTypeConnectionCloseTransport   = 0x1c
+	frameTypeConnectionCloseApplication = 0x1d
+	frameTypeHandshakeDone              = 0x1e
+)
+
+// STREAM frame flag bits.
+const (
+	streamOffBit = 0x04
+	streamLenBit = 0x02
+	streamFinBit = 0x01
+)
+
+// handleDatagramLocked processes a datagram received from the peer.
+func (c *Conn) handleDatagramLocked(now time.Time, b []byte) {
+	switch c.state {
+	case stateClosing:
+		// Respond to packets with another CONNECTION_CLOSE.
+		// See RFC 9000, Section 10.2.1.
+		c.closePending = true
+		c.flushLocked(now)
+		return
+	case stateDraining, stateDone:
+		return
+	}
+	c.bytesRecv += int64(len(b))
+	for len(b) > 0 && c.state == stateOpen {
+		n := c.handlePacket(now, b)
+		if n <= 0 {
+			break
+		}
+		b = b[n:]
+	}
+	c.flushLocked(now)
+	c.wakeLocked()
+}
+
+// handlePacket processes the first packet in b and returns its length,
+// or a non-positive value if the rest of the datagram should be dropped.
+func (c *Conn) handlePacket(now time.Time, b []byte) int {
+	if b[0]&fixedBit == 0 {
+		return -1
+	}
+	if !isLongHeader(b[0]) {
+		if len(b) < 1+connIDLen || !bytes.Equal(b[1:1+connIDLen], c.localConnID) {
+			return -1
+		}
+		c.handleProtectedPacket(now, appDataSpace, b, 1+connIDLen, nil)
+		return len(b)
+	}
+
+	// Long header packet. See RFC 9000, Section 17.2.
+	if len(b) < 7 {
+		return -1
+	}
+	if binary.BigEndian.Uint32(b[1:5]) != quicVersion1 {
+		return -1
+	}
+	pos := 5
+	dcid, n := consumeUint8Bytes(b[pos:])
+	if n < 0 {
+		return -1
+	}
+	pos += n
+	scid, n := consumeUint8Bytes(b[pos:])
+	if n < 0 {
+		return -1
+	}
+	pos += n
+	var space numberSpace
+	switch (b[0] >> 4) & 0x03 {
+	case packetTypeInitial:
+		space = initialSpace
+		_, n := consumeVarintBytes(b[pos:]) // token
+		if n < 0 {
+			return -1
+		}
+		pos += n
+	case packetTypeHandshake:
+		space = handshakeSpace
+	case packetType0RTT:
+		// We never accept 0-RTT data; skip the packet.
+		space = -1
+	default:
+		// Retry packets are not supported.
+		return -1
+	}
+	length, n := consumeVarint(b[pos:])
+	if n < 0 || length > uint64(len(b)-pos-n) {
+		return -1
+	}
+	pos += n
+	end := pos + int(length)
+	if space < 0 {
+		return end
+	}
+	if !bytes.Equal(dcid, c.localConnID) && !(space == initialSpace && bytes.Equal(dcid, c.origDstConnID)) {
+		return end
+	}
+	c.handleProtectedPacket(now, space, b[:end], pos, scid)
+	return end
+}
+
+func consumeUint8Bytes(b []byte) ([]byte, int) {
+	if len(b) < 1 || int(b[0]) > len(b)-1 {
+		return nil, -1
+	}
+	return b[1 : 1+int(b[0])], 1 + int(b[0])
+}
+
+// handleProtectedPacket decrypts and processes a packet.
+// The packet number begins at pkt[pnOff].
+func (c *Conn) handleProtectedPacket(now time.Time, space numberSpace, pkt []byte, pnOff int, scid []byte) {
+	k := c.readKeys[space]
+	if k == nil {
+		return
+	}
+	s := &c.spaces[space]
+	truncated, pnLen, ok := k.unprotectHeader(pkt, pnOff)
+	if !ok {
+		return
+	}
+	num := decodePacketNumber(s.largestRecv, truncated, pnLen)
+	hdrLen := pnOff + pnLen
+	keyUpdate := false
+	if space == appDataSpace && (pkt[0]&keyPhaseBit != 0) != c.keyPhase {
+		if c.nextReadKey == nil {
+			c.nextReadKey = k.next()
+		}
+		k = c.nextReadKey
+		keyUpdate = true
+	}
+	payload, err := k.open(pkt, hdrLen, num)
+	if err != nil {
+		return
+	}
+	if keyUpdate {
+		// The peer initiated a key update. See RFC 9001, Section 6.2.
+		c.keyPhase = !c.keyPhase
+		c.readKeys[appDataSpace] = k
+		c.writeKeys[appDataSpace] = c.writeKeys[appDataSpace].next()
+		c.nextReadKey = nil
+	}
+	if num < s.recvFloor || s.recv.contains(num) {
+		return // duplicate
+	}
+	reserved := byte(reservedShortBits)
+	if isLongHeader(pkt[0]) {
+		reserved = reservedLongBits
+	}
+	if pkt[0]&reserved != 0 {
+		c.closeWithErrorLocked(now, localTransportError{errProtocolViolation, "reserved header bits are set"})
+		return
+	}
+	if len(payload) == 0 {
+		c.closeWithErrorLocked(now, localTransportError{errProtocolViolation, "packet has no frames"})
+		return
+	}
+	c.lastActivity = now
+	if c.isClient && !c.gotPeerConnID && scid != nil {
+		// The client switches to the connection ID chosen by the server.
+		// See RFC 9000, Section 7.2.
+		c.peerConnID = append([]byte(nil), scid...)
+		c.gotPeerConnID = true
+	}
+	if !c.isClient && space == handshakeSpace {
+		// Receiving a Handshake packet validates the client's address,
+		// and the server no longer needs its Initial keys.
+		// See RFC 9000, Section 8.1 and RFC 9001, Section 4.9.1.
+		c.addressValidated = true
+		c.discardKeysLocked(initialSpace)
+	}
+
+	ackEliciting, err := c.handleFrames(now, space, payload)
+	if err != nil {
+		c.closeWithErrorLocked(now, err)
+		return
+	}
+	if c.discarded[space] {
+		return
+	}
+	s.recv.add(num, num+1)
+	if len(s.recv) > maxAckRanges {
+		s.recvFloor = s.recv[len(s.recv)-maxAckRanges].start
+		s.recv.removeBefore(s.recvFloor)
+	}
+	if num > s.largestRecv {
+		s.largestRecv = num
+		s.largestRecvTime = now
+	}
+	if ackEliciting {
+		s.unackedElicit++
+		switch {
+		case space != appDataSpace || s.unackedElicit >= 2 || !c.handshakeComplete:
+			s.ackPending = true
+		case s.ackDeadline.IsZero():
+			s.ackDeadline = now.Add(maxAckDelay)
+		}
+	}
+}
+
+// handleFrames processes the frames in a packet payload.
+// It reports whether the packet was ack-eliciting.
+func (c *Conn) handleFrames(now time.Time, space numberSpace, b []byte) (ackEliciting bool, err error) {
+	errMalformed := localTransportError{errFrameEncoding, "malformed frame"}
+	for len(b) > 0 {
+		typ, n := consumeVarint(b)
+		if n < 0 {
+			return false, errMalformed
+		}
+		// Only a few frame types are allowed in Initial and Handshake packets.
+		// See RFC 9000, Section 12.4.
+		if space != appDataSpace {
+			switch typ {
+			case frameTypePadding, frameTypePing, frameTypeAck, frameTypeAckECN,
+				frameTypeCrypto, frameTypeConnectionCloseTransport:
+			default:
+				return false, localTransportError{errProtocolViolation, "frame not allowed in handshake packets"}
+			}
+		}
+		if typ != frameTypePadding && typ != frameTypeAck && typ != frameTypeAckECN &&
+			typ != frameTypeConnectionCloseTransport && typ != frameTypeConnectionCloseApplication {
+			ackEliciting = true
+		}
+		switch {
+		case typ == frameTypePadding:
+			for n < len(b) && b[n] == 0 {
+				n++
+			}
+		case typ == frameTypePing:
+		case typ == frameTypeAck || typ == frameTypeAckECN:
+			n = c.handleAckFrame(now, space, b, typ == frameTypeAckECN)
+		case typ == frameTypeResetStream:
+			n = c.handleResetStreamFrame(b)
+		case typ == frameTypeStopSending:
+			n = c.handleStopSendingFrame(b)
+		case typ == frameTypeCrypto:
+			n = c.handleCryptoFrame(space, b)
+		case typ == frameTypeNewToken:
+			if !c.isClient {
+				return false, localTransportError{errProtocolViolation, "client sent NEW_TOKEN"}
+			}
+			_, m := consumeVarintBytes(b[n:])
+			if m < 0 {
+				return false, errMalformed
+			}
+			n += m
+		case typ >= frameTypeStreamBase && typ < frameTypeStreamBase+8:
+			n = c.handleStreamFrame(b, byte(typ))
+		case typ == frameTypeMaxData:
+			v, m := consumeVarintInt64(b[n:])
+			if m < 0 {
+				return false, errMalformed
+			}
+			if v > c.peerMaxData {
+				c.peerMaxData = v
+			}
+			n += m
+		case typ == frameTypeMaxStreamData:
+			n = c.handleMaxStreamDataFrame(b)
+		case typ == frameTypeMaxStreamsBidi || typ == frameTypeMaxStreamsUni:
+			v, m := consumeVarintInt64(b[n:])
+			if m < 0 {
+				return false, errMalformed
+			}
+			if v > 1<<60 {
+				return false, localTransportError{errFrameEncoding, "MAX_STREAMS too large"}
+			}
+			t := bidiStream
+			if typ == frameTypeMaxStreamsUni {
+				t = uniStream
+			}
+			if v > c.peerMaxStreams[t] {
+				c.peerMaxStreams[t] = v
+			}
+			n += m
+		case typ == frameTypeDataBlocked || typ == frameTypeStreamsBlockedBidi ||
+			typ == frameTypeStreamsBlockedUni:
+			_, m := consumeVarint(b[n:])
+			if m < 0 {
+				return false, errMalformed
+			}
+			n += m
+		case typ == frameTypeStreamDataBlocked:
+			_, m1 := consumeVarint(b[n:])
+			if m1 < 0 {
+				return false, errMalformed
+			}
+			_, m2 := consumeVarint(b[n+m1:])
+			if m2 < 0 {
+				return false, errMalformed
+			}
+			n += m1 + m2
+		case typ == frameTypeNewConnectionID:
+			n = c.handleNewConnectionIDFrame(b)
+		case typ == frameTypeRetireConnectionID:
+			// We only ever issue a single connection ID, which the
+			// peer may not retire while it is in use.
+			_, m := consumeVarint(b[n:])
+			if m < 0 {
+				return false, errMalformed
+			}
+			n += m
+		case typ == frameTypePathChallenge:
+			if len(b) < n+8 {
+				return false, errMalformed
+			}
+			var data [8]byte
+			copy(data[:], b[n:])
+			c.pathResponses = append(c.pathResponses, data)
+			n += 8
+		case typ == frameTypePathResponse:
+			// We never send PATH_CHALLENGE frames.
+			if len(b) < n+8 {
+				return false, errMalformed
+			}
+			n += 8
+		case typ == frameTypeConnectionCloseTransport || typ == frameTypeConnectionCloseApplication:
+			n = c.handleConnectionCloseFrame(now, b, typ == frameTypeConnectionCloseApplication)
+		case typ == frameTypeHandshakeDone:
+			if !c.isClient {
+				return false, localTransportError{errProtocolViolation, "client sent HANDSHAKE_DONE"}
+			}
+			// The handshake is confirmed. See RFC 9001, Section 4.1.2.
+			c.handshakeConfirmed = true
+			c.discardKeysLocked(handshakeSpace)
+		default:
+			return false, localTransportError{errFrameEncoding, "unknown frame type"}
+		}
+		if n < 0 {
+			if err := c.frameErr; err != nil {
+				c.frameErr = nil
+				return false, err
+			}
+			return false, errMalformed
+		}
+		b = b[n:]
+	}
+	return ackEliciting, nil
+}
+
+// handleAckFrame processes an ACK frame, returning its length.
+func (c *Conn) handleAckFrame(now time.Time, space numberSpace, b []byte, ecn bool) int {
+	n := 1
+	next := func() (int64, bool) {
+		v, m := consumeVarintInt64(b[n:])
+		if m < 0 {
+			return 0, false
+		}
+		n += m
+		return v, true
+	}
+	largest, ok1 := next()
+	delay, ok2 := next()
+	count, ok3 := next()
+	first, ok4 := next()
+	if !ok1 || !ok2 || !ok3 || !ok4 || first > largest {
+		return -1
+	}
+	ranges := []i64range{{largest - first, largest + 1}}
+	smallest := largest - first
+	for i := int64(0); i < count; i++ {
+		gap, ok1 := next()
+		length, ok2 := next()
+		if !ok1 || !ok2 {
+			return -1
+		}
+		hi := smallest - gap - 2
+		lo := hi - length
+		if lo < 0 {
+			return -1
+		}
+		ranges = append(ranges, i64range{lo, hi + 1})
+		smallest = lo
+	}
+	if ecn {
+		for i := 0; i < 3; i++ {
+			if _, ok := next(); !ok {
+				return -1
+			}
+		}
+	}
+	if c.discarded[space] {
+		return n
+	}
+	exp := c.peerParams.ackDelayExponent
+	if !c.gotPeerParams {
+		exp = 3
+	}
+	ackDelay := time.Duration(delay<<exp) * time.Microsecond
+	if err := c.handleAck(now, space, ranges, ackDelay); err != nil {
+		c.frameErr = err
+		return -1
+	}
+	return n
+}
+
+// handleCryptoFrame processes a CRYPTO frame, returning its length.
+func (c *Conn) handleCryptoFrame(space numberSpace, b []byte) int {
+	n := 1
+	off, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	data, m := consumeVarintBytes(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	cs := &c.crypto[space]
+	if off+int64(len(data)) > cs.in.off+maxCryptoBuffer {
+		c.frameErr = localTransportError{errCryptoBufferExceeded, ""}
+		return -1
+	}
+	cs.in.write(off, data)
+	if avail := cs.in.available(); avail > 0 {
+		buf := make([]byte, avail)
+		cs.in.read(buf)
+		if err := c.tls.HandleData(levelForSpace(space), buf); err != nil {
+			c.frameErr = err
+			return -1
+		}
+		if err := c.handleTLSEventsLocked(); err != nil {
+			c.frameErr = err
+			return -1
+		}
+	}
+	return n
+}
+
+// handleStreamFrame processes a STREAM frame, returning its length.
+func (c *Conn) handleStreamFrame(b []byte, typ byte) int {
+	n := 1
+	id, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	var off int64
+	if typ&streamOffBit != 0 {
+		off, m = consumeVarintInt64(b[n:])
+		if m < 0 {
+			return -1
+		}
+		n += m
+	}
+	var data []byte
+	if typ&streamLenBit != 0 {
+		data, m = consumeVarintBytes(b[n:])
+		if m < 0 {
+			return -1
+		}
+		n += m
+	} else {
+		data = b[n:]
+		n = len(b)
+	}
+	if off+int64(len(data)) > maxVarint {
+		c.frameErr = localTransportError{errFrameEncoding, "stream offset too large"}
+		return -1
+	}
+	s, err := c.streamForFrame(id, true)
+	if err != nil {
+		c.frameErr = err
+		return -1
+	}
+	if s == nil {
+		return n
+	}
+	if err := s.handleData(off, data, typ&streamFinBit != 0); err != nil {
+		c.frameErr = err
+		return -1
+	}
+	return n
+}
+
+// handleResetStreamFrame processes a RESET_STREAM frame, returning its length.
+func (c *Conn) handleResetStreamFrame(b []byte) int {
+	n := 1
+	var vals [3]int64
+	for i := range vals {
+		v, m := consumeVarintInt64(b[n:])
+		if m < 0 {
+			return -1
+		}
+		vals[i] = v
+		n += m
+	}
+	s, err := c.streamForFrame(vals[0], true)
+	if err != nil {
+		c.frameErr = err
+		return -1
+	}
+	if s == nil {
+		return n
+	}
+	if err := s.handleReset(uint64(vals[1]), vals[2]); err != nil {
+		c.frameErr = err
+		return -1
+	}
+	return n
+}
+
+// handleStopSendingFrame processes a STOP_SENDING frame, returning its length.
+func (c *Conn) handleStopSendingFrame(b []byte) int {
+	n := 1
+	id, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	code, m := consumeVarint(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	s, err := c.streamForFrame(id, false)
+	if err != nil {
+		c.frameErr = err
+		return -1
+	}
+	if s != nil {
+		s.handleStopSending(code)
+	}
+	return n
+}
+
+// handleMaxStreamDataFrame processes a MAX_STREAM_DATA frame, returning its length.
+func (c *Conn) handleMaxStreamDataFrame(b []byte) int {
+	n := 1
+	id, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	v, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	s, err := c.streamForFrame(id, false)
+	if err != nil {
+		c.frameErr = err
+		return -1
+	}
+	if s != nil && v > s.sendMax {
+		s.sendMax = v
+	}
+	return n
+}
+
+// handleNewConnectionIDFrame processes a NEW_CONNECTION_ID frame,
+// returning its length. We only change the connection ID we send to
+// when the peer asks us to retire the one in use.
+func (c *Conn) handleNewConnectionIDFrame(b []byte) int {
+	n := 1
+	seq, m := consumeVarintInt64(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	retire, m := consumeVarintInt64(b[n:])
+	if m < 0 || retire > seq {
+		return -1
+	}
+	n += m
+	id, m := consumeUint8Bytes(b[n:])
+	if m < 0 || len(id) < 1 || len(id) > 20 {
+		return -1
+	}
+	n += m
+	if len(b) < n+16 { // stateless reset token
+		return -1
+	}
+	n += 16
+	if len(c.peerConnID) == 0 {
+		c.frameErr = localTransportError{errProtocolViolation, "NEW_CONNECTION_ID with zero-length connection ID"}
+		return -1
+	}
+	if seq <= c.peerConnIDSeq || seq < c.peerConnIDRetired {
+		if seq < c.peerConnIDRetired && seq != c.peerConnIDSeq {
+			c.retireConnIDs = append(c.retireConnIDs, seq)
+		}
+		return n
+	}
+	if c.peerConnIDs == nil {
+		c.peerConnIDs = make(map[int64][]byte)
+	}
+	c.peerConnIDs[seq] = append([]byte(nil), id...)
+	if len(c.peerConnIDs) > 2*activeConnIDLimit {
+		c.frameErr = localTransportError{errConnectionIDLimit, ""}
+		return -1
+	}
+	if retire > c.peerConnIDRetired {
+		c.peerConnIDRetired = retire
+		// Switch to the oldest connection ID that is still valid,
+		// and retire the others. See RFC 9000, Section 5.1.2.
+		if c.peerConnIDSeq < retire {
+			c.retireConnIDs = append(c.retireConnIDs, c.peerConnIDSeq)
+			next := int64(-1)
+			for s := range c.peerConnIDs {
+				if s >= retire && (next < 0 || s < next) {
+					next = s
+				}
+			}
+			c.peerConnIDSeq = next
+			c.peerConnID = c.peerConnIDs[next]
+		}
+		for s := range c.peerConnIDs {
+			if s < retire {
+				c.retireConnIDs = append(c.retireConnIDs, s)
+				delete(c.peerConnIDs, s)
+			}
+		}
+		delete(c.peerConnIDs, c.peerConnIDSeq)
+	}
+	return n
+}
+
+// handleConnectionCloseFrame processes a CONNECTION_CLOSE frame,
+// returning its length.
+func (c *Conn) handleConnectionCloseFrame(now time.Time, b []byte, isApp bool) int {
+	n := 1
+	code, m := consumeVarint(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	if !isApp {
+		_, m = consumeVarint(b[n:]) // frame type
+		if m < 0 {
+			return -1
+		}
+		n += m
+	}
+	reason, m := consumeVarintBytes(b[n:])
+	if m < 0 {
+		return -1
+	}
+	n += m
+	if isApp {
+		c.enterDrainingLocked(now, &ApplicationError{Code: code, Reason: string(reason)})
+	} else {
+		c.enterDrainingLocked(now, peerTransportError{code: transportError(code), reason: string(reason)})
+	}
+	return n
+}
@@ -0,0 +1,435 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// An outPacket is a packet being assembled for sending.
+type outPacket struct {
+	space        numberSpace
+	num          int64
+	pnLen        int
+	payload      []byte
+	frames       []sentFrame
+	ackEliciting bool
+}
+
+// longHeaderSize returns the size of a long header with a two-byte
+// Length field, not including the packet number.
+func (c *Conn) longHeaderSize(space numberSpace) int {
+	n := 1 + 4 + 1 + len(c.peerConnID) + 1 + len(c.localConnID) + 2
+	if space == initialSpace {
+		n++ // empty token
+	}
+	return n
+}
+
+// flushLocked sends as many datagrams as the connection has data for
+// and the congestion controller and anti-amplification limit permit,
+// then rearms the connection timer.
+func (c *Conn) flushLocked(now time.Time) {
+	if c.state == stateOpen || c.state == stateClosing {
+		for {
+			d := c.appendDatagram(now)
+			if d == nil {
+				break
+			}
+			c.bytesSent += int64(len(d))
+			c.endpoint.writeTo(d, c.peerAddr)
+		}
+	}
+	c.resetTimerLocked(now)
+}
+
+// appendDatagram assembles the next datagram to send, coalescing
+// packets from each packet number space with keys. It returns nil if
+// there is nothing to send.
+func (c *Conn) appendDatagram(now time.Time) []byte {
+	limit := maxDatagramSize
+	if !c.isClient && !c.addressValidated {
+		// Before the client's address is validated, the server may
+		// send at most three times the data it received.
+		// See RFC 9000, Section 8.1.
+		if budget := 3*c.bytesRecv - c.bytesSent; budget < int64(limit) {
+			return nil
+		}
+	}
+	canElicit := c.cc.canSend()
+	for _, n := range c.probes {
+		if n > 0 {
+			canElicit = true
+		}
+	}
+
+	var pkts []*outPacket
+	size := 0
+	padInitial := false
+	for space := initialSpace; space < numberSpaceCount; space++ {
+		k := c.writeKeys[space]
+		if k == nil {
+			continue
+		}
+		s := &c.spaces[space]
+		p := &outPacket{
+			space: space,
+			num:   s.nextNum,
+			pnLen: packetNumberLength(s.nextNum, s.largestAcked),
+		}
+		hdrLen := 1 + len(c.peerConnID)
+		if space != appDataSpace {
+			hdrLen = c.longHeaderSize(space)
+		}
+		max := limit - size - hdrLen - p.pnLen - aeadOverhead
+		if max < 32 {
+			break
+		}
+		if c.state == stateClosing {
+			c.appendCloseFrame(p, space)
+		} else {
+			c.appendFrames(now, p, max, canElicit)
+		}
+		if len(p.payload) == 0 {
+			continue
+		}
+		if space == initialSpace && (c.isClient || p.ackEliciting) {
+			// Datagrams containing Initial packets are padded to
+			// the minimum datagram size. See RFC 9000, Section 14.1.
+			padInitial = true
+		}
+		pkts = append(pkts, p)
+		size += hdrLen + p.pnLen + len(p.payload) + aeadOverhead
+	}
+	if c.state == stateClosing {
+		c.closePending = false
+	}
+	if len(pkts) == 0 {
+		return nil
+	}
+	if last := pkts[len(pkts)-1]; padInitial && size < maxDatagramSize {
+		n := maxDatagramSize - size
+		last.payload = append(last.payload, make([]byte, n)...)
+		size += n
+	}
+
+	d := make([]byte, 0, size+4)
+	sentHandshake := false
+	for _, p := range pkts {
+		// Header protection samples 16 bytes starting 4 bytes after the
+		// start of the packet number. See RFC 9001, Section 5.4.2.
+		if n := p.pnLen + len(p.payload); n < 4 {
+			p.payload = append(p.payload, make([]byte, 4-n)...)
+		}
+		start := len(d)
+		if p.space == appDataSpace {
+			b0 := byte(fixedBit) | byte(p.pnLen-1)
+			if c.keyPhase {
+				b0 |= keyPhaseBit
+			}
+			d = append(d, b0)
+			d = append(d, c.peerConnID...)
+		} else {
+			typ := byte(packetTypeInitial)
+			if p.space == handshakeSpace {
+				typ = packetTypeHandshake
+				sentHandshake = true
+			}
+			d = append(d, headerFormLong|fixedBit|typ<<4|byte(p.pnLen-1))
+			d = binary.BigEndian.AppendUint32(d, quicVersion1)
+			d = append(d, byte(len(c.peerConnID)))
+			d = append(d, c.peerConnID...)
+			d = append(d, byte(len(c.localConnID)))
+			d = append(d, c.localConnID...)
+			if p.space == initialSpace {
+				d = append(d, 0) // token length
+			}
+			d = appendVarint2(d, uint64(p.pnLen+len(p.payload)+aeadOverhead))
+		}
+		d = appendPacketNumber(d, p.num, p.pnLen)
+		hdrLen := len(d) - start
+		d = append(d, p.payload...)
+		d = append(d[:start], c.writeKeys[p.space].protect(d[start:], hdrLen, p.pnLen, p.num)...)
+
+		s := &c.spaces[p.space]
+		s.nextNum++
+		if p.ackEliciting {
+			c.onPacketSent(p.space, &sentPacket{
+				num:    p.num,
+				time:   now,
+				size:   len(d) - start,
+				frames: p.frames,
+			})
+			c.lastActivity = now
+			if c.probes[p.space] > 0 {
+				c.probes[p.space]--
+			}
+		}
+	}
+	if c.isClient && sentHandshake {
+		// The client discards its Initial keys when it first sends
+		// a Handshake packet. See RFC 9001, Section 4.9.1.
+		c.discardKeysLocked(initialSpace)
+	}
+	return d
+}
+
+// appendCloseFrame adds a CONNECTION_CLOSE frame to p.
+func (c *Conn) appendCloseFrame(p *outPacket, space numberSpace) {
+	if !c.closePending {
+		return
+	}
+	b := p.payload
+	switch {
+	case c.closeIsApp && space == appDataSpace:
+		b = append(b, frameTypeConnectionCloseApplication)
+		b = appendVarint(b, c.closeCode)
+		b = appendVarint(b, uint64(len(c.closeReason)))
+		b = append(b, c.closeReason...)
+	case c.closeIsApp:
+		// Application errors are not sent in Initial or Handshake
+		// packets, where they might be seen by an attacker.
+		// See RFC 9000, Section 10.2.3.
+		b = append(b, frameTypeConnectionCloseTransport)
+		b = appendVarint(b, uint64(errApplicationError))
+		b = appendVarint(b, 0) // frame type
+		b = appendVarint(b, 0) // reason
+	default:
+		reason := c.closeReason
+		if len(reason) > 256 {
+			reason = reason[:256]
+		}
+		b = append(b, frameTypeConnectionCloseTransport)
+		b = appendVarint(b, c.closeCode)
+		b = appendVarint(b, 0) // frame type
+		b = appendVarint(b, uint64(len(reason)))
+		b = append(b, reason...)
+	}
+	p.payload = b
+}
+
+// appendFrames adds frames to p, up to a total of max bytes.
+// Only ACK frames are added if canElicit is false.
+func (c *Conn) appendFrames(now time.Time, p *outPacket, max int, canElicit bool) {
+	s := &c.spaces[p.space]
+	var ack []byte
+	if len(s.recv) > 0 && s.unackedElicit+boolInt(s.ackPending) > 0 {
+		ack = c.appendAckFrame(nil, now, p.space)
+		max -= len(ack)
+	}
+	if canElicit {
+		c.appendElicitingFrames(p, max)
+		if p.ackEliciting && c.probes[p.space] == 0 && c.pingPending {
+			c.pingPending = false
+		}
+		if !p.ackEliciting && (c.probes[p.space] > 0 || c.pingPending && p.space == appDataSpace) {
+			p.payload = append(p.payload, frameTypePing)
+			p.ackEliciting = true
+			c.pingPending = false
+		}
+	}
+	sendAck := s.ackPending || p.ackEliciting ||
+		!s.ackDeadline.IsZero() && !now.Before(s.ackDeadline)
+	if ack != nil && sendAck {
+		p.payload = append(p.payload, ack...)
+		s.ackPending = false
+		s.ackDeadline = time.Time{}
+		s.unackedElicit = 0
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// appendAckFrame appends an ACK frame for the packets received in space.
+func (c *Conn) appendAckFrame(b []byte, now time.Time, space numberSpace) []byte {
+	s := &c.spaces[space]
+	last := s.recv[len(s.recv)-1]
+	var delay int64
+	if space == appDataSpace {
+		delay = now.Sub(s.largestRecvTime).Microseconds() >> ackDelayExponent
+		if delay < 0 {
+			delay = 0
+		}
+	}
+	b = append(b, frameTypeAck)
+	b = appendVarint(b, uint64(last.end-1))
+	b = appendVarint(b, uint64(delay))
+	b = appendVarint(b, uint64(len(s.recv)-1))
+	b = appendVarint(b, uint64(last.size()-1))
+	smallest := last.start
+	for i := len(s.recv) - 2; i >= 0; i-- {
+		r := s.recv[i]
+		b = appendVarint(b, uint64(smallest-r.end-1))
+		b = appendVarint(b, uint64(r.size()-1))
+		smallest = r.start
+	}
+	return b
+}
+
+// appendElicitingFrames adds ack-eliciting frames to p,
+// up to a total of max bytes.
+func (c *Conn) appendElicitingFrames(p *outPacket, max int) {
+	add := func(typ byte, f []byte, record bool, sf sentFrame) bool {
+		if len(p.payload)+len(f) > max {
+			return false
+		}
+		p.payload = append(p.payload, f...)
+		p.ackEliciting = true
+		if record {
+			sf.typ = typ
+			sf.space = p.space
+			p.frames = append(p.frames, sf)
+		}
+		return true
+	}
+
+	if p.space == appDataSpace {
+		if c.handshakeDonePending && add(frameTypeHandshakeDone, []byte{frameTypeHandshakeDone}, true, sentFrame{}) {
+			c.handshakeDonePending = false
+		}
+		for len(c.pathResponses) > 0 {
+			f := append([]byte{frameTypePathResponse}, c.pathResponses[0][:]...)
+			if !add(frameTypePathResponse, f, false, sentFrame{}) {
+				break
+			}
+			c.pathResponses = c.pathResponses[1:]
+		}
+		for len(c.retireConnIDs) > 0 {
+			seq := c.retireConnIDs[0]
+			f := appendVarint([]byte{frameTypeRetireConnectionID}, uint64(seq))
+			if !add(frameTypeRetireConnectionID, f, true, sentFrame{off: seq}) {
+				break
+			}
+			c.retireConnIDs = c.retireConnIDs[1:]
+		}
+		if c.maxDataPending {
+			f := appendVarint([]byte{frameTypeMaxData}, uint64(c.localMaxData))
+			if add(frameTypeMaxData, f, true, sentFrame{}) {
+				c.maxDataPending = false
+			}
+		}
+		for typ, pending := range c.maxStreamsPending {
+			if !pending {
+				continue
+			}
+			ft := byte(frameTypeMaxStreamsBidi + typ)
+			f := appendVarint([]byte{ft}, uint64(c.localMaxStreams[typ]))
+			if add(ft, f, true, sentFrame{}) {
+				c.maxStreamsPending[typ] = false
+			}
+		}
+		for _, s := range c.streams {
+			if s.maxStreamDataPending {
+				f := appendVarint([]byte{frameTypeMaxStreamData}, uint64(s.id))
+				f = appendVarint(f, uint64(s.recvMax))
+				if add(frameTypeMaxStreamData, f, true, sentFrame{stream: s}) {
+					s.maxStreamDataPending = false
+				}
+			}
+			if s.stopPending {
+				f := appendVarint([]byte{frameTypeStopSending}, uint64(s.id))
+				f = appendVarint(f, s.stopCode)
+				if add(frameTypeStopSending, f, true, sentFrame{stream: s}) {
+					s.stopPending = false
+				}
+			}
+			if s.resetPending {
+				f := appendVarint([]byte{frameTypeResetStream}, uint64(s.id))
+				f = appendVarint(f, s.resetCode)
+				f = appendVarint(f, uint64(s.resetFinalSize))
+				if add(frameTypeResetStream, f, true, sentFrame{stream: s}) {
+					s.resetPending = false
+				}
+			}
+		}
+	}
+
+	cs := &c.crypto[p.space]
+	for cs.out.hasLost() || cs.out.hasUnsent() {
+		room := int64(max - len(p.payload) - 1 - 8 - 2)
+		if room <= 0 {
+			break
+		}
+		var off int64
+		var data []byte
+		if cs.out.hasLost() {
+			off, data = cs.out.nextLost(room)
+		} else {
+			off, data = cs.out.nextUnsent(room)
+		}
+		f := appendVarint([]byte{frameTypeCrypto}, uint64(off))
+		f = appendVarint(f, uint64(len(data)))
+		f = append(f, data...)
+		add(frameTypeCrypto, f, true, sentFrame{off: off, n: int64(len(data))})
+	}
+
+	if p.space == appDataSpace {
+		for _, s := range c.streams {
+			if !c.appendStreamFrames(p, s, max, add) {
+				break
+			}
+		}
+	}
+}
+
+// appendStreamFrames adds STREAM frames for s to p, up to a total of
+// max bytes. It reports whether there is room left in the packet.
+func (c *Conn) appendStreamFrames(p *outPacket, s *Stream, max int, add func(byte, []byte, bool, sentFrame) bool) bool {
+	if !s.hasSend || s.resetQueued {
+		return true
+	}
+	for {
+		// A STREAM frame with the OFF and LEN bits set has a header of
+		// at most 1 + 8 + 8 + 2 bytes.
+		hdr := 1 + sizeVarint(uint64(s.id)) + 8 + 2
+		room := int64(max - len(p.payload) - hdr)
+		if room < 0 {
+			return false
+		}
+		var off int64
+		var data []byte
+		switch {
+		case s.out.hasLost():
+			if room == 0 {
+				return false
+			}
+			off, data = s.out.nextLost(room)
+		case s.out.hasUnsent():
+			flow := min64(s.sendMax-s.out.next, c.peerMaxData-c.sentData)
+			if flow <= 0 {
+				return true
+			}
+			if room == 0 {
+				return false
+			}
+			off, data = s.out.nextUnsent(min64(room, flow))
+			c.sentData += int64(len(data))
+		case s.finQueued && !s.finSent:
+			off = s.out.end()
+		default:
+			return true
+		}
+		end := off + int64(len(data))
+		fin := s.finQueued && end == s.out.end()
+		if fin {
+			s.finSent = true
+		}
+		typ := byte(frameTypeStreamBase | streamOffBit | streamLenBit)
+		if fin {
+			typ |= streamFinBit
+		}
+		f := appendVarint([]byte{typ}, uint64(s.id))
+		f = appendVarint(f, uint64(off))
+		f = appendVarint2(f, uint64(len(data)))
+		f = append(f, data...)
+		add(frameTypeStreamBase, f, true, sentFrame{stream: s, off: off, n: int64(len(data)), fin: fin})
+	}
+}
@@ -0,0 +1,492 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// localhostCert is the certificate of net/http/internal/testcert, which
+// is valid for "example.com". This package cannot import testcert, since
+// it is internal to net/http.
+var localhostCert = []byte(`-----BEGIN CERTIFICATE-----
+MIIDOTCCAiGgAwIBAgIQSRJrEpBGFc7tNb1fb5pKFzANBgkqhkiG9w0BAQsFADAS
+MRAwDgYDVQQKEwdBY21lIENvMCAXDTcwMDEwMTAwMDAwMFoYDzIwODQwMTI5MTYw
+MDAwWjASMRAwDgYDVQQKEwdBY21lIENvMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A
+MIIBCgKCAQEA6Gba5tHV1dAKouAaXO3/ebDUU4rvwCUg/CNaJ2PT5xLD4N1Vcb8r
+bFSW2HXKq+MPfVdwIKR/1DczEoAGf/JWQTW7EgzlXrCd3rlajEX2D73faWJekD0U
+aUgz5vtrTXZ90BQL7WvRICd7FlEZ6FPOcPlumiyNmzUqtwGhO+9ad1W5BqJaRI6P
+YfouNkwR6Na4TzSj5BrqUfP0FwDizKSJ0XXmh8g8G9mtwxOSN3Ru1QFc61Xyeluk
+POGKBV/q6RBNklTNe0gI8usUMlYyoC7ytppNMW7X2vodAelSu25jgx2anj9fDVZu
+h7AXF5+4nJS4AAt0n1lNY7nGSsdZas8PbQIDAQABo4GIMIGFMA4GA1UdDwEB/wQE
+AwICpDATBgNVHSUEDDAKBggrBgEFBQcDATAPBgNVHRMBAf8EBTADAQH/MB0GA1Ud
+DgQWBBStsdjh3/JCXXYlQryOrL4Sh7BW5TAuBgNVHREEJzAlggtleGFtcGxlLmNv
+bYcEfwAAAYcQAAAAAAAAAAAAAAAAAAAAATANBgkqhkiG9w0BAQsFAAOCAQEAxWGI
+5NhpF3nwwy/4yB4i/CwwSpLrWUa70NyhvprUBC50PxiXav1TeDzwzLx/o5HyNwsv
+cxv3HdkLW59i/0SlJSrNnWdfZ19oTcS+6PtLoVyISgtyN6DpkKpdG1cOkW3Cy2P2
++tK/tKHRP1Y/Ra0RiDpOAmqn0gCOFGz8+lqDIor/T7MTpibL3IxqWfPrvfVRHL3B
+grw/ZQTTIVjjh4JBSW3WyWgNo/ikC1lrVxzl4iPUGptxT36Cr7Zk2Bsg0XqwbOvK
+5d+NTDREkSnUbie4GeutujmX3Dsx88UiV6UY/4lHJa6I5leHUNOHahRbpbWeOfs/
+WkBKOclmOV2xlTVuPw==
+-----END CERTIFICATE-----`)
+
+// localhostKey is the private key for localhostCert.
+var localhostKey = []byte(strings.ReplaceAll(`-----BEGIN RSA TESTING KEY-----
+MIIEvAIBADANBgkqhkiG9w0BAQEFAASCBKYwggSiAgEAAoIBAQDoZtrm0dXV0Aqi
+4Bpc7f95sNRTiu/AJSD8I1onY9PnEsPg3VVxvytsVJbYdcqr4w99V3AgpH/UNzMS
+gAZ/8lZBNbsSDOVesJ3euVqMRfYPvd9pYl6QPRRpSDPm+2tNdn3QFAvta9EgJ3sW
+URnoU85w+W6aLI2bNSq3AaE771p3VbkGolpEjo9h+i42TBHo1rhPNKPkGupR8/QX
+AOLMpInRdeaHyDwb2a3DE5I3dG7VAVzrVfJ6W6Q84YoFX+rpEE2SVM17SAjy6xQy
+VjKgLvK2mk0xbtfa+h0B6VK7bmODHZqeP18NVm6HsBcXn7iclLgAC3SfWU1jucZK
+x1lqzw9tAgMBAAECggEABWzxS1Y2wckblnXY57Z+sl6YdmLV+gxj2r8Qib7g4ZIk
+lIlWR1OJNfw7kU4eryib4fc6nOh6O4AWZyYqAK6tqNQSS/eVG0LQTLTTEldHyVJL
+dvBe+MsUQOj4nTndZW+QvFzbcm2D8lY5n2nBSxU5ypVoKZ1EqQzytFcLZpTN7d89
+EPj0qDyrV4NZlWAwL1AygCwnlwhMQjXEalVF1ylXwU3QzyZ/6MgvF6d3SSUlh+sq
+XefuyigXw484cQQgbzopv6niMOmGP3of+yV4JQqUSb3IDmmT68XjGd2Dkxl4iPki
+6ZwXf3CCi+c+i/zVEcufgZ3SLf8D99kUGE7v7fZ6AQKBgQD1ZX3RAla9hIhxCf+O
+3D+I1j2LMrdjAh0ZKKqwMR4JnHX3mjQI6LwqIctPWTU8wYFECSh9klEclSdCa64s
+uI/GNpcqPXejd0cAAdqHEEeG5sHMDt0oFSurL4lyud0GtZvwlzLuwEweuDtvT9cJ
+Wfvl86uyO36IW8JdvUprYDctrQKBgQDycZ697qutBieZlGkHpnYWUAeImVA878sJ
+w44NuXHvMxBPz+lbJGAg8Cn8fcxNAPqHIraK+kx3po8cZGQywKHUWsxi23ozHoxo
++bGqeQb9U661TnfdDspIXia+xilZt3mm5BPzOUuRqlh4Y9SOBpSWRmEhyw76w4ZP
+OPxjWYAgwQKBgA/FehSYxeJgRjSdo+MWnK66tjHgDJE8bYpUZsP0JC4R9DL5oiaA
+brd2fI6Y+SbyeNBallObt8LSgzdtnEAbjIH8uDJqyOmknNePRvAvR6mP4xyuR+Bv
+m+Lgp0DMWTw5J9CKpydZDItc49T/mJ5tPhdFVd+am0NAQnmr1MCZ6nHxAoGABS3Y
+LkaC9FdFUUqSU8+Chkd/YbOkuyiENdkvl6t2e52jo5DVc1T7mLiIrRQi4SI8N9bN
+/3oJWCT+uaSLX2ouCtNFunblzWHBrhxnZzTeqVq4SLc8aESAnbslKL4i8/+vYZlN
+s8xtiNcSvL+lMsOBORSXzpj/4Ot8WwTkn1qyGgECgYBKNTypzAHeLE6yVadFp3nQ
+Ckq9yzvP/ib05rvgbvrne00YeOxqJ9gtTrzgh7koqJyX1L4NwdkEza4ilDWpucn0
+xiUZS4SoaJq6ZvcBYS62Yr1t8n09iG47YL8ibgtmH3L+svaotvpVxVK+d7BLevA/
+ZboOWVe3icTy64BT3OQhmg==
+-----END RSA TESTING KEY-----`, "TESTING KEY", "PRIVATE KEY"))
+
+// testTLSConfigs returns matching server and client TLS configurations
+// using localhostCert.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	cert, err := tls.X509KeyPair(localhostCert, localhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(localhostCert)
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"test"},
+	}
+	client = &tls.Config{
+		RootCAs:    roots,
+		ServerName: "example.com",
+		NextProtos: []string{"test"},
+	}
+	return server, client
+}
+
+// A lossyPacketConn drops a fraction of the datagrams written to it.
+type lossyPacketConn struct {
+	net.PacketConn
+	mu   sync.Mutex
+	rng  *mathrand.Rand
+	loss float64
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	drop := c.rng.Float64() < c.loss
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+type testPair struct {
+	server, client *Endpoint
+	serverConfig   *Config
+	clientConfig   *Config
+}
+
+// newTestPair returns a server and client endpoint on the loopback
+// interface. If loss is non-zero, each endpoint drops that fraction of
+// the datagrams it sends.
+func newTestPair(t *testing.T, loss float64, configure func(server, client *Config)) *testPair {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	p := &testPair{
+		serverConfig: &Config{TLSConfig: serverTLS},
+		clientConfig: &Config{TLSConfig: clientTLS},
+	}
+	if configure != nil {
+		configure(p.serverConfig, p.clientConfig)
+	}
+	newEndpoint := func(config *Config, seed int64) *Endpoint {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Skipf("cannot listen on loopback: %v", err)
+		}
+		if loss > 0 {
+			pc = &lossyPacketConn{PacketConn: pc, rng: mathrand.New(mathrand.NewSource(seed)), loss: loss}
+		}
+		e := NewEndpoint(pc, config)
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			e.Close(ctx)
+		})
+		return e
+	}
+	p.server = newEndpoint(p.serverConfig, 1)
+	p.client = newEndpoint(nil, 2)
+	return p
+}
+
+// connect returns a connected client and server connection.
+func (p *testPair) connect(t *testing.T) (client, server *Conn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := p.client.Dial(ctx, "udp", p.server.LocalAddr().String(), p.clientConfig)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	server, err = p.server.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	return client, server
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// echoStreams accepts streams on c and echoes their data.
+func echoStreams(ctx context.Context, c *Conn) {
+	for {
+		s, err := c.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(s, s)
+			s.Close()
+		}()
+	}
+}
+
+// roundTrip writes data to a new stream on c and returns the reply.
+func roundTrip(ctx context.Context, c *Conn, data []byte) ([]byte, error) {
+	s, err := c.NewStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.SetReadContext(ctx)
+	s.SetWriteContext(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.Write(data)
+		s.CloseWrite()
+		errc <- err
+	}()
+	got, err := io.ReadAll(s)
+	if werr := <-errc; err == nil {
+		err = werr
+	}
+	s.Close()
+	return got, err
+}
+
+func TestConnHandshake(t *testing.T) {
+	p := newTestPair(t, 0, nil)
+	client, server := p.connect(t)
+	for _, c := range []*Conn{client, server} {
+		cs := c.ConnectionState()
+		if cs.Version != tls.VersionTLS13 || cs.NegotiatedProtocol != "test" || !cs.HandshakeComplete {
+			t.Errorf("ConnectionState = version %x, protocol %q, complete %v", cs.Version, cs.NegotiatedProtocol, cs.HandshakeComplete)
+		}
+	}
+	if got, want := client.RemoteAddr().String(), p.server.LocalAddr().String(); got != want {
+		t.Errorf("client RemoteAddr = %v, want %v", got, want)
+	}
+	if got, want := server.RemoteAddr().String(), p.client.LocalAddr().String(); got != want {
+		t.Errorf("server RemoteAddr = %v, want %v", got, want)
+	}
+}
+
+func TestConnStreamEcho(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		loss float64
+		size int
+	}{
+		{"small", 0, 100},
+		{"large", 0, 1 << 20},
+		{"lossy", 0.1, 128 << 10},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestPair(t, test.loss, func(server, client *Config) {
+				// Small windows exercise flow control.
+				for _, c := range []*Config{server, client} {
+					c.MaxStreamReadBufferSize = 16 << 10
+					c.MaxConnReadBufferSize = 32 << 10
+					c.MaxStreamWriteBufferSize = 8 << 10
+				}
+			})
+			client, server := p.connect(t)
+			ctx := testContext(t)
+			go echoStreams(ctx, server)
+			data := make([]byte, test.size)
+			rand.Read(data)
+			got, err := roundTrip(ctx, client, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("echoed %v bytes, want the %v bytes sent", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestConnStreamLimit(t *testing.T) {
+	p := newTestPair(t, 0, func(server, client *Config) {
+		server.MaxBidiRemoteStreams = 2
+	})
+	client, server := p.connect(t)
+	ctx := testContext(t)
+	go echoStreams(ctx, server)
+	// Opening more streams than the limit requires the server
+	// to send MAX_STREAMS as streams are closed.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := []byte{byte(i)}
+			got, err := roundTrip(ctx, client, data)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("stream %v: roundTrip = %x, %v", i, got, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStreamReset(t *testing.T) {
+	p := newTestPair(t, 0, nil)
+	client, server := p.connect(t)
+	ctx := testContext(t)
+
+	cs, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.SetReadContext(ctx)
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(ss, buf); err != nil {
+		t.Fatal(err)
+	}
+	cs.Reset(42)
+	if _, err := ss.Read(buf); err != StreamErrorCode(42) {
+		t.Errorf("Read after peer reset: %v, want StreamErrorCode(42)", err)
+	}
+
+	// STOP_SENDING causes the peer's writes to fail.
+	ss.StopSending(7)
+	cs.SetWriteContext(ctx)
+	for {
+		_, err := cs.Write(make([]byte, 1024))
+		if err == nil {
+			continue
+		}
+		if err != StreamErrorCode(7) {
+			// The stream was already reset above, so writes
+			// fail without waiting for STOP_SENDING.
+			if err != errStreamClosed {
+				t.Errorf("Write after STOP_SENDING: %v", err)
+			}
+		}
+		break
+	}
+
+	cs2, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs2.Write([]byte("x"))
+	ss2, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss2.StopSending(7)
+	cs2.SetWriteContext(ctx)
+	for {
+		if _, err := cs2.Write(make([]byte, 1024)); err != nil {
+			if err != StreamErrorCode(7) {
+				t.Errorf("Write after STOP_SENDING: %v, want StreamErrorCode(7)", err)
+			}
+			break
+		}
+	}
+}
+
+func TestSendOnlyStream(t *testing.T) {
+	p := newTestPair(t, 0, nil)
+	client, server := p.connect(t)
+	ctx := testContext(t)
+	cs, err := client.NewSendOnlyStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read from send-only stream succeeded")
+	}
+	cs.Write([]byte("one way"))
+	cs.CloseWrite()
+	ss, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := ss.ID(); id != 2 {
+		t.Errorf("stream ID = %v, want 2", id)
+	}
+	ss.SetReadContext(ctx)
+	got, err := io.ReadAll(ss)
+	if err != nil || string(got) != "one way" {
+		t.Errorf("ReadAll = %q, %v", got, err)
+	}
+	if _, err := ss.Write([]byte("x")); err == nil {
+		t.Errorf("Write to receive-only stream succeeded")
+	}
+}
+
+func TestConnAbort(t *testing.T) {
+	p := newTestPair(t, 0, nil)
+	client, server := p.connect(t)
+	ctx := testContext(t)
+	client.Abort(&ApplicationError{Code: 3, Reason: "bye"})
+	_, err := server.AcceptStream(ctx)
+	var ae *ApplicationError
+	if !errors.As(err, &ae) || ae.Code != 3 || ae.Reason != "bye" {
+		t.Fatalf("AcceptStream after peer closed: %v, want application error 3", err)
+	}
+	if !errors.Is(err, &ApplicationError{Code: 3}) {
+		t.Errorf("errors.Is(%v, ApplicationError{Code: 3}) = false", err)
+	}
+	if _, err := client.NewStream(ctx); err != errConnClosed {
+		t.Errorf("NewStream after Abort: %v, want %v", err, errConnClosed)
+	}
+}
+
+func TestDialBadCertificate(t *testing.T) {
+	p := newTestPair(t, 0, func(server, client *Config) {
+		client.TLSConfig = client.TLSConfig.Clone()
+		client.TLSConfig.RootCAs = x509.NewCertPool()
+	})
+	ctx := testContext(t)
+	_, err := p.client.Dial(ctx, "udp", p.server.LocalAddr().String(), p.clientConfig)
+	if err == nil {
+		t.Fatal("Dial succeeded with an untrusted certificate")
+	}
+	var alert tls.AlertError
+	if !errors.As(err, &alert) {
+		t.Errorf("Dial: %v, want a TLS alert", err)
+	}
+}
+
+func TestConnIdleTimeout(t *testing.T) {
+	p := newTestPair(t, 0, func(server, client *Config) {
+		server.MaxIdleTimeout = 100 * time.Millisecond
+		client.MaxIdleTimeout = time.Hour
+	})
+	client, _ := p.connect(t)
+	ctx := testContext(t)
+	// The client uses the smaller of the two timeouts.
+	if _, err := client.AcceptStream(ctx); err != errIdleTimeout {
+		t.Fatalf("AcceptStream: %v, want %v", err, errIdleTimeout)
+	}
+}
+
+func TestConnKeepAlive(t *testing.T) {
+	p := newTestPair(t, 0, func(server, client *Config) {
+		server.MaxIdleTimeout = 100 * time.Millisecond
+		client.KeepAlivePeriod = 20 * time.Millisecond
+	})
+	client, server := p.connect(t)
+	ctx := testContext(t)
+	go echoStreams(ctx, server)
+	time.Sleep(300 * time.Millisecond)
+	if got, err := roundTrip(ctx, client, []byte("ping")); err != nil || string(got) != "ping" {
+		t.Fatalf("roundTrip after idle period = %q, %v", got, err)
+	}
+}
+
+func TestEndpointDropsDatagramFromOtherAddr(t *testing.T) {
+	p := newTestPair(t, 0, nil)
+	client, server := p.connect(t)
+	ctx := testContext(t)
+	go echoStreams(ctx, server)
+	if _, err := roundTrip(ctx, client, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	// A short header packet for the server's connection, which is
+	// counted toward its received bytes if it is processed.
+	b := make([]byte, maxDatagramSize)
+	b[0] = fixedBit
+	copy(b[1:], server.localConnID)
+	bytesRecv := func() int64 {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return server.bytesRecv
+	}
+
+	before := bytesRecv()
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: server.RemoteAddr().(*net.UDPAddr).Port}
+	p.server.handleDatagram(b, other)
+	if n := bytesRecv() - before; n >= int64(len(b)) {
+		t.Errorf("datagram from %v, not the peer, was processed", other)
+	}
+
+	before = bytesRecv()
+	p.server.handleDatagram(b, server.RemoteAddr())
+	if n := bytesRecv() - before; n < int64(len(b)) {
+		t.Errorf("datagram from the peer was not processed")
+	}
+}
+
+func TestEndpointClose(t *testing.T) {
+	p := newTestPair(t, 0, nil)
+	client, _ := p.connect(t)
+	ctx := testContext(t)
+	if err := p.server.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var ae *ApplicationError
+	if _, err := client.AcceptStream(ctx); !errors.As(err, &ae) || ae.Code != 0 {
+		t.Errorf("AcceptStream after server closed: %v, want application error 0", err)
+	}
+	if _, err := p.server.Accept(ctx); err != errEndpointClosed {
+		t.Errorf("Accept after Close: %v, want %v", err, errEndpointClosed)
+	}
+}
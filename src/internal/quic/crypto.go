@@ -0,0 +1,268 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// initialSalt is the salt used to derive Initial packet protection keys
+// for QUIC version 1. See RFC 9001, Section 5.2.
+var initialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// aeadOverhead is the size of the authentication tag of all supported AEADs.
+const aeadOverhead = 16
+
+// headerProtectionSampleSize is the size of the ciphertext sample used
+// for header protection. See RFC 9001, Section 5.4.2.
+const headerProtectionSampleSize = 16
+
+// A cipherSuite describes the packet protection algorithms negotiated
+// by a TLS 1.3 cipher suite.
+type cipherSuite struct {
+	hash   func() hash.Hash
+	keyLen int
+	aead   func(key []byte) (cipher.AEAD, error)
+	hp     func(key []byte) (headerProtector, error)
+}
+
+func cipherSuiteByID(id uint16) *cipherSuite {
+	switch id {
+	case tls.TLS_AES_128_GCM_SHA256:
+		return &cipherSuite{sha256.New, 16, newAESGCM, newAESHeaderProtector}
+	case tls.TLS_AES_256_GCM_SHA384:
+		return &cipherSuite{sha512.New384, 32, newAESGCM, newAESHeaderProtector}
+	case tls.TLS_CHACHA20_POLY1305_SHA256:
+		return &cipherSuite{sha256.New, 32, chacha20poly1305.New, newChaChaHeaderProtector}
+	}
+	return nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// A headerProtector computes the header protection mask for a sample
+// of packet ciphertext.
+type headerProtector interface {
+	mask(sample []byte) [5]byte
+}
+
+type aesHeaderProtector struct {
+	block cipher.Block
+}
+
+func newAESHeaderProtector(key []byte) (headerProtector, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesHeaderProtector{block}, nil
+}
+
+func (p aesHeaderProtector) mask(sample []byte) (m [5]byte) {
+	var buf [aes.BlockSize]byte
+	p.block.Encrypt(buf[:], sample)
+	copy(m[:], buf[:])
+	return m
+}
+
+type chachaHeaderProtector struct {
+	key []byte
+}
+
+func newChaChaHeaderProtector(key []byte) (headerProtector, error) {
+	if len(key) != chacha20.KeySize {
+		return nil, errors.New("quic: invalid ChaCha20 header protection key")
+	}
+	return chachaHeaderProtector{key}, nil
+}
+
+func (p chachaHeaderProtector) mask(sample []byte) (m [5]byte) {
+	c, err := chacha20.NewUnauthenticatedCipher(p.key, sample[4:16])
+	if err != nil {
+		panic(err)
+	}
+	c.SetCounter(binary.LittleEndian.Uint32(sample[:4]))
+	c.XORKeyStream(m[:], m[:])
+	return m
+}
+
+// A packetKey protects packets in one direction at one encryption level.
+type packetKey struct {
+	suite  *cipherSuite
+	secret []byte
+	aead   cipher.AEAD
+	iv     []byte
+	hp     headerProtector
+}
+
+// newPacketKey derives packet protection keys from a TLS traffic secret.
+func newPacketKey(suiteID uint16, secret []byte) (*packetKey, error) {
+	suite := cipherSuiteByID(suiteID)
+	if suite == nil {
+		return nil, errors.New("quic: unsupported cipher suite")
+	}
+	hpKey := hkdfExpandLabel(suite.hash, secret, "quic hp", suite.keyLen)
+	hp, err := suite.hp(hpKey)
+	if err != nil {
+		return nil, err
+	}
+	return newPacketKeyWithHP(suite, secret, hp)
+}
+
+func newPacketKeyWithHP(suite *cipherSuite, secret []byte, hp headerProtector) (*packetKey, error) {
+	key := hkdfExpandLabel(suite.hash, secret, "quic key", suite.keyLen)
+	aead, err := suite.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	return &packetKey{
+		suite:  suite,
+		secret: secret,
+		aead:   aead,
+		iv:     hkdfExpandLabel(suite.hash, secret, "quic iv", aead.NonceSize()),
+		hp:     hp,
+	}, nil
+}
+
+// next returns the key for the next key phase. The header protection
+// key is not changed by a key update. See RFC 9001, Section 6.
+func (k *packetKey) next() *packetKey {
+	secret := hkdfExpandLabel(k.suite.hash, k.secret, "quic ku", len(k.secret))
+	nk, err := newPacketKeyWithHP(k.suite, secret, k.hp)
+	if err != nil {
+		panic(err) // the same parameters worked for k
+	}
+	return nk
+}
+
+func (k *packetKey) nonce(num int64) []byte {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(num >> (8 * i))
+	}
+	return nonce
+}
+
+// protect encrypts the payload of the packet in pkt, which begins with a
+// header of length hdrLen whose packet number field has length pnLen,
+// and applies header protection. It returns the protected packet.
+func (k *packetKey) protect(pkt []byte, hdrLen, pnLen int, num int64) []byte {
+	hdr := pkt[:hdrLen]
+	pkt = k.aead.Seal(hdr, k.nonce(num), pkt[hdrLen:], hdr)
+	pnOff := hdrLen - pnLen
+	sample := pkt[pnOff+4:][:headerProtectionSampleSize]
+	mask := k.hp.mask(sample)
+	if isLongHeader(pkt[0]) {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOff+i] ^= mask[1+i]
+	}
+	return pkt
+}
+
+// unprotectHeader removes header protection from the packet in pkt,
+// whose packet number field starts at pnOff. It returns the truncated
+// packet number and its length.
+func (k *packetKey) unprotectHeader(pkt []byte, pnOff int) (truncated int64, pnLen int, ok bool) {
+	if len(pkt) < pnOff+4+headerProtectionSampleSize {
+		return 0, 0, false
+	}
+	mask := k.hp.mask(pkt[pnOff+4:][:headerProtectionSampleSize])
+	if isLongHeader(pkt[0]) {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	pnLen = int(pkt[0]&0x03) + 1
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOff+i] ^= mask[1+i]
+		truncated = truncated<<8 | int64(pkt[pnOff+i])
+	}
+	return truncated, pnLen, true
+}
+
+// open decrypts the payload of a packet whose header (including the
+// unprotected packet number) is pkt[:hdrLen].
+func (k *packetKey) open(pkt []byte, hdrLen int, num int64) ([]byte, error) {
+	hdr := pkt[:hdrLen]
+	return k.aead.Open(pkt[hdrLen:hdrLen], k.nonce(num), pkt[hdrLen:], hdr)
+}
+
+// initialKeys returns the Initial packet protection keys derived from
+// the client's original destination connection ID. See RFC 9001, Section 5.2.
+func initialKeys(cid []byte, isClient bool) (read, write *packetKey) {
+	initialSecret := hkdfExtract(sha256.New, cid, initialSalt)
+	clientSecret := hkdfExpandLabel(sha256.New, initialSecret, "client in", sha256.Size)
+	serverSecret := hkdfExpandLabel(sha256.New, initialSecret, "server in", sha256.Size)
+	client, err := newPacketKey(tls.TLS_AES_128_GCM_SHA256, clientSecret)
+	if err != nil {
+		panic(err)
+	}
+	server, err := newPacketKey(tls.TLS_AES_128_GCM_SHA256, serverSecret)
+	if err != nil {
+		panic(err)
+	}
+	if isClient {
+		return server, client
+	}
+	return client, server
+}
+
+// hkdfExtract implements HKDF-Extract from RFC 5869.
+func hkdfExtract(h func() hash.Hash, secret, salt []byte) []byte {
+	mac := hmac.New(h, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label from RFC 8446, Section 7.1,
+// with an empty context.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	const prefix = "tls13 "
+	info := make([]byte, 0, 4+len(prefix)+len(label))
+	info = append(info, byte(length>>8), byte(length))
+	info = append(info, byte(len(prefix)+len(label)))
+	info = append(info, prefix...)
+	info = append(info, label...)
+	info = append(info, 0) // context length
+
+	// HKDF-Expand, RFC 5869, Section 2.3.
+	mac := hmac.New(h, secret)
+	out := make([]byte, 0, length+mac.Size())
+	var prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac.Reset()
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
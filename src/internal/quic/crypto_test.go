@@ -0,0 +1,117 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestInitialSecrets(t *testing.T) {
+	// Test vectors from RFC 9001, Appendix A.1.
+	dcid := unhex(t, "8394c8f03e515708")
+	initial := hkdfExtract(sha256.New, dcid, initialSalt)
+	if got, want := initial, unhex(t, "7db5df06e7a69e432496adedb00851923595221596ae2ae9fb8115c1e9ed0a44"); !bytes.Equal(got, want) {
+		t.Errorf("initial_secret = %x, want %x", got, want)
+	}
+	for _, test := range []struct {
+		label       string
+		secret      string
+		key, iv, hp string
+	}{{
+		label:  "client in",
+		secret: "c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea",
+		key:    "1f369613dd76d5467730efcbe3b1a22d",
+		iv:     "fa044b2f42a3fd3b46fb255c",
+		hp:     "9f50449e04a0e810283a1e9933adedd2",
+	}, {
+		label:  "server in",
+		secret: "3c199828fd139efd216c155ad844cc81fb82fa8d7446fa7d78be803acdda951b",
+		key:    "cf3a5331653c364c88f0f379b6067e37",
+		iv:     "0ac1493ca1905853b0bba03e",
+		hp:     "c206b8d9b9f0f37644430b490eeaa314",
+	}} {
+		secret := hkdfExpandLabel(sha256.New, initial, test.label, 32)
+		if got, want := secret, unhex(t, test.secret); !bytes.Equal(got, want) {
+			t.Errorf("%v: secret = %x, want %x", test.label, got, want)
+		}
+		for _, v := range []struct {
+			label, want string
+			n           int
+		}{
+			{"quic key", test.key, 16},
+			{"quic iv", test.iv, 12},
+			{"quic hp", test.hp, 16},
+		} {
+			if got, want := hkdfExpandLabel(sha256.New, secret, v.label, v.n), unhex(t, v.want); !bytes.Equal(got, want) {
+				t.Errorf("%v: %v = %x, want %x", test.label, v.label, got, want)
+			}
+		}
+	}
+}
+
+func TestChaCha20ShortHeaderPacket(t *testing.T) {
+	// Test vector from RFC 9001, Appendix A.5.
+	secret := unhex(t, "9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b")
+	k, err := newPacketKey(tls.TLS_CHACHA20_POLY1305_SHA256, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const num = 654360564
+	pkt := unhex(t, "4200bff401")
+	got := k.protect(pkt, 4, 3, num)
+	want := unhex(t, "4cfe4189655e5cd55c41f69080575d7999c25a5bfb")
+	if !bytes.Equal(got, want) {
+		t.Fatalf("protected packet = %x, want %x", got, want)
+	}
+	truncated, pnLen, ok := k.unprotectHeader(got, 1)
+	if !ok || pnLen != 3 {
+		t.Fatalf("unprotectHeader = %x, %v, %v; want packet number length 3", truncated, pnLen, ok)
+	}
+	payload, err := k.open(got, 4, decodePacketNumber(num-1, truncated, pnLen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, []byte{0x01}) {
+		t.Errorf("payload = %x, want 01", payload)
+	}
+
+	if got, want := k.next().secret, unhex(t, "1223504755036d556342ee9361d253421a826c9ecdf3c7148684b36b714881f9"); !bytes.Equal(got, want) {
+		t.Errorf("next secret = %x, want %x", got, want)
+	}
+}
+
+func TestInitialKeysRoundTrip(t *testing.T) {
+	dcid := newConnID()
+	_, clientWrite := initialKeys(dcid, true)
+	serverRead, _ := initialKeys(dcid, false)
+	hdr := []byte{headerFormLong | fixedBit | 0x01, 0, 0, 0, 1, 0, 0, 0, 0x40, 0x15, 0x12, 0x34}
+	payload := bytes.Repeat([]byte{frameTypePing}, 5)
+	pkt := append(append([]byte{}, hdr...), payload...)
+	pkt = clientWrite.protect(pkt, len(hdr), 2, 0x1234)
+	truncated, pnLen, ok := serverRead.unprotectHeader(pkt, len(hdr)-2)
+	if !ok || pnLen != 2 || truncated != 0x1234 {
+		t.Fatalf("unprotectHeader = %x, %v, %v; want 1234, 2, true", truncated, pnLen, ok)
+	}
+	got, err := serverRead.open(pkt, len(hdr), 0x1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("payload = %x, want %x", got, payload)
+	}
+}
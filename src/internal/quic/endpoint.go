@@ -0,0 +1,310 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// An Endpoint handles QUIC traffic on a network address.
+// It can accept inbound connections or create outbound ones.
+//
+// Multiple goroutines may invoke methods on an Endpoint simultaneously.
+type Endpoint struct {
+	pc     net.PacketConn
+	config *Config // for inbound connections; nil if none are accepted
+	done   chan struct{}
+
+	mu          sync.Mutex
+	conns       map[string]*Conn // by connection ID
+	acceptQueue []*Conn
+	wake        chan struct{} // closed and replaced when the state changes
+	closed      bool
+}
+
+var errEndpointClosed = errors.New("quic: endpoint closed")
+
+// Listen listens on a local network address.
+// If config is non-nil, the endpoint accepts inbound connections.
+// The configuration config must be non-nil to accept inbound connections.
+func Listen(network, address string, config *Config) (*Endpoint, error) {
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewEndpoint(pc, config), nil
+}
+
+// NewEndpoint returns an endpoint using the packet connection pc,
+// which is closed when the endpoint is closed.
+// If config is non-nil, the endpoint accepts inbound connections.
+func NewEndpoint(pc net.PacketConn, config *Config) *Endpoint {
+	e := &Endpoint{
+		pc:     pc,
+		config: config,
+		done:   make(chan struct{}),
+		conns:  make(map[string]*Conn),
+		wake:   make(chan struct{}),
+	}
+	go e.readLoop()
+	return e
+}
+
+// LocalAddr returns the local network address.
+func (e *Endpoint) LocalAddr() net.Addr {
+	return e.pc.LocalAddr()
+}
+
+// Close closes the endpoint and all of its connections, sending each
+// peer a CONNECTION_CLOSE frame. It waits for the connections to finish
+// closing or for ctx to be done, and then closes the underlying
+// packet connection.
+func (e *Endpoint) Close(ctx context.Context) error {
+	e.mu.Lock()
+	e.closed = true
+	conns := make([]*Conn, 0, len(e.conns))
+	for _, c := range e.conns {
+		conns = append(conns, c)
+	}
+	e.wakeLocked()
+	e.mu.Unlock()
+	for _, c := range conns {
+		c.Abort(nil)
+	}
+	e.mu.Lock()
+	for len(e.conns) > 0 {
+		wake := e.wake
+		e.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+		}
+		e.mu.Lock()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	e.mu.Unlock()
+	err := e.pc.Close()
+	<-e.done
+	return err
+}
+
+func (e *Endpoint) wakeLocked() {
+	close(e.wake)
+	e.wake = make(chan struct{})
+}
+
+// Accept waits for and returns the next inbound connection
+// whose handshake has completed.
+func (e *Endpoint) Accept(ctx context.Context) (*Conn, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.acceptQueue) == 0 {
+		if e.closed {
+			return nil, errEndpointClosed
+		}
+		wake := e.wake
+		e.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+		}
+		e.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	c := e.acceptQueue[0]
+	e.acceptQueue[0] = nil
+	e.acceptQueue = e.acceptQueue[1:]
+	return c, nil
+}
+
+// Dial creates a connection to a remote address and waits
+// for its handshake to complete.
+//
+// If config.TLSConfig.ServerName is empty, the host part of address is used.
+func (e *Endpoint) Dial(ctx context.Context, network, address string, config *Config) (*Conn, error) {
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.TLSConfig == nil {
+		return nil, errors.New("quic: Config.TLSConfig is required")
+	}
+	if config.TLSConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		c := *config
+		c.TLSConfig = config.TLSConfig.Clone()
+		c.TLSConfig.ServerName = host
+		config = &c
+	}
+	dcid := newConnID()
+	c, err := newConn(e, config, true, addr, dcid, dcid)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil, errEndpointClosed
+	}
+	e.conns[string(c.localConnID)] = c
+	e.mu.Unlock()
+
+	c.mu.Lock()
+	now := time.Now()
+	if err := c.startLocked(); err != nil {
+		c.closeWithErrorLocked(now, err)
+	}
+	c.flushLocked(now)
+	c.mu.Unlock()
+	if err := c.waitHandshake(ctx); err != nil {
+		c.Abort(err)
+		return nil, err
+	}
+	return c, nil
+}
+
+// queueAccept adds a connection whose handshake has completed
+// to the accept queue.
+func (e *Endpoint) queueAccept(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.acceptQueue = append(e.acceptQueue, c)
+	e.wakeLocked()
+}
+
+// removeConn forgets a connection which has finished closing.
+func (e *Endpoint) removeConn(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range [][]byte{c.localConnID, c.origDstConnID} {
+		if e.conns[string(id)] == c {
+			delete(e.conns, string(id))
+		}
+	}
+	e.wakeLocked()
+}
+
+func (e *Endpoint) writeTo(b []byte, addr net.Addr) {
+	// Send errors are treated as packet loss.
+	e.pc.WriteTo(b, addr)
+}
+
+func (e *Endpoint) readLoop() {
+	defer close(e.done)
+	buf := make([]byte, maxUDPPayloadSize)
+	for {
+		n, addr, err := e.pc.ReadFrom(buf)
+		if err != nil {
+			e.mu.Lock()
+			closed := e.closed
+			e.closed = true
+			conns := make([]*Conn, 0, len(e.conns))
+			for _, c := range e.conns {
+				conns = append(conns, c)
+			}
+			e.wakeLocked()
+			e.mu.Unlock()
+			if closed {
+				err = errEndpointClosed
+			}
+			for _, c := range conns {
+				c.mu.Lock()
+				c.finishLocked(err)
+				c.mu.Unlock()
+			}
+			return
+		}
+		e.handleDatagram(buf[:n], addr)
+	}
+}
+
+// handleDatagram routes a datagram to the connection it is addressed to,
+// creating a new inbound connection for a client's first Initial packet.
+func (e *Endpoint) handleDatagram(b []byte, addr net.Addr) {
+	dcid, ok := dstConnIDForDatagram(b)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	c := e.conns[string(dcid)]
+	isNew := false
+	if c == nil {
+		c = e.newServerConnLocked(b, dcid, addr)
+		isNew = true
+	}
+	e.mu.Unlock()
+	if c == nil {
+		return
+	}
+	if !isNew && !sameAddr(addr, c.peerAddr) {
+		// Connections advertise disable_active_migration, so a datagram
+		// from another address is not from the peer. Drop it rather than
+		// let a sender that learned a connection ID inject packets.
+		// See RFC 9000, Section 9.
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if isNew {
+		if err := c.startLocked(); err != nil {
+			c.closeWithErrorLocked(now, err)
+			return
+		}
+	}
+	c.handleDatagramLocked(now, b)
+}
+
+// sameAddr reports whether a and b are the same network address.
+func sameAddr(a, b net.Addr) bool {
+	ua, ok1 := a.(*net.UDPAddr)
+	ub, ok2 := b.(*net.UDPAddr)
+	if ok1 && ok2 {
+		return ua.IP.Equal(ub.IP) && ua.Port == ub.Port && ua.Zone == ub.Zone
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// newServerConnLocked creates an inbound connection for the datagram b,
+// if b begins with a valid client Initial packet.
+func (e *Endpoint) newServerConnLocked(b, dcid []byte, addr net.Addr) *Conn {
+	if e.config == nil || e.closed {
+		return nil
+	}
+	// The client's first Initial packet must be in a datagram of at least
+	// 1200 bytes, with a destination connection ID of at least 8 bytes.
+	// See RFC 9000, Sections 7.2 and 14.1.
+	if len(b) < maxDatagramSize || !isLongHeader(b[0]) || (b[0]>>4)&0x03 != packetTypeInitial {
+		return nil
+	}
+	if binary.BigEndian.Uint32(b[1:5]) != quicVersion1 || len(dcid) < 8 {
+		return nil
+	}
+	scid, n := consumeUint8Bytes(b[6+len(dcid):])
+	if n < 0 {
+		return nil
+	}
+	origDstConnID := append([]byte(nil), dcid...)
+	c, err := newConn(e, e.config, false, addr, origDstConnID, append([]byte(nil), scid...))
+	if err != nil {
+		return nil
+	}
+	c.gotPeerConnID = true
+	e.conns[string(c.localConnID)] = c
+	e.conns[string(origDstConnID)] = c
+	return c
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A transportError is a transport error code from RFC 9000, Section 20.1.
+type transportError uint64
+
+const (
+	errNo                   = transportError(0x00)
+	errInternal             = transportError(0x01)
+	errConnectionRefused    = transportError(0x02)
+	errFlowControl          = transportError(0x03)
+	errStreamLimit          = transportError(0x04)
+	errStreamState          = transportError(0x05)
+	errFinalSize            = transportError(0x06)
+	errFrameEncoding        = transportError(0x07)
+	errTransportParameter   = transportError(0x08)
+	errConnectionIDLimit    = transportError(0x09)
+	errProtocolViolation    = transportError(0x0a)
+	errInvalidToken         = transportError(0x0b)
+	errApplicationError     = transportError(0x0c)
+	errCryptoBufferExceeded = transportError(0x0d)
+	errKeyUpdateError       = transportError(0x0e)
+	errAEADLimitReached     = transportError(0x0f)
+	errNoViablePath         = transportError(0x10)
+	errTLSBase              = transportError(0x0100) // 0x0100-0x01ff; base + TLS alert code
+)
+
+func (e transportError) String() string {
+	switch e {
+	case errNo:
+		return "NO_ERROR"
+	case errInternal:
+		return "INTERNAL_ERROR"
+	case errConnectionRefused:
+		return "CONNECTION_REFUSED"
+	case errFlowControl:
+		return "FLOW_CONTROL_ERROR"
+	case errStreamLimit:
+		return "STREAM_LIMIT_ERROR"
+	case errStreamState:
+		return "STREAM_STATE_ERROR"
+	case errFinalSize:
+		return "FINAL_SIZE_ERROR"
+	case errFrameEncoding:
+		return "FRAME_ENCODING_ERROR"
+	case errTransportParameter:
+		return "TRANSPORT_PARAMETER_ERROR"
+	case errConnectionIDLimit:
+		return "CONNECTION_ID_LIMIT_ERROR"
+	case errProtocolViolation:
+		return "PROTOCOL_VIOLATION"
+	case errInvalidToken:
+		return "INVALID_TOKEN"
+	case errApplicationError:
+		return "APPLICATION_ERROR"
+	case errCryptoBufferExceeded:
+		return "CRYPTO_BUFFER_EXCEEDED"
+	case errKeyUpdateError:
+		return "KEY_UPDATE_ERROR"
+	case errAEADLimitReached:
+		return "AEAD_LIMIT_REACHED"
+	case errNoViablePath:
+		return "NO_VIABLE_PATH"
+	}
+	if e >= 0x0100 && e <= 0x01ff {
+		return fmt.Sprintf("CRYPTO_ERROR(%v)", uint64(e)&0xff)
+	}
+	return fmt.Sprintf("ERROR %d", uint64(e))
+}
+
+// A localTransportError is a transport error detected by this endpoint,
+// which is sent to the peer in a CONNECTION_CLOSE frame.
+type localTransportError struct {
+	code   transportError
+	reason string
+}
+
+func (e localTransportError) Error() string {
+	if e.reason == "" {
+		return fmt.Sprintf("quic: closed connection with %v", e.code)
+	}
+	return fmt.Sprintf("quic: closed connection with %v: %v", e.code, e.reason)
+}
+
+// A peerTransportError is a transport error sent by the peer
+// in a CONNECTION_CLOSE frame.
+type peerTransportError struct {
+	code   transportError
+	reason string
+}
+
+func (e peerTransportError) Error() string {
+	return fmt.Sprintf("quic: peer closed connection with %v: %q", e.code, e.reason)
+}
+
+// A StreamErrorCode is an application protocol error code (RFC 9000,
+// Section 20.2) indicating why a stream is being closed.
+//
+// Reads from a stream reset by the peer and writes to a stream the peer
+// asked to stop sending return the peer's StreamErrorCode.
+type StreamErrorCode uint64
+
+func (e StreamErrorCode) Error() string {
+	return fmt.Sprintf("quic: stream error code %v", uint64(e))
+}
+
+// An ApplicationError is an application protocol error code (RFC 9000,
+// Section 20.2) indicating why a connection is being closed.
+//
+// Operations on a connection closed by the peer with an application
+// error return an *ApplicationError. Conn.Abort sends one to the peer.
+type ApplicationError struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *ApplicationError) Error() string {
+	return fmt.Sprintf("quic: application error %v: %q", e.Code, e.Reason)
+}
+
+// Is reports whether target is an *ApplicationError with the same code.
+func (e *ApplicationError) Is(target error) bool {
+	e2, ok := target.(*ApplicationError)
+	return ok && e2.Code == e.Code
+}
+
+var (
+	// errIdleTimeout is returned by operations on connections
+	// closed due to an idle timeout.
+	errIdleTimeout = errors.New("quic: connection closed due to idle timeout")
+
+	// errConnClosed is returned by operations on a connection
+	// closed locally.
+	errConnClosed = errors.New("quic: connection closed")
+
+	// errStreamClosed is returned by operations on a stream
+	// closed locally in the direction of the operation.
+	errStreamClosed = errors.New("quic: stream closed")
+)
@@ -0,0 +1,368 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "time"
+
+// spaceState is the per-packet number space state of a connection.
+type spaceState struct {
+	// Sending.
+	nextNum       int64
+	sent          []*sentPacket // unacknowledged ack-eliciting packets, by number
+	largestAcked  int64
+	lossTime      time.Time
+	lastAckElicit time.Time
+
+	// Receiving.
+	recv            rangeset // received packet numbers not yet forgotten
+	recvFloor       int64    // packets below this are treated as duplicates
+	largestRecv     int64
+	largestRecvTime time.Time
+	ackPending      bool      // an ACK frame should be sent now
+	ackDeadline     time.Time // an ACK frame should be sent at this time
+	unackedElicit   int       // ack-eliciting packets received since the last ACK
+}
+
+// maxAckRanges is the maximum number of ranges of received packet numbers
+// we track. Packets older than the oldest range are dropped as duplicates.
+const maxAckRanges = 32
+
+// A sentPacket is an ack-eliciting packet that has been sent
+// but not yet acknowledged or declared lost.
+type sentPacket struct {
+	num    int64
+	time   time.Time
+	size   int
+	frames []sentFrame
+}
+
+// A sentFrame records a frame that must be retransmitted if lost,
+// or whose acknowledgement changes the state of the connection.
+type sentFrame struct {
+	typ    byte
+	stream *Stream
+	off    int64 // CRYPTO and STREAM frames; sequence number for RETIRE_CONNECTION_ID
+	n      int64
+	fin    bool
+	space  numberSpace
+}
+
+// rttState is the RTT estimate of RFC 9002, Section 5.
+type rttState struct {
+	latest    time.Duration
+	min       time.Duration
+	smoothed  time.Duration
+	variance  time.Duration
+	hasSample bool
+}
+
+const initialRTT = 333 * time.Millisecond
+
+func (r *rttState) init() {
+	r.smoothed = initialRTT
+	r.variance = initialRTT / 2
+}
+
+func (r *rttState) update(sample, ackDelay, maxAckDelay time.Duration, confirmed bool) {
+	r.latest = sample
+	if !r.hasSample {
+		r.hasSample = true
+		r.min = sample
+		r.smoothed = sample
+		r.variance = sample / 2
+		return
+	}
+	if sample < r.min {
+		r.min = sample
+	}
+	if confirmed && ackDelay > maxAckDelay {
+		ackDelay = maxAckDelay
+	}
+	adjusted := sample
+	if sample >= r.min+ackDelay {
+		adjusted -= ackDelay
+	}
+	d := r.smoothed - adjusted
+	if d < 0 {
+		d = -d
+	}
+	r.variance = (3*r.variance + d) / 4
+	r.smoothed = (7*r.smoothed + adjusted) / 8
+}
+
+// pto returns the probe timeout period, without backoff.
+func (r *rttState) pto(maxAckDelay time.Duration) time.Duration {
+	v := 4 * r.variance
+	if v < timerGranularity {
+		v = timerGranularity
+	}
+	return r.smoothed + v + maxAckDelay
+}
+
+// lossDelay returns the time threshold for declaring a packet lost.
+// See RFC 9002, Section 6.1.2.
+func (r *rttState) lossDelay() time.Duration {
+	d := r.smoothed
+	if r.latest > d {
+		d = r.latest
+	}
+	d = d * 9 / 8
+	if d < timerGranularity {
+		d = timerGranularity
+	}
+	return d
+}
+
+// congestionState implements the NewReno congestion controller
+// of RFC 9002, Section 7.
+type congestionState struct {
+	cwnd          int
+	ssthresh      int
+	bytesInFlight int
+	recoveryStart time.Time
+}
+
+const minCongestionWindow = 2 * maxDatagramSize
+
+func (cc *congestionState) init() {
+	cc.cwnd = 10 * maxDatagramSize
+	cc.ssthresh = 1<<31 - 1
+}
+
+func (cc *congestionState) canSend() bool {
+	return cc.bytesInFlight+maxDatagramSize <= cc.cwnd
+}
+
+func (cc *congestionState) onSent(p *sentPacket) {
+	cc.bytesInFlight += p.size
+}
+
+func (cc *congestionState) discard(p *sentPacket) {
+	cc.bytesInFlight -= p.size
+}
+
+func (cc *congestionState) onAcked(p *sentPacket) {
+	cc.bytesInFlight -= p.size
+	if !p.time.After(cc.recoveryStart) {
+		return
+	}
+	if cc.cwnd < cc.ssthresh {
+		cc.cwnd += p.size
+	} else {
+		cc.cwnd += maxDatagramSize * p.size / cc.cwnd
+	}
+}
+
+func (cc *congestionState) onLost(now time.Time, p *sentPacket) {
+	cc.bytesInFlight -= p.size
+	if !p.time.After(cc.recoveryStart) {
+		return
+	}
+	cc.recoveryStart = now
+	cc.cwnd /= 2
+	if cc.cwnd < minCongestionWindow {
+		cc.cwnd = minCongestionWindow
+	}
+	cc.ssthresh = cc.cwnd
+}
+
+// onPacketSent records an ack-eliciting packet.
+func (c *Conn) onPacketSent(space numberSpace, p *sentPacket) {
+	s := &c.spaces[space]
+	s.sent = append(s.sent, p)
+	s.lastAckElicit = p.time
+	c.lastAckElicit = p.time
+	c.cc.onSent(p)
+}
+
+// handleAck processes the ranges of an ACK frame, ordered from largest
+// to smallest.
+func (c *Conn) handleAck(now time.Time, space numberSpace, ranges []i64range, ackDelay time.Duration) error {
+	s := &c.spaces[space]
+	largest := ranges[0].end - 1
+	if largest >= s.nextNum {
+		return localTransportError{errProtocolViolation, "acknowledgement of unsent packet"}
+	}
+	acked := func(num int64) bool {
+		for _, r := range ranges {
+			if num >= r.start && num < r.end {
+				return true
+			}
+		}
+		return false
+	}
+	var newlyAcked []*sentPacket
+	kept := s.sent[:0]
+	for _, p := range s.sent {
+		if acked(p.num) {
+			newlyAcked = append(newlyAcked, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+	if largest > s.largestAcked {
+		s.largestAcked = largest
+	}
+	if len(newlyAcked) == 0 {
+		return nil
+	}
+	if last := newlyAcked[len(newlyAcked)-1]; last.num == largest {
+		if space != appDataSpace {
+			ackDelay = 0
+		}
+		c.rtt.update(now.Sub(last.time), ackDelay, c.peerParams.maxAckDelay, c.handshakeConfirmed)
+	}
+	for _, p := range newlyAcked {
+		c.cc.onAcked(p)
+		for _, f := range p.frames {
+			c.onFrameAcked(f)
+		}
+	}
+	c.detectLost(now, space)
+	c.ptoCount = 0
+	return nil
+}
+
+// detectLost declares packets lost as described in RFC 9002, Section 6.1.
+func (c *Conn) detectLost(now time.Time, space numberSpace) {
+	s := &c.spaces[space]
+	s.lossTime = time.Time{}
+	lossDelay := c.rtt.lossDelay()
+	var lost []*sentPacket
+	kept := s.sent[:0]
+	for _, p := range s.sent {
+		if p.num > s.largestAcked {
+			kept = append(kept, p)
+			continue
+		}
+		const packetThreshold = 3
+		if s.largestAcked-p.num >= packetThreshold || !p.time.After(now.Add(-lossDelay)) {
+			lost = append(lost, p)
+			continue
+		}
+		if t := p.time.Add(lossDelay); s.lossTime.IsZero() || t.Before(s.lossTime) {
+			s.lossTime = t
+		}
+		kept = append(kept, p)
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+	for _, p := range lost {
+		c.cc.onLost(now, p)
+		for _, f := range p.frames {
+			c.onFrameLost(f)
+		}
+	}
+}
+
+// lossDetectionTimer returns the time of the next loss detection
+// or probe timeout, and the packet number space it applies to.
+// See RFC 9002, Section 6.2.
+func (c *Conn) lossDetectionTimer() (time.Time, numberSpace) {
+	var t time.Time
+	var space numberSpace
+	for sp := initialSpace; sp < numberSpaceCount; sp++ {
+		if lt := c.spaces[sp].lossTime; !lt.IsZero() && (t.IsZero() || lt.Before(t)) {
+			t, space = lt, sp
+		}
+	}
+	if !t.IsZero() {
+		return t, space
+	}
+	backoff := time.Duration(1) << c.ptoCount
+	inFlight := false
+	for sp := initialSpace; sp < numberSpaceCount; sp++ {
+		s := &c.spaces[sp]
+		if len(s.sent) == 0 {
+			continue
+		}
+		inFlight = true
+		if sp == appDataSpace && !c.handshakeComplete {
+			continue
+		}
+		var maxAckDelay time.Duration
+		if sp == appDataSpace {
+			maxAckDelay = c.peerParams.maxAckDelay
+		}
+		pt := s.lastAckElicit.Add(backoff * c.rtt.pto(maxAckDelay))
+		if t.IsZero() || pt.Before(t) {
+			t, space = pt, sp
+		}
+	}
+	if !inFlight && c.isClient && !c.handshakeConfirmed && c.state == stateOpen {
+		// The client must keep probing until the handshake is confirmed,
+		// to avoid a deadlock if the server is blocked by the
+		// anti-amplification limit. See RFC 9002, Section 6.2.2.1.
+		space = initialSpace
+		if c.writeKeys[handshakeSpace] != nil {
+			space = handshakeSpace
+		}
+		t = c.lastAckElicit.Add(backoff * c.rtt.pto(0))
+	}
+	return t, space
+}
+
+// onLossDetectionTimeout handles the expiration of the loss detection timer.
+func (c *Conn) onLossDetectionTimeout(now time.Time, space numberSpace) {
+	if !c.spaces[space].lossTime.IsZero() {
+		c.detectLost(now, space)
+		return
+	}
+	// Probe timeout: retransmit all unacknowledged data in the space,
+	// without waiting for it to be declared lost.
+	c.ptoCount++
+	for _, p := range c.spaces[space].sent {
+		for _, f := range p.frames {
+			c.onFrameLost(f)
+		}
+	}
+	c.probes[space] = 2
+}
+
+// onFrameAcked updates state for an acknowledged frame.
+func (c *Conn) onFrameAcked(f sentFrame) {
+	switch f.typ {
+	case frameTypeCrypto:
+		c.crypto[f.space].out.ack(f.off, f.n)
+	case frameTypeStreamBase:
+		f.stream.onDataAcked(f.off, f.n, f.fin)
+	case frameTypeResetStream:
+		f.stream.onResetAcked()
+	}
+}
+
+// onFrameLost schedules the retransmission of a lost frame.
+func (c *Conn) onFrameLost(f sentFrame) {
+	switch f.typ {
+	case frameTypeCrypto:
+		if !c.discarded[f.space] {
+			c.crypto[f.space].out.markLost(f.off, f.n)
+		}
+	case frameTypeStreamBase:
+		f.stream.onDataLost(f.off, f.n, f.fin)
+	case frameTypeResetStream:
+		f.stream.onResetLost()
+	case frameTypeStopSending:
+		f.stream.onStopSendingLost()
+	case frameTypeMaxStreamData:
+		f.stream.onMaxStreamDataLost()
+	case frameTypeMaxData:
+		c.maxDataPending = true
+	case frameTypeMaxStreamsBidi:
+		c.maxStreamsPending[bidiStream] = true
+	case frameTypeMaxStreamsUni:
+		c.maxStreamsPending[uniStream] = true
+	case frameTypeHandshakeDone:
+		c.handshakeDonePending = true
+	case frameTypeRetireConnectionID:
+		c.retireConnIDs = append(c.retireConnIDs, f.off)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quic implements the QUIC transport protocol, as described in
+// RFC 9000, using the TLS 1.3 handshake provided by crypto/tls (RFC 9001)
+// and the loss detection and congestion control of RFC 9002.
+//
+// It is a minimal implementation intended for HTTP/3 in net/http.
+// Only QUIC version 1 is supported. 0-RTT, Retry packets, version
+// negotiation, connection migration, stateless resets and path MTU
+// discovery are not implemented; every datagram is at most 1200 bytes.
+package quic
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// A Config structure is used to configure a QUIC endpoint or connection.
+// A Config may be reused; the quic package will not modify it.
+type Config struct {
+	// TLSConfig is the endpoint's TLS configuration.
+	// It must be non-nil, and its MinVersion must be at least tls.VersionTLS13.
+	// Server configurations must include a certificate.
+	TLSConfig *tls.Config
+
+	// MaxBidiRemoteStreams limits the number of simultaneous bidirectional
+	// streams a peer may open. If zero, the default is 100.
+	MaxBidiRemoteStreams int64
+
+	// MaxUniRemoteStreams limits the number of simultaneous unidirectional
+	// streams a peer may open. If zero, the default is 100.
+	MaxUniRemoteStreams int64
+
+	// MaxStreamReadBufferSize is the maximum amount of data sent by the peer
+	// that a stream will buffer before it is read by the application.
+	// If zero, the default is 1MiB.
+	MaxStreamReadBufferSize int64
+
+	// MaxStreamWriteBufferSize is the maximum amount of data a stream will
+	// buffer for sending to the peer before Write blocks.
+	// If zero, the default is 1MiB.
+	MaxStreamWriteBufferSize int64
+
+	// MaxConnReadBufferSize is the maximum amount of data sent by the peer
+	// that a connection will buffer across all of its streams.
+	// If zero, the default is 1MiB.
+	MaxConnReadBufferSize int64
+
+	// MaxIdleTimeout is the maximum time before an idle connection is closed.
+	// The effective timeout is the smaller of the two endpoints' values.
+	// If zero, the default is 30 seconds. If negative, there is no timeout.
+	MaxIdleTimeout time.Duration
+
+	// KeepAlivePeriod is the time after which a packet is sent to keep an
+	// idle connection alive. If zero, keep-alive packets are not sent.
+	KeepAlivePeriod time.Duration
+}
+
+func (c *Config) maxBidiRemoteStreams() int64 {
+	return configDefault(c.MaxBidiRemoteStreams, 100)
+}
+
+func (c *Config) maxUniRemoteStreams() int64 {
+	return configDefault(c.MaxUniRemoteStreams, 100)
+}
+
+func (c *Config) maxStreamReadBufferSize() int64 {
+	return configDefault(c.MaxStreamReadBufferSize, 1<<20)
+}
+
+func (c *Config) maxStreamWriteBufferSize() int64 {
+	return configDefault(c.MaxStreamWriteBufferSize, 1<<20)
+}
+
+func (c *Config) maxConnReadBufferSize() int64 {
+	return configDefault(c.MaxConnReadBufferSize, 1<<20)
+}
+
+func (c *Config) maxIdleTimeout() time.Duration {
+	switch {
+	case c.MaxIdleTimeout < 0:
+		return 0
+	case c.MaxIdleTimeout == 0:
+		return 30 * time.Second
+	}
+	return c.MaxIdleTimeout
+}
+
+func configDefault(v, def int64) int64 {
+	if v <= 0 {
+		return def
+	}
+	return min64(v, maxVarint)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+const (
+	// quicVersion1 is the only supported version, QUIC version 1 (RFC 9000).
+	quicVersion1 = 1
+
+	// connIDLen is the length of the connection IDs chosen by this package.
+	connIDLen = 8
+
+	// maxDatagramSize is the maximum size of the UDP datagrams we send.
+	// RFC 9000, Section 14 requires that all paths support at least
+	// 1200 bytes, and we never attempt to discover a larger size.
+	maxDatagramSize = 1200
+
+	// maxUDPPayloadSize is the maximum size of datagrams we accept.
+	maxUDPPayloadSize = 1472
+
+	// ackDelayExponent and maxAckDelay are the values of the corresponding
+	// transport parameters we send.
+	ackDelayExponent = 3
+	maxAckDelay      = 25 * time.Millisecond
+
+	// activeConnIDLimit is the number of connection IDs issued by the
+	// peer we are willing to store.
+	activeConnIDLimit = 2
+
+	// timerGranularity is the kGranularity of RFC 9002, Section 6.1.2.
+	timerGranularity = time.Millisecond
+)
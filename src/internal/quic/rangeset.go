@@ -0,0 +1,130 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+// An i64range is the half-open range [start, end).
+type i64range struct {
+	start, end int64
+}
+
+func (r i64range) size() int64 { return r.end - r.start }
+
+// A rangeset is a set of int64s, stored as an ordered list of
+// non-overlapping, non-adjacent ranges.
+type rangeset []i64range
+
+// add adds [start, end) to the set.
+func (s *rangeset) add(start, end int64) {
+	if start >= end {
+		return
+	}
+	rs := *s
+	// Find the first range that ends at or after start.
+	i := 0
+	for i < len(rs) && rs[i].end < start {
+		i++
+	}
+	// Find the first range that starts after end.
+	j := i
+	for j < len(rs) && rs[j].start <= end {
+		j++
+	}
+	if i == j {
+		// No overlap: insert a new range.
+		rs = append(rs, i64range{})
+		copy(rs[i+1:], rs[i:])
+		rs[i] = i64range{start, end}
+		*s = rs
+		return
+	}
+	// Merge with rs[i:j].
+	if rs[i].start < start {
+		start = rs[i].start
+	}
+	if rs[j-1].end > end {
+		end = rs[j-1].end
+	}
+	rs[i] = i64range{start, end}
+	*s = append(rs[:i+1], rs[j:]...)
+}
+
+// sub removes [start, end) from the set.
+func (s *rangeset) sub(start, end int64) {
+	if start >= end {
+		return
+	}
+	rs := *s
+	out := rs[:0:0]
+	for _, r := range rs {
+		if r.end <= start || r.start >= end {
+			out = append(out, r)
+			continue
+		}
+		if r.start < start {
+			out = append(out, i64range{r.start, start})
+		}
+		if r.end > end {
+			out = append(out, i64range{end, r.end})
+		}
+	}
+	*s = out
+}
+
+// contains reports whether v is in the set.
+func (s rangeset) contains(v int64) bool {
+	for _, r := range s {
+		if v < r.start {
+			return false
+		}
+		if v < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// containsRange reports whether all of [start, end) is in the set.
+func (s rangeset) containsRange(start, end int64) bool {
+	if start >= end {
+		return true
+	}
+	for _, r := range s {
+		if start < r.start {
+			return false
+		}
+		if end <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// min returns the smallest value in the set, or 0 if the set is empty.
+func (s rangeset) min() int64 {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[0].start
+}
+
+// max returns the largest value in the set, or -1 if the set is empty.
+func (s rangeset) max() int64 {
+	if len(s) == 0 {
+		return -1
+	}
+	return s[len(s)-1].end - 1
+}
+
+// removeBefore removes all values less than v from the set.
+func (s *rangeset) removeBefore(v int64) {
+	rs := *s
+	for len(rs) > 0 && rs[0].end <= v {
+		rs = rs[1:]
+	}
+	if len(rs) > 0 && rs[0].start < v {
+		rs[0].start = v
+	}
+	*s = rs
+}
@@ -0,0 +1,552 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// A Stream is an ordered byte stream within a QUIC connection.
+//
+// Streams are not safe for concurrent reads or concurrent writes,
+// but one goroutine may read while another writes.
+type Stream struct {
+	id   int64
+	conn *Conn
+
+	// The following fields are guarded by conn.mu.
+
+	readCtx  context.Context
+	writeCtx context.Context
+	hasRecv  bool // the stream has a receiving part
+	hasSend  bool // the stream has a sending part
+	retired  bool // the stream has been removed from the connection
+
+	// Receiving.
+	in                   recvBuffer
+	recvHighest          int64 // highest offset received
+	recvMax              int64 // MAX_STREAM_DATA sent to the peer
+	consumed             int64 // data counted as read for connection flow control
+	finalSize            int64 // -1 until known
+	resetRecvd           bool
+	resetRecvdCode       uint64
+	stopSending          bool // the reading side was closed locally
+	stopCode             uint64
+	stopPending          bool // a STOP_SENDING frame must be sent
+	maxStreamDataPending bool // a MAX_STREAM_DATA frame must be sent
+
+	// Sending.
+	out            sendBuffer
+	sendMax        int64 // peer's MAX_STREAM_DATA
+	finQueued      bool  // CloseWrite was called
+	finSent        bool  // the FIN bit has been sent and not lost
+	finAcked       bool
+	resetQueued    bool // the sending part was reset
+	resetCode      uint64
+	resetFinalSize int64
+	resetPending   bool // a RESET_STREAM frame must be sent
+	resetAcked     bool
+	peerStopped    bool // the peer sent STOP_SENDING
+	peerStopCode   uint64
+}
+
+// Stream IDs encode the initiator and direction in their low bits.
+// See RFC 9000, Section 2.1.
+const (
+	streamServerBit = 0x01
+	streamUniBit    = 0x02
+)
+
+func streamType(id int64) int {
+	if id&streamUniBit != 0 {
+		return uniStream
+	}
+	return bidiStream
+}
+
+// isLocal reports whether the stream with the given ID was initiated by c.
+func (c *Conn) isLocal(id int64) bool {
+	return (id&streamServerBit == 0) == c.isClient
+}
+
+func (c *Conn) newStreamLocked(id int64) *Stream {
+	s := &Stream{
+		id:        id,
+		conn:      c,
+		readCtx:   context.Background(),
+		writeCtx:  context.Background(),
+		finalSize: -1,
+		recvMax:   c.config.maxStreamReadBufferSize(),
+	}
+	local := c.isLocal(id)
+	switch {
+	case streamType(id) == bidiStream:
+		s.hasRecv, s.hasSend = true, true
+		if local {
+			s.sendMax = c.peerParams.initialMaxStreamDataBidiRemote
+		} else {
+			s.sendMax = c.peerParams.initialMaxStreamDataBidiLocal
+		}
+	case local:
+		s.hasSend = true
+		s.sendMax = c.peerParams.initialMaxStreamDataUni
+	default:
+		s.hasRecv = true
+	}
+	c.streams[id] = s
+	return s
+}
+
+// NewStream creates a bidirectional stream, waiting for the handshake
+// to complete and for the peer to permit another stream if necessary.
+//
+// The peer is not told about the stream until data is written to it.
+func (c *Conn) NewStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, bidiStream)
+}
+
+// NewSendOnlyStream creates a unidirectional stream, waiting for the
+// handshake to complete and for the peer to permit another stream if
+// necessary.
+func (c *Conn) NewSendOnlyStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, uniStream)
+}
+
+func (c *Conn) newLocalStream(ctx context.Context, typ int) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.waitLocked(ctx, func() bool {
+		return c.err != nil || c.handshakeComplete && c.localStreams[typ] < c.peerMaxStreams[typ]
+	}); err != nil {
+		return nil, err
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	id := c.localStreams[typ]<<2 | int64(typ)<<1
+	if !c.isClient {
+		id |= streamServerBit
+	}
+	c.localStreams[typ]++
+	return c.newStreamLocked(id), nil
+}
+
+// AcceptStream waits for and returns the next stream opened by the peer.
+func (c *Conn) AcceptStream(ctx context.Context) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.waitLocked(ctx, func() bool {
+		return c.err != nil || len(c.acceptQueue) > 0
+	}); err != nil {
+		return nil, err
+	}
+	if len(c.acceptQueue) == 0 {
+		return nil, c.err
+	}
+	s := c.acceptQueue[0]
+	c.acceptQueue[0] = nil
+	c.acceptQueue = c.acceptQueue[1:]
+	return s, nil
+}
+
+// streamForFrame returns the stream with the given ID, creating streams
+// opened by the peer as necessary. recvFrame reports whether the frame
+// applies to the receiving part of the stream. It returns a nil stream
+// if the stream has been retired.
+func (c *Conn) streamForFrame(id int64, recvFrame bool) (*Stream, error) {
+	local := c.isLocal(id)
+	typ := streamType(id)
+	if typ == uniStream && local == recvFrame {
+		return nil, localTransportError{errStreamState, "frame for the wrong direction of a unidirectional stream"}
+	}
+	num := id >> 2
+	if local {
+		if num >= c.localStreams[typ] {
+			return nil, localTransportError{errStreamState, "frame for a stream that has not been opened"}
+		}
+		return c.streams[id], nil
+	}
+	if num >= c.localMaxStreams[typ] {
+		return nil, localTransportError{errStreamLimit, ""}
+	}
+	for c.peerStreams[typ] <= num {
+		nid := c.peerStreams[typ]<<2 | id&3
+		c.peerStreams[typ]++
+		c.acceptQueue = append(c.acceptQueue, c.newStreamLocked(nid))
+	}
+	return c.streams[id], nil
+}
+
+// ID returns the QUIC stream ID of s.
+func (s *Stream) ID() int64 {
+	return s.id
+}
+
+// SetReadContext sets the context used by future reads.
+// Reads return ctx.Err() when ctx is done.
+func (s *Stream) SetReadContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	s.readCtx = ctx
+}
+
+// SetWriteContext sets the context used by future writes.
+// Writes return ctx.Err() when ctx is done.
+func (s *Stream) SetWriteContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	s.writeCtx = ctx
+}
+
+// Read reads data from the stream.
+// It returns io.EOF after all data sent by the peer has been read,
+// and a StreamErrorCode if the peer reset the stream.
+func (s *Stream) Read(b []byte) (int, error) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.hasRecv {
+		return 0, errors.New("quic: read from send-only stream")
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err := c.waitLocked(s.readCtx, func() bool {
+		return s.in.available() > 0 || s.in.off == s.finalSize ||
+			s.resetRecvd || s.stopSending || c.err != nil
+	}); err != nil {
+		return 0, err
+	}
+	switch {
+	case s.stopSending:
+		return 0, errStreamClosed
+	case s.resetRecvd:
+		return 0, StreamErrorCode(s.resetRecvdCode)
+	}
+	n := s.in.read(b)
+	if n == 0 {
+		if s.in.off == s.finalSize {
+			s.maybeRetireLocked()
+			return 0, io.EOF
+		}
+		return 0, c.err
+	}
+	s.consumeLocked(s.in.off)
+	if s.finalSize < 0 {
+		window := c.config.maxStreamReadBufferSize()
+		if s.recvMax-s.in.off < window/2 {
+			s.recvMax = s.in.off + window
+			s.maxStreamDataPending = true
+		}
+	}
+	if s.maxStreamDataPending || c.maxDataPending {
+		c.flushLocked(time.Now())
+	}
+	return n, nil
+}
+
+// consumeLocked counts stream data up to off as read
+// for the purposes of connection-level flow control.
+func (s *Stream) consumeLocked(off int64) {
+	c := s.conn
+	if off <= s.consumed {
+		return
+	}
+	c.readData += off - s.consumed
+	s.consumed = off
+	window := c.config.maxConnReadBufferSize()
+	if c.localMaxData-c.readData < window/2 {
+		c.localMaxData = c.readData + window
+		c.maxDataPending = true
+	}
+}
+
+// Write writes data to the stream, blocking while the stream's send
+// buffer is full. It returns a StreamErrorCode if the peer asked us to
+// stop sending.
+func (s *Stream) Write(b []byte) (int, error) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.hasSend {
+		return 0, errors.New("quic: write to receive-only stream")
+	}
+	maxBuf := c.config.maxStreamWriteBufferSize()
+	n := 0
+	for len(b) > 0 {
+		if err := c.waitLocked(s.writeCtx, func() bool {
+			return s.out.buffered() < maxBuf || s.resetQueued || s.peerStopped || c.err != nil
+		}); err != nil {
+			return n, err
+		}
+		switch {
+		case s.peerStopped:
+			return n, StreamErrorCode(s.peerStopCode)
+		case s.resetQueued || s.finQueued:
+			return n, errStreamClosed
+		case c.err != nil:
+			return n, c.err
+		}
+		m := int(min64(int64(len(b)), maxBuf-s.out.buffered()))
+		s.out.write(b[:m])
+		b = b[m:]
+		n += m
+		c.flushLocked(time.Now())
+	}
+	return n, nil
+}
+
+// CloseWrite closes the sending part of the stream. The peer reads
+// io.EOF after reading all data written to the stream.
+func (s *Stream) CloseWrite() error {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.hasSend || s.resetQueued || s.finQueued {
+		return nil
+	}
+	s.finQueued = true
+	c.flushLocked(time.Now())
+	return nil
+}
+
+// Reset aborts the sending part of the stream, discarding unsent data.
+// The peer's reads return a StreamErrorCode with the given code.
+func (s *Stream) Reset(code uint64) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.resetLocked(code)
+	c.flushLocked(time.Now())
+}
+
+func (s *Stream) resetLocked(code uint64) {
+	if !s.hasSend || s.resetQueued || s.finAcked {
+		return
+	}
+	s.resetQueued = true
+	s.resetCode = code
+	s.resetFinalSize = s.out.next
+	s.resetPending = true
+	s.out.reset()
+	s.conn.wakeLocked()
+}
+
+// StopSending closes the receiving part of the stream, discarding
+// unread data and asking the peer to stop sending with the given code.
+func (s *Stream) StopSending(code uint64) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.stopSendingLocked(code)
+	c.flushLocked(time.Now())
+}
+
+func (s *Stream) stopSendingLocked(code uint64) {
+	if !s.hasRecv || s.stopSending {
+		return
+	}
+	s.stopSending = true
+	s.in.discard()
+	s.consumeLocked(s.recvHighest)
+	s.maxStreamDataPending = false
+	if !s.resetRecvd && s.in.off != s.finalSize {
+		s.stopCode = code
+		s.stopPending = true
+	}
+	s.maybeRetireLocked()
+	s.conn.wakeLocked()
+}
+
+// WaitAborted blocks until the peer resets the stream or asks us to stop
+// sending on it, or until the connection is closed. It returns ctx.Err()
+// if ctx is done first.
+func (s *Stream) WaitAborted(ctx context.Context) error {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waitLocked(ctx, func() bool {
+		return s.resetRecvd || s.peerStopped || c.err != nil
+	})
+}
+
+// Close closes the stream: the sending part is closed as by CloseWrite,
+// and unread data is discarded as by StopSending with a code of 0.
+func (s *Stream) Close() error {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.hasSend && !s.resetQueued {
+		s.finQueued = true
+	}
+	s.stopSendingLocked(0)
+	c.flushLocked(time.Now())
+	return nil
+}
+
+// handleData processes data received in a STREAM frame.
+func (s *Stream) handleData(off int64, data []byte, fin bool) error {
+	end := off + int64(len(data))
+	if s.finalSize >= 0 && (end > s.finalSize || fin && end != s.finalSize) {
+		return localTransportError{errFinalSize, ""}
+	}
+	if fin {
+		if end < s.recvHighest {
+			return localTransportError{errFinalSize, ""}
+		}
+		s.finalSize = end
+		s.maxStreamDataPending = false
+	}
+	if err := s.updateRecvHighest(end); err != nil {
+		return err
+	}
+	if s.resetRecvd || s.stopSending {
+		s.consumeLocked(s.recvHighest)
+		s.maybeRetireLocked()
+		return nil
+	}
+	s.in.write(off, data)
+	if s.in.off == s.finalSize {
+		s.maybeRetireLocked()
+	}
+	return nil
+}
+
+// updateRecvHighest records the receipt of data up to offset end,
+// enforcing flow control limits.
+func (s *Stream) updateRecvHighest(end int64) error {
+	c := s.conn
+	if end > s.recvMax {
+		return localTransportError{errFlowControl, "stream data exceeds MAX_STREAM_DATA"}
+	}
+	if end > s.recvHighest {
+		c.recvData += end - s.recvHighest
+		s.recvHighest = end
+		if c.recvData > c.localMaxData {
+			return localTransportError{errFlowControl, "stream data exceeds MAX_DATA"}
+		}
+	}
+	return nil
+}
+
+// handleReset processes a RESET_STREAM frame.
+func (s *Stream) handleReset(code uint64, finalSize int64) error {
+	if s.finalSize >= 0 && finalSize != s.finalSize || finalSize < s.recvHighest {
+		return localTransportError{errFinalSize, ""}
+	}
+	if err := s.updateRecvHighest(finalSize); err != nil {
+		return err
+	}
+	// A reset is ignored once all data up to a FIN has been read.
+	// See RFC 9000, Section 3.2.
+	dataRead := s.finalSize >= 0 && s.in.off == s.finalSize
+	s.finalSize = finalSize
+	s.maxStreamDataPending = false
+	s.stopPending = false
+	if !s.resetRecvd && !dataRead {
+		s.resetRecvd = true
+		s.resetRecvdCode = code
+		s.in.discard()
+	}
+	s.consumeLocked(finalSize)
+	s.maybeRetireLocked()
+	return nil
+}
+
+// handleStopSending processes a STOP_SENDING frame.
+func (s *Stream) handleStopSending(code uint64) {
+	if s.peerStopped {
+		return
+	}
+	s.peerStopped = true
+	s.peerStopCode = code
+	// Respond with a RESET_STREAM frame. See RFC 9000, Section 3.5.
+	s.resetLocked(code)
+}
+
+// recvDone reports whether the receiving part of the stream
+// requires no further state.
+func (s *Stream) recvDone() bool {
+	if !s.hasRecv {
+		return true
+	}
+	return s.resetRecvd || s.finalSize >= 0 && (s.in.off == s.finalSize || s.stopSending)
+}
+
+// sendDone reports whether the sending part of the stream
+// requires no further state.
+func (s *Stream) sendDone() bool {
+	if !s.hasSend {
+		return true
+	}
+	if s.resetQueued {
+		return s.resetAcked
+	}
+	return s.finAcked && s.out.buffered() == 0
+}
+
+// maybeRetireLocked removes s from its connection once both parts of
+// the stream are done, allowing the peer to open another stream.
+func (s *Stream) maybeRetireLocked() {
+	if s.retired || !s.recvDone() || !s.sendDone() {
+		return
+	}
+	c := s.conn
+	s.retired = true
+	delete(c.streams, s.id)
+	if !c.isLocal(s.id) {
+		typ := streamType(s.id)
+		c.localMaxStreams[typ]++
+		c.maxStreamsPending[typ] = true
+	}
+}
+
+func (s *Stream) onDataAcked(off, n int64, fin bool) {
+	if s.resetQueued {
+		return
+	}
+	s.out.ack(off, n)
+	if fin {
+		s.finAcked = true
+	}
+	s.maybeRetireLocked()
+	s.conn.wakeLocked()
+}
+
+func (s *Stream) onDataLost(off, n int64, fin bool) {
+	if s.resetQueued || s.retired {
+		return
+	}
+	s.out.markLost(off, n)
+	if fin && !s.finAcked {
+		s.finSent = false
+	}
+}
+
+func (s *Stream) onResetAcked() {
+	s.resetAcked = true
+	s.maybeRetireLocked()
+}
+
+func (s *Stream) onResetLost() {
+	if !s.resetAcked && !s.retired {
+		s.resetPending = true
+	}
+}
+
+func (s *Stream) onStopSendingLost() {
+	if !s.recvDone() && !s.retired {
+		s.stopPending = true
+	}
+}
+
+func (s *Stream) onMaxStreamDataLost() {
+	if s.finalSize < 0 && !s.stopSending && !s.retired {
+		s.maxStreamDataPending = true
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "time"
+
+// transportParameters are the QUIC transport parameters
+// sent during the handshake. See RFC 9000, Section 18.
+type transportParameters struct {
+	originalDstConnID              []byte
+	maxIdleTimeout                 time.Duration
+	maxUDPPayloadSize              int64
+	initialMaxData                 int64
+	initialMaxStreamDataBidiLocal  int64
+	initialMaxStreamDataBidiRemote int64
+	initialMaxStreamDataUni        int64
+	initialMaxStreamsBidi          int64
+	initialMaxStreamsUni           int64
+	ackDelayExponent               int8
+	maxAckDelay                    time.Duration
+	disableActiveMigration         bool
+	activeConnIDLimit              int64
+	initialSrcConnID               []byte
+	retrySrcConnID                 []byte
+}
+
+// Transport parameter IDs.
+const (
+	paramOriginalDestinationConnectionID = 0x00
+	paramMaxIdleTimeout                  = 0x01
+	paramStatelessResetToken             = 0x02
+	paramMaxUDPPayloadSize               = 0x03
+	paramInitialMaxData                  = 0x04
+	paramInitialMaxStreamDataBidiLocal   = 0x05
+	paramInitialMaxStreamDataBidiRemote  = 0x06
+	paramInitialMaxStreamDataUni         = 0x07
+	paramInitialMaxStreamsBidi           = 0x08
+	paramInitialMaxStreamsUni            = 0x09
+	paramAckDelayExponent                = 0x0a
+	paramMaxAckDelay                     = 0x0b
+	paramDisableActiveMigration          = 0x0c
+	paramPreferredAddress                = 0x0d
+	paramActiveConnectionIDLimit         = 0x0e
+	paramInitialSourceConnectionID       = 0x0f
+	paramRetrySourceConnectionID         = 0x10
+)
+
+// defaultTransportParameters returns the values of transport
+// parameters a peer uses when it omits them.
+func defaultTransportParameters() transportParameters {
+	return transportParameters{
+		maxUDPPayloadSize: 65527,
+		ackDelayExponent:  3,
+		maxAckDelay:       25 * time.Millisecond,
+		activeConnIDLimit: 2,
+	}
+}
+
+func (p *transportParameters) marshal() []byte {
+	var b []byte
+	appendInt := func(id uint64, v int64) {
+		b = appendVarint(b, id)
+		b = appendVarint(b, uint64(sizeVarint(uint64(v))))
+		b = appendVarint(b, uint64(v))
+	}
+	appendBytes := func(id uint64, v []byte) {
+		b = appendVarint(b, id)
+		b = appendVarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+	if p.originalDstConnID != nil {
+		appendBytes(paramOriginalDestinationConnectionID, p.originalDstConnID)
+	}
+	if p.maxIdleTimeout > 0 {
+		appendInt(paramMaxIdleTimeout, p.maxIdleTimeout.Milliseconds())
+	}
+	appendInt(paramMaxUDPPayloadSize, p.maxUDPPayloadSize)
+	appendInt(paramInitialMaxData, p.initialMaxData)
+	appendInt(paramInitialMaxStreamDataBidiLocal, p.initialMaxStreamDataBidiLocal)
+	appendInt(paramInitialMaxStreamDataBidiRemote, p.initialMaxStreamDataBidiRemote)
+	appendInt(paramInitialMaxStreamDataUni, p.initialMaxStreamDataUni)
+	appendInt(paramInitialMaxStreamsBidi, p.initialMaxStreamsBidi)
+	appendInt(paramInitialMaxStreamsUni, p.initialMaxStreamsUni)
+	appendInt(paramAckDelayExponent, int64(p.ackDelayExponent))
+	appendInt(paramMaxAckDelay, p.maxAckDelay.Milliseconds())
+	if p.disableActiveMigration {
+		appendBytes(paramDisableActiveMigration, nil)
+	}
+	appendInt(paramActiveConnectionIDLimit, p.activeConnIDLimit)
+	appendBytes(paramInitialSourceConnectionID, p.initialSrcConnID)
+	if p.retrySrcConnID != nil {
+		appendBytes(paramRetrySourceConnectionID, p.retrySrcConnID)
+	}
+	return b
+}
+
+func unmarshalTransportParameters(b []byte) (transportParameters, error) {
+	p := defaultTransportParameters()
+	seen := map[uint64]bool{}
+	for len(b) > 0 {
+		id, n := consumeVarint(b)
+		if n < 0 {
+			return p, localTransportError{errTransportParameter, "malformed transport parameters"}
+		}
+		b = b[n:]
+		val, n := consumeVarintBytes(b)
+		if n < 0 {
+			return p, localTransportError{errTransportParameter, "malformed transport parameters"}
+		}
+		b = b[n:]
+		if seen[id] {
+			return p, localTransportError{errTransportParameter, "duplicate transport parameter"}
+		}
+		seen[id] = true
+
+		readInt := func() (int64, bool) {
+			v, n := consumeVarint(val)
+			return int64(v), n == len(val)
+		}
+		var ok = true
+		var v int64
+		switch id {
+		case paramOriginalDestinationConnectionID:
+			p.originalDstConnID = append([]byte{}, val...)
+		case paramMaxIdleTimeout:
+			v, ok = readInt()
+			p.maxIdleTimeout = time.Duration(v) * time.Millisecond
+		case paramStatelessResetToken:
+			ok = len(val) == 16
+		case paramMaxUDPPayloadSize:
+			v, ok = readInt()
+			ok = ok && v >= 1200
+			p.maxUDPPayloadSize = v
+		case paramInitialMaxData:
+			p.initialMaxData, ok = readInt()
+		case paramInitialMaxStreamDataBidiLocal:
+			p.initialMaxStreamDataBidiLocal, ok = readInt()
+		case paramInitialMaxStreamDataBidiRemote:
+			p.initialMaxStreamDataBidiRemote, ok = readInt()
+		case paramInitialMaxStreamDataUni:
+			p.initialMaxStreamDataUni, ok = readInt()
+		case paramInitialMaxStreamsBidi:
+			p.initialMaxStreamsBidi, ok = readInt()
+			ok = ok && p.initialMaxStreamsBidi <= 1<<60
+		case paramInitialMaxStreamsUni:
+			p.initialMaxStreamsUni, ok = readInt()
+			ok = ok && p.initialMaxStreamsUni <= 1<<60
+		case paramAckDelayExponent:
+			v, ok = readInt()
+			ok = ok && v <= 20
+			p.ackDelayExponent = int8(v)
+		case paramMaxAckDelay:
+			v, ok = readInt()
+			ok = ok && v < 1<<14
+			p.maxAckDelay = time.Duration(v) * time.Millisecond
+		case paramDisableActiveMigration:
+			ok = len(val) == 0
+			p.disableActiveMigration = true
+		case paramActiveConnectionIDLimit:
+			p.activeConnIDLimit, ok = readInt()
+			ok = ok && p.activeConnIDLimit >= 2
+		case paramInitialSourceConnectionID:
+			p.initialSrcConnID = append([]byte{}, val...)
+		case paramRetrySourceConnectionID:
+			p.retrySrcConnID = append([]byte{}, val...)
+		default:
+			// Unknown parameters, including preferred_address
+			// (which we do not use), are ignored.
+		}
+		if !ok {
+			return p, localTransportError{errTransportParameter, "invalid transport parameter value"}
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import "encoding/binary"
+
+// maxVarint is the largest value that can be encoded as a variable-length
+// integer. See RFC 9000, Section 16.
+const maxVarint = (1 << 62) - 1
+
+// sizeVarint returns the size of the variable-length integer encoding of v.
+func sizeVarint(v uint64) int {
+	switch {
+	case v < 1<<6:
+		return 1
+	case v < 1<<14:
+		return 2
+	case v < 1<<30:
+		return 4
+	case v <= maxVarint:
+		return 8
+	}
+	panic("quic: varint too large")
+}
+
+// appendVarint appends the variable-length integer encoding of v to b.
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 1<<6|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 2<<6|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case v <= maxVarint:
+		return append(b, 3<<6|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	panic("quic: varint too large")
+}
+
+// appendVarint2 appends v encoded as a two-byte variable-length integer,
+// which is used for length fields that are filled in after the fact.
+func appendVarint2(b []byte, v uint64) []byte {
+	if v >= 1<<14 {
+		panic("quic: value too large for two-byte varint")
+	}
+	return append(b, 1<<6|byte(v>>8), byte(v))
+}
+
+// consumeVarint parses a variable-length integer at the start of b,
+// returning its value and encoded length. It returns a negative
+// length if b does not contain a complete varint.
+func consumeVarint(b []byte) (v uint64, n int) {
+	if len(b) < 1 {
+		return 0, -1
+	}
+	n = 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v = uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// consumeVarintInt64 is like consumeVarint, but returns an int64.
+func consumeVarintInt64(b []byte) (v int64, n int) {
+	u, n := consumeVarint(b)
+	return int64(u), n
+}
+
+// consumeVarintBytes parses a varint length followed by that many bytes.
+func consumeVarintBytes(b []byte) ([]byte, int) {
+	size, n := consumeVarint(b)
+	if n < 0 || size > uint64(len(b)-n) {
+		return nil, -1
+	}
+	return b[n : n+int(size)], n + int(size)
+}
+
+// Long header packet types. See RFC 9000, Section 17.2.
+const (
+	packetTypeInitial   = 0
+	packetType0RTT      = 1
+	packetTypeHandshake = 2
+	packetTypeRetry     = 3
+)
+
+const (
+	headerFormLong    = 0x80
+	fixedBit          = 0x40
+	keyPhaseBit       = 0x04
+	reservedLongBits  = 0x0c
+	reservedShortBits = 0x18
+)
+
+// isLongHeader reports whether b is the first byte of a long header packet.
+func isLongHeader(b byte) bool {
+	return b&headerFormLong != 0
+}
+
+// dstConnIDForDatagram returns the destination connection ID of the
+// first packet in a datagram. Short header packets are assumed to use
+// connection IDs of length connIDLen, since we always choose our own.
+func dstConnIDForDatagram(b []byte) (id []byte, ok bool) {
+	if len(b) < 1 {
+		return nil, false
+	}
+	if !isLongHeader(b[0]) {
+		if len(b) < 1+connIDLen {
+			return nil, false
+		}
+		return b[1 : 1+connIDLen], true
+	}
+	if len(b) < 6 {
+		return nil, false
+	}
+	n := int(b[5])
+	if n > 20 || len(b) < 6+n {
+		return nil, false
+	}
+	return b[6 : 6+n], true
+}
+
+// packetNumberLength returns the number of bytes to use when encoding
+// packet number num, given the largest number acknowledged by the peer.
+// See RFC 9000, Section 17.1.
+func packetNumberLength(num, largestAcked int64) int {
+	d := num - largestAcked
+	switch {
+	case d < 1<<7:
+		return 1
+	case d < 1<<15:
+		return 2
+	case d < 1<<23:
+		return 3
+	}
+	return 4
+}
+
+// appendPacketNumber appends the low n bytes of num to b.
+func appendPacketNumber(b []byte, num int64, n int) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(num))
+	return append(b, buf[4-n:]...)
+}
+
+// decodePacketNumber reconstructs a full packet number from its truncated
+// encoding, as described in RFC 9000, Appendix A.3.
+func decodePacketNumber(largest, truncated int64, n int) int64 {
+	expected := largest + 1
+	win := int64(1) << (n * 8)
+	hwin := win / 2
+	mask := win - 1
+	candidate := (expected &^ mask) | truncated
+	if candidate <= expected-hwin && candidate < (1<<62)-win {
+		return candidate + win
+	}
+	if candidate > expected+hwin && candidate >= win {
+		return candidate - win
+	}
+	return candidate
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	// Examples from RFC 9000, Appendix A.1.
+	for _, test := range []struct {
+		enc string
+		v   uint64
+	}{
+		{"c2197c5eff14e88c", 151288809941952652},
+		{"9d7f3e7d", 494878333},
+		{"7bbd", 15293},
+		{"25", 37},
+	} {
+		b, _ := hex.DecodeString(test.enc)
+		v, n := consumeVarint(b)
+		if v != test.v || n != len(b) {
+			t.Errorf("consumeVarint(%v) = %v, %v; want %v, %v", test.enc, v, n, test.v, len(b))
+		}
+		if got := appendVarint(nil, test.v); !bytes.Equal(got, b) {
+			t.Errorf("appendVarint(%v) = %x, want %v", test.v, got, test.enc)
+		}
+		if got := sizeVarint(test.v); got != len(b) {
+			t.Errorf("sizeVarint(%v) = %v, want %v", test.v, got, len(b))
+		}
+		if _, n := consumeVarint(b[:len(b)-1]); n >= 0 {
+			t.Errorf("consumeVarint(truncated %v) succeeded", test.enc)
+		}
+	}
+	// The two-byte encoding of 37 is also valid.
+	if got, want := appendVarint2(nil, 37), []byte{0x40, 0x25}; !bytes.Equal(got, want) {
+		t.Errorf("appendVarint2(37) = %x, want %x", got, want)
+	}
+	if v, n := consumeVarint([]byte{0x40, 0x25}); v != 37 || n != 2 {
+		t.Errorf("consumeVarint(4025) = %v, %v; want 37, 2", v, n)
+	}
+}
+
+func TestDecodePacketNumber(t *testing.T) {
+	// Example from RFC 9000, Appendix A.3.
+	if got, want := decodePacketNumber(0xa82f30ea, 0x9b32, 2), int64(0xa82f9b32); got != want {
+		t.Errorf("decodePacketNumber = %x, want %x", got, want)
+	}
+	for _, test := range []struct {
+		largest, num int64
+	}{
+		{-1, 0},
+		{0, 1},
+		{254, 255},
+		{255, 256},
+		{100000, 100050},
+		{1<<20 - 1, 1 << 20},
+	} {
+		n := packetNumberLength(test.num, test.largest)
+		b := appendPacketNumber(nil, test.num, n)
+		var truncated int64
+		for _, c := range b {
+			truncated = truncated<<8 | int64(c)
+		}
+		if got := decodePacketNumber(test.largest, truncated, n); got != test.num {
+			t.Errorf("largest=%v: packet number %v round trips as %v", test.largest, test.num, got)
+		}
+	}
+}
+
+func TestTransportParametersRoundTrip(t *testing.T) {
+	p := transportParameters{
+		originalDstConnID:             []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		maxIdleTimeout:                30000 * 1e6,
+		maxUDPPayloadSize:             1472,
+		initialMaxData:                1 << 20,
+		initialMaxStreamDataBidiLocal: 1 << 18,
+		initialMaxStreamDataUni:       1 << 16,
+		initialMaxStreamsBidi:         100,
+		initialMaxStreamsUni:          3,
+		ackDelayExponent:              3,
+		maxAckDelay:                   25 * 1e6,
+		disableActiveMigration:        true,
+		activeConnIDLimit:             2,
+		initialSrcConnID:              []byte{9, 9, 9},
+	}
+	got, err := unmarshalTransportParameters(p.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.originalDstConnID, p.originalDstConnID) ||
+		!bytes.Equal(got.initialSrcConnID, p.initialSrcConnID) {
+		t.Errorf("connection IDs = %x, %x; want %x, %x",
+			got.originalDstConnID, got.initialSrcConnID, p.originalDstConnID, p.initialSrcConnID)
+	}
+	got.originalDstConnID, got.initialSrcConnID = nil, nil
+	p.originalDstConnID, p.initialSrcConnID = nil, nil
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, p)
+	}
+
+	for _, bad := range [][]byte{
+		{paramMaxUDPPayloadSize, 2, 0x44, 0x00},                // below 1200
+		{paramAckDelayExponent, 1, 21},                         // above 20
+		{paramDisableActiveMigration, 1, 0},                    // must be empty
+		{paramActiveConnectionIDLimit, 1, 1},                   // below 2
+		{paramInitialMaxData, 1, 1, paramInitialMaxData, 1, 1}, // duplicate
+		{paramInitialMaxData, 3, 1},                            // truncated
+	} {
+		if _, err := unmarshalTransportParameters(bad); err == nil {
+			t.Errorf("unmarshalTransportParameters(%x) succeeded, want error", bad)
+		}
+	}
+}
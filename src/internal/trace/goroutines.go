@@ -353,5 +353,5 @@ func RelatedGoroutines(events []*Event, goid uint64) map[uint64]bool {
 func IsSystemGoroutine(entryFn string) bool {
 	// This mimics runtime.isSystemGoroutine as closely as
 	// possible.
-	return entryFn != "runtime.main" && strings.HasPrefix(entryFn, "runtime.")
+	return entryFn != "runtime.main" && entryFn != "runtime.corostart" && strings.HasPrefix(entryFn, "runtime.")
 }
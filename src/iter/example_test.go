@@ -0,0 +1,52 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build goexperiment.rangefunc
+
+package iter_test
+
+import (
+	"fmt"
+	"iter"
+)
+
+// Countdown returns an iterator over the integers from n down to 1.
+func Countdown(n int) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := n; i > 0; i-- {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func ExampleSeq() {
+	for i := range Countdown(3) {
+		fmt.Println(i)
+	}
+	fmt.Println("liftoff")
+	// Output:
+	// 3
+	// 2
+	// 1
+	// liftoff
+}
+
+func ExamplePull() {
+	// Zip the values of two sequences together, stopping
+	// at the end of the shorter one.
+	next, stop := iter.Pull(Countdown(2))
+	defer stop()
+	for v := range Countdown(5) {
+		w, ok := next()
+		if !ok {
+			break
+		}
+		fmt.Println(v, w)
+	}
+	// Output:
+	// 5 2
+	// 4 1
+}
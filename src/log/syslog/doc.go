@@ -4,16 +4,17 @@
 
 // Package syslog provides a simple interface to the system log
 // service. It can send messages to the syslog daemon using UNIX
-// domain sockets, UDP or TCP.
+// domain sockets, UDP, TCP or TLS.
 //
 // Only one call to Dial is necessary. On write failures,
 // the syslog client will attempt to reconnect to the server
 // and write again.
 //
-// The syslog package is frozen and is not accepting new features.
-// Some external packages provide more functionality. See:
-//
-//	https://godoc.org/?q=syslog
+// By default, messages use the traditional BSD format of RFC 3164.
+// DialConfig can instead select the format of RFC 5424, which adds
+// a message ID and structured data (see Writer.WriteStructured),
+// the octet-counted framing of RFC 6587 for stream connections,
+// and the TLS transport of RFC 5425.
 package syslog
 
 // BUG(brainman): This package is not implemented on Windows. As the
@@ -7,6 +7,7 @@
 package syslog_test
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"log/syslog"
@@ -21,3 +22,17 @@ func ExampleDial() {
 	fmt.Fprintf(sysLog, "This is a daemon warning with demotag.")
 	sysLog.Emerg("And this is a daemon emergency with demotag.")
 }
+
+func ExampleDialConfig() {
+	sysLog, err := syslog.DialConfig("tcp", "logs.example.com:6514",
+		syslog.LOG_INFO|syslog.LOG_LOCAL0, "demotag", &syslog.Config{
+			Format:    syslog.RFC5424,
+			TLSConfig: &tls.Config{ServerName: "logs.example.com"},
+		})
+	if err != nil {
+		log.Fatal(err)
+	}
+	sysLog.WriteStructured(syslog.LOG_NOTICE, "LOGIN", []syslog.SDElement{
+		{ID: "origin", Params: []syslog.SDParam{{Name: "ip", Value: "192.0.2.1"}}},
+	}, "user logged in")
+}
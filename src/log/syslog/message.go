@@ -0,0 +1,193 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+
+package syslog
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// An SDElement is an RFC 5424 structured data element, such as
+//
+//	[exampleSDID@32473 iut="3" eventSource="Application"]
+//
+// The ID and the parameter names must be valid SD-NAMEs: between 1
+// and 32 printable US-ASCII characters, excluding '=', ' ', ']' and
+// '"'. Parameter values may hold any text, but must be valid UTF-8.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// An SDParam is a name-value pair within an SDElement.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// A message holds the fields of a single syslog message.
+type message struct {
+	format   Format
+	time     time.Time
+	p        Priority
+	hostname string
+	tag      string
+	msgID    string
+	data     []SDElement
+	msg      string
+}
+
+// Maximum lengths of the RFC 5424 header fields.
+const (
+	maxHostnameLen = 255
+	maxAppNameLen  = 48
+	maxMsgIDLen    = 32
+	maxSDNameLen   = 32
+)
+
+// rfc5424Time is the RFC 5424 TIMESTAMP layout, which allows at most
+// microsecond precision.
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+// appendTo appends the formatted message to b, without any framing.
+// Local messages in the RFC3164 format omit the hostname and use
+// a shorter timestamp, as expected by the local syslog daemon.
+func (m *message) appendTo(b []byte, local bool) []byte {
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(m.p), 10)
+	b = append(b, '>')
+
+	if m.format == RFC5424 {
+		// HEADER SP STRUCTURED-DATA [SP MSG]
+		b = append(b, "1 "...)
+		b = m.time.AppendFormat(b, rfc5424Time)
+		b = append(b, ' ')
+		b = appendHeaderField(b, m.hostname, maxHostnameLen)
+		b = append(b, ' ')
+		b = appendHeaderField(b, m.tag, maxAppNameLen)
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, int64(os.Getpid()), 10)
+		b = append(b, ' ')
+		b = appendHeaderField(b, m.msgID, maxMsgIDLen)
+		b = append(b, ' ')
+		b = appendSD(b, m.data)
+		if m.msg != "" {
+			b = append(b, ' ')
+			b = append(b, m.msg...)
+		}
+		return b
+	}
+
+	// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+	if local {
+		// Compared to the network form, the changes are:
+		//	1. Use time.Stamp instead of time.RFC3339.
+		//	2. Drop the hostname field.
+		b = m.time.AppendFormat(b, time.Stamp)
+	} else {
+		b = m.time.AppendFormat(b, time.RFC3339)
+		b = append(b, ' ')
+		b = append(b, m.hostname...)
+	}
+	b = append(b, ' ')
+	b = append(b, m.tag...)
+	b = append(b, '[')
+	b = strconv.AppendInt(b, int64(os.Getpid()), 10)
+	b = append(b, "]: "...)
+	b = append(b, m.msg...)
+	return b
+}
+
+// appendHeaderField appends s to b as an RFC 5424 header field.
+// An empty field is written as the NILVALUE "-", characters outside
+// the printable US-ASCII range are replaced with '_', and the
+// field is truncated to max bytes.
+func appendHeaderField(b []byte, s string, max int) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isPrintASCII(c) {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// appendSD appends the STRUCTURED-DATA part of an RFC 5424 message.
+func appendSD(b []byte, data []SDElement) []byte {
+	if len(data) == 0 {
+		return append(b, '-')
+	}
+	for _, e := range data {
+		b = append(b, '[')
+		b = append(b, e.ID...)
+		for _, p := range e.Params {
+			b = append(b, ' ')
+			b = append(b, p.Name...)
+			b = append(b, '=', '"')
+			for i := 0; i < len(p.Value); i++ {
+				switch c := p.Value[i]; c {
+				case '"', '\\', ']':
+					b = append(b, '\\', c)
+				default:
+					b = append(b, c)
+				}
+			}
+			b = append(b, '"')
+		}
+		b = append(b, ']')
+	}
+	return b
+}
+
+// validateSD reports an error if an element ID or parameter name in
+// data is not a valid SD-NAME, or if a parameter value is not valid
+// UTF-8, as RFC 5424 requires of PARAM-VALUEs.
+func validateSD(data []SDElement) error {
+	for _, e := range data {
+		if !isSDName(e.ID) {
+			return errors.New("log/syslog: invalid structured data ID " + strconv.Quote(e.ID))
+		}
+		for _, p := range e.Params {
+			if !isSDName(p.Name) {
+				return errors.New("log/syslog: invalid structured data parameter name " + strconv.Quote(p.Name))
+			}
+			if !utf8.ValidString(p.Value) {
+				return errors.New("log/syslog: invalid UTF-8 in structured data parameter " + strconv.Quote(p.Name))
+			}
+		}
+	}
+	return nil
+}
+
+func isSDName(s string) bool {
+	if s == "" || len(s) > maxSDNameLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case !isPrintASCII(c), c == '=', c == ']', c == '"':
+			return false
+		}
+	}
+	return true
+}
+
+// isPrintASCII reports whether c is a PRINTUSASCII character,
+// as defined by RFC 5424.
+func isPrintASCII(c byte) bool {
+	return '!' <= c && c <= '~'
+}
@@ -7,11 +7,12 @@
 package syslog
 
 import (
+	"crypto/tls"
 	"errors"
-	"fmt"
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -72,13 +73,67 @@ const (
 	LOG_LOCAL7
 )
 
+// A Format selects the wire format of the messages sent by a Writer.
+type Format int
+
+const (
+	// RFC3164 is the traditional BSD syslog format described in
+	// RFC 3164. It is the default.
+	RFC3164 Format = iota
+
+	// RFC5424 is the syslog protocol format described in RFC 5424.
+	// It carries a message ID and structured data in addition to
+	// the free-form message.
+	RFC5424
+)
+
+// A Framing selects how messages are delimited on stream-oriented
+// connections, as described in RFC 6587. It has no effect on
+// datagram networks, where each message is sent in its own packet.
+type Framing int
+
+const (
+	// NonTransparentFraming terminates each message with a newline.
+	// It is the default.
+	NonTransparentFraming Framing = iota
+
+	// OctetCountingFraming prefixes each message with its length in
+	// bytes and a space. Unlike NonTransparentFraming, it allows
+	// messages to contain newlines.
+	OctetCountingFraming
+)
+
+// A Config configures a Writer created by DialConfig.
+// A nil *Config is equivalent to a zero Config.
+type Config struct {
+	// Format is the message format. The default is RFC3164.
+	Format Format
+
+	// Framing is the framing used on stream connections.
+	// It is ignored if TLSConfig is set, because RFC 5425
+	// requires OctetCountingFraming for TLS transport.
+	Framing Framing
+
+	// Hostname is reported as the host that originated each message.
+	// If empty, the result of os.Hostname is used.
+	Hostname string
+
+	// TLSConfig, if non-nil, causes the Writer to connect to the
+	// server using TLS, as described in RFC 5425. The network passed
+	// to DialConfig must then be "tcp", "tcp4" or "tcp6".
+	TLSConfig *tls.Config
+}
+
 // A Writer is a connection to a syslog server.
 type Writer struct {
-	priority Priority
-	tag      string
-	hostname string
-	network  string
-	raddr    string
+	priority  Priority
+	tag       string
+	hostname  string
+	network   string
+	raddr     string
+	format    Format
+	framing   Framing
+	tlsConfig *tls.Config
 
 	mu   sync.Mutex // guards conn
 	conn serverConn
@@ -91,13 +146,14 @@ type Writer struct {
 // return a type that satisfies this interface and simply calls the C
 // library syslog function.
 type serverConn interface {
-	writeString(p Priority, hostname, tag, s, nl string) error
+	writeMessage(m *message) error
 	close() error
 }
 
 type netConn struct {
-	local bool
-	conn  net.Conn
+	local   bool
+	framing Framing
+	conn    net.Conn
 }
 
 // New establishes a new connection to the system log daemon. Each
@@ -116,14 +172,26 @@ func New(priority Priority, tag string) (*Writer, error) {
 // Otherwise, see the documentation for net.Dial for valid values
 // of network and raddr.
 func Dial(network, raddr string, priority Priority, tag string) (*Writer, error) {
+	return DialConfig(network, raddr, priority, tag, nil)
+}
+
+// DialConfig is like Dial but uses config to select the message
+// format, the framing and, optionally, a TLS transport.
+func DialConfig(network, raddr string, priority Priority, tag string, config *Config) (*Writer, error) {
 	if priority < 0 || priority > LOG_LOCAL7|LOG_DEBUG {
 		return nil, errors.New("log/syslog: invalid priority")
 	}
+	if config == nil {
+		config = &Config{}
+	}
 
 	if tag == "" {
 		tag = os.Args[0]
 	}
-	hostname, _ := os.Hostname()
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
 
 	w := &Writer{
 		priority: priority,
@@ -131,6 +199,17 @@ func Dial(network, raddr string, priority Priority, tag string) (*Writer, error)
 		hostname: hostname,
 		network:  network,
 		raddr:    raddr,
+		format:   config.Format,
+		framing:  config.Framing,
+	}
+	if config.TLSConfig != nil {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return nil, errors.New("log/syslog: TLS requires a TCP network")
+		}
+		w.tlsConfig = config.TLSConfig
+		w.framing = OctetCountingFraming
 	}
 
 	w.mu.Lock()
@@ -159,12 +238,21 @@ func (w *Writer) connect() (err error) {
 		}
 	} else {
 		var c net.Conn
-		c, err = net.Dial(w.network, w.raddr)
+		if w.tlsConfig != nil {
+			c, err = tls.Dial(w.network, w.raddr, w.tlsConfig)
+		} else {
+			c, err = net.Dial(w.network, w.raddr)
+		}
 		if err == nil {
-			w.conn = &netConn{
+			nc := &netConn{
 				conn:  c,
 				local: w.network == "unixgram" || w.network == "unix",
 			}
+			switch w.network {
+			case "tcp", "tcp4", "tcp6", "unix":
+				nc.framing = w.framing
+			}
+			w.conn = nc
 			if w.hostname == "" {
 				w.hostname = c.LocalAddr().String()
 			}
@@ -175,7 +263,7 @@ func (w *Writer) connect() (err error) {
 
 // Write sends a log message to the syslog daemon.
 func (w *Writer) Write(b []byte) (int, error) {
-	return w.writeAndRetry(w.priority, string(b))
+	return w.writeAndRetry(w.priority, "", nil, string(b))
 }
 
 // Close closes a connection to the syslog daemon.
@@ -194,110 +282,126 @@ func (w *Writer) Close() error {
 // Emerg logs a message with severity LOG_EMERG, ignoring the severity
 // passed to New.
 func (w *Writer) Emerg(m string) error {
-	_, err := w.writeAndRetry(LOG_EMERG, m)
+	_, err := w.writeAndRetry(LOG_EMERG, "", nil, m)
 	return err
 }
 
 // Alert logs a message with severity LOG_ALERT, ignoring the severity
 // passed to New.
 func (w *Writer) Alert(m string) error {
-	_, err := w.writeAndRetry(LOG_ALERT, m)
+	_, err := w.writeAndRetry(LOG_ALERT, "", nil, m)
 	return err
 }
 
 // Crit logs a message with severity LOG_CRIT, ignoring the severity
 // passed to New.
 func (w *Writer) Crit(m string) error {
-	_, err := w.writeAndRetry(LOG_CRIT, m)
+	_, err := w.writeAndRetry(LOG_CRIT, "", nil, m)
 	return err
 }
 
 // Err logs a message with severity LOG_ERR, ignoring the severity
 // passed to New.
 func (w *Writer) Err(m string) error {
-	_, err := w.writeAndRetry(LOG_ERR, m)
+	_, err := w.writeAndRetry(LOG_ERR, "", nil, m)
 	return err
 }
 
 // Warning logs a message with severity LOG_WARNING, ignoring the
 // severity passed to New.
 func (w *Writer) Warning(m string) error {
-	_, err := w.writeAndRetry(LOG_WARNING, m)
+	_, err := w.writeAndRetry(LOG_WARNING, "", nil, m)
 	return err
 }
 
 // Notice logs a message with severity LOG_NOTICE, ignoring the
 // severity passed to New.
 func (w *Writer) Notice(m string) error {
-	_, err := w.writeAndRetry(LOG_NOTICE, m)
+	_, err := w.writeAndRetry(LOG_NOTICE, "", nil, m)
 	return err
 }
 
 // Info logs a message with severity LOG_INFO, ignoring the severity
 // passed to New.
 func (w *Writer) Info(m string) error {
-	_, err := w.writeAndRetry(LOG_INFO, m)
+	_, err := w.writeAndRetry(LOG_INFO, "", nil, m)
 	return err
 }
 
 // Debug logs a message with severity LOG_DEBUG, ignoring the severity
 // passed to New.
 func (w *Writer) Debug(m string) error {
-	_, err := w.writeAndRetry(LOG_DEBUG, m)
+	_, err := w.writeAndRetry(LOG_DEBUG, "", nil, m)
 	return err
 }
 
-func (w *Writer) writeAndRetry(p Priority, s string) (int, error) {
+// WriteStructured logs a message with the given severity, message ID
+// and RFC 5424 structured data, ignoring the severity passed to New.
+// The msgID and data may be empty. It returns an error if w does not
+// use the RFC5424 format and either msgID or data is not empty, if an
+// element or parameter name in data is not a valid RFC 5424 SD-NAME, or
+// if a parameter value in data is not valid UTF-8.
+func (w *Writer) WriteStructured(severity Priority, msgID string, data []SDElement, m string) error {
+	if w.format != RFC5424 && (msgID != "" || len(data) > 0) {
+		return errors.New("log/syslog: message ID and structured data require the RFC5424 format")
+	}
+	if err := validateSD(data); err != nil {
+		return err
+	}
+	_, err := w.writeAndRetry(severity, msgID, data, m)
+	return err
+}
+
+func (w *Writer) writeAndRetry(p Priority, msgID string, data []SDElement, s string) (int, error) {
 	pr := (w.priority & facilityMask) | (p & severityMask)
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	if w.conn != nil {
-		if n, err := w.write(pr, s); err == nil {
+		if n, err := w.write(pr, msgID, data, s); err == nil {
 			return n, err
 		}
 	}
 	if err := w.connect(); err != nil {
 		return 0, err
 	}
-	return w.write(pr, s)
+	return w.write(pr, msgID, data, s)
 }
 
-// write generates and writes a syslog formatted string. The
-// format is as follows: <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
-func (w *Writer) write(p Priority, msg string) (int, error) {
-	// ensure it ends in a \n
-	nl := ""
-	if !strings.HasSuffix(msg, "\n") {
-		nl = "\n"
-	}
-
-	err := w.conn.writeString(p, w.hostname, w.tag, msg, nl)
+// write generates and writes a syslog formatted message.
+func (w *Writer) write(p Priority, msgID string, data []SDElement, msg string) (int, error) {
+	err := w.conn.writeMessage(&message{
+		format:   w.format,
+		time:     time.Now(),
+		p:        p,
+		hostname: w.hostname,
+		tag:      w.tag,
+		msgID:    msgID,
+		data:     data,
+		msg:      msg,
+	})
 	if err != nil {
 		return 0, err
 	}
 	// Note: return the length of the input, not the number of
-	// bytes printed by Fprintf, because this must behave like
-	// an io.Writer.
+	// bytes written to the connection, because this must behave
+	// like an io.Writer.
 	return len(msg), nil
 }
 
-func (n *netConn) writeString(p Priority, hostname, tag, msg, nl string) error {
-	if n.local {
-		// Compared to the network form below, the changes are:
-		//	1. Use time.Stamp instead of time.RFC3339.
-		//	2. Drop the hostname field from the Fprintf.
-		timestamp := time.Now().Format(time.Stamp)
-		_, err := fmt.Fprintf(n.conn, "<%d>%s %s[%d]: %s%s",
-			p, timestamp,
-			tag, os.Getpid(), msg, nl)
-		return err
+func (n *netConn) writeMessage(m *message) error {
+	b := m.appendTo(nil, n.local)
+	if n.framing == OctetCountingFraming {
+		// RFC 6587, section 3.4.1: MSG-LEN SP SYSLOG-MSG.
+		framed := strconv.AppendInt(make([]byte, 0, len(b)+8), int64(len(b)), 10)
+		framed = append(framed, ' ')
+		b = append(framed, b...)
+	} else if !strings.HasSuffix(m.msg, "\n") {
+		// ensure it ends in a \n
+		b = append(b, '\n')
 	}
-	timestamp := time.Now().Format(time.RFC3339)
-	_, err := fmt.Fprintf(n.conn, "<%d>%s %s %s[%d]: %s%s",
-		p, timestamp, hostname,
-		tag, os.Getpid(), msg, nl)
+	_, err := n.conn.Write(b)
 	return err
 }
 
@@ -8,12 +8,18 @@ package syslog
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -427,3 +433,191 @@ func TestConcurrentReconnect(t *testing.T) {
 		t.Error("timeout in concurrent reconnect")
 	}
 }
+
+func TestMessageFormat(t *testing.T) {
+	tm := time.Date(2003, 10, 11, 22, 14, 15, 3000, time.UTC)
+	pid := os.Getpid()
+	tests := []struct {
+		m     message
+		local bool
+		want  string
+	}{
+		{
+			m:    message{p: LOG_USER | LOG_ERR, time: tm, hostname: "host", tag: "app", msg: "hello"},
+			want: fmt.Sprintf("<11>2003-10-11T22:14:15Z host app[%d]: hello", pid),
+		},
+		{
+			m:     message{p: LOG_USER | LOG_ERR, time: tm, hostname: "host", tag: "app", msg: "hello"},
+			local: true,
+			want:  fmt.Sprintf("<11>Oct 11 22:14:15 app[%d]: hello", pid),
+		},
+		{
+			m:    message{format: RFC5424, p: LOG_AUTH | LOG_CRIT, time: tm, hostname: "mymachine.example.com", tag: "su", msgID: "ID47", msg: "'su root' failed"},
+			want: fmt.Sprintf("<34>1 2003-10-11T22:14:15.000003Z mymachine.example.com su %d ID47 - 'su root' failed", pid),
+		},
+		{
+			m:    message{format: RFC5424, p: LOG_LOCAL4 | LOG_NOTICE, time: tm, tag: "how's it going?"},
+			want: fmt.Sprintf("<165>1 2003-10-11T22:14:15.000003Z - how's_it_going? %d - -", pid),
+		},
+		{
+			m: message{
+				format: RFC5424, p: LOG_LOCAL4 | LOG_NOTICE, time: tm, hostname: "host", tag: "evntslog", msgID: "ID47",
+				data: []SDElement{
+					{ID: "exampleSDID@32473", Params: []SDParam{{"iut", "3"}, {"eventSource", "Application"}}},
+					{ID: "examplePriority@32473", Params: []SDParam{{"class", `a"b\c]d`}}},
+				},
+				msg: "An application event log entry...",
+			},
+			want: fmt.Sprintf(`<165>1 2003-10-11T22:14:15.000003Z host evntslog %d ID47 [exampleSDID@32473 iut="3" eventSource="Application"][examplePriority@32473 class="a\"b\\c\]d"] An application event log entry...`, pid),
+		},
+	}
+	for _, test := range tests {
+		if got := string(test.m.appendTo(nil, test.local)); got != test.want {
+			t.Errorf("got  %q\nwant %q", got, test.want)
+		}
+	}
+}
+
+func TestWriteStructuredErrors(t *testing.T) {
+	done := make(chan string, 1)
+	addr, sock, srvWG := startServer(t, "udp", "", done)
+	defer srvWG.Wait()
+	defer sock.Close()
+
+	w, err := Dial("udp", addr, LOG_USER|LOG_INFO, "syslog_test")
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer w.Close()
+	if err := w.WriteStructured(LOG_INFO, "ID1", nil, "msg"); err == nil {
+		t.Error("WriteStructured with RFC3164 format succeeded, want error")
+	}
+
+	w5424, err := DialConfig("udp", addr, LOG_USER|LOG_INFO, "syslog_test", &Config{Format: RFC5424})
+	if err != nil {
+		t.Fatalf("DialConfig() failed: %v", err)
+	}
+	defer w5424.Close()
+	for _, data := range [][]SDElement{
+		{{ID: ""}},
+		{{ID: "a b"}},
+		{{ID: "x=y"}},
+		{{ID: strings.Repeat("a", 33)}},
+		{{ID: "ok", Params: []SDParam{{Name: `"quoted"`}}}},
+		{{ID: "ok", Params: []SDParam{{Name: "n", Value: "bad\xffutf8"}}}},
+	} {
+		if err := w5424.WriteStructured(LOG_INFO, "", data, "msg"); err == nil {
+			t.Errorf("WriteStructured(%v) succeeded, want error", data)
+		}
+	}
+}
+
+func TestDialConfigTLSNetwork(t *testing.T) {
+	_, err := DialConfig("udp", "127.0.0.1:6514", LOG_USER|LOG_INFO, "syslog_test", &Config{TLSConfig: &tls.Config{}})
+	if err == nil {
+		t.Fatal("DialConfig with TLS over udp succeeded, want error")
+	}
+}
+
+// readOctetCounted reads a single RFC 6587 octet-counted message from r.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	n, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(n, " "))
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// runOctetCountedServer accepts a single connection from l and sends
+// each message it reads to done.
+func runOctetCountedServer(t *testing.T, l net.Listener, done chan<- string) {
+	c, err := l.Accept()
+	if err != nil {
+		t.Error(err)
+		close(done)
+		return
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	for {
+		s, err := readOctetCounted(r)
+		if err != nil {
+			close(done)
+			return
+		}
+		done <- s
+	}
+}
+
+func testOctetCounted(t *testing.T, l net.Listener, config *Config) {
+	done := make(chan string, 2)
+	go runOctetCountedServer(t, l, done)
+
+	w, err := DialConfig("tcp", l.Addr().String(), LOG_LOCAL0|LOG_INFO, "syslog_test", config)
+	if err != nil {
+		t.Fatalf("DialConfig() failed: %v", err)
+	}
+	if err := w.Info("line one\nline two"); err != nil {
+		t.Fatalf("Info() failed: %v", err)
+	}
+	data := []SDElement{{ID: "meta@32473", Params: []SDParam{{"seq", "2"}}}}
+	if err := w.WriteStructured(LOG_WARNING, "ID2", data, "second"); err != nil {
+		t.Fatalf("WriteStructured() failed: %v", err)
+	}
+	w.Close()
+
+	pid := os.Getpid()
+	for _, want := range []string{
+		fmt.Sprintf(`^<134>1 \S+ testhost syslog_test %d - - line one\nline two$`, pid),
+		fmt.Sprintf(`^<132>1 \S+ testhost syslog_test %d ID2 \[meta@32473 seq="2"\] second$`, pid),
+	} {
+		got, ok := <-done
+		if !ok {
+			t.Fatalf("server stopped, want message matching %q", want)
+		}
+		if !regexp.MustCompile(want).MatchString(got) {
+			t.Errorf("got %q, want match for %q", got, want)
+		}
+	}
+}
+
+func TestOctetCountingFraming(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	testOctetCounted(t, l, &Config{
+		Format:   RFC5424,
+		Framing:  OctetCountingFraming,
+		Hostname: "testhost",
+	})
+}
+
+func TestTLS(t *testing.T) {
+	// Borrow the certificate of an httptest server, which is valid
+	// for 127.0.0.1.
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	testOctetCounted(t, l, &Config{
+		Format:    RFC5424,
+		Hostname:  "testhost",
+		TLSConfig: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+	})
+}
@@ -2216,3 +2216,121 @@ func TestDNSPacketSize(t *testing.T) {
 		t.Errorf("lookup failed: %v", err)
 	}
 }
+
+// fakeDNSTransport is a DNSTransport that answers queries with rh.
+type fakeDNSTransport struct {
+	name string
+	rh   func(q dnsmessage.Message) (dnsmessage.Message, error)
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func (t *fakeDNSTransport) String() string { return t.name }
+
+func (t *fakeDNSTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("no deadline for exchange")
+	}
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.queries = append(t.queries, q.Questions[0].Name.String()+" "+q.Questions[0].Type.String())
+	t.mu.Unlock()
+	r, err := t.rh(q)
+	if err != nil {
+		return nil, err
+	}
+	return r.Pack()
+}
+
+func TestDNSTransport(t *testing.T) {
+	defer dnsWaitGroup.Wait()
+
+	conf, err := newResolvConfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.teardown()
+	if err := conf.writeAndUpdate([]string{
+		"nameserver 192.0.2.53",
+		"search x.golang.org",
+		"options ndots:2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	answer := func(q dnsmessage.Message) (dnsmessage.Message, error) {
+		r := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:                 q.Header.ID,
+				Response:           true,
+				RecursionAvailable: true,
+			},
+			Questions: q.Questions,
+		}
+		if q.Questions[0].Name.String() != "www.x.golang.org." {
+			r.Header.RCode = dnsmessage.RCodeNameError
+			return r, nil
+		}
+		if q.Questions[0].Type == dnsmessage.TypeA {
+			r.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{
+					Name:  q.Questions[0].Name,
+					Type:  dnsmessage.TypeA,
+					Class: dnsmessage.ClassINET,
+				},
+				Body: &dnsmessage.AResource{A: TestAddr},
+			}}
+		}
+		return r, nil
+	}
+	tr := &fakeDNSTransport{name: "fake-transport", rh: answer}
+	r := &Resolver{
+		Transport: tr,
+		Dial: func(ctx context.Context, network, address string) (Conn, error) {
+			t.Errorf("resolver with a Transport dialed %s %s", network, address)
+			return nil, errors.New("unexpected dial")
+		},
+	}
+
+	// The search list from resolv.conf is applied.
+	addrs, err := r.LookupHost(context.Background(), "www")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.1"}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("LookupHost = %v; want %v", addrs, want)
+	}
+	tr.mu.Lock()
+	queries := strings.Join(tr.queries, ",")
+	tr.mu.Unlock()
+	if !strings.Contains(queries, "www.x.golang.org. TypeA") {
+		t.Errorf("queries = %v; want www.x.golang.org A query", queries)
+	}
+
+	_, err = r.LookupHost(context.Background(), "missing.example.com")
+	if de, ok := err.(*DNSError); !ok || !de.IsNotFound || de.Server != "fake-transport" {
+		t.Errorf("LookupHost of missing name: err = %#v; want not found from fake-transport", err)
+	}
+
+	// Transport errors and invalid responses are reported.
+	tr.rh = func(q dnsmessage.Message) (dnsmessage.Message, error) {
+		return dnsmessage.Message{}, errors.New("connection refused by test")
+	}
+	_, err = r.LookupHost(context.Background(), "www")
+	if de, ok := err.(*DNSError); !ok || de.Server != "fake-transport" || !strings.Contains(de.Err, "refused by test") {
+		t.Errorf("LookupHost with failing transport: err = %#v", err)
+	}
+	tr.rh = func(q dnsmessage.Message) (dnsmessage.Message, error) {
+		r, err := answer(q)
+		r.Header.ID++
+		return r, err
+	}
+	_, err = r.LookupHost(context.Background(), "www")
+	if de, ok := err.(*DNSError); !ok || de.Err != errInvalidDNSResponse.Error() {
+		t.Errorf("LookupHost with mismatched response ID: err = %#v", err)
+	}
+}
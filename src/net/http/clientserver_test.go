@@ -1620,6 +1620,46 @@ func testIdentityTransferEncoding(t *testing.T, h2 bool) {
 	}
 }
 
+func TestInformationalResponses_h1(t *testing.T) { testInformationalResponses(t, h1Mode) }
+func TestInformationalResponses_h2(t *testing.T) { testInformationalResponses(t, h2Mode) }
+func testInformationalResponses(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, h2, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusProcessing)
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(StatusEarlyHints)
+		w.Write([]byte("body"))
+	}))
+	defer cst.close()
+
+	var codes []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			codes = append(codes, code)
+			return nil
+		},
+	}
+	req, _ := NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", cst.ts.URL, nil)
+	res, err := cst.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if want := []int{StatusProcessing, StatusEarlyHints}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("informational responses = %v, want %v", codes, want)
+	}
+	if res.StatusCode != StatusOK {
+		t.Errorf("status = %d, want %d", res.StatusCode, StatusOK)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "body" {
+		t.Errorf("body = %q, want %q", body, "body")
+	}
+}
+
 func TestEarlyHintsRequest_h1(t *testing.T) { testEarlyHintsRequest(t, h1Mode) }
 func TestEarlyHintsRequest_h2(t *testing.T) { testEarlyHintsRequest(t, h2Mode) }
 func testEarlyHintsRequest(t *testing.T, h2 bool) {
@@ -0,0 +1,446 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http/internal/ascii"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// DefaultCompressionMinSize is the default value of
+// CompressionConfig.MinSize.
+const DefaultCompressionMinSize = 1024
+
+// A CompressionConfig configures the compression of response bodies
+// by a Server or by CompressHandler.
+//
+// A response is compressed if the request's Accept-Encoding header
+// field accepts one of the supported content codings, the response's
+// media type is one of the compressible types, and its body is at
+// least MinSize bytes long. Responses that already have a
+// Content-Encoding, partial content (206) responses, responses to HEAD
+// requests, and responses with the Cache-Control directive
+// "no-transform" are never compressed.
+//
+// When a response is compressed, its Content-Length header field is
+// removed and a strong ETag is made weak. Every response whose media
+// type is compressible has "Accept-Encoding" added to its Vary header
+// field.
+//
+// The "gzip" coding is always supported. Other codings may be added
+// with RegisterEncoding.
+type CompressionConfig struct {
+	// MinSize is the size in bytes of the smallest response body to
+	// compress. If zero, DefaultCompressionMinSize is used.
+	// Bodies are buffered until MinSize bytes have been written,
+	// the handler returns, or the response is flushed.
+	MinSize int
+
+	// ContentTypes lists the media types of responses to compress,
+	// such as "application/json". An entry of the form "type/*"
+	// matches all subtypes of type. If ContentTypes is nil, the
+	// text types, JSON, XML, JavaScript, WebAssembly and SVG are
+	// compressed.
+	ContentTypes []string
+
+	// GzipLevel is the compression level of the gzip coding, as
+	// defined by compress/gzip. If zero, gzip.DefaultCompression is used.
+	GzipLevel int
+
+	encodings []contentEncoding // registered, in order of preference
+}
+
+// A contentEncoding is a content coding supported by a CompressionConfig.
+type contentEncoding struct {
+	name      string
+	newWriter func(io.Writer) io.WriteCloser
+}
+
+// RegisterEncoding adds support for the content coding with the given
+// name, such as "br" or "zstd". The newWriter function returns a writer
+// that encodes the data written to it and writes it to w. If the writer
+// has a Flush method, with or without an error result, it is called
+// when the response is flushed.
+//
+// When a client accepts several codings equally, registered codings
+// are preferred to gzip, and earlier registrations to later ones.
+// RegisterEncoding must not be called once the configuration is in use.
+func (c *CompressionConfig) RegisterEncoding(name string, newWriter func(w io.Writer) io.WriteCloser) {
+	name, _ = ascii.ToLower(name)
+	c.encodings = append(c.encodings, contentEncoding{name, newWriter})
+}
+
+func (c *CompressionConfig) minSize() int {
+	if c.MinSize > 0 {
+		return c.MinSize
+	}
+	return DefaultCompressionMinSize
+}
+
+// compressibleType reports whether responses with the given Content-Type
+// header value are compressed.
+func (c *CompressionConfig) compressibleType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	typ, sub, _ := strings.Cut(mt, "/")
+	if c.ContentTypes == nil {
+		switch {
+		case typ == "text":
+			return true
+		case typ == "application":
+			switch sub {
+			case "json", "xml", "javascript", "x-javascript", "ecmascript", "wasm":
+				return true
+			}
+			return strings.HasSuffix(sub, "+json") || strings.HasSuffix(sub, "+xml")
+		case mt == "image/svg+xml":
+			return true
+		}
+		return false
+	}
+	for _, ct := range c.ContentTypes {
+		ct, _ = ascii.ToLower(ct)
+		if ct == mt || strings.HasSuffix(ct, "/*") && ct[:len(ct)-2] == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the content coding to use for a request with the
+// given Accept-Encoding header fields, or nil if the response should not
+// be encoded.
+func (c *CompressionConfig) negotiate(acceptEncoding []string) *contentEncoding {
+	qvalues := parseAcceptEncoding(acceptEncoding)
+	if qvalues == nil {
+		return nil
+	}
+	var best *contentEncoding
+	bestQ := 0.0
+	consider := func(e *contentEncoding) {
+		if q := qvalues.q(e.name); q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	for i := range c.encodings {
+		consider(&c.encodings[i])
+	}
+	gz := &contentEncoding{name: "gzip", newWriter: c.newGzipWriter}
+	consider(gz)
+	return best
+}
+
+// acceptedCodings maps the lower-case content codings listed in an
+// Accept-Encoding header field to their quality values.
+type acceptedCodings map[string]float64
+
+// parseAcceptEncoding parses the given Accept-Encoding header fields.
+// It returns nil if there are none. See RFC 9110, Section 12.5.3.
+func parseAcceptEncoding(acceptEncoding []string) acceptedCodings {
+	if len(acceptEncoding) == 0 {
+		return nil
+	}
+	qvalues := make(acceptedCodings)
+	for _, v := range acceptEncoding {
+		for _, elem := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(elem, ";")
+			coding, _ = ascii.ToLower(textproto.TrimString(coding))
+			if coding == "" {
+				continue
+			}
+			if coding == "x-gzip" {
+				coding = "gzip"
+			}
+			q := 1.0
+			for _, p := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(p, "=")
+				if ascii.EqualFold(textproto.TrimString(name), "q") {
+					if f, err := strconv.ParseFloat(textproto.TrimString(value), 64); err == nil && f >= 0 && f <= 1 {
+						q = f
+					} else {
+						q = 0
+					}
+				}
+			}
+			if _, ok := qvalues[coding]; !ok {
+				qvalues[coding] = q
+			}
+		}
+	}
+	return qvalues
+}
+
+// q returns the quality value of the named coding.
+func (a acceptedCodings) q(coding string) float64 {
+	if q, ok := a[coding]; ok {
+		return q
+	}
+	return a["*"]
+}
+
+var gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+func (c *CompressionConfig) newGzipWriter(w io.Writer) io.WriteCloser {
+	level := c.GzipLevel
+	if level == 0 || level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	pool := &gzipWriterPools[level-gzip.HuffmanOnly]
+	if zw, ok := pool.Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return &pooledGzipWriter{zw, pool}
+	}
+	zw, _ := gzip.NewWriterLevel(w, level)
+	return &pooledGzipWriter{zw, pool}
+}
+
+// A pooledGzipWriter returns its gzip.Writer to a pool when closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	err := w.Writer.Close()
+	w.Writer.Reset(nil)
+	w.pool.Put(w.Writer)
+	return err
+}
+
+// CompressHandler returns a handler that serves requests with h,
+// compressing response bodies as configured by c.
+// If c is nil, a zero CompressionConfig is used.
+//
+// The ResponseWriter passed to h implements Flusher and Hijacker,
+// which succeed if the original ResponseWriter supports them, and has
+// an Unwrap method for use with ResponseController. A response cannot
+// be hijacked once its compressed body has begun.
+func CompressHandler(h Handler, c *CompressionConfig) Handler {
+	if c == nil {
+		c = &CompressionConfig{}
+	}
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		serveCompressed(h, c, w, r)
+	})
+}
+
+func serveCompressed(h Handler, c *CompressionConfig, w ResponseWriter, r *Request) {
+	enc := c.negotiate(r.Header["Accept-Encoding"])
+	if r.Method == "HEAD" {
+		enc = nil
+	}
+	cw := &compressWriter{rw: w, config: c, enc: enc}
+	// Finish even if h panics, so that the encoder is closed and
+	// returned to its pool.
+	defer cw.finish()
+	h.ServeHTTP(cw, r)
+}
+
+// A compressWriter is a ResponseWriter that compresses the
+// response body.
+type compressWriter struct {
+	rw     ResponseWriter
+	config *CompressionConfig
+	enc    *contentEncoding // negotiated coding, or nil
+
+	wroteHeader bool // the handler called WriteHeader or Write
+	code        int
+	committed   bool // the header has been written to rw
+	buf         []byte
+	w           io.WriteCloser // encodes to rw, if compressing
+	hijacked    bool
+}
+
+func (cw *compressWriter) Header() Header { return cw.rw.Header() }
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.committed {
+		// Let the underlying ResponseWriter report the error.
+		cw.rw.WriteHeader(code)
+		return
+	}
+	if cw.wroteHeader {
+		return
+	}
+	if code >= 100 && code <= 199 && code != StatusSwitchingProtocols {
+		cw.rw.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+	cw.code = code
+	if !cw.compressible() {
+		cw.commit(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(StatusOK)
+	}
+	if cw.committed {
+		if cw.w != nil {
+			return cw.w.Write(p)
+		}
+		return cw.rw.Write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.config.minSize() {
+		if err := cw.commit(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// compressible reports whether the response may be compressed,
+// based on its status code and header. It does not consider the
+// response's media type or size.
+func (cw *compressWriter) compressible() bool {
+	switch {
+	case cw.code < 200,
+		cw.code == StatusNoContent,
+		cw.code == StatusPartialContent,
+		cw.code == StatusNotModified:
+		return false
+	}
+	h := cw.rw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	for _, v := range h["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			if ascii.EqualFold(textproto.TrimString(d), "no-transform") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// commit writes the response header to the underlying ResponseWriter,
+// followed by any buffered body data. If allowCompression is set, the
+// response body is compressed if it qualifies.
+func (cw *compressWriter) commit(allowCompression bool) error {
+	cw.committed = true
+	h := cw.rw.Header()
+	compressible := cw.compressible()
+	if compressible {
+		if _, haveType := h["Content-Type"]; !haveType && len(cw.buf) > 0 {
+			// Sniff the uncompressed data, as the Server would.
+			h.Set("Content-Type", DetectContentType(cw.buf))
+		}
+		compressible = cw.config.compressibleType(h.Get("Content-Type"))
+	}
+	if compressible {
+		if !httpguts.HeaderValuesContainsToken(h["Vary"], "Accept-Encoding") {
+			h.Add("Vary", "Accept-Encoding")
+		}
+		if cl := h.Get("Content-Length"); cl != "" {
+			if n, err := strconv.ParseInt(cl, 10, 64); err == nil && n < int64(cw.config.minSize()) {
+				allowCompression = false
+			}
+		}
+	}
+	if compressible && allowCompression && cw.enc != nil {
+		h.Set("Content-Encoding", cw.enc.name)
+		h.Del("Content-Length")
+		// Byte ranges of the uncompressed body, as served by
+		// ServeContent, do not apply to the compressed one.
+		h.Del("Accept-Ranges")
+		if etag := h.Get("Etag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("Etag", "W/"+etag)
+		}
+		cw.rw.WriteHeader(cw.code)
+		cw.w = cw.enc.newWriter(cw.rw)
+	} else {
+		cw.rw.WriteHeader(cw.code)
+	}
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.w != nil {
+		_, err = cw.w.Write(cw.buf)
+	} else {
+		_, err = cw.rw.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// finish completes the response after the handler returns.
+func (cw *compressWriter) finish() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.committed && cw.wroteHeader {
+		cw.commit(false)
+	}
+	if cw.w != nil {
+		cw.w.Close()
+	}
+}
+
+// Flush sends any buffered data to the client. If the response has
+// not yet been committed, it is compressed if it qualifies, whatever
+// its size.
+func (cw *compressWriter) Flush() {
+	cw.FlushError()
+}
+
+// FlushError is like Flush, but returns any error encountered.
+func (cw *compressWriter) FlushError() error {
+	if !cw.wroteHeader {
+		cw.WriteHeader(StatusOK)
+	}
+	if !cw.committed {
+		_, haveType := cw.rw.Header()["Content-Type"]
+		if err := cw.commit(haveType || len(cw.buf) > 0); err != nil {
+			return err
+		}
+	}
+	switch f := cw.w.(type) {
+	case interface{ Flush() error }:
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return NewResponseController(cw.rw).Flush()
+}
+
+// Hijack implements the Hijacker interface. It fails if the
+// response body is being compressed.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !cw.committed && cw.wroteHeader {
+		cw.commit(false)
+	}
+	if cw.w != nil {
+		return nil, nil, ErrNotSupported
+	}
+	c, brw, err := NewResponseController(cw.rw).Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return c, brw, err
+}
+
+// Unwrap returns the ResponseWriter wrapped by cw.
+func (cw *compressWriter) Unwrap() ResponseWriter {
+	return cw.rw
+}
@@ -0,0 +1,438 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	. "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var compressibleText = strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+
+func TestServerCompression_h1(t *testing.T) { testServerCompression(t, h1Mode) }
+func TestServerCompression_h2(t *testing.T) { testServerCompression(t, h2Mode) }
+func testServerCompression(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, h2, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, compressibleText)
+	}), func(ts *httptest.Server) {
+		ts.Config.Compression = &CompressionConfig{}
+	})
+	defer cst.close()
+
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Uncompressed {
+		t.Errorf("response was not compressed")
+	}
+	if string(body) != compressibleText {
+		t.Errorf("body = %q, want %q", body, compressibleText)
+	}
+	if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want %q", got, "Accept-Encoding")
+	}
+}
+
+// gunzip returns the decompressed contents of a gzip stream, which may
+// have been flushed but not closed.
+func gunzip(t *testing.T, b []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	var out bytes.Buffer
+	_, err = io.Copy(&out, zr)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		t.Fatalf("reading gzip data: %v", err)
+	}
+	return out.String()
+}
+
+func TestCompressHandler(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		header         Header
+		code           int
+		body           string
+		config         *CompressionConfig
+
+		wantEncoding string
+		wantVary     bool
+		wantHeader   Header
+	}{{
+		name:           "compressed",
+		acceptEncoding: "gzip, deflate",
+		header:         Header{"Content-Type": {"text/html"}},
+		body:           compressibleText,
+		wantEncoding:   "gzip",
+		wantVary:       true,
+	}, {
+		name:           "sniffed",
+		acceptEncoding: "gzip",
+		body:           "<html>" + compressibleText,
+		wantEncoding:   "gzip",
+		wantVary:       true,
+		wantHeader:     Header{"Content-Type": {"text/html; charset=utf-8"}},
+	}, {
+		name:           "x-gzip",
+		acceptEncoding: "x-gzip",
+		header:         Header{"Content-Type": {"application/json"}},
+		body:           compressibleText,
+		wantEncoding:   "gzip",
+		wantVary:       true,
+	}, {
+		name:           "wildcard",
+		acceptEncoding: "*",
+		header:         Header{"Content-Type": {"application/ld+json"}},
+		body:           compressibleText,
+		wantEncoding:   "gzip",
+		wantVary:       true,
+	}, {
+		name:           "headers adjusted",
+		acceptEncoding: "gzip",
+		header: Header{
+			"Content-Type":   {"text/plain"},
+			"Content-Length": {"4500"},
+			"Etag":           {`"abc"`},
+			"Vary":           {"Origin"},
+		},
+		body:         compressibleText,
+		wantEncoding: "gzip",
+		wantHeader: Header{
+			"Etag": {`W/"abc"`},
+			"Vary": {"Origin", "Accept-Encoding"},
+		},
+	}, {
+		name:           "small",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           "short",
+		wantVary:       true,
+	}, {
+		name:           "min size",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           "short",
+		config:         &CompressionConfig{MinSize: 5},
+		wantEncoding:   "gzip",
+		wantVary:       true,
+	}, {
+		name:           "not accepted",
+		acceptEncoding: "",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           compressibleText,
+		wantVary:       true,
+	}, {
+		name:           "refused",
+		acceptEncoding: "gzip;q=0, identity",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           compressibleText,
+		wantVary:       true,
+	}, {
+		name:           "unsupported coding",
+		acceptEncoding: "br",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           compressibleText,
+		wantVary:       true,
+	}, {
+		name:           "incompressible type",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"image/png"}},
+		body:           compressibleText,
+	}, {
+		name:           "configured type",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"image/x-portable-pixmap"}},
+		body:           compressibleText,
+		config:         &CompressionConfig{ContentTypes: []string{"image/*"}},
+		wantEncoding:   "gzip",
+		wantVary:       true,
+	}, {
+		name:           "unconfigured type",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           compressibleText,
+		config:         &CompressionConfig{ContentTypes: []string{"application/json"}},
+	}, {
+		name:           "already encoded",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"br"}},
+		body:           compressibleText,
+		wantEncoding:   "br",
+	}, {
+		name:           "no-transform",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}, "Cache-Control": {"max-age=10, No-Transform"}},
+		body:           compressibleText,
+	}, {
+		name:           "partial content",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}, "Content-Range": {"bytes 0-4499/10000"}},
+		code:           StatusPartialContent,
+		body:           compressibleText,
+	}, {
+		name:           "head",
+		method:         "HEAD",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}},
+		body:           compressibleText,
+		wantVary:       true,
+	}, {
+		name:           "error status",
+		acceptEncoding: "gzip",
+		header:         Header{"Content-Type": {"text/plain"}},
+		code:           StatusNotFound,
+		body:           compressibleText,
+		wantEncoding:   "gzip",
+		wantVary:       true,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			h := HandlerFunc(func(w ResponseWriter, r *Request) {
+				for k, v := range test.header {
+					w.Header()[k] = v
+				}
+				if test.code != 0 {
+					w.WriteHeader(test.code)
+				}
+				// Write in pieces, to exercise buffering.
+				for s := test.body; s != ""; {
+					n := len(s)
+					if n > 100 {
+						n = 100
+					}
+					io.WriteString(w, s[:n])
+					s = s[n:]
+				}
+			})
+			method := test.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if test.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			CompressHandler(h, test.config).ServeHTTP(rec, req)
+			res := rec.Result()
+			if test.code != 0 && res.StatusCode != test.code {
+				t.Errorf("status = %v, want %v", res.StatusCode, test.code)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != test.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, test.wantEncoding)
+			}
+			if got, want := strings.Contains(strings.Join(res.Header["Vary"], ","), "Accept-Encoding"), test.wantVary || test.wantHeader["Vary"] != nil; got != want {
+				t.Errorf("Vary = %q, want Accept-Encoding listed = %v", res.Header["Vary"], want)
+			}
+			for k, v := range test.wantHeader {
+				if got := res.Header[k]; strings.Join(got, "|") != strings.Join(v, "|") {
+					t.Errorf("%v = %q, want %q", k, got, v)
+				}
+			}
+			body := rec.Body.String()
+			if test.wantEncoding == "gzip" {
+				if _, ok := res.Header["Content-Length"]; ok {
+					t.Errorf("compressed response has Content-Length %q", res.Header.Get("Content-Length"))
+				}
+				body = gunzip(t, rec.Body.Bytes())
+			}
+			if body != test.body {
+				t.Errorf("body = %q, want %q", body, test.body)
+			}
+		})
+	}
+}
+
+// upperWriter is a toy content coding that converts to upper case.
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u upperWriter) Write(p []byte) (int, error) { return u.w.Write(bytes.ToUpper(p)) }
+func (u upperWriter) Close() error                { return nil }
+
+func TestCompressNegotiation(t *testing.T) {
+	c := &CompressionConfig{MinSize: 1}
+	c.RegisterEncoding("Upper", func(w io.Writer) io.WriteCloser { return upperWriter{w} })
+	h := CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello")
+	}), c)
+	for _, test := range []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"gzip, upper", "upper"},
+		{"gzip;q=1.0, upper;q=0.9", "gzip"},
+		{"GZIP; Q=0.5, upper;q=0.4", "gzip"},
+		{"upper", "upper"},
+		{"*", "upper"},
+		{"*, upper;q=0", "gzip"},
+		{"*;q=0", ""},
+		{"gzip;q=bogus", ""},
+		{"identity", ""},
+		{"", ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != test.want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", test.acceptEncoding, got, test.want)
+		}
+		if test.want == "upper" && rec.Body.String() != "HELLO" {
+			t.Errorf("Accept-Encoding %q: body = %q, want %q", test.acceptEncoding, rec.Body.String(), "HELLO")
+		}
+	}
+}
+
+func TestCompressHandlerPanic(t *testing.T) {
+	var closed bool
+	c := &CompressionConfig{MinSize: 1}
+	c.RegisterEncoding("upper", func(w io.Writer) io.WriteCloser {
+		return closeFuncWriter{upperWriter{w}, func() { closed = true }}
+	})
+	h := CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello")
+		panic(ErrAbortHandler)
+	}), c)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "upper")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("handler did not panic")
+		}
+		if !closed {
+			t.Error("encoder was not closed after the handler panicked")
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// closeFuncWriter calls close when it is closed.
+type closeFuncWriter struct {
+	io.WriteCloser
+	close func()
+}
+
+func (w closeFuncWriter) Close() error {
+	w.close()
+	return w.WriteCloser.Close()
+}
+
+func TestCompressFlush(t *testing.T) {
+	flushed := make(chan bool)
+	proceed := make(chan bool)
+	h := CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: one\n\n")
+		if err := NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		flushed <- true
+		<-proceed
+		io.WriteString(w, "data: two\n\n")
+		w.(Flusher).Flush()
+		flushed <- true
+		<-proceed
+	}), nil)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		h.ServeHTTP(rec, req)
+		close(done)
+	}()
+	for _, want := range []string{"data: one\n\n", "data: one\n\ndata: two\n\n"} {
+		<-flushed
+		if !rec.Flushed {
+			t.Fatalf("response was not flushed")
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", got)
+		}
+		if got := gunzip(t, rec.Body.Bytes()); got != want {
+			t.Errorf("flushed data = %q, want %q", got, want)
+		}
+		proceed <- true
+	}
+	<-done
+	if got := gunzip(t, rec.Body.Bytes()); got != "data: one\n\ndata: two\n\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestCompressFileServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(compressibleText)},
+		"image.png":  {Data: []byte(compressibleText)},
+	}
+	ts := httptest.NewServer(CompressHandler(FileServer(FS(fsys)), nil))
+	defer ts.Close()
+	tr := &Transport{DisableCompression: true}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	get := func(path string, header ...string) (*Response, []byte) {
+		t.Helper()
+		req, _ := NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+
+	res, body := get("/")
+	if res.Header.Get("Content-Encoding") != "gzip" || res.ContentLength == int64(len(compressibleText)) {
+		t.Errorf("index: Content-Encoding %q, ContentLength %v; want gzip and compressed length", res.Header.Get("Content-Encoding"), res.ContentLength)
+	} else if got := gunzip(t, body); got != compressibleText {
+		t.Errorf("index: decompressed body %q", got)
+	}
+	if got := res.Header.Get("Accept-Ranges"); got != "" {
+		t.Errorf("index: Accept-Ranges %q on a compressed response; want none", got)
+	}
+
+	res, body = get("/", "Range", "bytes=4-8")
+	if res.StatusCode != StatusPartialContent || res.Header.Get("Content-Encoding") != "" || string(body) != compressibleText[4:9] {
+		t.Errorf("range: got %v, Content-Encoding %q, body %q", res.Status, res.Header.Get("Content-Encoding"), body)
+	}
+
+	res, body = get("/image.png")
+	if res.Header.Get("Content-Encoding") != "" || string(body) != compressibleText {
+		t.Errorf("image: Content-Encoding %q, body %q", res.Header.Get("Content-Encoding"), body)
+	}
+	if got := res.Header.Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("image: Accept-Ranges %q; want %q", got, "bytes")
+	}
+}
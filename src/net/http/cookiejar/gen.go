@@ -0,0 +1,135 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+
+// This program generates table.go, which holds the rules of the
+// public suffix list used by DefaultPublicSuffixList.
+//
+// Run it with
+//
+//	go run gen.go
+//
+// to fetch the current list from publicsuffix.org, or with
+//
+//	go run gen.go -file public_suffix_list.dat
+//
+// to use a local copy.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	url    = flag.String("url", "https://publicsuffix.org/list/public_suffix_list.dat", "URL of the public suffix list")
+	file   = flag.String("file", "", "local copy of the public suffix list; overrides -url")
+	output = flag.String("output", "table.go", "output file")
+)
+
+func main() {
+	flag.Parse()
+	data, err := readList()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := parse(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Code generated by gen.go; DO NOT EDIT.
+
+package cookiejar
+
+// pslVersion describes the public suffix list pslRules was generated from.
+const pslVersion = "publicsuffix.org's public_suffix_list.dat, sha256 %x"
+
+// pslRules holds the sorted rules of the public suffix list,
+// with internationalized labels in their ASCII (Punycode) form.
+// Wildcard rules start with "*." and exception rules with "!".
+var pslRules = [...]string{
+`, sha256.Sum256(data))
+	for _, r := range rules {
+		fmt.Fprintf(&buf, "\t%q,\n", r)
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readList() ([]byte, error) {
+	if *file != "" {
+		return os.ReadFile(*file)
+	}
+	res, err := http.Get(*url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", *url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// parse returns the sorted, deduplicated rules of the list in data.
+// Both the ICANN and private sections are included.
+func parse(data []byte) ([]string, error) {
+	seen := make(map[string]bool)
+	var rules []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		// Each line is only read up to the first whitespace.
+		line := sc.Text()
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		prefix := ""
+		switch {
+		case strings.HasPrefix(line, "!"):
+			prefix, line = "!", line[1:]
+		case strings.HasPrefix(line, "*."):
+			prefix, line = "*.", line[2:]
+		}
+		// Rules are lowercase; mapping them with the lookup
+		// profile only converts internationalized labels.
+		ascii, err := idna.Lookup.ToASCII(line)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", line, err)
+		}
+		if r := prefix + ascii; !seen[r] {
+			seen[r] = true
+			rules = append(rules, r)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(rules)
+	return rules, nil
+}
@@ -3,6 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // Package cookiejar implements an in-memory RFC 6265-compliant http.CookieJar.
+//
+// The contents of a Jar can be saved and restored with its Save and Load
+// methods, for example to keep cookies across runs of a program.
 package cookiejar
 
 import (
@@ -30,8 +33,8 @@ import (
 // testing but it is not secure: it means that the HTTP server for foo.com can
 // set a cookie for bar.com.
 //
-// A public suffix list implementation is in the package
-// golang.org/x/net/publicsuffix.
+// DefaultPublicSuffixList is an implementation bundled with this package.
+// Another one is in the package golang.org/x/net/publicsuffix.
 type PublicSuffixList interface {
 	// PublicSuffix returns the public suffix of domain.
 	//
@@ -51,16 +54,21 @@ type Options struct {
 	// PublicSuffixList is the public suffix list that determines whether
 	// an HTTP server can set a cookie for a domain.
 	//
-	// A nil value is valid and may be useful for testing but it is not
-	// secure: it means that the HTTP server for foo.co.uk can set a cookie
-	// for bar.co.uk.
+	// If nil, DefaultPublicSuffixList is used.
 	PublicSuffixList PublicSuffixList
+
+	// PersistSessionCookies, if true, makes Save also write session
+	// cookies, which have no expiry time. By default Save omits them,
+	// as a browser discards session cookies when it exits.
+	PersistSessionCookies bool
 }
 
 // Jar implements the http.CookieJar interface from the net/http package.
 type Jar struct {
 	psList PublicSuffixList
 
+	persistSession bool
+
 	// mu locks the remaining fields.
 	mu sync.Mutex
 
@@ -77,10 +85,14 @@ type Jar struct {
 // Options.
 func New(o *Options) (*Jar, error) {
 	jar := &Jar{
+		psList:  DefaultPublicSuffixList,
 		entries: make(map[string]map[string]entry),
 	}
 	if o != nil {
-		jar.psList = o.PublicSuffixList
+		if o.PublicSuffixList != nil {
+			jar.psList = o.PublicSuffixList
+		}
+		jar.persistSession = o.PersistSessionCookies
 	}
 	return jar, nil
 }
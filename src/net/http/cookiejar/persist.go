@@ -0,0 +1,136 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// savedJarVersion is the version of the format written by Save.
+const savedJarVersion = 1
+
+// savedJar is the format written by Save. It is JSON-encoded.
+type savedJar struct {
+	Version int
+	Entries []entry
+}
+
+var errSavedJarVersion = errors.New("cookiejar: unsupported saved jar version")
+
+// Save writes the cookies in j to w, in a format that Load reads.
+// Expired cookies are not written, and neither are session cookies
+// unless the jar was created with Options.PersistSessionCookies.
+//
+// The output contains cookie values, which often grant access to
+// accounts, so it should be stored with appropriate care.
+func (j *Jar) Save(w io.Writer) error {
+	return j.save(w, time.Now())
+}
+
+// save is like Save but takes the current time as a parameter.
+func (j *Jar) save(w io.Writer, now time.Time) error {
+	j.mu.Lock()
+	var entries []entry
+	for _, submap := range j.entries {
+		for _, e := range submap {
+			if e.Persistent {
+				if !e.Expires.After(now) {
+					continue
+				}
+			} else if !j.persistSession {
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	j.mu.Unlock()
+
+	// Write entries in the order they were created, so that Load
+	// preserves the order in which Cookies returns them.
+	sort.Slice(entries, func(i, k int) bool {
+		if !entries[i].Creation.Equal(entries[k].Creation) {
+			return entries[i].Creation.Before(entries[k].Creation)
+		}
+		return entries[i].seqNum < entries[k].seqNum
+	})
+	return json.NewEncoder(w).Encode(savedJar{
+		Version: savedJarVersion,
+		Entries: entries,
+	})
+}
+
+// Load reads cookies written by Save from r and adds them to j,
+// replacing any cookies in j with the same name, domain and path.
+// Cookies that have expired since they were saved are skipped, as
+// are cookies that j would not accept from a server, such as those
+// set for a domain that is a public suffix.
+func (j *Jar) Load(r io.Reader) error {
+	return j.load(r, time.Now())
+}
+
+// load is like Load but takes the current time as a parameter.
+func (j *Jar) load(r io.Reader, now time.Time) error {
+	var saved savedJar
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	if saved.Version != savedJarVersion {
+		return errSavedJarVersion
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range saved.Entries {
+		if !j.validSaved(&e, now) {
+			continue
+		}
+		key := jarKey(e.Domain, j.psList)
+		submap := j.entries[key]
+		if submap == nil {
+			submap = make(map[string]entry)
+			j.entries[key] = submap
+		}
+		id := e.id()
+		if old, ok := submap[id]; ok {
+			e.seqNum = old.seqNum
+		} else {
+			e.seqNum = j.nextSeqNum
+			j.nextSeqNum++
+		}
+		submap[id] = e
+	}
+	return nil
+}
+
+// validSaved reports whether the saved entry e should be loaded
+// into j at time now, normalizing e where needed.
+func (j *Jar) validSaved(e *entry, now time.Time) bool {
+	if e.Persistent {
+		if !e.Expires.After(now) {
+			return false
+		}
+	} else {
+		e.Expires = endOfTime
+	}
+	if e.Path == "" || e.Path[0] != '/' {
+		return false
+	}
+	host, err := canonicalHost(e.Domain)
+	if err != nil || host == "" || host != e.Domain || strings.HasPrefix(host, ".") {
+		return false
+	}
+	if e.HostOnly {
+		return true
+	}
+	// A domain cookie must be one that domainAndType would accept
+	// for a request to its own domain.
+	domain, hostOnly, err := j.domainAndType(host, host)
+	return err == nil && domain == host && !hostOnly
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cookieString(cookies []*http.Cookie) string {
+	var s []string
+	for _, c := range cookies {
+		s = append(s, c.Name+"="+c.Value)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestSaveLoad(t *testing.T) {
+	u, _ := url.Parse("https://www.example.com/path/")
+	for _, tt := range []struct {
+		name           string
+		persistSession bool
+		want           string
+	}{
+		{"persistent only", false, "z=1 a=2"},
+		{"with session cookies", true, "z=1 s=3 a=2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			jar, _ := New(&Options{PersistSessionCookies: tt.persistSession})
+			jar.setCookies(u, []*http.Cookie{
+				{Name: "z", Value: "1", MaxAge: 3600},
+				{Name: "a", Value: "2", MaxAge: 3600, Domain: "example.com", Path: "/"},
+				{Name: "s", Value: "3"},
+				{Name: "short", Value: "4", MaxAge: 60},
+			}, tNow)
+
+			var buf bytes.Buffer
+			if err := jar.save(&buf, tNow); err != nil {
+				t.Fatal(err)
+			}
+
+			// Two minutes later, the short-lived cookie has expired.
+			later := tNow.Add(2 * time.Minute)
+			jar2, _ := New(nil)
+			if err := jar2.load(bytes.NewReader(buf.Bytes()), later); err != nil {
+				t.Fatal(err)
+			}
+			if got := cookieString(jar2.cookies(u, later)); got != tt.want {
+				t.Errorf("cookies after Load = %q; want %q", got, tt.want)
+			}
+			// The domain cookie is still sent to other subdomains.
+			other, _ := url.Parse("https://api.example.com/")
+			if got := cookieString(jar2.cookies(other, later)); got != "a=2" {
+				t.Errorf("cookies for %v after Load = %q; want %q", other, got, "a=2")
+			}
+			// Saved expiry times are kept.
+			if got := jar2.cookies(u, tNow.Add(2*time.Hour)); len(got) != 0 && !tt.persistSession {
+				t.Errorf("cookies after expiry = %v; want none", got)
+			}
+		})
+	}
+}
+
+func TestLoadReplaces(t *testing.T) {
+	u, _ := url.Parse("http://example.com/")
+	jar, _ := New(nil)
+	jar.setCookies(u, []*http.Cookie{{Name: "a", Value: "old", MaxAge: 3600}}, tNow)
+	var buf bytes.Buffer
+	saver, _ := New(nil)
+	saver.setCookies(u, []*http.Cookie{{Name: "a", Value: "new", MaxAge: 3600}}, tNow)
+	if err := saver.save(&buf, tNow); err != nil {
+		t.Fatal(err)
+	}
+	if err := jar.load(&buf, tNow); err != nil {
+		t.Fatal(err)
+	}
+	if got := cookieString(jar.cookies(u, tNow)); got != "a=new" {
+		t.Errorf("cookies = %q; want %q", got, "a=new")
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	const expires = "2013-01-01T13:00:00Z"
+	for _, tt := range []struct {
+		name, entry string
+	}{
+		{"public suffix domain", `{"Name":"a","Value":"1","Domain":"co.uk","Path":"/","Persistent":true,"Expires":"` + expires + `"}`},
+		{"relative path", `{"Name":"a","Value":"1","Domain":"example.com","Path":"x","Persistent":true,"HostOnly":true,"Expires":"` + expires + `"}`},
+		{"uppercase domain", `{"Name":"a","Value":"1","Domain":"EXAMPLE.com","Path":"/","Persistent":true,"HostOnly":true,"Expires":"` + expires + `"}`},
+		{"leading dot", `{"Name":"a","Value":"1","Domain":".example.com","Path":"/","Persistent":true,"Expires":"` + expires + `"}`},
+		{"expired", `{"Name":"a","Value":"1","Domain":"example.com","Path":"/","Persistent":true,"HostOnly":true,"Expires":"2012-01-01T00:00:00Z"}`},
+	} {
+		jar, _ := New(nil)
+		if err := jar.load(strings.NewReader(`{"Version":1,"Entries":[`+tt.entry+`]}`), tNow); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(jar.entries) != 0 {
+			t.Errorf("%s: loaded %v; want nothing", tt.name, jar.entries)
+		}
+	}
+
+	jar, _ := New(nil)
+	if err := jar.load(strings.NewReader(`{"Version":2,"Entries":[]}`), tNow); err != errSavedJarVersion {
+		t.Errorf("loading version 2: err = %v; want %v", err, errSavedJarVersion)
+	}
+	if err := jar.load(strings.NewReader(`not json`), tNow); err == nil {
+		t.Errorf("loading invalid input succeeded")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+//go:generate go run gen.go
+
+import (
+	"net/http/internal/ascii"
+	"sort"
+	"strings"
+)
+
+// DefaultPublicSuffixList is a PublicSuffixList built from a copy of
+// the list published at https://publicsuffix.org/, including both its
+// ICANN and private domains. Its String method describes the copy.
+//
+// Jars use it unless Options.PublicSuffixList is set.
+var DefaultPublicSuffixList PublicSuffixList = publicSuffixList{}
+
+type publicSuffixList struct{}
+
+// PublicSuffix returns the public suffix of domain according to the
+// algorithm at https://publicsuffix.org/list/: an exception rule takes
+// precedence over all others, otherwise the matching rule with the most
+// labels wins, and a domain that matches no rule has its last label as
+// its public suffix. Internationalized labels must be in their ASCII
+// (Punycode) form.
+func (publicSuffixList) PublicSuffix(domain string) string {
+	if lower, ok := ascii.ToLower(domain); ok {
+		domain = lower
+	}
+
+	// The implicit "*" rule.
+	suffix := domain[strings.LastIndexByte(domain, '.')+1:]
+	matched := false
+	for s := domain; ; {
+		dot := strings.IndexByte(s, '.')
+		if hasPSLRule("!" + s) {
+			// Exception rules always have at least two labels.
+			return s[dot+1:]
+		}
+		if !matched && (hasPSLRule(s) || dot >= 0 && hasPSLRule("*"+s[dot:])) {
+			suffix, matched = s, true
+		}
+		if dot < 0 {
+			break
+		}
+		s = s[dot+1:]
+	}
+	return suffix
+}
+
+func (publicSuffixList) String() string {
+	return pslVersion
+}
+
+// hasPSLRule reports whether rule is in pslRules.
+func hasPSLRule(rule string) bool {
+	i := sort.SearchStrings(pslRules[:], rule)
+	return i < len(pslRules) && pslRules[i] == rule
+}
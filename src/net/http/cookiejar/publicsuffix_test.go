@@ -0,0 +1,84 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+var publicSuffixTests = []struct {
+	domain, want string
+}{
+	// No matching rule: the implicit "*" rule applies.
+	{"localhost", "localhost"},
+	{"example", "example"},
+	{"foo.example", "example"},
+
+	// Plain rules.
+	{"com", "com"},
+	{"example.com", "com"},
+	{"www.example.com", "com"},
+	{"EXAMPLE.COM", "com"},
+	{"co.uk", "co.uk"},
+	{"www.example.co.uk", "co.uk"},
+
+	// Private domains are included.
+	{"foo.github.io", "github.io"},
+	{"example.uk.com", "uk.com"},
+
+	// Wildcard and exception rules.
+	{"ck", "ck"},
+	{"foo.ck", "foo.ck"},
+	{"bar.foo.ck", "foo.ck"},
+	{"www.ck", "ck"},
+	{"bar.www.ck", "ck"},
+	{"foo.kobe.jp", "foo.kobe.jp"},
+	{"city.kobe.jp", "kobe.jp"},
+	{"www.city.kobe.jp", "kobe.jp"},
+
+	// Internationalized rules are matched in their ASCII form.
+	{"xn--85x722f.xn--55qx5d.cn", "xn--55qx5d.cn"},
+	{"www.xn--85x722f.xn--55qx5d.cn", "xn--55qx5d.cn"},
+}
+
+func TestDefaultPublicSuffixList(t *testing.T) {
+	for _, tt := range publicSuffixTests {
+		if got := DefaultPublicSuffixList.PublicSuffix(tt.domain); got != tt.want {
+			t.Errorf("PublicSuffix(%q) = %q; want %q", tt.domain, got, tt.want)
+		}
+	}
+	if DefaultPublicSuffixList.String() == "" {
+		t.Errorf("String() is empty")
+	}
+}
+
+func TestPSLRulesSorted(t *testing.T) {
+	for i := 1; i < len(pslRules); i++ {
+		if pslRules[i-1] >= pslRules[i] {
+			t.Fatalf("pslRules not sorted: %q before %q", pslRules[i-1], pslRules[i])
+		}
+	}
+}
+
+func TestNewUsesDefaultPublicSuffixList(t *testing.T) {
+	jar, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, _ := url.Parse("http://www.example.co.uk/")
+	jar.SetCookies(from, []*http.Cookie{
+		{Name: "a", Value: "1", Domain: "co.uk"},
+		{Name: "b", Value: "2", Domain: "example.co.uk"},
+	})
+	other, _ := url.Parse("http://other.co.uk/")
+	if got := jar.Cookies(other); len(got) != 0 {
+		t.Errorf("cookies sent to another registrable domain: %v", got)
+	}
+	if got := jar.Cookies(from); len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("cookies for %v = %v; want only b", from, got)
+	}
+}
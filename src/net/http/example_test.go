@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 )
 
 func ExampleHijacker() {
@@ -193,3 +194,28 @@ func ExampleNotFoundHandler() {
 
 	log.Fatal(http.ListenAndServe(":8080", mux))
 }
+
+func ExampleEventWriter() {
+	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		ew := http.NewEventWriter(w, r)
+		// Close must be called before the handler returns, to stop
+		// the heartbeats.
+		defer ew.Close()
+		ew.Heartbeat(15 * time.Second)
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case t := <-ticker.C:
+				if err := ew.Send(&http.Event{Type: "tick", Data: t.String()}); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
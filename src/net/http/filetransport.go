@@ -11,7 +11,7 @@ import (
 
 // fileTransport implements RoundTripper for the 'file' protocol.
 type fileTransport struct {
-	fh fileHandler
+	fh *fileHandler
 }
 
 // NewFileTransport returns a new RoundTripper, serving the provided
@@ -28,7 +28,7 @@ type fileTransport struct {
 //	res, err := c.Get("file:///etc/passwd")
 //	...
 func NewFileTransport(fs FileSystem) RoundTripper {
-	return fileTransport{fileHandler{fs}}
+	return fileTransport{&fileHandler{root: fs}}
 }
 
 func (t fileTransport) RoundTrip(req *Request) (resp *Response, err error) {
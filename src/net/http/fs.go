@@ -7,6 +7,8 @@
 package http
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -21,7 +23,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/net/http/httpguts"
 )
 
 // A Dir implements FileSystem using the native file system restricted to a
@@ -201,7 +206,7 @@ func ServeContent(w ResponseWriter, req *Request, name string, modtime time.Time
 		}
 		return size, nil
 	}
-	serveContent(w, req, name, modtime, sizeFunc, content)
+	serveContent(w, req, name, modtime, sizeFunc, content, "")
 }
 
 // errSeeker is returned by ServeContent's sizeFunc when the content
@@ -218,7 +223,9 @@ var errNoOverlap = errors.New("invalid range: failed to overlap")
 // if modtime.IsZero(), modtime is unknown.
 // content must be seeked to the beginning of the file.
 // The sizeFunc is called at most once. Its error, if any, is sent in the HTTP response.
-func serveContent(w ResponseWriter, r *Request, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker) {
+// If coding is not empty, it is the content coding of content, and is
+// set in the Content-Encoding header field of a successful response.
+func serveContent(w ResponseWriter, r *Request, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker, coding string) {
 	setLastModified(w, modtime)
 	done, rangeReq := checkPreconditions(w, r, modtime)
 	if done {
@@ -326,11 +333,14 @@ func serveContent(w ResponseWriter, r *Request, name string, modtime time.Time,
 		}
 
 		w.Header().Set("Accept-Ranges", "bytes")
-		if w.Header().Get("Content-Encoding") == "" {
+		if coding != "" || w.Header().Get("Content-Encoding") == "" {
 			w.Header().Set("Content-Length", strconv.FormatInt(sendSize, 10))
 		}
 	}
 
+	if coding != "" {
+		w.Header().Set("Content-Encoding", coding)
+	}
 	w.WriteHeader(code)
 
 	if r.Method != "HEAD" {
@@ -584,7 +594,8 @@ func checkPreconditions(w ResponseWriter, r *Request, modtime time.Time) (done b
 }
 
 // name is '/'-separated, not filepath.Separator.
-func serveFile(w ResponseWriter, r *Request, fs FileSystem, name string, redirect bool) {
+// If etags is non-nil, it is used to compute ETags for the files served.
+func serveFile(w ResponseWriter, r *Request, fs FileSystem, name string, redirect bool, etags *etagCache) {
 	const indexPage = "/index.html"
 
 	// redirect .../index.html to .../
@@ -660,9 +671,145 @@ func serveFile(w ResponseWriter, r *Request, fs FileSystem, name string, redirec
 		return
 	}
 
+	// The media type is that of the original file, even if a
+	// precompressed variant is served.
+	typeName := d.Name()
+	var coding string
+	if v, ff, dd := openPrecompressed(w, r, fs, name, d); ff != nil {
+		defer ff.Close()
+		coding = v.coding
+		name, f, d = name+v.suffix, ff, dd
+	}
+
+	if _, haveETag := w.Header()["Etag"]; etags != nil && !haveETag {
+		if etag := etags.etag(name, f, d); etag != "" {
+			w.Header().Set("Etag", etag)
+		}
+	}
+
 	// serveContent will check modification time
 	sizeFunc := func() (int64, error) { return d.Size(), nil }
-	serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, f)
+	serveContent(w, r, typeName, d.ModTime(), sizeFunc, f, coding)
+}
+
+// A precompressedVariant describes the precompressed variants of files
+// in one content coding.
+type precompressedVariant struct {
+	coding, suffix string
+}
+
+// precompressedVariants lists the content codings of the precompressed
+// variants of a file that are served in its place, in order of
+// preference, with the suffixes of the variants' file names.
+var precompressedVariants = []precompressedVariant{
+	{"br", ".br"},
+	{"zstd", ".zst"},
+	{"gzip", ".gz"},
+}
+
+// openPrecompressed opens the precompressed variant of the file name,
+// whose FileInfo is d, that is best accepted by the request r.
+// A variant is a regular file named after the original with a suffix
+// from precompressedVariants, modified no earlier than the original.
+// Variants are opened in order of the client's preference, followed by
+// those it does not accept, and only until one is found. If one is, the
+// response depends on the request's Accept-Encoding header, so
+// openPrecompressed adds Accept-Encoding to w's Vary header field.
+// It returns a nil File if no variant is acceptable.
+func openPrecompressed(w ResponseWriter, r *Request, fsys FileSystem, name string, d fs.FileInfo) (v precompressedVariant, f File, fd fs.FileInfo) {
+	if w.Header().get("Content-Encoding") != "" {
+		return v, nil, nil
+	}
+	accepted := parseAcceptEncoding(r.Header["Accept-Encoding"])
+	candidates := append([]precompressedVariant(nil), precompressedVariants...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return accepted.q(candidates[i].coding) > accepted.q(candidates[j].coding)
+	})
+	for _, v := range candidates {
+		f, err := fsys.Open(name + v.suffix)
+		if err != nil {
+			continue
+		}
+		fd, err := f.Stat()
+		if err != nil || !fd.Mode().IsRegular() || fd.ModTime().Before(d.ModTime()) {
+			f.Close()
+			continue
+		}
+		if !httpguts.HeaderValuesContainsToken(w.Header()["Vary"], "Accept-Encoding") {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		if accepted.q(v.coding) <= 0 {
+			// The variant only tells us that the response varies.
+			f.Close()
+			break
+		}
+		return v, f, fd
+	}
+	return precompressedVariant{}, nil, nil
+}
+
+// A contentHasher is a FileInfo that knows a hash of its file's
+// contents, as do those of the files in an embed.FS.
+type contentHasher interface {
+	ContentHash() []byte
+}
+
+// An etagCache holds the ETags computed for the files served by a
+// FileServer, keyed by name.
+type etagCache struct {
+	mu sync.Mutex
+	m  map[string]etagCacheEntry
+}
+
+type etagCacheEntry struct {
+	size    int64
+	modtime time.Time
+	etag    string
+}
+
+// etag returns a strong ETag for f, the file name whose FileInfo is d,
+// or "" if it has none. The ETag is derived from the file's
+// ContentHash if its FileInfo has one. Otherwise, if the file's
+// modification time is known, it is derived from a SHA-256 hash of the
+// file's contents, which is cached until the file's size or
+// modification time changes. f is left positioned at its start.
+func (c *etagCache) etag(name string, f File, d fs.FileInfo) string {
+	if h, ok := d.(contentHasher); ok {
+		if sum := h.ContentHash(); len(sum) > 0 {
+			return formatETag(sum)
+		}
+	}
+	size, modtime := d.Size(), d.ModTime()
+	if isZeroTime(modtime) {
+		return ""
+	}
+	c.mu.Lock()
+	e, ok := c.m[name]
+	c.mu.Unlock()
+	if ok && e.size == size && e.modtime.Equal(modtime) {
+		return e.etag
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	etag := formatETag(h.Sum(nil)[:16])
+
+	c.mu.Lock()
+	if c.m == nil {
+		c.m = make(map[string]etagCacheEntry)
+	}
+	c.m[name] = etagCacheEntry{size, modtime, etag}
+	c.mu.Unlock()
+	return etag
+}
+
+func formatETag(sum []byte) string {
+	return `"` + base64.RawURLEncoding.EncodeToString(sum) + `"`
 }
 
 // toHTTPError returns a non-specific HTTP error message and status code
@@ -712,6 +859,10 @@ func localRedirect(w ResponseWriter, r *Request, newPath string) {
 // Outside of those two special cases, ServeFile does not use
 // r.URL.Path for selecting the file or directory to serve; only the
 // file or directory provided in the name argument is used.
+//
+// Like FileServer, ServeFile serves a precompressed variant of the
+// file if the request accepts one. Unlike FileServer, it does not set
+// an ETag header.
 func ServeFile(w ResponseWriter, r *Request, name string) {
 	if containsDotDot(r.URL.Path) {
 		// Too many programs use r.URL.Path to construct the argument to
@@ -723,7 +874,7 @@ func ServeFile(w ResponseWriter, r *Request, name string) {
 		return
 	}
 	dir, file := filepath.Split(name)
-	serveFile(w, r, Dir(dir), file, false)
+	serveFile(w, r, Dir(dir), file, false, nil)
 }
 
 func containsDotDot(v string) bool {
@@ -741,7 +892,8 @@ func containsDotDot(v string) bool {
 func isSlashRune(r rune) bool { return r == '/' || r == '\\' }
 
 type fileHandler struct {
-	root FileSystem
+	root  FileSystem
+	etags etagCache
 }
 
 type ioFS struct {
@@ -837,8 +989,30 @@ func FS(fsys fs.FS) FileSystem {
 // To use an fs.FS implementation, use http.FS to convert it:
 //
 //	http.Handle("/", http.FileServer(http.FS(fsys)))
+//
+// The file server sets a strong ETag header on each response, derived
+// from a hash of the file's contents, unless one has already been set.
+// For files in an embed.FS, the hash computed at build time is used.
+// For other files, the hash is computed when the file is first served
+// and recomputed when its size or modification time changes; files
+// without a modification time get no ETag. Computing it reads the whole
+// file, whatever the request's method or Range header, which can be
+// costly for large files. To serve a file without an ETag, set the
+// header to nil, as in w.Header()["Etag"] = nil, before calling the
+// file server.
+//
+// If the request's Accept-Encoding header accepts it, the file server
+// serves a precompressed variant of a file in its place: a file of the
+// same name with the suffix ".br", ".zst" or ".gz", for the "br",
+// "zstd" and "gzip" content codings respectively, that was modified no
+// earlier than the original. Such variants are preferred in that order
+// when accepted equally, and are served with the original's media type.
+//
+// To compress the files served, use CompressHandler or set the
+// Server's Compression field. Range requests are then served
+// uncompressed. Precompressed variants are not compressed again.
 func FileServer(root FileSystem) Handler {
-	return &fileHandler{root}
+	return &fileHandler{root: root}
 }
 
 func (f *fileHandler) ServeHTTP(w ResponseWriter, r *Request) {
@@ -847,7 +1021,7 @@ func (f *fileHandler) ServeHTTP(w ResponseWriter, r *Request) {
 		upath = "/" + upath
 		r.URL.Path = upath
 	}
-	serveFile(w, r, f.root, path.Clean(upath), true)
+	serveFile(w, r, f.root, path.Clean(upath), true, &f.etags)
 }
 
 // httpRange specifies the byte range to be sent to the client.
@@ -26,6 +26,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -1156,7 +1157,7 @@ func TestServerFileStatError(t *testing.T) {
 	redirect := false
 	name := "file.txt"
 	fs := issue12991FS{}
-	ExportServeFile(rec, r, fs, name, redirect)
+	ExportServeFile(rec, r, fs, name, redirect, nil)
 	if body := rec.Body.String(); !strings.Contains(body, "403") || !strings.Contains(body, "Forbidden") {
 		t.Errorf("wanted 403 forbidden message; got: %s", body)
 	}
@@ -1472,3 +1473,203 @@ func testServeFileRejectsInvalidSuffixLengths(t *testing.T, h2 bool) {
 		})
 	}
 }
+
+func TestFileServerPrecompressed(t *testing.T) {
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"app.js":     {Data: []byte("raw js"), ModTime: modTime},
+		"app.js.br":  {Data: []byte("br js"), ModTime: modTime},
+		"app.js.gz":  {Data: []byte("gzip js"), ModTime: modTime},
+		"app.css":    {Data: []byte("raw css"), ModTime: modTime.Add(time.Hour)},
+		"app.css.gz": {Data: []byte("stale gzip css"), ModTime: modTime},
+		"app.txt":    {Data: []byte("raw txt"), ModTime: modTime},
+	}
+	tests := []struct {
+		path, accept string
+		wantBody     string
+		wantEncoding string
+		wantVary     bool
+	}{
+		{"/app.js", "", "raw js", "", true},
+		{"/app.js", "gzip", "gzip js", "gzip", true},
+		{"/app.js", "x-gzip", "gzip js", "gzip", true},
+		{"/app.js", "gzip, br", "br js", "br", true},
+		{"/app.js", "br;q=0.5, gzip", "gzip js", "gzip", true},
+		{"/app.js", "*", "br js", "br", true},
+		{"/app.js", "*, br;q=0", "gzip js", "gzip", true},
+		{"/app.js", "identity", "raw js", "", true},
+		{"/app.js", "deflate", "raw js", "", true},
+		{"/app.js", "gzip;q=0, br;q=0", "raw js", "", true},
+		{"/app.css", "gzip", "raw css", "", false},
+		{"/app.txt", "gzip", "raw txt", "", false},
+	}
+	h := FileServer(FS(fsys))
+	etags := make(map[string]string)
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Encoding", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		res := rec.Result()
+		name := tt.path + " with Accept-Encoding " + tt.accept
+		if res.StatusCode != StatusOK {
+			t.Errorf("%s: status = %d, want %d", name, res.StatusCode, StatusOK)
+			continue
+		}
+		if got := rec.Body.String(); got != tt.wantBody {
+			t.Errorf("%s: body = %q, want %q", name, got, tt.wantBody)
+		}
+		if got := res.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", name, got, tt.wantEncoding)
+		}
+		if got := res.Header.Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+			t.Errorf("%s: Vary = %q, want Accept-Encoding: %v", name, res.Header.Get("Vary"), tt.wantVary)
+		}
+		wantType := mime.TypeByExtension(path.Ext(tt.path))
+		if got := res.Header.Get("Content-Type"); got != wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", name, got, wantType)
+		}
+		etag := res.Header.Get("Etag")
+		if prev, ok := etags[tt.wantBody]; ok && prev != etag {
+			t.Errorf("%s: ETag = %q, want %q as before", name, etag, prev)
+		}
+		for body, other := range etags {
+			if body != tt.wantBody && other == etag {
+				t.Errorf("%s: ETag %q is also that of %q", name, etag, body)
+			}
+		}
+		etags[tt.wantBody] = etag
+	}
+}
+
+func TestFileServerPrecompressedETagPerDirectory(t *testing.T) {
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a/app.js":    {Data: []byte("raw js a"), ModTime: modTime},
+		"a/app.js.gz": {Data: []byte("gzip js a"), ModTime: modTime},
+		"b/app.js":    {Data: []byte("raw js b"), ModTime: modTime},
+		"b/app.js.gz": {Data: []byte("gzip js b"), ModTime: modTime},
+	}
+	h := FileServer(FS(fsys))
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	etagA := get("/a/app.js", "").Header().Get("Etag")
+	recB := get("/b/app.js", "")
+	if got := recB.Body.String(); got != "gzip js b" {
+		t.Fatalf("/b/app.js: body = %q, want %q", got, "gzip js b")
+	}
+	if etagB := recB.Header().Get("Etag"); etagA == etagB {
+		t.Errorf("/a/app.js and /b/app.js have the same ETag %q", etagA)
+	}
+	if rec := get("/b/app.js", etagA); rec.Code != StatusOK {
+		t.Errorf("/b/app.js with If-None-Match of /a/app.js: status = %d, want %d", rec.Code, StatusOK)
+	}
+}
+
+func TestFileServerPrecompressedError(t *testing.T) {
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("raw js"), ModTime: modTime},
+		"app.js.gz": {Data: []byte("gzip js"), ModTime: modTime},
+	}
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=100-")
+	rec := httptest.NewRecorder()
+	FileServer(FS(fsys)).ServeHTTP(rec, req)
+	if rec.Code != StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("status = %d, want %d", rec.Code, StatusRequestedRangeNotSatisfiable)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+}
+
+func TestFileServerETag(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := FileServer(Dir(dir))
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/file.txt", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	write("first", modTime)
+	etag1 := get("").Header().Get("Etag")
+	if etag1 == "" || strings.HasPrefix(etag1, "W/") {
+		t.Fatalf("ETag = %q, want a strong ETag", etag1)
+	}
+	if rec := get(etag1); rec.Code != StatusNotModified {
+		t.Errorf("If-None-Match %s: status = %d, want %d", etag1, rec.Code, StatusNotModified)
+	}
+
+	write("other", modTime.Add(time.Hour))
+	rec := get(etag1)
+	if rec.Code != StatusOK || rec.Body.String() != "other" {
+		t.Errorf("after modification: status = %d, body = %q; want %d, %q", rec.Code, rec.Body.String(), StatusOK, "other")
+	}
+	if etag2 := rec.Header().Get("Etag"); etag2 == etag1 {
+		t.Errorf("after modification: ETag = %q, want a new ETag", etag2)
+	}
+
+	write("first", modTime.Add(2*time.Hour))
+	if etag3 := get("").Header().Get("Etag"); etag3 != etag1 {
+		t.Errorf("after restoring contents: ETag = %q, want %q", etag3, etag1)
+	}
+
+	// An ETag set by the caller is kept.
+	custom := HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Etag", `"custom"`)
+		h.ServeHTTP(w, r)
+	})
+	rec = httptest.NewRecorder()
+	custom.ServeHTTP(rec, httptest.NewRequest("GET", "/file.txt", nil))
+	if got := rec.Header().Get("Etag"); got != `"custom"` {
+		t.Errorf("with ETag set by caller: ETag = %q, want %q", got, `"custom"`)
+	}
+
+	// An ETag header set to nil by the caller suppresses the ETag.
+	suppress := HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header()["Etag"] = nil
+		h.ServeHTTP(w, r)
+	})
+	rec = httptest.NewRecorder()
+	suppress.ServeHTTP(rec, httptest.NewRequest("GET", "/file.txt", nil))
+	if got := rec.Header().Get("Etag"); got != "" {
+		t.Errorf("with ETag set to nil by caller: ETag = %q, want none", got)
+	}
+
+	// Files without a modification time get no ETag.
+	rec = httptest.NewRecorder()
+	FileServer(FS(fstest.MapFS{"file.txt": {Data: []byte("data")}})).ServeHTTP(rec, httptest.NewRequest("GET", "/file.txt", nil))
+	if got := rec.Header().Get("Etag"); got != "" {
+		t.Errorf("without modification time: ETag = %q, want none", got)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !nethttpomithttp2
+
+package http
+
+import (
+	"math"
+	"time"
+)
+
+// configureHTTP2Server copies the values in conf, a Server's HTTP2
+// field, to the unset fields of the bundled HTTP/2 server s.
+// Invalid values and values s has no setting for are ignored.
+func configureHTTP2Server(conf *HTTP2Config, s *http2Server) {
+	if conf == nil {
+		return
+	}
+	setConfigUint32(&s.MaxConcurrentStreams, conf.MaxConcurrentStreams, 1, math.MaxUint32)
+	setConfigUint32(&s.MaxDecoderHeaderTableSize, conf.MaxDecoderHeaderTableSize, 1, maxConfigHeaderTableSize)
+	setConfigUint32(&s.MaxEncoderHeaderTableSize, conf.MaxEncoderHeaderTableSize, 1, maxConfigHeaderTableSize)
+	setConfigUint32(&s.MaxReadFrameSize, conf.MaxReadFrameSize, http2minMaxFrameSize, http2maxFrameSize)
+	setConfigInt32(&s.MaxUploadBufferPerConnection, conf.MaxReceiveBufferPerConnection, http2initialWindowSize+1, math.MaxInt32)
+	setConfigInt32(&s.MaxUploadBufferPerStream, conf.MaxReceiveBufferPerStream, http2initialWindowSize+1, math.MaxInt32)
+	if conf.PermitProhibitedCipherSuites {
+		s.PermitProhibitedCipherSuites = true
+	}
+	if s.CountError == nil {
+		s.CountError = conf.CountError
+	}
+}
+
+// configureHTTP2Transport copies the values in conf, a Transport's
+// HTTP2 field, to the unset fields of the bundled HTTP/2 transport t.
+// Invalid values and values t has no setting for are ignored.
+func configureHTTP2Transport(conf *HTTP2Config, t *http2Transport) {
+	if conf == nil {
+		return
+	}
+	setConfigUint32(&t.MaxDecoderHeaderTableSize, conf.MaxDecoderHeaderTableSize, 1, maxConfigHeaderTableSize)
+	setConfigUint32(&t.MaxEncoderHeaderTableSize, conf.MaxEncoderHeaderTableSize, 1, maxConfigHeaderTableSize)
+	setConfigUint32(&t.MaxReadFrameSize, conf.MaxReadFrameSize, http2minMaxFrameSize, http2maxFrameSize)
+	setConfigDuration(&t.ReadIdleTimeout, conf.SendPingTimeout)
+	setConfigDuration(&t.PingTimeout, conf.PingTimeout)
+	setConfigDuration(&t.WriteByteTimeout, conf.WriteByteTimeout)
+	if t.CountError == nil {
+		t.CountError = conf.CountError
+	}
+}
+
+// maxConfigHeaderTableSize bounds the header table sizes accepted
+// from an HTTP2Config.
+const maxConfigHeaderTableSize = 4<<20 - 1
+
+// setConfigUint32 sets *dst to v if *dst is zero and v is within [min, max].
+func setConfigUint32(dst *uint32, v int, min, max uint32) {
+	if *dst == 0 && int64(v) >= int64(min) && int64(v) <= int64(max) {
+		*dst = uint32(v)
+	}
+}
+
+// setConfigInt32 sets *dst to v if *dst is zero and v is within [min, max].
+func setConfigInt32(dst *int32, v int, min, max int32) {
+	if *dst == 0 && int64(v) >= int64(min) && int64(v) <= int64(max) {
+		*dst = int32(v)
+	}
+}
+
+// setConfigDuration sets *dst to v if *dst is zero and v is positive.
+func setConfigDuration(dst *time.Duration, v time.Duration) {
+	if *dst == 0 && v > 0 {
+		*dst = v
+	}
+}
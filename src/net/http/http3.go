@@ -0,0 +1,712 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 framing and message encoding shared by the client and server.
+// See RFC 9114.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"internal/quic"
+	"io"
+	"net/http/internal/ascii"
+	"net/http/internal/qpack"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// http3NextProto is the ALPN protocol ID for HTTP/3.
+const http3NextProto = "h3"
+
+// HTTP/3 frame types. See RFC 9114, Section 7.2.
+const (
+	http3FrameData        = 0x00
+	http3FrameHeaders     = 0x01
+	http3FrameCancelPush  = 0x03
+	http3FrameSettings    = 0x04
+	http3FramePushPromise = 0x05
+	http3FrameGoAway      = 0x07
+	http3FrameMaxPushID   = 0x0d
+)
+
+// HTTP/3 unidirectional stream types. See RFC 9114, Section 6.2,
+// and RFC 9204, Section 4.2.
+const (
+	http3StreamControl      = 0x00
+	http3StreamPush         = 0x01
+	http3StreamQPACKEncoder = 0x02
+	http3StreamQPACKDecoder = 0x03
+)
+
+// http3SettingMaxFieldSectionSize is SETTINGS_MAX_FIELD_SECTION_SIZE.
+// We send no other settings: the defaults for the QPACK settings
+// disable the dynamic table. See RFC 9114, Section 7.2.4.1.
+const http3SettingMaxFieldSectionSize = 0x06
+
+// An http3Error is an HTTP/3 error code. See RFC 9114, Section 8.1.
+type http3Error uint64
+
+const (
+	http3ErrNoError              http3Error = 0x100
+	http3ErrGeneralProtocolError http3Error = 0x101
+	http3ErrInternalError        http3Error = 0x102
+	http3ErrStreamCreationError  http3Error = 0x103
+	http3ErrClosedCriticalStream http3Error = 0x104
+	http3ErrFrameUnexpected      http3Error = 0x105
+	http3ErrFrameError           http3Error = 0x106
+	http3ErrExcessiveLoad        http3Error = 0x107
+	http3ErrIDError              http3Error = 0x108
+	http3ErrSettingsError        http3Error = 0x109
+	http3ErrMissingSettings      http3Error = 0x10a
+	http3ErrRequestRejected      http3Error = 0x10b
+	http3ErrRequestCancelled     http3Error = 0x10c
+	http3ErrRequestIncomplete    http3Error = 0x10d
+	http3ErrMessageError         http3Error = 0x10e
+	http3ErrConnectError         http3Error = 0x10f
+	http3ErrVersionFallback      http3Error = 0x110
+
+	// QPACK_DECOMPRESSION_FAILED, from RFC 9204, Section 6.
+	http3ErrQPACKDecompressionFailed http3Error = 0x200
+)
+
+var http3ErrorNames = map[http3Error]string{
+	http3ErrNoError:              "H3_NO_ERROR",
+	http3ErrGeneralProtocolError: "H3_GENERAL_PROTOCOL_ERROR",
+	http3ErrInternalError:        "H3_INTERNAL_ERROR",
+	http3ErrStreamCreationError:  "H3_STREAM_CREATION_ERROR",
+	http3ErrClosedCriticalStream: "H3_CLOSED_CRITICAL_STREAM",
+	http3ErrFrameUnexpected:      "H3_FRAME_UNEXPECTED",
+	http3ErrFrameError:           "H3_FRAME_ERROR",
+	http3ErrExcessiveLoad:        "H3_EXCESSIVE_LOAD",
+	http3ErrIDError:              "H3_ID_ERROR",
+	http3ErrSettingsError:        "H3_SETTINGS_ERROR",
+	http3ErrMissingSettings:      "H3_MISSING_SETTINGS",
+	http3ErrRequestRejected:      "H3_REQUEST_REJECTED",
+	http3ErrRequestCancelled:     "H3_REQUEST_CANCELLED",
+	http3ErrRequestIncomplete:    "H3_REQUEST_INCOMPLETE",
+	http3ErrMessageError:         "H3_MESSAGE_ERROR",
+	http3ErrConnectError:         "H3_CONNECT_ERROR",
+	http3ErrVersionFallback:      "H3_VERSION_FALLBACK",
+
+	http3ErrQPACKDecompressionFailed: "QPACK_DECOMPRESSION_FAILED",
+}
+
+func (e http3Error) String() string {
+	if s, ok := http3ErrorNames[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint64(e))
+}
+
+func (e http3Error) Error() string {
+	return "http3: " + e.String()
+}
+
+// An http3StreamError is a request stream reset by the peer.
+type http3StreamError struct {
+	Code http3Error
+}
+
+func (e http3StreamError) Error() string {
+	return fmt.Sprintf("http3: stream reset by peer with %v", e.Code)
+}
+
+// http3MessageError returns an error for a malformed request or response,
+// which is answered by resetting the stream with H3_MESSAGE_ERROR.
+func http3MessageError(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{http3ErrMessageError}, args...)...)
+}
+
+// http3ErrorCode returns the HTTP/3 error code carried by err, or code
+// if there is none.
+func http3ErrorCode(err error, code http3Error) http3Error {
+	errors.As(err, &code)
+	return code
+}
+
+// http3AppendVarint appends v in the QUIC variable-length integer encoding.
+func http3AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// http3ReadVarint reads a QUIC variable-length integer.
+// It returns io.EOF only if no bytes were read.
+func http3ReadVarint(r io.ByteReader) (uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1 << (c >> 6)
+	v := uint64(c & 0x3f)
+	for i := 1; i < n; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// http3ConsumeVarint decodes a QUIC variable-length integer from b.
+// It returns the value and its length, or a negative length on error.
+func http3ConsumeVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, -1
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// http3AppendFrame appends a frame with the given type and payload.
+func http3AppendFrame(b []byte, typ uint64, payload []byte) []byte {
+	b = http3AppendVarint(b, typ)
+	b = http3AppendVarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// http3AppendSettings appends a SETTINGS frame advertising
+// the given maximum field section size.
+func http3AppendSettings(b []byte, maxFieldSectionSize int64) []byte {
+	var p []byte
+	p = http3AppendVarint(p, http3SettingMaxFieldSectionSize)
+	p = http3AppendVarint(p, uint64(maxFieldSectionSize))
+	return http3AppendFrame(b, http3FrameSettings, p)
+}
+
+// http3IsReservedFrame reports whether typ is an HTTP/2 frame type
+// which has no HTTP/3 equivalent and must not be sent.
+// See RFC 9114, Section 7.2.8.
+func http3IsReservedFrame(typ uint64) bool {
+	switch typ {
+	case 0x02, 0x06, 0x08, 0x09:
+		return true
+	}
+	return false
+}
+
+// An http3Stream is a request stream, carrying one request and its response.
+type http3Stream struct {
+	qconn *quic.Conn
+	qs    *quic.Stream
+	br    *bufio.Reader
+}
+
+func newHTTP3Stream(qconn *quic.Conn, qs *quic.Stream) *http3Stream {
+	return &http3Stream{
+		qconn: qconn,
+		qs:    qs,
+		br:    bufio.NewReader(qs),
+	}
+}
+
+// http3ConnError closes the connection with an HTTP/3 error code.
+func http3ConnError(qconn *quic.Conn, code http3Error, reason string) {
+	qconn.Abort(&quic.ApplicationError{Code: uint64(code), Reason: reason})
+}
+
+// http3ReadErr converts errors from reading a QUIC stream.
+func http3ReadErr(err error) error {
+	var code quic.StreamErrorCode
+	if errors.As(err, &code) {
+		return http3StreamError{http3Error(code)}
+	}
+	return err
+}
+
+// readFrameHeader reads the type and length of the next frame on
+// the stream. It returns io.EOF at the end of the stream.
+func (st *http3Stream) readFrameHeader() (typ, length uint64, err error) {
+	typ, err = http3ReadVarint(st.br)
+	if err != nil {
+		return 0, 0, http3ReadErr(err)
+	}
+	length, err = http3ReadVarint(st.br)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return typ, length, http3ReadErr(err)
+}
+
+// readFramePayload reads a frame payload of the given length,
+// which must not exceed max.
+func (st *http3Stream) readFramePayload(length uint64, max int64) ([]byte, error) {
+	if length > uint64(max) {
+		return nil, http3MessageError("frame of %v bytes exceeds limit of %v", length, max)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(st.br, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, http3ReadErr(err)
+	}
+	return b, nil
+}
+
+// skipFrame discards the payload of a frame of an unknown type.
+// Frames which are not allowed on request streams are connection errors.
+func (st *http3Stream) skipFrame(typ, length uint64) error {
+	switch {
+	case typ == http3FrameSettings || typ == http3FrameGoAway ||
+		typ == http3FrameMaxPushID || typ == http3FrameCancelPush ||
+		http3IsReservedFrame(typ):
+		http3ConnError(st.qconn, http3ErrFrameUnexpected, "")
+		return http3ErrFrameUnexpected
+	case typ == http3FramePushPromise:
+		// We never send MAX_PUSH_ID, so the server may not push.
+		http3ConnError(st.qconn, http3ErrIDError, "")
+		return http3ErrIDError
+	}
+	return st.discard(length)
+}
+
+// discard discards length bytes from the stream.
+func (st *http3Stream) discard(length uint64) error {
+	for length > 0 {
+		n := length
+		if n > 64<<10 {
+			n = 64 << 10
+		}
+		m, err := st.br.Discard(int(n))
+		length -= uint64(m)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return http3ReadErr(err)
+		}
+	}
+	return nil
+}
+
+// readHeaders reads the next HEADERS frame on the stream,
+// skipping unknown frames. It returns io.EOF if the stream ends first.
+func (st *http3Stream) readHeaders(maxSize int64) ([]qpack.HeaderField, error) {
+	for {
+		typ, length, err := st.readFrameHeader()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case http3FrameHeaders:
+			b, err := st.readFramePayload(length, maxSize)
+			if err != nil {
+				return nil, err
+			}
+			fields, err := qpack.ParseFieldSection(b, maxSize)
+			if err != nil {
+				http3ConnError(st.qconn, http3ErrQPACKDecompressionFailed, "")
+				return nil, err
+			}
+			return fields, nil
+		case http3FrameData:
+			http3ConnError(st.qconn, http3ErrFrameUnexpected, "DATA before HEADERS")
+			return nil, http3ErrFrameUnexpected
+		default:
+			if err := st.skipFrame(typ, length); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// writeFrame writes a single frame to the stream.
+func (st *http3Stream) writeFrame(typ uint64, payload []byte) error {
+	_, err := st.qs.Write(http3AppendFrame(make([]byte, 0, len(payload)+16), typ, payload))
+	return err
+}
+
+// writeHeaders writes a HEADERS frame containing the given fields.
+func (st *http3Stream) writeHeaders(fields []qpack.HeaderField) error {
+	return st.writeFrame(http3FrameHeaders, qpack.AppendFieldSection(nil, fields))
+}
+
+// reset abruptly terminates both directions of the stream.
+func (st *http3Stream) reset(code http3Error) {
+	st.qs.Reset(uint64(code))
+	st.qs.StopSending(uint64(code))
+}
+
+// http3ValidPseudoPath reports whether v is a valid :path pseudo-header
+// value: either an absolute path or "*". See RFC 9114, Section 4.3.1.
+func http3ValidPseudoPath(v string) bool {
+	return (len(v) > 0 && v[0] == '/') || v == "*"
+}
+
+// http3IsConnectionSpecific reports whether the lowercase field name is
+// a connection-specific header field, which HTTP/3 messages must not
+// contain. See RFC 9114, Section 4.2.
+func http3IsConnectionSpecific(name string) bool {
+	switch name {
+	case "connection", "proxy-connection", "keep-alive", "transfer-encoding", "upgrade":
+		return true
+	}
+	return false
+}
+
+// http3AppendHeaderFields appends the fields of h to fields,
+// omitting connection-specific fields and those in exclude.
+func http3AppendHeaderFields(fields []qpack.HeaderField, h Header, exclude map[string]bool) []qpack.HeaderField {
+	for k, vv := range h {
+		name, ascii := ascii.ToLower(k)
+		if !ascii || !httpguts.ValidHeaderFieldName(k) || exclude[name] || http3IsConnectionSpecific(name) {
+			continue
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				continue
+			}
+			if name == "te" && v != "trailers" {
+				continue
+			}
+			fields = append(fields, qpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	return fields
+}
+
+// http3SplitFields validates the fields of a decoded field section,
+// returning the pseudo-header fields and the regular fields.
+// See RFC 9114, Section 4.1.2.
+func http3SplitFields(fields []qpack.HeaderField) (pseudo map[string]string, h Header, err error) {
+	pseudo = make(map[string]string)
+	h = make(Header)
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			if len(h) > 0 {
+				return nil, nil, http3MessageError("pseudo-header field %q after regular fields", f.Name)
+			}
+			if _, dup := pseudo[f.Name]; dup {
+				return nil, nil, http3MessageError("duplicate pseudo-header field %q", f.Name)
+			}
+			pseudo[f.Name] = f.Value
+			continue
+		}
+		if lower, _ := ascii.ToLower(f.Name); !httpguts.ValidHeaderFieldName(f.Name) || lower != f.Name {
+			return nil, nil, http3MessageError("invalid field name %q", f.Name)
+		}
+		if !httpguts.ValidHeaderFieldValue(f.Value) {
+			return nil, nil, http3MessageError("invalid value for field %q", f.Name)
+		}
+		if http3IsConnectionSpecific(f.Name) || f.Name == "te" && f.Value != "trailers" {
+			return nil, nil, http3MessageError("connection-specific field %q", f.Name)
+		}
+		h.Add(CanonicalHeaderKey(f.Name), f.Value)
+	}
+	return pseudo, h, nil
+}
+
+// http3ContentLength returns the value of the content-length fields in h,
+// or -1 if there are none.
+func http3ContentLength(h Header) (int64, error) {
+	vv := h["Content-Length"]
+	if len(vv) == 0 {
+		return -1, nil
+	}
+	for _, v := range vv[1:] {
+		if v != vv[0] {
+			return 0, http3MessageError("conflicting content-length fields")
+		}
+	}
+	n, err := parseContentLength(vv[0])
+	if err != nil || n < 0 {
+		return 0, http3MessageError("invalid content-length %q", vv[0])
+	}
+	return n, nil
+}
+
+// An http3BodyReader reads the DATA frames of a message body
+// from a request stream.
+type http3BodyReader struct {
+	st            *http3Stream
+	remaining     uint64 // bytes left in the current DATA frame
+	contentLength int64  // declared length not yet read, or -1
+	maxTrailer    int64
+	setTrailer    func(Header) // called with the trailers, if any
+	err           error        // sticky
+}
+
+func (b *http3BodyReader) Read(p []byte) (n int, err error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	defer func() {
+		if err != nil {
+			b.err = err
+		}
+	}()
+	for b.remaining == 0 {
+		typ, length, err := b.st.readFrameHeader()
+		if err == io.EOF {
+			if b.contentLength > 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch typ {
+		case http3FrameData:
+			b.remaining = length
+		case http3FrameHeaders:
+			return 0, b.readTrailers(length)
+		default:
+			if err := b.st.skipFrame(typ, length); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if uint64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err = b.st.br.Read(p)
+	b.remaining -= uint64(n)
+	if b.contentLength >= 0 {
+		b.contentLength -= int64(n)
+		if b.contentLength < 0 {
+			return n, http3MessageError("body exceeds declared content-length")
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, http3ReadErr(err)
+}
+
+// readTrailers reads a trailing HEADERS frame, which must be the last
+// frame on the stream. It returns io.EOF on success.
+func (b *http3BodyReader) readTrailers(length uint64) error {
+	if b.contentLength > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	payload, err := b.st.readFramePayload(length, b.maxTrailer)
+	if err != nil {
+		return err
+	}
+	fields, err := qpack.ParseFieldSection(payload, b.maxTrailer)
+	if err != nil {
+		http3ConnError(b.st.qconn, http3ErrQPACKDecompressionFailed, "")
+		return err
+	}
+	pseudo, trailer, err := http3SplitFields(fields)
+	if err != nil {
+		return err
+	}
+	if len(pseudo) > 0 {
+		return http3MessageError("pseudo-header field in trailers")
+	}
+	if _, _, err := b.st.readFrameHeader(); err != io.EOF {
+		if err == nil {
+			err = http3MessageError("frame after trailers")
+		}
+		return err
+	}
+	if b.setTrailer != nil {
+		b.setTrailer(trailer)
+	}
+	return io.EOF
+}
+
+// http3PeerStreams processes the unidirectional streams opened by the
+// peer of an HTTP/3 connection. See RFC 9114, Section 6.2.
+type http3PeerStreams struct {
+	qconn    *quic.Conn
+	isServer bool
+
+	// onGoAway is called with the stream ID in each GOAWAY frame
+	// received by a client.
+	onGoAway func(id int64)
+
+	mu   sync.Mutex
+	seen [http3StreamQPACKDecoder + 1]bool // critical streams opened
+}
+
+// serve reads a unidirectional stream until it ends.
+func (p *http3PeerStreams) serve(qs *quic.Stream) {
+	st := newHTTP3Stream(p.qconn, qs)
+	typ, err := http3ReadVarint(st.br)
+	if err != nil {
+		qs.StopSending(uint64(http3ErrStreamCreationError))
+		return
+	}
+	switch typ {
+	case http3StreamControl, http3StreamQPACKEncoder, http3StreamQPACKDecoder:
+		p.mu.Lock()
+		dup := p.seen[typ]
+		p.seen[typ] = true
+		p.mu.Unlock()
+		if dup {
+			http3ConnError(p.qconn, http3ErrStreamCreationError, "duplicate critical stream")
+			return
+		}
+	case http3StreamPush:
+		if p.isServer {
+			http3ConnError(p.qconn, http3ErrStreamCreationError, "push stream opened by client")
+		} else {
+			// We never send MAX_PUSH_ID, so the server may not push.
+			http3ConnError(p.qconn, http3ErrIDError, "unexpected push stream")
+		}
+		return
+	default:
+		// Unknown stream types are ignored.
+		// See RFC 9114, Section 6.2.3.
+		qs.StopSending(uint64(http3ErrStreamCreationError))
+		return
+	}
+	if typ == http3StreamControl {
+		err = p.readControl(st)
+	} else {
+		// We advertise a QPACK dynamic table capacity of zero and never
+		// use the peer's dynamic table, so these streams carry nothing
+		// of interest.
+		_, err = io.Copy(io.Discard, st.br)
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	var se http3StreamError
+	if err == io.EOF || errors.As(err, &se) {
+		http3ConnError(p.qconn, http3ErrClosedCriticalStream, "")
+	}
+}
+
+// readControl reads frames from the peer's control stream.
+func (p *http3PeerStreams) readControl(st *http3Stream) error {
+	typ, length, err := st.readFrameHeader()
+	if err != nil {
+		return err
+	}
+	if typ != http3FrameSettings {
+		http3ConnError(p.qconn, http3ErrMissingSettings, "")
+		return http3ErrMissingSettings
+	}
+	if err := p.readSettings(st, length); err != nil {
+		return err
+	}
+	for {
+		typ, length, err := st.readFrameHeader()
+		if err != nil {
+			return err
+		}
+		switch {
+		case typ == http3FrameGoAway:
+			if length > 8 {
+				http3ConnError(p.qconn, http3ErrFrameError, "")
+				return http3ErrFrameError
+			}
+			b, err := st.readFramePayload(length, 8)
+			if err != nil {
+				return err
+			}
+			id, n := http3ConsumeVarint(b)
+			if n != len(b) {
+				http3ConnError(p.qconn, http3ErrFrameError, "")
+				return http3ErrFrameError
+			}
+			if p.isServer {
+				// A client's GOAWAY carries a push ID, and we don't push.
+				continue
+			}
+			if id%4 != 0 {
+				http3ConnError(p.qconn, http3ErrIDError, "")
+				return http3ErrIDError
+			}
+			if p.onGoAway != nil {
+				p.onGoAway(int64(id))
+			}
+		case typ == http3FrameData || typ == http3FrameHeaders ||
+			typ == http3FrameSettings || typ == http3FramePushPromise ||
+			typ == http3FrameMaxPushID && !p.isServer ||
+			http3IsReservedFrame(typ):
+			http3ConnError(p.qconn, http3ErrFrameUnexpected, "")
+			return http3ErrFrameUnexpected
+		default:
+			if err := st.discard(length); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readSettings reads the payload of a SETTINGS frame.
+// We don't act on any of the peer's settings; SETTINGS_MAX_FIELD_SECTION_SIZE
+// is advisory, and we never use the QPACK dynamic table.
+func (p *http3PeerStreams) readSettings(st *http3Stream, length uint64) error {
+	b, err := st.readFramePayload(length, 16<<10)
+	if err != nil {
+		http3ConnError(p.qconn, http3ErrExcessiveLoad, "SETTINGS frame too large")
+		return err
+	}
+	seen := make(map[uint64]bool)
+	for len(b) > 0 {
+		id, n := http3ConsumeVarint(b)
+		if n < 0 {
+			break
+		}
+		b = b[n:]
+		_, n = http3ConsumeVarint(b)
+		if n < 0 {
+			break
+		}
+		b = b[n:]
+		if seen[id] || id >= 0x02 && id <= 0x05 {
+			// Duplicate settings and HTTP/2 settings are errors.
+			// See RFC 9114, Section 7.2.4.1.
+			http3ConnError(p.qconn, http3ErrSettingsError, "")
+			return http3ErrSettingsError
+		}
+		seen[id] = true
+	}
+	if len(b) > 0 {
+		http3ConnError(p.qconn, http3ErrFrameError, "malformed SETTINGS frame")
+		return http3ErrFrameError
+	}
+	return nil
+}
+
+// http3OpenControlStream opens the local control stream and sends our settings.
+func http3OpenControlStream(ctx context.Context, qconn *quic.Conn, maxFieldSectionSize int64) (*quic.Stream, error) {
+	qs, err := qconn.NewSendOnlyStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := http3AppendVarint(nil, http3StreamControl)
+	b = http3AppendSettings(b, maxFieldSectionSize)
+	if _, err := qs.Write(b); err != nil {
+		return nil, err
+	}
+	return qs, nil
+}
+
+// http3AppendGoAway appends a GOAWAY frame carrying the given ID.
+func http3AppendGoAway(b []byte, id int64) []byte {
+	return http3AppendFrame(b, http3FrameGoAway, http3AppendVarint(nil, uint64(id)))
+}
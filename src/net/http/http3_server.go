@@ -0,0 +1,834 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 server.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"internal/quic"
+	"io"
+	"net"
+	"net/http/internal/qpack"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServeHTTP3 serves HTTP/3 requests on the UDP packet connection pc,
+// calling srv.Handler to reply to them.
+//
+// The TLS configuration and certificate are set up as by ServeTLS,
+// except that the only protocol advertised with ALPN is "h3".
+// Request.Proto is "HTTP/3.0" for requests received over HTTP/3.
+// The ConnContext and ConnState hooks are not called for HTTP/3
+// connections, which have no net.Conn.
+//
+// While ServeHTTP3 is running, responses to requests the server receives
+// over TLS with HTTP/1 or HTTP/2 carry an Alt-Svc header field
+// advertising HTTP/3 on pc's port, unless the Handler sets one.
+// Clients use this to upgrade to HTTP/3; it is expected that pc listens
+// on the same port number as the server's TCP listener.
+//
+// After Shutdown or Close, connections are closed once their requests
+// finish, and then pc is closed.
+//
+// ServeHTTP3 always returns a non-nil error. After Shutdown or Close,
+// the returned error is ErrServerClosed.
+func (srv *Server) ServeHTTP3(pc net.PacketConn, certFile, keyFile string) error {
+	// Setup HTTP/2 first, since it may modify srv.TLSConfig
+	// concurrently with a call to Serve or ServeTLS.
+	if err := srv.setupHTTP2_ServeTLS(); err != nil {
+		return err
+	}
+	config := cloneTLSConfig(srv.TLSConfig)
+	config.NextProtos = []string{http3NextProto}
+	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
+	if !configHasCert || certFile != "" || keyFile != "" {
+		var err error
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+	}
+	qconfig := &quic.Config{
+		TLSConfig:      config,
+		MaxIdleTimeout: srv.idleTimeout(),
+	}
+	l := &http3Listener{
+		srv:      srv,
+		endpoint: quic.NewEndpoint(pc, qconfig),
+		conns:    make(map[*http3ServerConn]struct{}),
+	}
+	var ln net.Listener = l
+	if !srv.trackListener(&ln, true) {
+		l.closeEndpoint()
+		return ErrServerClosed
+	}
+	defer srv.trackListener(&ln, false)
+
+	if addr, ok := pc.LocalAddr().(*net.UDPAddr); ok {
+		altSvc := fmt.Sprintf(`%v=":%v"; ma=86400`, http3NextProto, addr.Port)
+		srv.http3AltSvc.Store(&altSvc)
+		defer srv.http3AltSvc.CompareAndSwap(&altSvc, nil)
+	}
+
+	baseCtx := context.Background()
+	if srv.BaseContext != nil {
+		baseCtx = srv.BaseContext(ln)
+		if baseCtx == nil {
+			panic("BaseContext returned a nil context")
+		}
+	}
+	ctx := context.WithValue(baseCtx, ServerContextKey, srv)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, pc.LocalAddr())
+	return l.serve(ctx)
+}
+
+// ListenAndServeHTTP3 listens on the UDP network address srv.Addr and
+// then calls ServeHTTP3 to handle requests on incoming HTTP/3 connections.
+//
+// If srv.Addr is blank, ":https" is used.
+//
+// ListenAndServeHTTP3 always returns a non-nil error. After Shutdown or
+// Close, the returned error is ErrServerClosed.
+func (srv *Server) ListenAndServeHTTP3(certFile, keyFile string) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeHTTP3(pc, certFile, keyFile)
+}
+
+// An http3Listener is the net.Listener tracked by the Server for a call
+// to ServeHTTP3. Closing it stops accepting connections, sends a GOAWAY
+// frame on each existing connection, and closes the QUIC endpoint once
+// the connections are gone.
+type http3Listener struct {
+	srv      *Server
+	endpoint *quic.Endpoint
+
+	mu      sync.Mutex
+	conns   map[*http3ServerConn]struct{}
+	closed  bool
+	cancel  context.CancelFunc // stops Accept
+	stopped bool               // the accept loop has exited
+}
+
+func (l *http3Listener) Accept() (net.Conn, error) {
+	return nil, errors.New("http: cannot Accept a net.Conn from an HTTP/3 listener")
+}
+
+func (l *http3Listener) Addr() net.Addr {
+	return l.endpoint.LocalAddr()
+}
+
+func (l *http3Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.cancel != nil {
+		l.cancel()
+	}
+	for sc := range l.conns {
+		go sc.goAway()
+	}
+	return nil
+}
+
+// serve accepts connections until the listener is closed.
+func (l *http3Listener) serve(ctx context.Context) error {
+	acceptCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l.mu.Lock()
+	l.cancel = cancel
+	if l.closed {
+		cancel()
+	}
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.stopped = true
+		idle := len(l.conns) == 0
+		l.mu.Unlock()
+		if idle {
+			l.closeEndpoint()
+		}
+	}()
+	for {
+		qconn, err := l.endpoint.Accept(acceptCtx)
+		if err != nil {
+			if acceptCtx.Err() != nil {
+				return ErrServerClosed
+			}
+			return err
+		}
+		sc := &http3ServerConn{
+			srv:   l.srv,
+			l:     l,
+			qconn: qconn,
+			peer:  http3PeerStreams{qconn: qconn, isServer: true},
+		}
+		l.mu.Lock()
+		closed := l.closed
+		l.conns[sc] = struct{}{}
+		l.mu.Unlock()
+		l.srv.trackHTTP3Conn(sc, true)
+		if closed {
+			sc.goAway()
+		}
+		go sc.serve(ctx)
+	}
+}
+
+// removeConn is called when a connection is closed.
+func (l *http3Listener) removeConn(sc *http3ServerConn) {
+	l.srv.trackHTTP3Conn(sc, false)
+	l.mu.Lock()
+	delete(l.conns, sc)
+	idle := l.stopped && len(l.conns) == 0
+	l.mu.Unlock()
+	if idle {
+		l.closeEndpoint()
+	}
+}
+
+func (l *http3Listener) closeEndpoint() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	l.endpoint.Close(ctx)
+}
+
+func (s *Server) trackHTTP3Conn(sc *http3ServerConn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.http3Conns == nil {
+		s.http3Conns = make(map[*http3ServerConn]struct{})
+	}
+	if add {
+		s.http3Conns[sc] = struct{}{}
+	} else {
+		delete(s.http3Conns, sc)
+	}
+}
+
+// An http3ServerConn is the server side of an HTTP/3 connection.
+type http3ServerConn struct {
+	srv   *Server
+	l     *http3Listener
+	qconn *quic.Conn
+	peer  http3PeerStreams
+
+	mu       sync.Mutex
+	ctrl     *quic.Stream // our control stream
+	active   int          // number of requests being handled
+	nextID   int64        // the lowest request stream ID not yet accepted
+	sentAway bool         // a GOAWAY frame has been sent
+}
+
+// serve accepts streams until the connection is closed.
+func (sc *http3ServerConn) serve(ctx context.Context) {
+	defer sc.l.removeConn(sc)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ctrl, err := http3OpenControlStream(ctx, sc.qconn, int64(sc.srv.maxHeaderBytes()))
+	if err != nil {
+		sc.qconn.Abort(err)
+		return
+	}
+	sc.mu.Lock()
+	sc.ctrl = ctrl
+	if sc.sentAway {
+		ctrl.Write(http3AppendGoAway(nil, sc.nextID))
+	}
+	sc.mu.Unlock()
+
+	for {
+		qs, err := sc.qconn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		if streamIsUni(qs.ID()) {
+			go sc.peer.serve(qs)
+			continue
+		}
+		sc.mu.Lock()
+		if sc.sentAway {
+			// Requests on streams after the ID in our GOAWAY frame
+			// are rejected; the client may retry them elsewhere.
+			sc.mu.Unlock()
+			qs.Reset(uint64(http3ErrRequestRejected))
+			qs.StopSending(uint64(http3ErrRequestRejected))
+			continue
+		}
+		sc.active++
+		sc.nextID = qs.ID() + 4
+		sc.mu.Unlock()
+		go sc.serveRequest(ctx, qs)
+	}
+}
+
+// streamIsUni reports whether id is the ID of a unidirectional stream.
+func streamIsUni(id int64) bool {
+	return id&0x2 != 0
+}
+
+// goAway sends a GOAWAY frame, after which new requests are rejected.
+// The connection is closed once existing requests have completed.
+func (sc *http3ServerConn) goAway() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.goAwayLocked()
+	if sc.active == 0 {
+		sc.qconn.Abort(&quic.ApplicationError{Code: uint64(http3ErrNoError)})
+	}
+}
+
+func (sc *http3ServerConn) goAwayLocked() {
+	if sc.sentAway {
+		return
+	}
+	sc.sentAway = true
+	if sc.ctrl != nil {
+		sc.ctrl.Write(http3AppendGoAway(nil, sc.nextID))
+	}
+}
+
+// closeIfIdle closes the connection if it has no active requests,
+// and reports whether it did so.
+func (sc *http3ServerConn) closeIfIdle() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.active > 0 {
+		return false
+	}
+	sc.goAwayLocked()
+	sc.qconn.Abort(&quic.ApplicationError{Code: uint64(http3ErrNoError)})
+	return true
+}
+
+// close closes the connection immediately.
+func (sc *http3ServerConn) close() {
+	sc.qconn.Abort(&quic.ApplicationError{Code: uint64(http3ErrNoError)})
+}
+
+// requestDone is called when a request handler returns.
+func (sc *http3ServerConn) requestDone() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.active--
+	if sc.sentAway && sc.active == 0 {
+		sc.qconn.Abort(&quic.ApplicationError{Code: uint64(http3ErrNoError)})
+	}
+}
+
+// serveRequest reads a request from qs and replies to it.
+func (sc *http3ServerConn) serveRequest(ctx context.Context, qs *quic.Stream) {
+	defer sc.requestDone()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	srv := sc.srv
+	st := newHTTP3Stream(sc.qconn, qs)
+	start := time.Now()
+
+	hctx := ctx
+	if d := srv.readHeaderTimeout(); d > 0 {
+		var hcancel context.CancelFunc
+		hctx, hcancel = context.WithTimeout(ctx, d)
+		defer hcancel()
+	}
+	qs.SetReadContext(hctx)
+	qs.SetWriteContext(ctx)
+	fields, err := st.readHeaders(int64(srv.maxHeaderBytes()))
+	if err != nil {
+		if err == io.EOF {
+			err = http3ErrRequestIncomplete
+		}
+		st.reset(http3ErrorCode(err, http3ErrRequestIncomplete))
+		return
+	}
+	rw := &http3ResponseWriter{
+		sc:            sc,
+		st:            st,
+		ctx:           ctx,
+		handlerHeader: make(Header),
+		contentLength: -1,
+	}
+	req, err := sc.newRequest(ctx, rw, fields)
+	if err != nil {
+		st.reset(http3ErrorCode(err, http3ErrMessageError))
+		return
+	}
+	rw.req = req
+	rw.bw = bufio.NewWriterSize(http3ChunkWriter{rw}, bufferBeforeChunkingSize)
+	var readDeadline, writeDeadline time.Time
+	if d := srv.ReadTimeout; d > 0 {
+		readDeadline = start.Add(d)
+	}
+	if d := srv.WriteTimeout; d > 0 {
+		writeDeadline = time.Now().Add(d)
+	}
+	rw.SetReadDeadline(readDeadline)
+	rw.SetWriteDeadline(writeDeadline)
+
+	// Cancel the request's context if the client abandons the request.
+	go func() {
+		if qs.WaitAborted(ctx) == nil {
+			cancel()
+		}
+	}()
+
+	defer func() {
+		if e := recover(); e != nil {
+			if e != ErrAbortHandler {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				srv.logf("http: panic serving %v: %v\n%s", req.RemoteAddr, e, buf)
+			}
+			st.reset(http3ErrInternalError)
+			return
+		}
+		rw.finish()
+	}()
+	serverHandler{srv}.ServeHTTP(rw, req)
+}
+
+// newRequest creates a Request from the fields of a request's HEADERS frame.
+// See RFC 9114, Section 4.3.1.
+func (sc *http3ServerConn) newRequest(ctx context.Context, rw *http3ResponseWriter, fields []qpack.HeaderField) (*Request, error) {
+	pseudo, header, err := http3SplitFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	for k := range pseudo {
+		switch k {
+		case ":method", ":scheme", ":authority", ":path":
+		default:
+			return nil, http3MessageError("invalid pseudo-header field %q", k)
+		}
+	}
+	method := pseudo[":method"]
+	scheme := pseudo[":scheme"]
+	authority := pseudo[":authority"]
+	rpath := pseudo[":path"]
+	isConnect := method == "CONNECT"
+	if isConnect {
+		if scheme != "" || rpath != "" || authority == "" {
+			return nil, http3MessageError("invalid CONNECT request")
+		}
+	} else if method == "" || scheme == "" || rpath == "" {
+		return nil, http3MessageError("missing required pseudo-header field")
+	}
+	if !validMethod(method) {
+		return nil, http3MessageError("invalid method %q", method)
+	}
+	if authority == "" {
+		authority = header.Get("Host")
+	}
+	header.Del("Host")
+
+	// Cookies may be split into separate fields for better compression.
+	// See RFC 9114, Section 4.2.1.
+	if cookies := header["Cookie"]; len(cookies) > 1 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	var u *url.URL
+	var requestURI string
+	if isConnect {
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		u, err = url.ParseRequestURI(rpath)
+		if err != nil {
+			return nil, http3MessageError("invalid :path %q", rpath)
+		}
+		requestURI = rpath
+	}
+	contentLength, err := http3ContentLength(header)
+	if err != nil {
+		return nil, err
+	}
+	cs := sc.qconn.ConnectionState()
+	req := &Request{
+		Method:        method,
+		URL:           u,
+		RemoteAddr:    sc.qconn.RemoteAddr().String(),
+		Header:        header,
+		RequestURI:    requestURI,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		TLS:           &cs,
+		Host:          authority,
+		ContentLength: contentLength,
+		ctx:           ctx,
+	}
+	for _, v := range header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			key = CanonicalHeaderKey(textproto.TrimString(key))
+			switch key {
+			case "", "Transfer-Encoding", "Trailer", "Content-Length":
+				// Bogus. (copy of http1 rules)
+				// Ignore.
+			default:
+				if req.Trailer == nil {
+					req.Trailer = make(Header)
+				}
+				req.Trailer[key] = nil
+			}
+		}
+	}
+	delete(header, "Trailer")
+
+	if contentLength == 0 {
+		req.Body = NoBody
+	} else {
+		req.Body = &http3RequestBody{
+			rw: rw,
+			r: http3BodyReader{
+				st:            rw.st,
+				contentLength: contentLength,
+				maxTrailer:    int64(sc.srv.maxHeaderBytes()),
+				setTrailer: func(trailer Header) {
+					if req.Trailer == nil {
+						return
+					}
+					for k, vv := range trailer {
+						req.Trailer[k] = vv
+					}
+				},
+			},
+		}
+		rw.needContinue = req.expectsContinue()
+	}
+	return req, nil
+}
+
+// An http3RequestBody is the body of a request received over HTTP/3.
+type http3RequestBody struct {
+	rw *http3ResponseWriter
+	r  http3BodyReader
+}
+
+func (b *http3RequestBody) Read(p []byte) (int, error) {
+	b.rw.writeContinue()
+	n, err := b.r.Read(p)
+	if err == context.DeadlineExceeded {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+func (b *http3RequestBody) Close() error {
+	b.rw.st.qs.StopSending(uint64(http3ErrNoError))
+	return nil
+}
+
+// An http3ResponseWriter is the ResponseWriter for requests received
+// over HTTP/3.
+type http3ResponseWriter struct {
+	sc  *http3ServerConn
+	st  *http3Stream
+	req *Request
+	ctx context.Context // canceled when the handler returns
+
+	handlerHeader Header
+	snapHeader    Header // handlerHeader at WriteHeader time
+	wroteHeader   bool   // WriteHeader called with a final status
+	status        int
+	contentLength int64 // declared Content-Length, or -1
+	written       int64 // body bytes written by the handler
+	handlerDone   bool
+	bw            *bufio.Writer // writes to http3ChunkWriter{rw}
+
+	mu           sync.Mutex // guards the following, and writes to st
+	sentHeader   bool       // the final HEADERS frame has been sent
+	needContinue bool       // the client is waiting for 100 Continue
+	cancels      []context.CancelFunc
+}
+
+// An http3ChunkWriter writes buffered response data as DATA frames.
+type http3ChunkWriter struct{ rw *http3ResponseWriter }
+
+func (cw http3ChunkWriter) Write(p []byte) (int, error) {
+	return cw.rw.writeChunk(p)
+}
+
+func (rw *http3ResponseWriter) Header() Header {
+	return rw.handlerHeader
+}
+
+func (rw *http3ResponseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		caller := relevantCaller()
+		rw.sc.srv.logf("http: superfluous response.WriteHeader call from %s (%s:%d)", caller.Function, path.Base(caller.File), caller.Line)
+		return
+	}
+	checkWriteHeaderCode(code)
+
+	if code >= 100 && code <= 199 {
+		rw.mu.Lock()
+		defer rw.mu.Unlock()
+		if code == StatusContinue {
+			if !rw.needContinue {
+				return
+			}
+			rw.needContinue = false
+		}
+		// Per RFC 8297 we must not clear the current header map.
+		fields := []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(code)}}
+		fields = http3AppendHeaderFields(fields, rw.handlerHeader, http3ExcludedHeadersNoBody)
+		rw.st.writeHeaders(fields)
+		return
+	}
+
+	rw.wroteHeader = true
+	rw.status = code
+	rw.snapHeader = rw.handlerHeader.Clone()
+	if cl := rw.snapHeader.get("Content-Length"); cl != "" {
+		v, err := strconv.ParseInt(cl, 10, 64)
+		if err == nil && v >= 0 {
+			rw.contentLength = v
+		} else {
+			rw.sc.srv.logf("http: invalid Content-Length of %q", cl)
+			rw.snapHeader.Del("Content-Length")
+		}
+	}
+	rw.mu.Lock()
+	rw.needContinue = false
+	rw.mu.Unlock()
+}
+
+func (rw *http3ResponseWriter) Write(p []byte) (int, error) {
+	return rw.write(len(p), p, "")
+}
+
+func (rw *http3ResponseWriter) WriteString(s string) (int, error) {
+	return rw.write(len(s), nil, s)
+}
+
+// write writes either p or s to the response body.
+func (rw *http3ResponseWriter) write(n int, p []byte, s string) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if !bodyAllowedForStatus(rw.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	rw.written += int64(n)
+	if rw.contentLength != -1 && rw.written > rw.contentLength {
+		return 0, ErrContentLength
+	}
+	if p != nil {
+		return rw.bw.Write(p)
+	}
+	return rw.bw.WriteString(s)
+}
+
+func (rw *http3ResponseWriter) Flush() {
+	rw.FlushError()
+}
+
+func (rw *http3ResponseWriter) FlushError() error {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if err := rw.bw.Flush(); err != nil {
+		return err
+	}
+	// Send the header even if there is no body data yet.
+	_, err := rw.writeChunk(nil)
+	return err
+}
+
+func (rw *http3ResponseWriter) SetReadDeadline(deadline time.Time) error {
+	rw.st.qs.SetReadContext(rw.deadlineContext(deadline))
+	return nil
+}
+
+func (rw *http3ResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	rw.st.qs.SetWriteContext(rw.deadlineContext(deadline))
+	return nil
+}
+
+// EnableFullDuplex does nothing: HTTP/3 requests may always be read
+// concurrently with writing the response.
+func (rw *http3ResponseWriter) EnableFullDuplex() error {
+	return nil
+}
+
+// deadlineContext returns a context which is done at the deadline,
+// or when the handler returns.
+func (rw *http3ResponseWriter) deadlineContext(deadline time.Time) context.Context {
+	if deadline.IsZero() {
+		return rw.ctx
+	}
+	ctx, cancel := context.WithDeadline(rw.ctx, deadline)
+	rw.mu.Lock()
+	rw.cancels = append(rw.cancels, cancel)
+	rw.mu.Unlock()
+	return ctx
+}
+
+// writeContinue sends a 100 Continue response if the client expects one.
+func (rw *http3ResponseWriter) writeContinue() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.needContinue {
+		return
+	}
+	rw.needContinue = false
+	rw.st.writeHeaders([]qpack.HeaderField{{Name: ":status", Value: "100"}})
+}
+
+// writeChunk writes p as the next part of the response body,
+// writing the response header first if necessary.
+func (rw *http3ResponseWriter) writeChunk(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.sentHeader {
+		if err := rw.writeFinalHeaderLocked(p); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) == 0 || rw.req.Method == "HEAD" {
+		return len(p), nil
+	}
+	if err := rw.st.writeFrame(http3FrameData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFinalHeaderLocked writes the final response header. The first
+// chunk of the response body, p, is used to sniff the Content-Type and,
+// if the handler has finished, to set the Content-Length.
+func (rw *http3ResponseWriter) writeFinalHeaderLocked(p []byte) error {
+	rw.sentHeader = true
+	rw.needContinue = false
+	h := rw.snapHeader
+	_, hasTrailer := h["Trailer"]
+	hasTrailer = hasTrailer || rw.hasPrefixTrailers()
+	var ctype, clen, date string
+	if rw.handlerDone && !hasTrailer && bodyAllowedForStatus(rw.status) && h.get("Content-Length") == "" &&
+		(rw.req.Method != "HEAD" || len(p) > 0) {
+		clen = strconv.Itoa(len(p))
+	}
+	_, haveType := h["Content-Type"]
+	if !haveType && bodyAllowedForStatus(rw.status) && h.get("Content-Encoding") == "" && len(p) > 0 {
+		ctype = DetectContentType(p)
+	}
+	if _, ok := h["Date"]; !ok {
+		date = string(appendTime(nil, time.Now()))
+	}
+	fields := []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(rw.status)}}
+	if ctype != "" {
+		fields = append(fields, qpack.HeaderField{Name: "content-type", Value: ctype})
+	}
+	if clen != "" {
+		fields = append(fields, qpack.HeaderField{Name: "content-length", Value: clen})
+	}
+	if date != "" {
+		fields = append(fields, qpack.HeaderField{Name: "date", Value: date})
+	}
+	fields = http3AppendHeaderFields(fields, h, nil)
+	return rw.st.writeHeaders(fields)
+}
+
+// http3ExcludedHeadersNoBody are the fields omitted from
+// informational responses.
+var http3ExcludedHeadersNoBody = map[string]bool{"content-length": true}
+
+// hasPrefixTrailers reports whether the handler has set trailers
+// using TrailerPrefix.
+func (rw *http3ResponseWriter) hasPrefixTrailers() bool {
+	for k := range rw.handlerHeader {
+		if strings.HasPrefix(k, TrailerPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// finish completes the response after the handler returns.
+func (rw *http3ResponseWriter) finish() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	rw.handlerDone = true
+	err := rw.bw.Flush()
+	if err == nil {
+		_, err = rw.writeChunk(nil)
+	}
+	if err == nil {
+		err = rw.writeTrailers()
+	}
+	rw.mu.Lock()
+	for _, cancel := range rw.cancels {
+		cancel()
+	}
+	rw.mu.Unlock()
+	if err != nil {
+		rw.st.reset(http3ErrInternalError)
+		return
+	}
+	// We won't read the rest of the request body. Asking the client to
+	// stop sending with H3_NO_ERROR tells it that the response is complete.
+	// See RFC 9114, Section 4.1.
+	rw.st.qs.StopSending(uint64(http3ErrNoError))
+	rw.st.qs.CloseWrite()
+}
+
+// writeTrailers writes the trailers declared in the Trailer header
+// and those set using TrailerPrefix.
+func (rw *http3ResponseWriter) writeTrailers() error {
+	trailer := make(Header)
+	for _, v := range rw.snapHeader["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			k = CanonicalHeaderKey(textproto.TrimString(k))
+			if vv, ok := rw.handlerHeader[k]; ok {
+				trailer[k] = vv
+			}
+		}
+	}
+	for k, vv := range rw.handlerHeader {
+		if strings.HasPrefix(k, TrailerPrefix) {
+			trailer[strings.TrimPrefix(k, TrailerPrefix)] = vv
+		}
+	}
+	if len(trailer) == 0 {
+		return nil
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.st.writeHeaders(http3AppendHeaderFields(nil, trailer, nil))
+}
@@ -0,0 +1,496 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	. "net/http"
+	"net/http/httptest"
+	"net/http/internal/testcert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type http3Test struct {
+	t    *testing.T
+	ts   *httptest.Server
+	tr   *Transport
+	c    *Client
+	errc chan error // result of ServeHTTP3
+}
+
+// newHTTP3Test starts a TLS server serving HTTP/1.1 and HTTP/2 over TCP,
+// and HTTP/3 over UDP on the same port number, and returns a client which
+// has learned from an Alt-Svc header field to use HTTP/3.
+func newHTTP3Test(t *testing.T, h Handler, opts ...any) *http3Test {
+	ts := httptest.NewUnstartedServer(h)
+	ts.EnableHTTP2 = true
+	var tropts []func(*Transport)
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case func(*Transport):
+			tropts = append(tropts, opt)
+		case func(*httptest.Server):
+			opt(ts)
+		default:
+			t.Fatalf("unhandled option type %T", opt)
+		}
+	}
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Config.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2"},
+	}
+	ts.StartTLS()
+	pc, err := net.ListenPacket("udp", ts.Listener.Addr().String())
+	if err != nil {
+		ts.Close()
+		t.Skipf("cannot listen on UDP port of TCP listener: %v", err)
+	}
+	ht := &http3Test{
+		t:    t,
+		ts:   ts,
+		tr:   ts.Client().Transport.(*Transport),
+		errc: make(chan error, 1),
+	}
+	ht.tr.EnableHTTP3 = true
+	for _, opt := range tropts {
+		opt(ht.tr)
+	}
+	ht.c = &Client{Transport: ht.tr}
+	go func() { ht.errc <- ts.Config.ServeHTTP3(pc, "", "") }()
+	t.Cleanup(ht.close)
+
+	// The first request is sent over TCP, and learns of HTTP/3.
+	res, err := ht.c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.ProtoMajor == 3 {
+		t.Fatalf("first request sent over HTTP/3")
+	}
+	if got, want := res.Header.Get("Alt-Svc"), fmt.Sprintf(`h3=":%v"; ma=86400`, ts.Listener.Addr().(*net.TCPAddr).Port); got != want {
+		t.Fatalf("Alt-Svc = %q, want %q", got, want)
+	}
+	return ht
+}
+
+func (ht *http3Test) close() {
+	ht.tr.CloseIdleConnections()
+	ht.ts.Close()
+	ht.ts.Config.Close()
+	if err := <-ht.errc; err != ErrServerClosed {
+		ht.t.Errorf("ServeHTTP3 = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestHTTP3AltSvcUpgrade(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor == 3 {
+			if r.Proto != "HTTP/3.0" || r.TLS == nil || r.TLS.NegotiatedProtocol != "h3" {
+				t.Errorf("HTTP/3 request has Proto %q, TLS %v", r.Proto, r.TLS)
+			}
+			if r.Host == "" || r.RemoteAddr == "" {
+				t.Errorf("HTTP/3 request has Host %q, RemoteAddr %q", r.Host, r.RemoteAddr)
+			}
+			if got, want := r.UserAgent(), "Go-http-client/3"; got != want {
+				t.Errorf("User-Agent = %q, want %q", got, want)
+			}
+		}
+		io.WriteString(w, r.Proto)
+	}))
+	for i := 0; i < 3; i++ {
+		res, err := ht.c.Get(ht.ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Proto != "HTTP/3.0" || string(body) != "HTTP/3.0" {
+			t.Errorf("request %v: response Proto %q, body %q; want HTTP/3.0", i, res.Proto, body)
+		}
+		if v := res.Header.Get("Alt-Svc"); v != "" {
+			t.Errorf("HTTP/3 response has Alt-Svc %q", v)
+		}
+		if res.Header.Get("Date") == "" || res.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("response header = %v, want Date and sniffed Content-Type", res.Header)
+		}
+	}
+}
+
+func TestHTTP3RequestBody(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Content-Length", fmt.Sprint(r.ContentLength))
+		io.Copy(w, r.Body)
+	}))
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	for _, test := range []struct {
+		name string
+		body io.Reader
+		want int64
+	}{
+		{"content-length", bytes.NewReader(data), int64(len(data))},
+		{"unknown length", struct{ io.Reader }{bytes.NewReader(data)}, -1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := NewRequest("POST", ht.ts.URL, test.body)
+			res, err := ht.c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			got, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.ProtoMajor != 3 {
+				t.Errorf("response Proto = %q, want HTTP/3.0", res.Proto)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("echoed %v bytes, want the %v bytes sent", len(got), len(data))
+			}
+			if got, want := res.Header.Get("X-Content-Length"), fmt.Sprint(test.want); got != want {
+				t.Errorf("Request.ContentLength = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHTTP3Trailers(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		if got := r.Trailer.Get("Client-Trailer"); got != "ct" {
+			t.Errorf("request trailer = %q, want %q", got, "ct")
+		}
+		w.Header().Set("Trailer", "Server-Trailer")
+		io.WriteString(w, "body")
+		w.Header().Set("Server-Trailer", "st")
+		w.Header().Set(TrailerPrefix+"Undeclared", "u")
+	}))
+	req, _ := NewRequest("POST", ht.ts.URL, strings.NewReader("request"))
+	req.Trailer = Header{"Client-Trailer": nil}
+	req.Trailer.Set("Client-Trailer", "ct")
+	res, err := ht.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if _, ok := res.Trailer["Server-Trailer"]; !ok {
+		t.Errorf("declared trailers = %v, want Server-Trailer", res.Trailer)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil || string(body) != "body" {
+		t.Fatalf("body = %q, %v", body, err)
+	}
+	if got := res.Trailer.Get("Server-Trailer"); got != "st" {
+		t.Errorf("Server-Trailer = %q, want %q", got, "st")
+	}
+	if got := res.Trailer.Get("Undeclared"); got != "u" {
+		t.Errorf("Undeclared trailer = %q, want %q", got, "u")
+	}
+}
+
+func TestHTTP3Gzip(t *testing.T) {
+	const text = "hello, hello, hello, hello"
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, text)
+		zw.Close()
+	}))
+	res, err := ht.c.Get(ht.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != text || !res.Uncompressed || res.ContentLength != -1 {
+		t.Errorf("body %q, Uncompressed %v, ContentLength %v; want %q, true, -1", body, res.Uncompressed, res.ContentLength, text)
+	}
+}
+
+func TestHTTP3NoBody(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/204":
+			w.WriteHeader(StatusNoContent)
+			if _, err := io.WriteString(w, "x"); err != ErrBodyNotAllowed {
+				t.Errorf("Write with 204 status = %v, want ErrBodyNotAllowed", err)
+			}
+		case "/cl":
+			w.Header().Set("Content-Length", "3")
+			if _, err := io.WriteString(w, "abcd"); err != ErrContentLength {
+				t.Errorf("Write beyond Content-Length = %v, want ErrContentLength", err)
+			}
+		default:
+			io.WriteString(w, "body")
+		}
+	}))
+	for _, test := range []struct {
+		method, path string
+		code         int
+		cl           int64
+		body         string
+	}{
+		{"GET", "/204", 204, -1, ""},
+		{"HEAD", "/", 200, 4, ""},
+		{"GET", "/", 200, 4, "body"},
+	} {
+		req, _ := NewRequest(test.method, ht.ts.URL+test.path, nil)
+		res, err := ht.c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || res.StatusCode != test.code || res.ContentLength != test.cl || string(body) != test.body {
+			t.Errorf("%v %v: status %v, ContentLength %v, body %q, %v; want %v, %v, %q",
+				test.method, test.path, res.StatusCode, res.ContentLength, body, err, test.code, test.cl, test.body)
+		}
+	}
+}
+
+func TestHTTP3FullDuplex(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 3 {
+			return
+		}
+		rc := NewResponseController(w)
+		if err := rc.EnableFullDuplex(); err != nil {
+			t.Errorf("EnableFullDuplex: %v", err)
+		}
+		if err := rc.Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		buf := make([]byte, 5)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				if err := rc.Flush(); err != nil {
+					t.Errorf("Flush: %v", err)
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}))
+	pr, pw := io.Pipe()
+	req, _ := NewRequest("POST", ht.ts.URL, pr)
+	res, err := ht.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	buf := make([]byte, 5)
+	for _, s := range []string{"hello", "world"} {
+		io.WriteString(pw, s)
+		if _, err := io.ReadFull(res.Body, buf); err != nil || string(buf) != s {
+			t.Fatalf("read %q, %v; want %q", buf, err, s)
+		}
+	}
+	pw.Close()
+	if n, err := res.Body.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read at end of body = %v, %v; want io.EOF", n, err)
+	}
+}
+
+func TestHTTP3ExpectContinue(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(StatusForbidden)
+			return
+		}
+		io.Copy(w, r.Body)
+	}), func(tr *Transport) {
+		tr.ExpectContinueTimeout = time.Hour
+	})
+	for _, test := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/", 200, "data"},
+		{"/reject", 403, ""},
+	} {
+		req, _ := NewRequest("PUT", ht.ts.URL+test.path, strings.NewReader("data"))
+		req.Header.Set("Expect", "100-continue")
+		res, err := ht.c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != test.code || string(body) != test.body {
+			t.Errorf("%v: status %v, body %q; want %v, %q", test.path, res.StatusCode, body, test.code, test.body)
+		}
+	}
+}
+
+func TestHTTP3RequestCancel(t *testing.T) {
+	handlerDone := make(chan error, 1)
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path != "/block" {
+			return
+		}
+		w.WriteHeader(StatusOK)
+		w.(Flusher).Flush()
+		<-r.Context().Done()
+		handlerDone <- r.Context().Err()
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := NewRequestWithContext(ctx, "GET", ht.ts.URL+"/block", nil)
+	res, err := ht.c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	cancel()
+	if _, err := io.ReadAll(res.Body); !errors.Is(err, context.Canceled) {
+		t.Errorf("reading body after cancel: %v, want context.Canceled", err)
+	}
+	if err := <-handlerDone; err != context.Canceled {
+		t.Errorf("handler context error = %v, want context.Canceled", err)
+	}
+
+	// The connection is still usable.
+	res, err = ht.c.Get(ht.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.ProtoMajor != 3 {
+		t.Errorf("response Proto = %q, want HTTP/3.0", res.Proto)
+	}
+}
+
+func TestHTTP3HandlerPanic(t *testing.T) {
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor == 3 {
+			panic(ErrAbortHandler)
+		}
+	}))
+	res, err := ht.c.Get(ht.ts.URL)
+	if err == nil {
+		res.Body.Close()
+		t.Fatalf("request to panicking handler succeeded with status %v", res.Status)
+	}
+}
+
+func TestHTTP3Shutdown(t *testing.T) {
+	unblock := make(chan struct{})
+	started := make(chan struct{})
+	ht := newHTTP3Test(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/block" {
+			close(started)
+			<-unblock
+			io.WriteString(w, "done")
+		}
+	}))
+	type result struct {
+		res  *Response
+		body string
+		err  error
+	}
+	resc := make(chan result)
+	go func() {
+		res, err := ht.c.Get(ht.ts.URL + "/block")
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		resc <- result{res, string(body), err}
+	}()
+	<-started
+	shutdownc := make(chan error)
+	go func() { shutdownc <- ht.ts.Config.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned %v with a request in progress", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	r := <-resc
+	if r.err != nil || r.res.ProtoMajor != 3 || r.body != "done" {
+		t.Errorf("request in progress during Shutdown = %q, %v", r.body, r.err)
+	}
+	if err := <-shutdownc; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestHTTP3FallbackToTCP(t *testing.T) {
+	// Advertise HTTP/3 on a port with nothing listening.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on UDP: %v", err)
+	}
+	deadPort := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+	var mu sync.Mutex
+	var protos []string
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		mu.Lock()
+		protos = append(protos, r.Proto)
+		mu.Unlock()
+		w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%v"`, deadPort))
+		io.Copy(w, r.Body)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	tr := ts.Client().Transport.(*Transport)
+	tr.EnableHTTP3 = true
+	tr.TLSHandshakeTimeout = 200 * time.Millisecond
+	defer tr.CloseIdleConnections()
+	for i := 0; i < 3; i++ {
+		res, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "data" || res.ProtoMajor == 3 {
+			t.Errorf("request %v: proto %q, body %q", i, res.Proto, body)
+		}
+	}
+	if len(protos) != 3 {
+		t.Errorf("server saw %v requests, want 3", len(protos))
+	}
+}
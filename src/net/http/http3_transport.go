@@ -0,0 +1,867 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/3 client.
+
+package http
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"internal/quic"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"net/http/internal/ascii"
+	"net/http/internal/qpack"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// errHTTP3Unavailable is returned by Transport.roundTripHTTP3 when
+// the server has not advertised HTTP/3 support.
+var errHTTP3Unavailable = errors.New("net/http: HTTP/3 not available")
+
+// An http3FallbackError is returned by Transport.roundTripHTTP3 when a
+// request was not processed by the server and should be retried over TCP.
+type http3FallbackError struct {
+	err error
+}
+
+func (e http3FallbackError) Error() string {
+	return "net/http: HTTP/3 request not sent: " + e.err.Error()
+}
+func (e http3FallbackError) Unwrap() error { return e.err }
+
+// http3BrokenDuration is how long an alternative service which
+// could not be reached is ignored.
+const http3BrokenDuration = 5 * time.Minute
+
+// An http3AltSvc is an HTTP/3 alternative service advertised by an origin.
+// See RFC 7838.
+type http3AltSvc struct {
+	addr        string // "host:port" of the alternative service
+	expires     time.Time
+	brokenUntil time.Time
+}
+
+// An http3ClientPool holds a Transport's HTTP/3 connections,
+// and the alternative services learned from Alt-Svc header fields.
+type http3ClientPool struct {
+	mu       sync.Mutex
+	endpoint *quic.Endpoint                // created when first needed
+	alts     map[string]*http3AltSvc       // by origin "host:port"
+	conns    map[string]*http3ClientConn   // by origin "host:port"
+	dials    map[string]*http3DialCall     // by origin "host:port"
+	expired  map[*http3ClientConn]struct{} // conns no longer in conns, not yet closed
+}
+
+// An http3DialCall is a dial in progress, shared by concurrent requests.
+type http3DialCall struct {
+	done chan struct{}
+	cc   *http3ClientConn
+	err  error
+}
+
+// setAltSvc records the Alt-Svc field values of a response from origin.
+// Only HTTP/3 alternatives ("h3") are used.
+func (p *http3ClientPool) setAltSvc(origin string, values []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, v := range values {
+		if textproto.TrimString(v) == "clear" {
+			delete(p.alts, origin)
+			return
+		}
+		for _, alt := range strings.Split(v, ",") {
+			addr, maxAge, ok := parseHTTP3AltSvc(alt)
+			if !ok {
+				continue
+			}
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				continue
+			}
+			if host == "" {
+				host, _, _ = net.SplitHostPort(origin)
+				addr = net.JoinHostPort(host, port)
+			}
+			if p.alts == nil {
+				p.alts = make(map[string]*http3AltSvc)
+			}
+			old := p.alts[origin]
+			a := &http3AltSvc{addr: addr, expires: time.Now().Add(maxAge)}
+			if old != nil && old.addr == addr {
+				a.brokenUntil = old.brokenUntil
+			}
+			p.alts[origin] = a
+			return
+		}
+	}
+}
+
+// parseHTTP3AltSvc parses an alternative in an Alt-Svc field value,
+// such as `h3=":443"; ma=3600`. It reports whether the alternative is
+// for HTTP/3. See RFC 7838, Section 3.
+func parseHTTP3AltSvc(alt string) (addr string, maxAge time.Duration, ok bool) {
+	params := strings.Split(alt, ";")
+	protocol, authority, ok := strings.Cut(textproto.TrimString(params[0]), "=")
+	if !ok || protocol != http3NextProto {
+		return "", 0, false
+	}
+	authority, err := strconv.Unquote(authority)
+	if err != nil {
+		return "", 0, false
+	}
+	maxAge = 24 * time.Hour
+	for _, param := range params[1:] {
+		k, v, _ := strings.Cut(textproto.TrimString(param), "=")
+		if ascii.EqualFold(k, "ma") {
+			n, err := strconv.ParseUint(strings.Trim(v, `"`), 10, 32)
+			if err != nil {
+				return "", 0, false
+			}
+			maxAge = time.Duration(n) * time.Second
+		}
+	}
+	return authority, maxAge, true
+}
+
+// altSvc returns the address of the HTTP/3 alternative service for origin.
+func (p *http3ClientPool) altSvc(origin string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	a := p.alts[origin]
+	if a == nil {
+		return "", false
+	}
+	now := time.Now()
+	if now.After(a.expires) {
+		delete(p.alts, origin)
+		return "", false
+	}
+	return a.addr, now.After(a.brokenUntil)
+}
+
+// markBroken records that the alternative service for origin could not
+// be used, so that requests are sent over TCP for a while.
+func (p *http3ClientPool) markBroken(origin string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if a := p.alts[origin]; a != nil {
+		a.brokenUntil = time.Now().Add(http3BrokenDuration)
+	}
+}
+
+// getConn returns a connection to origin, dialing addr if necessary.
+func (p *http3ClientPool) getConn(t *Transport, req *Request, cm connectMethod, addr string) (*http3ClientConn, error) {
+	origin := cm.targetAddr
+	p.mu.Lock()
+	if cc := p.conns[origin]; cc != nil && cc.canTakeNewRequest() {
+		p.mu.Unlock()
+		return cc, nil
+	}
+	call := p.dials[origin]
+	if call == nil {
+		if p.endpoint == nil {
+			e, err := quic.Listen("udp", ":0", nil)
+			if err != nil {
+				p.mu.Unlock()
+				return nil, err
+			}
+			p.endpoint = e
+		}
+		call = &http3DialCall{done: make(chan struct{})}
+		if p.dials == nil {
+			p.dials = make(map[string]*http3DialCall)
+		}
+		p.dials[origin] = call
+		go p.dial(t, call, cm, addr)
+	}
+	p.mu.Unlock()
+	select {
+	case <-call.done:
+		return call.cc, call.err
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+// dial creates a new connection to origin, and completes call.
+func (p *http3ClientPool) dial(t *Transport, call *http3DialCall, cm connectMethod, addr string) {
+	origin := cm.targetAddr
+	tlsConfig := cloneTLSConfig(t.TLSClientConfig)
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cm.tlsHost()
+	}
+	tlsConfig.NextProtos = []string{http3NextProto}
+	config := &quic.Config{
+		TLSConfig:      tlsConfig,
+		MaxIdleTimeout: t.IdleConnTimeout,
+	}
+	timeout := t.TLSHandshakeTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	p.mu.Lock()
+	e := p.endpoint
+	p.mu.Unlock()
+	qconn, err := e.Dial(ctx, "udp", addr, config)
+	var cc *http3ClientConn
+	if err == nil {
+		cc, err = newHTTP3ClientConn(ctx, p, t, origin, qconn)
+	}
+	p.mu.Lock()
+	delete(p.dials, origin)
+	if cc != nil {
+		if old := p.conns[origin]; old != nil {
+			if p.expired == nil {
+				p.expired = make(map[*http3ClientConn]struct{})
+			}
+			p.expired[old] = struct{}{}
+		}
+		if p.conns == nil {
+			p.conns = make(map[string]*http3ClientConn)
+		}
+		p.conns[origin] = cc
+	}
+	p.mu.Unlock()
+	call.cc, call.err = cc, err
+	close(call.done)
+}
+
+// removeConn removes a closed connection from the pool.
+func (p *http3ClientPool) removeConn(cc *http3ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns[cc.origin] == cc {
+		delete(p.conns, cc.origin)
+	}
+	delete(p.expired, cc)
+}
+
+// closeIdleConnections closes connections with no requests in progress.
+// When no connections remain, the QUIC endpoint is closed.
+func (p *http3ClientPool) closeIdleConnections() {
+	p.mu.Lock()
+	var conns []*http3ClientConn
+	for _, cc := range p.conns {
+		conns = append(conns, cc)
+	}
+	for cc := range p.expired {
+		conns = append(conns, cc)
+	}
+	p.mu.Unlock()
+	for _, cc := range conns {
+		if cc.closeIfIdle() {
+			p.removeConn(cc)
+		}
+	}
+	p.mu.Lock()
+	var e *quic.Endpoint
+	if len(p.conns) == 0 && len(p.expired) == 0 && len(p.dials) == 0 {
+		e = p.endpoint
+		p.endpoint = nil
+	}
+	p.mu.Unlock()
+	if e != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		e.Close(ctx)
+	}
+}
+
+// roundTripHTTP3 sends req over HTTP/3 if the server has advertised
+// support for it. It returns errHTTP3Unavailable or an http3FallbackError
+// if the request was not sent, in which case req.Body has not been closed.
+func (t *Transport) roundTripHTTP3(req *Request) (*Response, error) {
+	if t.hasCustomTLSDialer() || req.URL.Host == "" || req.Method != "" && !validMethod(req.Method) {
+		return nil, errHTTP3Unavailable
+	}
+	cm := connectMethod{targetScheme: "https", targetAddr: canonicalAddr(req.URL)}
+	addr, ok := t.h3.altSvc(cm.targetAddr)
+	if !ok {
+		return nil, errHTTP3Unavailable
+	}
+	if t.Proxy != nil {
+		if u, err := t.Proxy(req); u != nil || err != nil {
+			return nil, errHTTP3Unavailable
+		}
+	}
+	cc, err := t.h3.getConn(t, req, cm, addr)
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			req.closeBody()
+			return nil, ctxErr
+		}
+		t.h3.markBroken(cm.targetAddr)
+		return nil, http3FallbackError{err}
+	}
+	return cc.roundTrip(req)
+}
+
+// recordAltSvc records the alternative services advertised
+// by a response to an https request.
+func (t *Transport) recordAltSvc(req *Request, resp *Response) {
+	if !t.EnableHTTP3 || resp.TLS == nil || req.URL.Scheme != "https" {
+		return
+	}
+	if altSvc := resp.Header["Alt-Svc"]; len(altSvc) > 0 {
+		t.h3.setAltSvc(canonicalAddr(req.URL), altSvc)
+	}
+}
+
+// An http3ClientConn is the client side of an HTTP/3 connection.
+type http3ClientConn struct {
+	t      *Transport
+	pool   *http3ClientPool
+	origin string
+	qconn  *quic.Conn
+	peer   http3PeerStreams
+
+	mu       sync.Mutex
+	active   int   // number of requests in progress
+	goAwayID int64 // -1, or the stream ID in the server's GOAWAY frame
+	closed   bool
+}
+
+func newHTTP3ClientConn(ctx context.Context, p *http3ClientPool, t *Transport, origin string, qconn *quic.Conn) (*http3ClientConn, error) {
+	cc := &http3ClientConn{
+		t:        t,
+		pool:     p,
+		origin:   origin,
+		qconn:    qconn,
+		goAwayID: -1,
+	}
+	cc.peer = http3PeerStreams{
+		qconn:    qconn,
+		onGoAway: cc.onGoAway,
+	}
+	if _, err := http3OpenControlStream(ctx, qconn, t.maxHeaderResponseSize()); err != nil {
+		qconn.Abort(err)
+		return nil, err
+	}
+	go cc.acceptStreams()
+	return cc, nil
+}
+
+// maxHeaderResponseSize is the limit on the size of a response header.
+func (t *Transport) maxHeaderResponseSize() int64 {
+	if v := t.MaxResponseHeaderBytes; v != 0 {
+		return v
+	}
+	return 10 << 20 // conservative default; same as http2
+}
+
+// acceptStreams handles streams opened by the server
+// until the connection is closed.
+func (cc *http3ClientConn) acceptStreams() {
+	defer cc.pool.removeConn(cc)
+	for {
+		qs, err := cc.qconn.AcceptStream(context.Background())
+		if err != nil {
+			cc.mu.Lock()
+			cc.closed = true
+			cc.mu.Unlock()
+			return
+		}
+		if !streamIsUni(qs.ID()) {
+			http3ConnError(cc.qconn, http3ErrStreamCreationError, "bidirectional stream opened by server")
+			continue
+		}
+		go cc.peer.serve(qs)
+	}
+}
+
+func (cc *http3ClientConn) onGoAway(id int64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.goAwayID = id
+	if cc.active == 0 {
+		cc.closeLocked()
+	}
+}
+
+func (cc *http3ClientConn) canTakeNewRequest() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return !cc.closed && cc.goAwayID < 0
+}
+
+func (cc *http3ClientConn) closeLocked() {
+	cc.closed = true
+	cc.qconn.Abort(&quic.ApplicationError{Code: uint64(http3ErrNoError)})
+}
+
+// closeIfIdle closes the connection if it has no requests in progress,
+// and reports whether it is closed.
+func (cc *http3ClientConn) closeIfIdle() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.active > 0 {
+		return cc.closed
+	}
+	cc.closeLocked()
+	return true
+}
+
+// requestDone is called when a request's response has been read.
+func (cc *http3ClientConn) requestDone() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.active--
+	if cc.active == 0 && (cc.goAwayID >= 0 || cc.t.DisableKeepAlives) {
+		cc.closeLocked()
+	}
+}
+
+// notProcessed reports whether the server has said that it did not
+// process the request on the stream with the given ID.
+func (cc *http3ClientConn) notProcessed(id int64) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.goAwayID >= 0 && id >= cc.goAwayID
+}
+
+// roundTrip sends a request and reads its response header.
+func (cc *http3ClientConn) roundTrip(req *Request) (*Response, error) {
+	ctx := req.Context()
+	trace := httptrace.ContextClientTrace(ctx)
+	cc.mu.Lock()
+	if cc.closed || cc.goAwayID >= 0 {
+		cc.mu.Unlock()
+		return nil, http3FallbackError{errors.New("connection is closing")}
+	}
+	cc.active++
+	cc.mu.Unlock()
+
+	qs, err := cc.qconn.NewStream(ctx)
+	if err != nil {
+		cc.requestDone()
+		if ctx.Err() != nil {
+			req.closeBody()
+			return nil, err
+		}
+		return nil, http3FallbackError{err}
+	}
+	rs := &http3ClientStream{
+		cc:  cc,
+		st:  newHTTP3Stream(cc.qconn, qs),
+		req: req,
+	}
+	qs.SetReadContext(ctx)
+	qs.SetWriteContext(ctx)
+
+	fields, requestedGzip, err := cc.requestFields(req)
+	if err != nil {
+		qs.Reset(uint64(http3ErrRequestCancelled))
+		rs.done()
+		req.closeBody()
+		return nil, err
+	}
+	if err := rs.st.writeHeaders(fields); err != nil {
+		qs.Reset(uint64(http3ErrRequestCancelled))
+		rs.done()
+		if ctx.Err() != nil {
+			req.closeBody()
+			return nil, err
+		}
+		return nil, http3FallbackError{err}
+	}
+	if trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+
+	hasBody := req.Body != nil && req.Body != NoBody && req.outgoingLength() != 0
+	var continueCh chan struct{}
+	if hasBody && req.expectsContinue() {
+		continueCh = make(chan struct{}, 1) // buffered, in case writeBody timed out
+	}
+	if hasBody {
+		go rs.writeBody(continueCh)
+	} else {
+		rs.closeBody()
+		qs.CloseWrite()
+		if trace != nil && trace.WroteRequest != nil {
+			trace.WroteRequest(httptrace.WroteRequestInfo{})
+		}
+	}
+
+	resp, err := rs.readResponse(continueCh, requestedGzip)
+	if err != nil {
+		rs.abort()
+		// Unblock the goroutine writing the body, if it is reading from it.
+		rs.closeBody()
+		var se http3StreamError
+		rejected := errors.As(err, &se) && se.Code == http3ErrRequestRejected
+		if (rejected || cc.notProcessed(qs.ID())) && ctx.Err() == nil {
+			// The server didn't process the request. If the body
+			// can be rewound, the caller will retry it over TCP.
+			return nil, http3FallbackError{err}
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// requestFields returns the fields of a request's HEADERS frame,
+// and whether the transport asked for a gzip-compressed response.
+func (cc *http3ClientConn) requestFields(req *Request) (fields []qpack.HeaderField, requestedGzip bool, err error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err = httpguts.PunycodeHostPort(host)
+	if err != nil {
+		return nil, false, err
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	fields = append(fields, qpack.HeaderField{Name: ":method", Value: method})
+	if method != "CONNECT" {
+		path := req.URL.RequestURI()
+		if !http3ValidPseudoPath(path) {
+			if req.URL.Opaque == "" {
+				return nil, false, fmt.Errorf("invalid request :path %q", path)
+			}
+			path = req.URL.Opaque
+		}
+		fields = append(fields,
+			qpack.HeaderField{Name: ":scheme", Value: "https"},
+			qpack.HeaderField{Name: ":path", Value: path})
+	}
+	fields = append(fields, qpack.HeaderField{Name: ":authority", Value: host})
+
+	if len(req.Trailer) > 0 {
+		keys := make([]string, 0, len(req.Trailer))
+		for k := range req.Trailer {
+			k = CanonicalHeaderKey(k)
+			switch k {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				return nil, false, fmt.Errorf("invalid Trailer key %q", k)
+			}
+			lower, ok := ascii.ToLower(k)
+			if !ok {
+				return nil, false, fmt.Errorf("invalid Trailer key %q", k)
+			}
+			keys = append(keys, lower)
+		}
+		fields = append(fields, qpack.HeaderField{Name: "trailer", Value: strings.Join(keys, ",")})
+	}
+	if cl := req.outgoingLength(); cl > 0 || cl == 0 && (method == "POST" || method == "PUT" || method == "PATCH") {
+		fields = append(fields, qpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(cl, 10)})
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		fields = append(fields, qpack.HeaderField{Name: "user-agent", Value: "Go-http-client/3"})
+	}
+	if !cc.t.DisableCompression &&
+		req.Header.Get("Accept-Encoding") == "" &&
+		req.Header.Get("Range") == "" &&
+		method != "HEAD" {
+		requestedGzip = true
+		fields = append(fields, qpack.HeaderField{Name: "accept-encoding", Value: "gzip"})
+	}
+	fields = http3AppendHeaderFields(fields, req.Header, http3ExcludedRequestHeaders)
+	return fields, requestedGzip, nil
+}
+
+// http3ExcludedRequestHeaders are the fields of Request.Header which
+// are replaced by pseudo-header fields or set by the transport.
+var http3ExcludedRequestHeaders = map[string]bool{
+	"host":           true,
+	"content-length": true,
+	"trailer":        true,
+}
+
+// An http3ClientStream is a request stream opened by a client.
+type http3ClientStream struct {
+	cc        *http3ClientConn
+	st        *http3Stream
+	req       *Request
+	doneOnce  sync.Once
+	closeOnce sync.Once
+}
+
+// done releases the stream's slot in the connection.
+func (rs *http3ClientStream) done() {
+	rs.doneOnce.Do(rs.cc.requestDone)
+}
+
+// closeBody closes the request body.
+func (rs *http3ClientStream) closeBody() {
+	rs.closeOnce.Do(func() { rs.req.closeBody() })
+}
+
+// abort cancels the request.
+func (rs *http3ClientStream) abort() {
+	rs.st.reset(http3ErrRequestCancelled)
+	rs.done()
+}
+
+// writeBody writes the request body and trailers, then closes the
+// sending part of the stream.
+func (rs *http3ClientStream) writeBody(continueCh <-chan struct{}) (err error) {
+	req := rs.req
+	trace := httptrace.ContextClientTrace(req.Context())
+	defer func() {
+		if err != nil {
+			rs.st.qs.Reset(uint64(http3ErrRequestCancelled))
+		}
+		rs.closeBody()
+		if trace != nil && trace.WroteRequest != nil {
+			trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+		}
+	}()
+	if continueCh != nil {
+		timer := time.NewTimer(rs.cc.t.ExpectContinueTimeout)
+		select {
+		case _, ok := <-continueCh:
+			if !ok {
+				// A final response arrived first.
+				timer.Stop()
+				return errors.New("net/http: request body not sent")
+			}
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	buf := make([]byte, 16<<10)
+	var written int64
+	declared := req.outgoingLength()
+	for {
+		n, rerr := req.Body.Read(buf)
+		if n > 0 {
+			written += int64(n)
+			if declared >= 0 && written > declared {
+				return fmt.Errorf("http: ContentLength=%d with Body length %d", declared, written)
+			}
+			if err := rs.st.writeFrame(http3FrameData, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	if declared > 0 && written != declared {
+		return fmt.Errorf("http: ContentLength=%d with Body length %d", declared, written)
+	}
+	if len(req.Trailer) > 0 {
+		if err := rs.st.writeHeaders(http3AppendHeaderFields(nil, req.Trailer, nil)); err != nil {
+			return err
+		}
+	}
+	return rs.st.qs.CloseWrite()
+}
+
+// readResponse reads the response header.
+func (rs *http3ClientStream) readResponse(continueCh chan struct{}, requestedGzip bool) (*Response, error) {
+	req := rs.req
+	ctx := req.Context()
+	trace := httptrace.ContextClientTrace(ctx)
+	cc := rs.cc
+	if d := cc.t.ResponseHeaderTimeout; d > 0 {
+		hctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		rs.st.qs.SetReadContext(hctx)
+		defer rs.st.qs.SetReadContext(ctx)
+	}
+	defer func() {
+		if continueCh != nil {
+			// Don't send the body if there is no 100 Continue response.
+			close(continueCh)
+		}
+	}()
+	num1xx := 0               // number of informational 1xx headers received
+	const max1xxResponses = 5 // arbitrary bound on number of informational responses
+	for {
+		fields, err := rs.st.readHeaders(cc.t.maxHeaderResponseSize())
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			err = errors.New("net/http: timeout awaiting response headers")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if trace != nil && trace.GotFirstResponseByte != nil && num1xx == 0 {
+			trace.GotFirstResponseByte()
+		}
+		pseudo, header, err := http3SplitFields(fields)
+		if err != nil {
+			return nil, err
+		}
+		status := pseudo[":status"]
+		if len(pseudo) != 1 || len(status) != 3 {
+			return nil, http3MessageError("invalid response pseudo-header fields")
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 {
+			return nil, http3MessageError("invalid :status %q", status)
+		}
+		if code < 200 {
+			if code == StatusContinue && continueCh != nil {
+				if trace != nil && trace.Got100Continue != nil {
+					trace.Got100Continue()
+				}
+				continueCh <- struct{}{}
+				continueCh = nil
+				continue
+			}
+			num1xx++
+			if num1xx > max1xxResponses {
+				return nil, errors.New("net/http: too many 1xx informational responses")
+			}
+			if trace != nil && trace.Got1xxResponse != nil {
+				if err := trace.Got1xxResponse(code, textproto.MIMEHeader(header)); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		return rs.newResponse(code, header, requestedGzip)
+	}
+}
+
+// newResponse creates a Response from its status code and header.
+func (rs *http3ClientStream) newResponse(code int, header Header, requestedGzip bool) (*Response, error) {
+	req := rs.req
+	contentLength, err := http3ContentLength(header)
+	if err != nil {
+		return nil, err
+	}
+	cs := rs.cc.qconn.ConnectionState()
+	resp := &Response{
+		Status:        strconv.Itoa(code) + " " + StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		Header:        header,
+		ContentLength: contentLength,
+		Request:       req,
+		TLS:           &cs,
+	}
+	for _, v := range header["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			key = CanonicalHeaderKey(textproto.TrimString(key))
+			if key == "" {
+				continue
+			}
+			if resp.Trailer == nil {
+				resp.Trailer = make(Header)
+			}
+			resp.Trailer[key] = nil
+		}
+	}
+	delete(header, "Trailer")
+
+	if req.Method == "HEAD" || !bodyAllowedForStatus(code) {
+		rs.st.qs.StopSending(uint64(http3ErrNoError))
+		rs.done()
+		resp.Body = NoBody
+		return resp, nil
+	}
+	resp.Body = &http3ResponseBody{
+		rs: rs,
+		r: http3BodyReader{
+			st:            rs.st,
+			contentLength: contentLength,
+			maxTrailer:    rs.cc.t.maxHeaderResponseSize(),
+			setTrailer: func(trailer Header) {
+				if resp.Trailer == nil {
+					resp.Trailer = make(Header)
+				}
+				for k, vv := range trailer {
+					resp.Trailer[k] = vv
+				}
+			},
+		},
+	}
+	if requestedGzip && ascii.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		resp.Body = &http3GzipReader{body: resp.Body}
+	}
+	return resp, nil
+}
+
+// An http3ResponseBody is the body of a response received over HTTP/3.
+type http3ResponseBody struct {
+	rs *http3ClientStream
+	r  http3BodyReader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (b *http3ResponseBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return 0, errReadOnClosedResBody
+	}
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.rs.done()
+	} else if err != nil {
+		b.rs.abort()
+	}
+	return n, err
+}
+
+func (b *http3ResponseBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	// If the response was not fully read, cancel the rest of the request.
+	// Otherwise, the server has already finished with the stream.
+	b.rs.st.qs.StopSending(uint64(http3ErrRequestCancelled))
+	b.rs.done()
+	return nil
+}
+
+// An http3GzipReader decompresses a response body.
+type http3GzipReader struct {
+	body io.ReadCloser
+	zr   *gzip.Reader // lazily-initialized gzip reader
+	zerr error        // any error from gzip.NewReader; sticky
+}
+
+func (gz *http3GzipReader) Read(p []byte) (int, error) {
+	if gz.zr == nil {
+		if gz.zerr == nil {
+			gz.zr, gz.zerr = gzip.NewReader(gz.body)
+		}
+		if gz.zerr != nil {
+			return 0, gz.zerr
+		}
+	}
+	return gz.zr.Read(p)
+}
+
+func (gz *http3GzipReader) Close() error {
+	return gz.body.Close()
+}
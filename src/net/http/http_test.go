@@ -218,3 +218,23 @@ func TestNoUnicodeStrings(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestProtocols(t *testing.T) {
+	var p Protocols
+	if got, want := p.String(), "{}"; got != want {
+		t.Errorf("zero Protocols = %v, want %v", got, want)
+	}
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	if !p.HTTP1() || p.HTTP2() || !p.UnencryptedHTTP2() {
+		t.Errorf("after SetHTTP1 and SetUnencryptedHTTP2: HTTP1 %v, HTTP2 %v, UnencryptedHTTP2 %v", p.HTTP1(), p.HTTP2(), p.UnencryptedHTTP2())
+	}
+	if got, want := p.String(), "{HTTP1,UnencryptedHTTP2}"; got != want {
+		t.Errorf("Protocols = %v, want %v", got, want)
+	}
+	p.SetHTTP1(false)
+	p.SetHTTP2(true)
+	if got, want := p.String(), "{HTTP2,UnencryptedHTTP2}"; got != want {
+		t.Errorf("Protocols = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package httpcache implements a private HTTP cache for clients,
+// as described in RFC 9111.
+//
+// A Transport is an http.RoundTripper that answers GET requests from
+// its Store when the stored responses are fresh, and otherwise forwards
+// requests to an underlying RoundTripper, revalidating stored responses
+// with conditional requests where possible.
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/internal/ascii"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A Store holds cached responses, encoded as byte slices.
+//
+// Implementations of Store must be safe for concurrent use by multiple
+// goroutines. A Store may discard entries at any time.
+type Store interface {
+	// Get returns the entry stored under key,
+	// and reports whether there was one.
+	Get(key string) (value []byte, ok bool)
+
+	// Set stores value under key, replacing any existing entry.
+	Set(key string, value []byte)
+
+	// Delete removes the entry stored under key, if there is one.
+	Delete(key string)
+}
+
+const (
+	// defaultStoreSize is the size limit of the store used
+	// by a Transport with a nil Store.
+	defaultStoreSize = 64 << 20
+
+	// defaultMaxBodySize is the default Transport.MaxBodySize.
+	defaultMaxBodySize = 10 << 20
+)
+
+// Transport is an http.RoundTripper that caches responses.
+//
+// Only responses to GET requests are cached. Requests with Range or
+// conditional header fields are always forwarded, as are requests with
+// other methods; a successful response to a request with an unsafe method,
+// such as POST, invalidates any stored response for its URL.
+//
+// For each URL, at most one response is stored. A response with a Vary
+// header field is used only for requests that match the request
+// it answered.
+//
+// A response is stored when its body has been read to the end.
+// Responses served from the cache have an Age header field.
+//
+// Since the cache is private, responses to requests with credentials,
+// and responses with the Cache-Control directive "private", are stored.
+// A Transport should not be shared by clients acting for different users.
+type Transport struct {
+	// Transport makes the requests that are not answered from the
+	// cache. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// Store holds the cached responses. If nil, a MemoryStore
+	// holding up to 64 MiB of responses is used.
+	Store Store
+
+	// MaxBodySize is the size in bytes of the largest response body
+	// that is cached. If zero, a default of 10 MiB is used.
+	MaxBodySize int64
+
+	now func() time.Time // for testing
+
+	storeOnce    sync.Once
+	defaultStore Store
+
+	mu           sync.Mutex
+	revalidating map[string]bool // keys being revalidated in the background
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) store() Store {
+	if t.Store != nil {
+		return t.Store
+	}
+	t.storeOnce.Do(func() {
+		t.defaultStore = NewMemoryStore(defaultStoreSize)
+	})
+	return t.defaultStore
+}
+
+func (t *Transport) maxBodySize() int64 {
+	if t.MaxBodySize > 0 {
+		return t.MaxBodySize
+	}
+	return defaultMaxBodySize
+}
+
+func (t *Transport) timeNow() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// cacheKey returns the key of the stored response for u.
+func cacheKey(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	v.RawFragment = ""
+	return v.String()
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheableRequest(req) {
+		resp, err := t.transport().RoundTrip(req)
+		if err == nil && !safeMethod(req.Method) && resp.StatusCode < 400 {
+			t.invalidate(req, resp)
+		}
+		return resp, err
+	}
+	reqCC := requestCacheControl(req)
+	if reqCC.has("no-store") {
+		return t.transport().RoundTrip(req)
+	}
+	key := cacheKey(req.URL)
+	e := t.load(key, req)
+	now := t.timeNow()
+	if e != nil {
+		switch e.use(reqCC, now) {
+		case useFresh:
+			return e.response(req, now), nil
+		case useStaleWhileRevalidate:
+			// Build the response before the revalidation can update e.
+			resp := e.response(req, now)
+			t.revalidateInBackground(key, req, e)
+			return resp, nil
+		}
+	}
+	if reqCC.has("only-if-cached") {
+		return gatewayTimeout(req), nil
+	}
+	return t.fetch(key, req, reqCC, e)
+}
+
+// cacheableRequest reports whether req may be answered from the cache.
+func cacheableRequest(req *http.Request) bool {
+	if req.Method != "" && req.Method != "GET" {
+		return false
+	}
+	for _, f := range []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+		if _, ok := req.Header[f]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// load returns the stored response for key if it matches req,
+// or nil if there is none.
+func (t *Transport) load(key string, req *http.Request) *entry {
+	b, ok := t.store().Get(key)
+	if !ok {
+		return nil
+	}
+	e, err := unmarshalEntry(b)
+	if err != nil {
+		t.store().Delete(key)
+		return nil
+	}
+	if !e.matches(req) {
+		return nil
+	}
+	return e
+}
+
+// fetch sends req to the server, validating the stored response e
+// if it is not nil. It arranges for a storable response to be stored
+// once its body has been read.
+func (t *Transport) fetch(key string, req *http.Request, reqCC cacheControl, e *entry) (*http.Response, error) {
+	outreq := req
+	if e != nil {
+		if r := e.conditional(req); r != nil {
+			outreq = r
+		}
+	}
+	requestTime := t.timeNow()
+	resp, err := t.transport().RoundTrip(outreq)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := t.timeNow()
+	if outreq != req {
+		resp.Request = req
+		if resp.StatusCode == http.StatusNotModified {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+			e.update(resp, requestTime, responseTime)
+			t.store().Set(key, e.marshal())
+			return e.response(req, responseTime), nil
+		}
+	}
+	if !storable(reqCC, resp) || resp.ContentLength > t.maxBodySize() {
+		return resp, nil
+	}
+	stored := newEntry(req, resp, requestTime, responseTime)
+	resp.Body = &cachingBody{
+		rc:  resp.Body,
+		max: t.maxBodySize(),
+		done: func(body []byte) {
+			stored.body = body
+			t.store().Set(key, stored.marshal())
+		},
+	}
+	return resp, nil
+}
+
+// revalidateInBackground validates the stored response e for req,
+// unless it is already being validated.
+func (t *Transport) revalidateInBackground(key string, req *http.Request, e *entry) {
+	t.mu.Lock()
+	if t.revalidating[key] {
+		t.mu.Unlock()
+		return
+	}
+	if t.revalidating == nil {
+		t.revalidating = make(map[string]bool)
+	}
+	t.revalidating[key] = true
+	t.mu.Unlock()
+
+	r := req.Clone(context.WithoutCancel(req.Context()))
+	r.Body = nil
+	go func() {
+		defer func() {
+			t.mu.Lock()
+			delete(t.revalidating, key)
+			t.mu.Unlock()
+		}()
+		resp, err := t.fetch(key, r, requestCacheControl(r), e)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// invalidate removes the stored responses for the URL of req and the
+// URLs in the Location and Content-Location header fields of resp,
+// after a request with an unsafe method. See RFC 9111, Section 4.4.
+func (t *Transport) invalidate(req *http.Request, resp *http.Response) {
+	t.store().Delete(cacheKey(req.URL))
+	for _, f := range []string{"Location", "Content-Location"} {
+		v := resp.Header.Get(f)
+		if v == "" {
+			continue
+		}
+		u, err := req.URL.Parse(v)
+		if err != nil || u.Scheme != req.URL.Scheme || !ascii.EqualFold(u.Host, req.URL.Host) {
+			continue
+		}
+		t.store().Delete(cacheKey(u))
+	}
+}
+
+// gatewayTimeout returns the response to a request with the
+// only-if-cached directive that cannot be answered from the cache.
+// See RFC 9111, Section 5.2.1.7.
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 Gateway Timeout",
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// A cachingBody is the body of a storable response. It collects the
+// data read from the body, and passes it to done when it has all been
+// read, unless it is larger than max.
+type cachingBody struct {
+	rc      io.ReadCloser
+	buf     bytes.Buffer
+	max     int64
+	tooLong bool
+	done    func([]byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if !b.tooLong {
+		if int64(b.buf.Len()+n) > b.max {
+			b.tooLong = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.tooLong && b.done != nil {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	return b.rc.Close()
+}
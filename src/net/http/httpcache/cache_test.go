@@ -0,0 +1,543 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A cacheTest is a server, and a client whose Transport caches its
+// responses using a fake clock.
+type cacheTest struct {
+	t       *testing.T
+	ts      *httptest.Server
+	tr      *Transport
+	client  *http.Client
+	handler func(w http.ResponseWriter, r *http.Request)
+	hits    atomic.Int32
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newCacheTest(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *cacheTest {
+	ct := &cacheTest{
+		t:       t,
+		handler: handler,
+		now:     time.Now(),
+	}
+	ct.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct.hits.Add(1)
+		ct.handler(w, r)
+	}))
+	t.Cleanup(ct.ts.Close)
+	ct.tr = &Transport{
+		Transport: ct.ts.Client().Transport,
+		now:       ct.clock,
+	}
+	ct.client = &http.Client{Transport: ct.tr}
+	return ct
+}
+
+func (ct *cacheTest) clock() time.Time {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.now
+}
+
+func (ct *cacheTest) advance(d time.Duration) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.now = ct.now.Add(d)
+}
+
+// get sends a GET request for path with the given header fields,
+// given as name/value pairs, and returns the response with its body.
+func (ct *cacheTest) get(path string, header ...string) (*http.Response, string) {
+	ct.t.Helper()
+	return ct.do("GET", path, header...)
+}
+
+func (ct *cacheTest) do(method, path string, header ...string) (*http.Response, string) {
+	ct.t.Helper()
+	req, err := http.NewRequest(method, ct.ts.URL+path, nil)
+	if err != nil {
+		ct.t.Fatal(err)
+	}
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Add(header[i], header[i+1])
+	}
+	resp, err := ct.client.Do(req)
+	if err != nil {
+		ct.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ct.t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// key returns the key of the stored response for path.
+func (ct *cacheTest) key(path string) string {
+	u, err := url.Parse(ct.ts.URL + path)
+	if err != nil {
+		ct.t.Fatal(err)
+	}
+	return cacheKey(u)
+}
+
+// wantHits checks that the server has handled n requests in total.
+func (ct *cacheTest) wantHits(n int32) {
+	ct.t.Helper()
+	if got := ct.hits.Load(); got != n {
+		ct.t.Errorf("server handled %v requests, want %v", got, n)
+	}
+}
+
+// counter returns a handler that sets the given header fields,
+// and replies with the number of requests it has handled.
+func counter(header ...string) func(w http.ResponseWriter, r *http.Request) {
+	var n atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		fmt.Fprint(w, n.Add(1))
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	ct := newCacheTest(t, counter("Cache-Control", "max-age=60"))
+	if _, body := ct.get("/"); body != "1" {
+		t.Fatalf("first response %q, want %q", body, "1")
+	}
+	ct.advance(30 * time.Second)
+	resp, body := ct.get("/#fragment")
+	if body != "1" {
+		t.Fatalf("fresh response %q, want cached %q", body, "1")
+	}
+	if age := resp.Header.Get("Age"); age != "30" && age != "31" {
+		t.Errorf("cached response Age = %q, want 30", age)
+	}
+	ct.wantHits(1)
+	ct.advance(31 * time.Second)
+	if _, body := ct.get("/"); body != "2" {
+		t.Fatalf("stale response %q, want %q", body, "2")
+	}
+	ct.wantHits(2)
+	if resp, body := ct.get("/other"); body != "3" || resp.Header.Get("Age") != "" {
+		t.Fatalf("response for other URL = %q with Age %q, want %q", body, resp.Header.Get("Age"), "3")
+	}
+}
+
+func TestExpires(t *testing.T) {
+	ct := newCacheTest(t, nil)
+	ct.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Expires", ct.clock().Add(time.Hour).UTC().Format(http.TimeFormat))
+		fmt.Fprint(w, ct.hits.Load())
+	}
+	ct.get("/")
+	ct.advance(59 * time.Minute)
+	if _, body := ct.get("/"); body != "1" {
+		t.Fatalf("response before expiry %q, want cached %q", body, "1")
+	}
+	ct.advance(2 * time.Minute)
+	if _, body := ct.get("/"); body != "2" {
+		t.Fatalf("response after expiry %q, want %q", body, "2")
+	}
+}
+
+func TestNotStored(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		code   int
+		header []string
+	}{
+		{"no-store", 200, []string{"Cache-Control", "no-store, max-age=60"}},
+		{"vary-star", 200, []string{"Cache-Control", "max-age=60", "Vary", "*"}},
+		{"status without freshness", 500, nil},
+		{"status with validator", 201, []string{"ETag", `"x"`}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ct := newCacheTest(t, nil)
+			ct.handler = func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < len(test.header); i += 2 {
+					w.Header().Set(test.header[i], test.header[i+1])
+				}
+				w.WriteHeader(test.code)
+				fmt.Fprint(w, ct.hits.Load())
+			}
+			ct.get("/")
+			if _, body := ct.get("/"); body != "2" {
+				t.Errorf("second response %q, want %q", body, "2")
+			}
+		})
+	}
+}
+
+func TestStoredStatus(t *testing.T) {
+	ct := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "not found")
+	})
+	ct.get("/")
+	resp, body := ct.get("/")
+	if resp.StatusCode != http.StatusNotFound || body != "not found" {
+		t.Errorf("cached response = %v %q, want 404 %q", resp.Status, body, "not found")
+	}
+	ct.wantHits(1)
+}
+
+func TestRequestDirectives(t *testing.T) {
+	ct := newCacheTest(t, counter("Cache-Control", "max-age=60"))
+	ct.get("/")
+	ct.advance(30 * time.Second)
+	for _, test := range []struct {
+		header []string
+		cached bool
+	}{
+		{[]string{"Cache-Control", "max-age=40"}, true},
+		{[]string{"Cache-Control", "max-age=20"}, false},
+		{[]string{"Cache-Control", "min-fresh=20"}, true},
+		{[]string{"Cache-Control", "min-fresh=40"}, false},
+		{[]string{"Cache-Control", "no-cache"}, false},
+		{[]string{"Pragma", "no-cache"}, false},
+		{[]string{"Pragma", "no-cache", "Cache-Control", "max-age=40"}, true},
+		{[]string{"Cache-Control", "no-store"}, false},
+		{[]string{"Range", "bytes=0-0"}, false},
+		{[]string{"If-None-Match", `"x"`}, false},
+	} {
+		before := ct.hits.Load()
+		ct.get("/", test.header...)
+		if cached := ct.hits.Load() == before; cached != test.cached {
+			t.Errorf("request with %q: served from cache = %v, want %v", test.header, cached, test.cached)
+		}
+		// Reset the stored response to one that is 30s old.
+		ct.tr.store().Delete(ct.key("/"))
+		ct.advance(-30 * time.Second)
+		ct.get("/")
+		ct.advance(30 * time.Second)
+	}
+}
+
+func TestMaxStale(t *testing.T) {
+	for _, mustRevalidate := range []bool{false, true} {
+		cc := "max-age=60"
+		if mustRevalidate {
+			cc += ", must-revalidate"
+		}
+		ct := newCacheTest(t, counter("Cache-Control", cc))
+		ct.get("/")
+		ct.advance(90 * time.Second)
+		if _, body := ct.get("/", "Cache-Control", "max-stale=10"); body != "2" {
+			t.Errorf("%q: response with max-stale=10 = %q, want %q", cc, body, "2")
+		}
+		ct.advance(90 * time.Second)
+		want := "2"
+		if mustRevalidate {
+			want = "3"
+		}
+		if _, body := ct.get("/", "Cache-Control", "max-stale"); body != want {
+			t.Errorf("%q: response with max-stale = %q, want %q", cc, body, want)
+		}
+	}
+}
+
+func TestOnlyIfCached(t *testing.T) {
+	ct := newCacheTest(t, counter("Cache-Control", "max-age=60"))
+	resp, _ := ct.get("/", "Cache-Control", "only-if-cached")
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("uncached only-if-cached response status = %v, want 504", resp.Status)
+	}
+	ct.wantHits(0)
+	ct.get("/")
+	if _, body := ct.get("/", "Cache-Control", "only-if-cached"); body != "1" {
+		t.Errorf("cached only-if-cached response = %q, want %q", body, "1")
+	}
+	ct.wantHits(1)
+}
+
+func TestETagRevalidation(t *testing.T) {
+	version := 1
+	ct := newCacheTest(t, nil)
+	ct.handler = func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Hit", fmt.Sprint(ct.hits.Load()))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "version %d", version)
+	}
+	ct.get("/")
+	resp, body := ct.get("/")
+	if resp.StatusCode != http.StatusOK || body != "version 1" {
+		t.Fatalf("revalidated response = %v %q, want 200 %q", resp.Status, body, "version 1")
+	}
+	if got := resp.Header.Get("X-Hit"); got != "2" {
+		t.Errorf("revalidated response X-Hit = %q, want header updated by 304 to %q", got, "2")
+	}
+	ct.wantHits(2)
+	version = 2
+	if _, body := ct.get("/"); body != "version 2" {
+		t.Fatalf("response after change = %q, want %q", body, "version 2")
+	}
+	if _, body := ct.get("/"); body != "version 2" {
+		t.Fatalf("revalidated response after change = %q, want %q", body, "version 2")
+	}
+	ct.wantHits(4)
+}
+
+func TestLastModified(t *testing.T) {
+	ct := newCacheTest(t, nil)
+	modified := ct.clock().Add(-100 * time.Minute)
+	ct.handler = func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", modified, strings.NewReader("content"))
+	}
+	ct.get("/")
+	// The heuristic freshness lifetime is a tenth of the time since
+	// the response was last modified.
+	ct.advance(9 * time.Minute)
+	ct.get("/")
+	ct.wantHits(1)
+	ct.advance(2 * time.Minute)
+	if resp, body := ct.get("/"); resp.StatusCode != http.StatusOK || body != "content" {
+		t.Fatalf("revalidated response = %v %q", resp.Status, body)
+	}
+	ct.wantHits(2)
+}
+
+func TestVary(t *testing.T) {
+	ct := newCacheTest(t, nil)
+	ct.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "%v %v", r.Header.Get("Accept-Language"), ct.hits.Load())
+	}
+	if _, body := ct.get("/", "Accept-Language", "en"); body != "en 1" {
+		t.Fatalf("response = %q", body)
+	}
+	if _, body := ct.get("/", "Accept-Language", " en"); body != "en 1" {
+		t.Errorf("response for matching request = %q, want cached %q", body, "en 1")
+	}
+	if _, body := ct.get("/", "Accept-Language", "fr"); body != "fr 2" {
+		t.Errorf("response for mismatched request = %q, want %q", body, "fr 2")
+	}
+	if _, body := ct.get("/"); body != " 3" {
+		t.Errorf("response for request without field = %q, want %q", body, " 3")
+	}
+	if _, body := ct.get("/"); body != " 3" {
+		t.Errorf("response for request without field = %q, want cached %q", body, " 3")
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	ct := newCacheTest(t, counter("Cache-Control", "max-age=60, stale-while-revalidate=30"))
+	ct.get("/")
+	ct.advance(70 * time.Second)
+	if _, body := ct.get("/"); body != "1" {
+		t.Fatalf("response within stale-while-revalidate = %q, want stale %q", body, "1")
+	}
+	// Wait for the background revalidation to store the new response.
+	for i := 0; ; i++ {
+		if b, ok := ct.tr.store().Get(ct.key("/")); ok {
+			if e, err := unmarshalEntry(b); err == nil && string(e.body) == "2" {
+				break
+			}
+		}
+		if i == 1000 {
+			t.Fatal("stale response was not revalidated")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, body := ct.get("/"); body != "2" {
+		t.Fatalf("response after revalidation = %q, want %q", body, "2")
+	}
+	ct.wantHits(2)
+	ct.advance(100 * time.Second)
+	if _, body := ct.get("/"); body != "3" {
+		t.Fatalf("response after stale-while-revalidate = %q, want %q", body, "3")
+	}
+}
+
+func TestStaleWhileRevalidateNotModified(t *testing.T) {
+	// The stale response is served while a revalidation that gets 304
+	// Not Modified updates the stored response, which must not race.
+	date := time.Now().Add(-10 * time.Second).UTC().Format(http.TimeFormat)
+	ct := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=1000")
+		w.Header().Set("Date", date)
+		w.Header().Set("Etag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "body")
+	})
+	ct.get("/")
+	for i := 0; i < 3; i++ {
+		if _, body := ct.get("/"); body != "body" {
+			t.Fatalf("response %d = %q, want %q", i, body, "body")
+		}
+		// Wait for the background revalidation to finish.
+		for j := 0; ; j++ {
+			ct.tr.mu.Lock()
+			done := len(ct.tr.revalidating) == 0
+			ct.tr.mu.Unlock()
+			if done {
+				break
+			}
+			if j == 1000 {
+				t.Fatal("stale response was not revalidated")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	ct.wantHits(4)
+}
+
+func TestInvalidation(t *testing.T) {
+	ct := newCacheTest(t, nil)
+	ct.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/other")
+			w.WriteHeader(http.StatusCreated)
+		}
+		fmt.Fprint(w, ct.hits.Load())
+	}
+	ct.get("/")
+	ct.get("/other")
+	ct.do("HEAD", "/")
+	if _, body := ct.get("/"); body != "1" {
+		t.Fatalf("response after HEAD = %q, want cached %q", body, "1")
+	}
+	ct.do("POST", "/")
+	if _, body := ct.get("/"); body != "5" {
+		t.Errorf("response after POST = %q, want %q", body, "5")
+	}
+	if _, body := ct.get("/other"); body != "6" {
+		t.Errorf("response for Location after POST = %q, want %q", body, "6")
+	}
+}
+
+func TestPartialRead(t *testing.T) {
+	ct := newCacheTest(t, counter("Cache-Control", "max-age=60"))
+	resp, err := ct.client.Get(ct.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, body := ct.get("/"); body != "2" {
+		t.Errorf("response after unread response = %q, want %q", body, "2")
+	}
+	if _, body := ct.get("/"); body != "2" {
+		t.Errorf("response after read response = %q, want cached %q", body, "2")
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	for _, chunked := range []bool{false, true} {
+		ct := newCacheTest(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			if chunked {
+				w.(http.Flusher).Flush()
+			}
+			io.WriteString(w, body)
+		})
+		ct.tr.MaxBodySize = 99
+		ct.get("/")
+		ct.get("/")
+		ct.wantHits(2)
+		ct.tr.MaxBodySize = 100
+		ct.get("/")
+		ct.get("/")
+		ct.wantHits(3)
+	}
+}
+
+func TestEntryRoundTrip(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	req.Header.Set("Accept-Language", "de")
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Vary":          {"Accept, accept-encoding", "Accept-Language"},
+			"Cache-Control": {"max-age=60"},
+		},
+	}
+	reqTime := time.Unix(1e9, 123)
+	e := newEntry(req, resp, reqTime, reqTime.Add(time.Second))
+	e.body = []byte("body")
+	got, err := unmarshalEntry(e.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.requestTime.Equal(e.requestTime) || !got.responseTime.Equal(e.responseTime) {
+		t.Errorf("times = %v, %v; want %v, %v", got.requestTime, got.responseTime, e.requestTime, e.responseTime)
+	}
+	if string(got.body) != "body" || got.resp.StatusCode != 200 || got.resp.Header.Get("Cache-Control") != "max-age=60" {
+		t.Errorf("response = %v %v %q", got.resp.Status, got.resp.Header, got.body)
+	}
+	if !got.matches(req) {
+		t.Errorf("entry does not match its request")
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	if got.matches(req) {
+		t.Errorf("entry matches a request with a different varied field")
+	}
+	if _, err := unmarshalEntry([]byte("garbage")); err == nil {
+		t.Errorf("unmarshalEntry of garbage succeeded")
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	h := http.Header{"Cache-Control": {`Max-Age=10, no-cache="Set-Cookie, Foo", private`, "max-age=20, max-stale"}}
+	cc := parseCacheControl(h)
+	want := cacheControl{
+		"max-age":   "10",
+		"no-cache":  "Set-Cookie, Foo",
+		"private":   "",
+		"max-stale": "",
+	}
+	if fmt.Sprint(cc) != fmt.Sprint(want) {
+		t.Errorf("parseCacheControl(%q) = %v, want %v", h["Cache-Control"], cc, want)
+	}
+	for _, test := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"0", 0},
+		{"60", time.Minute},
+		{"-1", 0},
+		{"1.5", 0},
+		{"", 0},
+		{"99999999999999999999999", 1 << 31 * time.Second},
+	} {
+		if got := parseDeltaSeconds(test.in); got != test.want {
+			t.Errorf("parseDeltaSeconds(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"math"
+	"net/http"
+	"net/http/internal/ascii"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the directives of Cache-Control header fields,
+// keyed by their lower-case names. Directives without an argument
+// have an empty value. See RFC 9111, Section 5.2.
+type cacheControl map[string]string
+
+// parseCacheControl parses the Cache-Control header fields in h.
+// If a directive appears more than once, the first is used.
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range splitDirectives(v) {
+			name, arg, _ := strings.Cut(d, "=")
+			name, ok := ascii.ToLower(textproto.TrimString(name))
+			if !ok || name == "" {
+				continue
+			}
+			arg = textproto.TrimString(arg)
+			if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+				arg = arg[1 : len(arg)-1]
+			}
+			if _, ok := cc[name]; !ok {
+				cc[name] = arg
+			}
+		}
+	}
+	return cc
+}
+
+// splitDirectives splits a Cache-Control field value into directives,
+// ignoring commas inside quoted strings.
+func splitDirectives(v string) []string {
+	var ds []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case ',':
+			if !quoted {
+				ds = append(ds, v[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(ds, v[start:])
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// duration returns the delta-seconds argument of the named directive,
+// and reports whether the directive is present. An invalid argument
+// is treated as zero.
+func (cc cacheControl) duration(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	return parseDeltaSeconds(arg), true
+}
+
+// parseDeltaSeconds parses a number of seconds, such as the argument of
+// a max-age directive or the value of an Age header field.
+// Invalid values are treated as zero, and values too large to represent
+// are treated as 2^31 seconds. See RFC 9111, Section 1.2.2.
+func parseDeltaSeconds(s string) time.Duration {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			n = math.MaxUint64
+		} else {
+			return 0
+		}
+	}
+	if n > 1<<31 {
+		n = 1 << 31
+	}
+	return time.Duration(n) * time.Second
+}
+
+// requestCacheControl returns the cache directives of a request.
+// An HTTP/1.0 Pragma: no-cache header field is honored if the request
+// has no Cache-Control header field. See RFC 9111, Section 5.4.
+func requestCacheControl(req *http.Request) cacheControl {
+	cc := parseCacheControl(req.Header)
+	if _, ok := req.Header["Cache-Control"]; !ok {
+		for _, v := range req.Header.Values("Pragma") {
+			if ascii.EqualFold(textproto.TrimString(v), "no-cache") {
+				cc["no-cache"] = ""
+			}
+		}
+	}
+	return cc
+}
+
+// heuristicallyCacheable reports whether a response with the given
+// status code may be cached without explicit freshness information.
+// Partial content is omitted, since the cache does not store it.
+// See RFC 9110, Section 15.1.
+func heuristicallyCacheable(code int) bool {
+	switch code {
+	case http.StatusOK,
+		http.StatusNonAuthoritativeInfo,
+		http.StatusNoContent,
+		http.StatusMultipleChoices,
+		http.StatusMovedPermanently,
+		http.StatusPermanentRedirect,
+		http.StatusNotFound,
+		http.StatusMethodNotAllowed,
+		http.StatusGone,
+		http.StatusRequestURITooLong,
+		http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// storable reports whether resp, the response to a request with the
+// directives reqCC, may be stored. See RFC 9111, Section 3.
+func storable(reqCC cacheControl, resp *http.Response) bool {
+	if reqCC.has("no-store") {
+		return false
+	}
+	code := resp.StatusCode
+	if code < 200 || code == http.StatusPartialContent || code == http.StatusNotModified {
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") {
+		return false
+	}
+	for _, f := range varyFields(resp.Header) {
+		if f == "*" {
+			return false
+		}
+	}
+	_, hasExpires := resp.Header["Expires"]
+	return cc.has("max-age") || hasExpires || cc.has("public") || heuristicallyCacheable(code)
+}
+
+// varyFields returns the canonical names of the request header fields
+// listed in the Vary header fields of h.
+func varyFields(h http.Header) []string {
+	var fields []string
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = textproto.TrimString(f); f != "" {
+				fields = append(fields, textproto.CanonicalMIMEHeaderKey(f))
+			}
+		}
+	}
+	return fields
+}
+
+// varyValue returns the normalized value of the request header field
+// name in h, for comparison with a stored request.
+func varyValue(h http.Header, name string) string {
+	var vs []string
+	for _, v := range h.Values(name) {
+		vs = append(vs, textproto.TrimString(v))
+	}
+	return strings.Join(vs, ", ")
+}
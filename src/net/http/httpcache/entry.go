@@ -0,0 +1,271 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An entry is a stored response.
+type entry struct {
+	requestTime  time.Time // when the request that produced resp was sent
+	responseTime time.Time // when resp was received
+	varied       http.Header
+	resp         *http.Response // Body is unused
+	body         []byte
+}
+
+// newEntry returns an entry for resp, received in response to req.
+// The caller sets the entry's body.
+func newEntry(req *http.Request, resp *http.Response, requestTime, responseTime time.Time) *entry {
+	e := &entry{
+		requestTime:  requestTime,
+		responseTime: responseTime,
+		varied:       http.Header{},
+	}
+	for _, f := range varyFields(resp.Header) {
+		if v := varyValue(req.Header, f); v != "" {
+			e.varied[f] = []string{v}
+		}
+	}
+	r := *resp
+	r.Header = resp.Header.Clone()
+	r.Body = nil
+	r.Request = nil
+	r.TLS = nil
+	e.resp = &r
+	return e
+}
+
+// entryVersion begins each encoded entry.
+const entryVersion = "httpcache/1"
+
+// marshal returns the encoding of e: a line holding the version and
+// times, a header block holding the varied request header fields,
+// and the response in HTTP/1.1 wire format.
+func (e *entry) marshal() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %d %d\r\n", entryVersion, e.requestTime.UnixNano(), e.responseTime.UnixNano())
+	e.varied.Write(&b)
+	b.WriteString("\r\n")
+	r := *e.resp
+	r.Body = io.NopCloser(bytes.NewReader(e.body))
+	r.ContentLength = int64(len(e.body))
+	r.TransferEncoding = nil
+	r.Close = false
+	r.Write(&b)
+	return b.Bytes()
+}
+
+var errBadEntry = errors.New("httpcache: malformed cache entry")
+
+// unmarshalEntry decodes an entry encoded by marshal.
+func unmarshalEntry(b []byte) (*entry, error) {
+	br := bufio.NewReader(bytes.NewReader(b))
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, errBadEntry
+	}
+	f := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if len(f) != 3 || f[0] != entryVersion {
+		return nil, errBadEntry
+	}
+	reqTime, err1 := strconv.ParseInt(f[1], 10, 64)
+	respTime, err2 := strconv.ParseInt(f[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errBadEntry
+	}
+	varied, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, errBadEntry
+	}
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return nil, errBadEntry
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errBadEntry
+	}
+	resp.Body = nil
+	return &entry{
+		requestTime:  time.Unix(0, reqTime),
+		responseTime: time.Unix(0, respTime),
+		varied:       http.Header(varied),
+		resp:         resp,
+		body:         body,
+	}, nil
+}
+
+// matches reports whether the request header fields named by the stored
+// response's Vary header fields match those of req.
+// See RFC 9111, Section 4.1.
+func (e *entry) matches(req *http.Request) bool {
+	for _, f := range varyFields(e.resp.Header) {
+		if f == "*" || varyValue(req.Header, f) != e.varied.Get(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// date returns the value of the stored response's Date header field,
+// or the time it was received if it has none.
+func (e *entry) date() time.Time {
+	if t, err := http.ParseTime(e.resp.Header.Get("Date")); err == nil {
+		return t
+	}
+	return e.responseTime
+}
+
+// age returns the current age of the stored response.
+// See RFC 9111, Section 4.2.3.
+func (e *entry) age(now time.Time) time.Duration {
+	apparentAge := e.responseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	responseDelay := e.responseTime.Sub(e.requestTime)
+	correctedAge := parseDeltaSeconds(e.resp.Header.Get("Age")) + responseDelay
+	initialAge := apparentAge
+	if correctedAge > initialAge {
+		initialAge = correctedAge
+	}
+	return initialAge + now.Sub(e.responseTime)
+}
+
+// freshnessLifetime returns the length of time for which the stored
+// response is fresh. See RFC 9111, Section 4.2.1.
+func (e *entry) freshnessLifetime(cc cacheControl) time.Duration {
+	if d, ok := cc.duration("max-age"); ok {
+		return d
+	}
+	if v, ok := e.resp.Header["Expires"]; ok {
+		exp, err := http.ParseTime(v[0])
+		if err != nil {
+			// An invalid date means the response has already expired.
+			return 0
+		}
+		return exp.Sub(e.date())
+	}
+	// Without explicit freshness information, use a tenth of the
+	// time since the response was last modified, as suggested by
+	// RFC 9111, Section 4.2.2.
+	if !heuristicallyCacheable(e.resp.StatusCode) {
+		return 0
+	}
+	lm, err := http.ParseTime(e.resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return 0
+	}
+	if d := e.date().Sub(lm); d > 0 {
+		return d / 10
+	}
+	return 0
+}
+
+// A use is how a stored response may satisfy a request.
+type use int
+
+const (
+	useValidate             use = iota // send the request, validating the response if possible
+	useFresh                           // send the stored response
+	useStaleWhileRevalidate            // send the stored response, and validate it in the background
+)
+
+// use reports how e may satisfy a request with the directives reqCC
+// at time now. See RFC 9111, Section 4.
+func (e *entry) use(reqCC cacheControl, now time.Time) use {
+	cc := parseCacheControl(e.resp.Header)
+	if cc.has("no-cache") || reqCC.has("no-cache") {
+		return useValidate
+	}
+	age := e.age(now)
+	lifetime := e.freshnessLifetime(cc)
+	if maxAge, ok := reqCC.duration("max-age"); ok && age > maxAge {
+		return useValidate
+	}
+	if minFresh, ok := reqCC.duration("min-fresh"); ok && lifetime-age < minFresh {
+		return useValidate
+	}
+	if lifetime > age {
+		return useFresh
+	}
+	if cc.has("must-revalidate") {
+		return useValidate
+	}
+	staleness := age - lifetime
+	if arg, ok := reqCC["max-stale"]; ok && (arg == "" || staleness <= parseDeltaSeconds(arg)) {
+		return useFresh
+	}
+	if swr, ok := cc.duration("stale-while-revalidate"); ok && staleness <= swr {
+		return useStaleWhileRevalidate
+	}
+	return useValidate
+}
+
+// conditional returns a copy of req that asks the server to respond
+// with 304 Not Modified if e is still valid, or nil if e has no
+// validators. See RFC 9111, Section 4.3.1.
+func (e *entry) conditional(req *http.Request) *http.Request {
+	etag := e.resp.Header.Get("Etag")
+	lastModified := e.resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	r := req.Clone(req.Context())
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+	return r
+}
+
+// unupdatedFields are the header fields of a stored response that are
+// not updated by a 304 Not Modified response. See RFC 9111, Section 3.2.
+var unupdatedFields = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Content-Range":     true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+}
+
+// update updates e with the header fields of a 304 Not Modified
+// response received at responseTime to a request sent at requestTime.
+func (e *entry) update(resp *http.Response, requestTime, responseTime time.Time) {
+	for k, vv := range resp.Header {
+		if !unupdatedFields[k] {
+			e.resp.Header[k] = append([]string(nil), vv...)
+		}
+	}
+	e.requestTime = requestTime
+	e.responseTime = responseTime
+}
+
+// response returns the stored response, as a response to req at time now.
+func (e *entry) response(req *http.Request, now time.Time) *http.Response {
+	resp := *e.resp
+	resp.Header = e.resp.Header.Clone()
+	resp.Header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	resp.Body = io.NopCloser(bytes.NewReader(e.body))
+	resp.ContentLength = int64(len(e.body))
+	resp.TransferEncoding = nil
+	resp.Close = false
+	resp.Request = req
+	return &resp
+}
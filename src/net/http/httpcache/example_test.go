@@ -0,0 +1,48 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httpcache"
+	"net/http/httptest"
+)
+
+func Example() {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		fmt.Fprintf(w, "hello")
+	}))
+	defer ts.Close()
+
+	client := &http.Client{
+		Transport: &httpcache.Transport{
+			Store: httpcache.NewMemoryStore(1 << 20),
+		},
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", body)
+	}
+	fmt.Println("requests to the server:", requests)
+	// Output:
+	// hello
+	// hello
+	// hello
+	// requests to the server: 1
+}
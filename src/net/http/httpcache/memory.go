@@ -0,0 +1,89 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A MemoryStore is a Store that holds entries in memory. When the total
+// size of its entries exceeds its limit, it discards the least recently
+// used entries.
+type MemoryStore struct {
+	maxSize int64
+
+	// mu locks the remaining fields.
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryStore returns a new MemoryStore holding at most maxSize bytes
+// of entries. If maxSize is zero or negative, the size is not limited.
+func NewMemoryStore(maxSize int64) *MemoryStore {
+	return &MemoryStore{
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryEntry).value, true
+}
+
+// Set implements Store. An entry larger than the store's limit is not stored.
+func (s *MemoryStore) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(key)
+	if s.maxSize > 0 && int64(len(value)) > s.maxSize {
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key, value})
+	s.size += int64(len(value))
+	for s.maxSize > 0 && s.size > s.maxSize {
+		s.delete(s.lru.Back().Value.(*memoryEntry).key)
+	}
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(key)
+}
+
+func (s *MemoryStore) delete(key string) {
+	el, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	s.lru.Remove(el)
+	delete(s.entries, key)
+	s.size -= int64(len(el.Value.(*memoryEntry).value))
+}
+
+// Size returns the total size in bytes of the entries in s.
+func (s *MemoryStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(10)
+	s.Set("a", []byte("aaa"))
+	s.Set("b", []byte("bbb"))
+	s.Set("c", []byte("ccc"))
+	if v, ok := s.Get("a"); !ok || string(v) != "aaa" {
+		t.Fatalf(`Get("a") = %q, %v`, v, ok)
+	}
+	// "b" is now the least recently used entry.
+	s.Set("d", []byte("ddd"))
+	if _, ok := s.Get("b"); ok {
+		t.Errorf(`Get("b") found an entry that should have been evicted`)
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok := s.Get(k); !ok {
+			t.Errorf("Get(%q) found no entry", k)
+		}
+	}
+	if got := s.Size(); got != 9 {
+		t.Errorf("Size() = %v, want 9", got)
+	}
+	s.Set("a", []byte("a"))
+	if got := s.Size(); got != 7 {
+		t.Errorf("Size() after replacing entry = %v, want 7", got)
+	}
+	s.Delete("c")
+	s.Delete("missing")
+	if got := s.Size(); got != 4 {
+		t.Errorf("Size() after Delete = %v, want 4", got)
+	}
+	s.Set("big", []byte(strings.Repeat("x", 11)))
+	if _, ok := s.Get("big"); ok {
+		t.Errorf("stored an entry larger than the limit")
+	}
+	if got := s.Size(); got != 4 {
+		t.Errorf("Size() after oversized Set = %v, want 4", got)
+	}
+}
+
+func TestMemoryStoreUnlimited(t *testing.T) {
+	s := NewMemoryStore(0)
+	for i := 0; i < 100; i++ {
+		s.Set(strings.Repeat("k", i), make([]byte, 1000))
+	}
+	if got := s.Size(); got != 100*1000 {
+		t.Errorf("Size() = %v, want %v", got, 100*1000)
+	}
+}
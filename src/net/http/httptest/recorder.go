@@ -20,6 +20,8 @@ import (
 // records its mutations for later inspection in tests.
 type ResponseRecorder struct {
 	// Code is the HTTP response code set by WriteHeader.
+	// Informational (1xx) responses other than 101 (Switching
+	// Protocols) are not final and do not set Code.
 	//
 	// Note that if a Handler never calls WriteHeader or Write,
 	// this might end up being 0, rather than the implicit
@@ -146,6 +148,9 @@ func (rw *ResponseRecorder) WriteHeader(code int) {
 	}
 
 	checkWriteHeaderCode(code)
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		return
+	}
 	rw.Code = code
 	rw.wroteHeader = true
 	if rw.HeaderMap == nil {
@@ -294,6 +294,32 @@ func TestRecorder(t *testing.T) {
 			check(hasResultContents("")), // check we don't crash reading the body
 
 		},
+		{
+			"informational response before final",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, "hi")
+			},
+			check(hasStatus(201), hasResultStatusCode(201), hasContents("hi"), hasHeader("Link", "</style.css>; rel=preload; as=style")),
+		},
+		{
+			"informational response without final",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				io.WriteString(w, "hi")
+			},
+			check(hasStatus(200), hasResultStatusCode(200), hasContents("hi")),
+		},
+		{
+			"switching protocols",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusSwitchingProtocols)
+			},
+			check(hasStatus(101), hasResultStatusCode(101)),
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			r, _ := http.NewRequest("GET", "http://foo.com/", nil)
@@ -0,0 +1,364 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// recordFlag lets
+//
+//	go test -httptest.record
+//
+// make every ReplayTransport record, to update golden files after the
+// services a test talks to have changed.
+var recordFlag bool
+
+func init() {
+	if strSliceContainsPrefix(os.Args, "-httptest.record") || strSliceContainsPrefix(os.Args, "--httptest.record") {
+		flag.BoolVar(&recordFlag, "httptest.record", false, "if true, ReplayTransports record exchanges to their golden files instead of replaying them.")
+	}
+}
+
+// A ReplayTransport is an http.RoundTripper that records HTTP exchanges
+// to a golden file and replays them in later runs, so that tests which
+// talk to real services can run quickly and deterministically.
+//
+// When recording, requests are sent with Transport and each request
+// and its response are written to File, in their HTTP/1.x wire form,
+// when Close is called. When replaying, which is the default, each
+// request is answered with the response of the first recorded exchange
+// not yet replayed whose request matches it, and no network traffic
+// happens.
+//
+// A typical test keeps its golden file in testdata and records it once
+// by running go test -httptest.record:
+//
+//	rt := &httptest.ReplayTransport{File: "testdata/api.txt"}
+//	defer rt.Close()
+//	client := &http.Client{Transport: rt}
+//
+// A ReplayTransport is safe for concurrent use, but exchanges recorded
+// concurrently are replayed in the order they completed.
+type ReplayTransport struct {
+	// File is the name of the golden file.
+	File string
+
+	// Record, if true, makes the ReplayTransport record exchanges
+	// instead of replaying them, replacing the contents of File.
+	// The -httptest.record test flag has the same effect.
+	Record bool
+
+	// Transport sends requests while recording.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// Match reports whether an incoming request matches a recorded
+	// one while replaying. The bodies of both requests may be read.
+	// If nil, MatchAll(MatchMethod, MatchURL, MatchBody) is used.
+	Match Matcher
+
+	// Redact, if non-nil, is called with copies of each request and
+	// response before they are written to File, and may remove
+	// secrets from their headers, URLs or bodies, for example by
+	// deleting the Authorization header. While replaying, it is
+	// also called with a copy of each incoming request and a nil
+	// response before matching, so that redacted requests still
+	// match.
+	Redact func(*http.Request, *http.Response)
+
+	mu        sync.Mutex
+	loaded    bool
+	loadErr   error
+	exchanges []*exchange
+	recorded  bytes.Buffer
+}
+
+// A Matcher reports whether req matches the recorded request.
+type Matcher func(req, recorded *http.Request) bool
+
+// MatchMethod reports whether req and recorded have the same method.
+func MatchMethod(req, recorded *http.Request) bool {
+	return valueOrDefault(req.Method, "GET") == valueOrDefault(recorded.Method, "GET")
+}
+
+// MatchURL reports whether req and recorded have the same URL.
+func MatchURL(req, recorded *http.Request) bool {
+	return req.URL.String() == recorded.URL.String()
+}
+
+// MatchBody reports whether req and recorded have the same body.
+func MatchBody(req, recorded *http.Request) bool {
+	b1, err1 := readBody(req.Body)
+	b2, err2 := readBody(recorded.Body)
+	return err1 == nil && err2 == nil && bytes.Equal(b1, b2)
+}
+
+// MatchAll returns a Matcher that reports whether all of matchers match.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(req, recorded *http.Request) bool {
+		for _, m := range matchers {
+			if !m(req, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+var defaultMatch = MatchAll(MatchMethod, MatchURL, MatchBody)
+
+// An exchange is a request and response read from a golden file.
+type exchange struct {
+	req      *http.Request
+	reqBody  []byte
+	res      *http.Response
+	resBody  []byte
+	replayed bool
+}
+
+func (t *ReplayTransport) recording() bool {
+	return t.Record || recordFlag
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if t.recording() {
+		return t.record(req, body)
+	}
+	return t.replay(req, body)
+}
+
+func (t *ReplayTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	rt := t.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	out := req.Clone(req.Context())
+	out.Body, out.GetBody = newBody(body), func() (io.ReadCloser, error) {
+		return newBody(body), nil
+	}
+	if len(body) == 0 {
+		out.Body, out.GetBody = nil, nil
+	}
+	res, err := rt.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = newBody(resBody)
+
+	// Write redacted copies, leaving the caller's values alone.
+	reqCopy := req.Clone(req.Context())
+	reqCopy.Body = newBody(body)
+	resCopy := new(http.Response)
+	*resCopy = *res
+	resCopy.Header = res.Header.Clone()
+	resCopy.Trailer = nil
+	resCopy.Body = newBody(resBody)
+	if t.Redact != nil {
+		t.Redact(reqCopy, resCopy)
+	}
+	dump, err := dumpExchange(reqCopy, resCopy)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.recorded.Write(dump)
+	t.mu.Unlock()
+	return res, nil
+}
+
+// dumpExchange returns req and res in the format read by readExchanges.
+// It modifies both.
+func dumpExchange(req *http.Request, res *http.Response) ([]byte, error) {
+	body, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// This is what httputil.DumpRequestOut and DumpResponse do, but
+	// httputil's tests import this package. The request is written in
+	// proxy form so that its absolute URL, including the scheme, is
+	// kept, and both bodies are written with an explicit length so
+	// that the messages can be read back.
+	var b bytes.Buffer
+	req.TransferEncoding = nil
+	req.ContentLength = int64(len(body))
+	req.Body = nil
+	if len(body) > 0 {
+		req.Body = newBody(body)
+	}
+	if err := req.WriteProxy(&b); err != nil {
+		return nil, err
+	}
+	// Follow each message with a blank line, for readability.
+	b.WriteString("\r\n")
+
+	if req.Method != "HEAD" {
+		res.ContentLength = int64(len(resBody))
+	}
+	res.TransferEncoding = nil
+	res.Request = req
+	res.Body = newBody(resBody)
+	if err := res.Write(&b); err != nil {
+		return nil, err
+	}
+	b.WriteString("\r\n")
+	return b.Bytes(), nil
+}
+
+func (t *ReplayTransport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	in := req.Clone(req.Context())
+	if t.Redact != nil {
+		in.Body = newBody(body)
+		t.Redact(in, nil)
+		var err error
+		if body, err = readBody(in.Body); err != nil {
+			return nil, err
+		}
+	}
+	match := t.Match
+	if match == nil {
+		match = defaultMatch
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	for _, ex := range t.exchanges {
+		if ex.replayed {
+			continue
+		}
+		in.Body = newBody(body)
+		ex.req.Body = newBody(ex.reqBody)
+		if !match(in, ex.req) {
+			continue
+		}
+		ex.replayed = true
+		res := new(http.Response)
+		*res = *ex.res
+		res.Header = ex.res.Header.Clone()
+		res.Body = newBody(ex.resBody)
+		res.Request = req
+		return res, nil
+	}
+	return nil, fmt.Errorf("httptest: no recorded response in %s for %s %s", t.File, valueOrDefault(req.Method, "GET"), req.URL)
+}
+
+// load reads the exchanges in t.File, if it has not been read yet.
+// t.mu must be held.
+func (t *ReplayTransport) load() error {
+	if !t.loaded {
+		t.loaded = true
+		data, err := os.ReadFile(t.File)
+		if err == nil {
+			t.exchanges, err = readExchanges(data)
+		}
+		if err != nil {
+			t.loadErr = fmt.Errorf("httptest: reading golden file: %w", err)
+		}
+	}
+	return t.loadErr
+}
+
+// readExchanges parses the exchanges written by dumpExchange.
+func readExchanges(data []byte) ([]*exchange, error) {
+	var exchanges []*exchange
+	br := bufio.NewReader(bytes.NewReader(data))
+	for skipBlankLines(br) {
+		ex := new(exchange)
+		var err error
+		if ex.req, err = http.ReadRequest(br); err != nil {
+			return nil, err
+		}
+		if ex.reqBody, err = readBody(ex.req.Body); err != nil {
+			return nil, err
+		}
+		skipBlankLines(br)
+		if ex.res, err = http.ReadResponse(br, ex.req); err != nil {
+			return nil, err
+		}
+		if ex.resBody, err = readBody(ex.res.Body); err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, nil
+}
+
+// skipBlankLines skips the blank lines that follow each message.
+// It reports whether any data remains.
+func skipBlankLines(br *bufio.Reader) bool {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return false
+		}
+		if c != '\r' && c != '\n' {
+			br.UnreadByte()
+			return true
+		}
+	}
+}
+
+// Close writes the recorded exchanges to File when recording,
+// creating its directory if needed. It does nothing when replaying.
+func (t *ReplayTransport) Close() error {
+	if !t.recording() {
+		return nil
+	}
+	if t.File == "" {
+		return errors.New("httptest: ReplayTransport.File is empty")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(t.File), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(t.File, t.recorded.Bytes(), 0666)
+}
+
+// readBody reads and closes b, which may be nil.
+func readBody(b io.ReadCloser) ([]byte, error) {
+	if b == nil || b == http.NoBody {
+		return nil, nil
+	}
+	defer b.Close()
+	return io.ReadAll(b)
+}
+
+func newBody(b []byte) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(b))
+}
+
+func valueOrDefault(value, def string) string {
+	if value != "" {
+		return value
+	}
+	return def
+}
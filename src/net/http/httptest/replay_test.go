@@ -0,0 +1,180 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func doReplay(t *testing.T, c *http.Client, method, url, body string) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func resBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestReplayTransport(t *testing.T) {
+	calls := 0
+	ts := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Call", strings.Repeat("x", calls))
+		switch {
+		case r.Method == "HEAD":
+			w.Header().Set("Content-Length", "10")
+		case r.URL.Path == "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			// A flushed response is sent chunked.
+			io.WriteString(w, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+			w.(http.Flusher).Flush()
+			io.WriteString(w, "\n")
+		}
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "testdata", "golden.txt")
+	redact := func(req *http.Request, res *http.Response) {
+		req.Header.Del("Authorization")
+	}
+	requests := []struct {
+		method, path, body string
+		wantCode           int
+		wantBody, wantCall string
+	}{
+		{"GET", "/a?x=1", "", 200, "GET /a?x=1 \n", "x"},
+		{"POST", "/b", "one", 200, "POST /b one\n", "xx"},
+		{"POST", "/b", "two", 200, "POST /b two\n", "xxx"},
+		{"GET", "/a?x=1", "", 200, "GET /a?x=1 \n", "xxxx"},
+		{"HEAD", "/c", "", 200, "", "xxxxx"},
+		{"GET", "/empty", "", 204, "", "xxxxxx"},
+	}
+
+	rec := &ReplayTransport{File: file, Record: true, Redact: redact}
+	c := &http.Client{Transport: rec}
+	for _, r := range requests {
+		res := doReplay(t, c, r.method, ts.URL+r.path, r.body)
+		if got := resBody(t, res); res.StatusCode != r.wantCode || got != r.wantBody {
+			t.Fatalf("recording %s %s: got %d %q; want %d %q", r.method, r.path, res.StatusCode, got, r.wantCode, r.wantBody)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(golden, []byte("secret")) {
+		t.Errorf("golden file contains redacted header:\n%s", golden)
+	}
+	ts.Close()
+	calls = 0
+
+	// Replay in a different order. Identical requests get their
+	// responses in the order they were recorded.
+	rep := &ReplayTransport{File: file, Redact: redact}
+	c = &http.Client{Transport: rep}
+	for _, i := range []int{2, 0, 5, 1, 4, 3} {
+		r := requests[i]
+		res := doReplay(t, c, r.method, ts.URL+r.path, r.body)
+		if got := resBody(t, res); res.StatusCode != r.wantCode || got != r.wantBody {
+			t.Errorf("replaying %s %s: got %d %q; want %d %q", r.method, r.path, res.StatusCode, got, r.wantCode, r.wantBody)
+		}
+		if got := res.Header.Get("X-Call"); got != r.wantCall {
+			t.Errorf("replaying %s %s: X-Call = %q; want %q", r.method, r.path, got, r.wantCall)
+		}
+		if r.method == "HEAD" && res.ContentLength != 10 {
+			t.Errorf("replaying HEAD: ContentLength = %d; want 10", res.ContentLength)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("replaying made %d requests to the server", calls)
+	}
+
+	// Every exchange has been replayed.
+	req, _ := http.NewRequest("GET", ts.URL+"/a?x=1", nil)
+	if _, err := rep.RoundTrip(req); err == nil {
+		t.Errorf("RoundTrip after all exchanges were replayed succeeded")
+	}
+	if err := rep.Close(); err != nil {
+		t.Errorf("Close while replaying: %v", err)
+	}
+}
+
+func TestReplayTransportMatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "golden.txt")
+	ts := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+	rec := &ReplayTransport{File: file, Record: true}
+	doReplay(t, &http.Client{Transport: rec}, "POST", ts.URL+"/?t=1", "body1").Body.Close()
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default Matcher compares the body, so a different body does
+	// not match; one that ignores the body and query does.
+	req, _ := http.NewRequest("POST", ts.URL+"/?t=2", strings.NewReader("body2"))
+	if _, err := (&ReplayTransport{File: file}).RoundTrip(req); err == nil {
+		t.Errorf("request with a different body matched")
+	}
+	rep := &ReplayTransport{
+		File: file,
+		Match: MatchAll(MatchMethod, func(req, recorded *http.Request) bool {
+			return req.URL.Path == recorded.URL.Path
+		}),
+	}
+	req, _ = http.NewRequest("POST", ts.URL+"/?t=2", strings.NewReader("body2"))
+	res, err := rep.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resBody(t, res); got != "ok" {
+		t.Errorf("body = %q; want %q", got, "ok")
+	}
+	if res.Request != req {
+		t.Errorf("Response.Request is not the replayed request")
+	}
+}
+
+func TestReplayTransportMissingFile(t *testing.T) {
+	rep := &ReplayTransport{File: filepath.Join(t.TempDir(), "missing.txt")}
+	if _, err := rep.RoundTrip(NewRequest("GET", "http://example.com/", nil)); err == nil {
+		t.Errorf("RoundTrip with a missing golden file succeeded")
+	}
+}
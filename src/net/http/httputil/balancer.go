@@ -0,0 +1,516 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Load balancing across multiple backends.
+
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoHealthyBackend is returned by Balancer.RoundTrip when no
+// backend is available to serve a request.
+var ErrNoHealthyBackend = errors.New("httputil: no healthy backend")
+
+// A Backend is a server to which a Balancer forwards requests.
+type Backend struct {
+	// URL is the scheme, host, and base path of the backend.
+	// Requests are routed to it as described for
+	// ProxyRequest.SetURL.
+	URL *url.URL
+
+	active atomic.Int64 // requests in flight
+
+	mu        sync.Mutex
+	checkDown bool      // the last active health check failed
+	fails     int       // consecutive passive failures
+	downUntil time.Time // passively down until this time
+}
+
+// NewBackend returns a Backend for the given URL.
+func NewBackend(u *url.URL) *Backend {
+	return &Backend{URL: u}
+}
+
+// Healthy reports whether b is currently considered healthy.
+func (b *Backend) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.healthyLocked(time.Now())
+}
+
+func (b *Backend) healthyLocked(now time.Time) bool {
+	return !b.checkDown && !now.Before(b.downUntil)
+}
+
+// ActiveRequests returns the number of requests currently being
+// served by b, including those whose response bodies have not yet
+// been closed.
+func (b *Backend) ActiveRequests() int {
+	return int(b.active.Load())
+}
+
+// A BalancingPolicy selects the backend for a request.
+type BalancingPolicy interface {
+	// Select returns one of backends to serve req.
+	// The backends slice is never empty and contains only
+	// healthy backends that have not already been tried for req.
+	// Select must be safe for concurrent use.
+	Select(backends []*Backend, req *http.Request) *Backend
+}
+
+// RoundRobin returns a BalancingPolicy that cycles through the
+// available backends in order.
+func RoundRobin() BalancingPolicy {
+	return new(roundRobin)
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (p *roundRobin) Select(backends []*Backend, req *http.Request) *Backend {
+	n := p.next.Add(1) - 1
+	return backends[n%uint64(len(backends))]
+}
+
+// LeastConnections returns a BalancingPolicy that selects the
+// available backend with the fewest requests in flight. Ties are
+// broken in favor of the backend listed first.
+func LeastConnections() BalancingPolicy {
+	return leastConnections{}
+}
+
+type leastConnections struct{}
+
+func (leastConnections) Select(backends []*Backend, req *http.Request) *Backend {
+	best := backends[0]
+	for _, b := range backends[1:] {
+		if b.ActiveRequests() < best.ActiveRequests() {
+			best = b
+		}
+	}
+	return best
+}
+
+// ConsistentHash returns a BalancingPolicy that maps each request to
+// a backend by hashing the string returned by key, so that requests
+// with the same key are sent to the same backend for as long as it
+// stays available. When a backend becomes unavailable, only the keys
+// that mapped to it move to other backends.
+//
+// If key is nil, the client IP address from Request.RemoteAddr is used.
+func ConsistentHash(key func(*http.Request) string) BalancingPolicy {
+	if key == nil {
+		key = clientIP
+	}
+	return consistentHash{key}
+}
+
+type consistentHash struct {
+	key func(*http.Request) string
+}
+
+// Select implements rendezvous hashing: each backend is scored by
+// a hash of the key and the backend URL, and the highest score wins.
+func (p consistentHash) Select(backends []*Backend, req *http.Request) *Backend {
+	key := p.key(req)
+	var (
+		best      *Backend
+		bestScore uint64
+	)
+	for _, b := range backends {
+		if score := hashString(hashString(offset64, key), b.URL.String()); best == nil || score > bestScore {
+			best, bestScore = b, score
+		}
+	}
+	return best
+}
+
+// FNV-1a constants, from hash/fnv.
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// hashString extends the FNV-1a hash h with s.
+func hashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	// Separate consecutive strings.
+	h *= prime64
+	return h
+}
+
+func clientIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// A HealthCheck configures active health checking of backends.
+type HealthCheck struct {
+	// Path is the path, relative to each backend's URL, that is
+	// requested with GET to check the backend's health.
+	// If empty, the backend's URL itself is requested.
+	Path string
+
+	// Interval is the time between health checks.
+	// If zero, a default of 10 seconds is used.
+	Interval time.Duration
+
+	// Timeout bounds each health check request.
+	// If zero, the Interval is used.
+	Timeout time.Duration
+
+	// Healthy reports whether a health check response indicates
+	// a healthy backend. If nil, any 2xx or 3xx status is healthy.
+	Healthy func(*http.Response) bool
+}
+
+func (hc *HealthCheck) interval() time.Duration {
+	if hc.Interval > 0 {
+		return hc.Interval
+	}
+	return 10 * time.Second
+}
+
+func (hc *HealthCheck) timeout() time.Duration {
+	if hc.Timeout > 0 {
+		return hc.Timeout
+	}
+	return hc.interval()
+}
+
+func (hc *HealthCheck) healthy(res *http.Response) bool {
+	if hc.Healthy != nil {
+		return hc.Healthy(res)
+	}
+	return res.StatusCode >= 200 && res.StatusCode < 400
+}
+
+// A Balancer is an http.RoundTripper that distributes requests
+// across a set of backends. Each request is routed to the backend
+// chosen by the Policy as described for ProxyRequest.SetURL, except
+// that the Host header is left unchanged.
+//
+// Backends are considered unhealthy, and are skipped, while active
+// health checks against them fail (see HealthCheck) or after they
+// fail MaxFails requests in a row (see FailTimeout).
+//
+// A Balancer is typically used as the Transport of a ReverseProxy;
+// see NewLoadBalancingReverseProxy.
+//
+// A Balancer must not be copied or modified after first use.
+type Balancer struct {
+	// Backends is the set of backends to balance across.
+	Backends []*Backend
+
+	// Policy selects the backend for each request.
+	// If nil, RoundRobin is used.
+	Policy BalancingPolicy
+
+	// Transport is used to send requests to backends.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// HealthCheck, if non-nil, enables active health checks.
+	// They are started by the first request and run until Close.
+	HealthCheck *HealthCheck
+
+	// MaxFails is the number of consecutive failed requests after
+	// which a backend is considered unhealthy for FailTimeout.
+	// A request fails if the Transport returns an error for it.
+	// If zero, failed requests do not affect backend health.
+	MaxFails int
+
+	// FailTimeout is how long a backend that reached MaxFails is
+	// considered unhealthy. If zero, a default of 10 seconds is used.
+	FailTimeout time.Duration
+
+	// MaxRetries is the number of other backends to try when a
+	// request fails. Only idempotent requests without a body are
+	// retried. If zero, failed requests are not retried.
+	MaxRetries int
+
+	rr        roundRobin // used if Policy is nil
+	checkOnce sync.Once
+	closeOnce sync.Once
+	closec    chan struct{}
+	checkDone chan struct{}
+}
+
+// NewLoadBalancingReverseProxy returns a new ReverseProxy that
+// distributes requests across the backends of b. It sets the
+// X-Forwarded-For, X-Forwarded-Host, and X-Forwarded-Proto headers
+// of outbound requests as described for ProxyRequest.SetXForwarded.
+func NewLoadBalancingReverseProxy(b *Balancer) *ReverseProxy {
+	return &ReverseProxy{
+		Rewrite: func(r *ProxyRequest) {
+			r.SetXForwarded()
+		},
+		Transport: b,
+	}
+}
+
+func (b *Balancer) transport() http.RoundTripper {
+	if b.Transport != nil {
+		return b.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (b *Balancer) policy() BalancingPolicy {
+	if b.Policy != nil {
+		return b.Policy
+	}
+	return &b.rr
+}
+
+func (b *Balancer) failTimeout() time.Duration {
+	if b.FailTimeout > 0 {
+		return b.FailTimeout
+	}
+	return 10 * time.Second
+}
+
+// RoundTrip implements http.RoundTripper. It sends req to a healthy
+// backend, retrying on other backends as configured by MaxRetries.
+// It returns ErrNoHealthyBackend if no backend is available.
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.checkOnce.Do(b.startHealthChecks)
+
+	var (
+		tried []*Backend
+		err   error
+	)
+	for {
+		be := b.pick(req, tried)
+		if be == nil {
+			if err == nil {
+				err = ErrNoHealthyBackend
+			}
+			return nil, err
+		}
+		tried = append(tried, be)
+
+		outreq := new(http.Request)
+		*outreq = *req // includes shallow copies of maps, but okay
+		u := *req.URL
+		outreq.URL = &u
+		rewriteRequestURL(outreq, be.URL)
+
+		be.active.Add(1)
+		var res *http.Response
+		res, err = b.transport().RoundTrip(outreq)
+		if err == nil {
+			b.noteSuccess(be)
+			res.Body = newBackendBody(res.Body, be)
+			return res, nil
+		}
+		be.active.Add(-1)
+		if req.Context().Err() != nil {
+			// The client went away; that says nothing about the backend.
+			return nil, err
+		}
+		b.noteFailure(be)
+		if len(tried) > b.MaxRetries || !canRetryRequest(req) {
+			return nil, err
+		}
+	}
+}
+
+// pick returns a healthy backend for req that is not in tried,
+// or nil if there is none.
+func (b *Balancer) pick(req *http.Request, tried []*Backend) *Backend {
+	now := time.Now()
+	var avail []*Backend
+	for _, be := range b.Backends {
+		if containsBackend(tried, be) {
+			continue
+		}
+		be.mu.Lock()
+		ok := be.healthyLocked(now)
+		be.mu.Unlock()
+		if ok {
+			avail = append(avail, be)
+		}
+	}
+	if len(avail) == 0 {
+		return nil
+	}
+	return b.policy().Select(avail, req)
+}
+
+func containsBackend(list []*Backend, be *Backend) bool {
+	for _, x := range list {
+		if x == be {
+			return true
+		}
+	}
+	return false
+}
+
+// canRetryRequest reports whether req may be sent again to another
+// backend after a failure.
+func canRetryRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (b *Balancer) noteSuccess(be *Backend) {
+	if b.MaxFails <= 0 {
+		return
+	}
+	be.mu.Lock()
+	be.fails = 0
+	be.mu.Unlock()
+}
+
+func (b *Balancer) noteFailure(be *Backend) {
+	if b.MaxFails <= 0 {
+		return
+	}
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	be.fails++
+	if be.fails >= b.MaxFails {
+		be.fails = 0
+		be.downUntil = time.Now().Add(b.failTimeout())
+	}
+}
+
+// backendBody decrements its backend's count of requests in flight
+// when the response body is closed.
+type backendBody struct {
+	io.ReadCloser
+	be   *Backend
+	once sync.Once
+}
+
+func (b *backendBody) Close() error {
+	b.once.Do(func() { b.be.active.Add(-1) })
+	return b.ReadCloser.Close()
+}
+
+// backendConn is a backendBody for the writable body of a
+// 101 Switching Protocols response.
+type backendConn struct {
+	*backendBody
+	io.Writer
+}
+
+func newBackendBody(body io.ReadCloser, be *Backend) io.ReadCloser {
+	b := &backendBody{ReadCloser: body, be: be}
+	if w, ok := body.(io.Writer); ok {
+		return backendConn{b, w}
+	}
+	return b
+}
+
+func (b *Balancer) startHealthChecks() {
+	b.closec = make(chan struct{})
+	if b.HealthCheck == nil {
+		return
+	}
+	b.checkDone = make(chan struct{})
+	go b.runHealthChecks()
+}
+
+func (b *Balancer) runHealthChecks() {
+	defer close(b.checkDone)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-b.closec
+		cancel()
+	}()
+	t := time.NewTicker(b.HealthCheck.interval())
+	defer t.Stop()
+	for {
+		b.checkHealth(ctx)
+		select {
+		case <-t.C:
+		case <-b.closec:
+			return
+		}
+	}
+}
+
+// checkHealth runs one round of health checks against all backends
+// concurrently and waits for them to finish.
+func (b *Balancer) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, be := range b.Backends {
+		wg.Add(1)
+		go func(be *Backend) {
+			defer wg.Done()
+			ok := b.checkBackend(ctx, be)
+			if ctx.Err() != nil {
+				return
+			}
+			be.mu.Lock()
+			be.checkDown = !ok
+			if ok {
+				be.fails = 0
+				be.downUntil = time.Time{}
+			}
+			be.mu.Unlock()
+		}(be)
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) checkBackend(ctx context.Context, be *Backend) bool {
+	hc := b.HealthCheck
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout())
+	defer cancel()
+	u := *be.URL
+	if hc.Path != "" {
+		u.Path, u.RawPath = joinURLPath(be.URL, &url.URL{Path: hc.Path})
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return false
+	}
+	res, err := b.transport().RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+	return hc.healthy(res)
+}
+
+// Close stops active health checks and waits for any in progress
+// to finish. It does not affect requests in flight. A Balancer
+// must not be used after Close.
+func (b *Balancer) Close() error {
+	b.checkOnce.Do(b.startHealthChecks)
+	b.closeOnce.Do(func() {
+		close(b.closec)
+		if b.checkDone != nil {
+			<-b.checkDone
+		}
+	})
+	return nil
+}
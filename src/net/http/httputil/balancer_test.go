@@ -0,0 +1,277 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestBackends starts n servers that respond with their index,
+// and returns them along with Backends for them.
+func newTestBackends(t *testing.T, n int) ([]*httptest.Server, []*Backend) {
+	var (
+		servers  []*httptest.Server
+		backends []*Backend
+	)
+	for i := 0; i < n; i++ {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, i)
+		}))
+		t.Cleanup(ts.Close)
+		u, err := url.Parse(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, ts)
+		backends = append(backends, NewBackend(u))
+	}
+	return servers, backends
+}
+
+func getBody(t *testing.T, c *http.Client, method, url string) (string, int) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), res.StatusCode
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	_, backends := newTestBackends(t, 3)
+	b := &Balancer{Backends: backends}
+	defer b.Close()
+	frontend := httptest.NewServer(NewLoadBalancingReverseProxy(b))
+	defer frontend.Close()
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		body, _ := getBody(t, frontend.Client(), "GET", frontend.URL)
+		got = append(got, body)
+	}
+	if g, w := strings.Join(got, ","), "0,1,2,0,1,2"; g != w {
+		t.Errorf("backends used = %v; want %v", g, w)
+	}
+	for i, be := range backends {
+		if n := be.ActiveRequests(); n != 0 {
+			t.Errorf("backend %d has %d active requests after all responses were read", i, n)
+		}
+	}
+}
+
+func TestBalancerLeastConnections(t *testing.T) {
+	backends := []*Backend{{}, {}, {}}
+	backends[0].active.Store(2)
+	backends[1].active.Store(1)
+	backends[2].active.Store(1)
+	if got := LeastConnections().Select(backends, nil); got != backends[1] {
+		t.Errorf("LeastConnections selected backend with %d active requests; want the first with 1", got.ActiveRequests())
+	}
+}
+
+func TestBalancerConsistentHash(t *testing.T) {
+	var backends []*Backend
+	for i := 0; i < 5; i++ {
+		backends = append(backends, NewBackend(&url.URL{Scheme: "http", Host: fmt.Sprintf("backend%d", i)}))
+	}
+	p := ConsistentHash(func(r *http.Request) string { return r.URL.Path })
+	assign := func(backends []*Backend) map[string]*Backend {
+		m := make(map[string]*Backend)
+		for i := 0; i < 100; i++ {
+			req := httptest.NewRequest("GET", fmt.Sprintf("/key%d", i), nil)
+			m[req.URL.Path] = p.Select(backends, req)
+		}
+		return m
+	}
+	before := assign(backends)
+	if again := assign(backends); fmt.Sprint(again) != fmt.Sprint(before) {
+		t.Fatalf("ConsistentHash is not stable across calls")
+	}
+	used := make(map[*Backend]bool)
+	for _, be := range before {
+		used[be] = true
+	}
+	if len(used) != len(backends) {
+		t.Errorf("100 keys used %d of %d backends", len(used), len(backends))
+	}
+
+	// Removing a backend only moves the keys that mapped to it.
+	removed := backends[2]
+	after := assign(append(backends[:2:2], backends[3:]...))
+	for key, be := range before {
+		if be != removed && after[key] != be {
+			t.Errorf("key %q moved from %v to %v after removing %v", key, be.URL, after[key].URL, removed.URL)
+		}
+	}
+
+	// The default key is the client IP address.
+	def := ConsistentHash(nil)
+	r1 := httptest.NewRequest("GET", "/a", nil)
+	r1.RemoteAddr = "10.0.0.1:1234"
+	r2 := httptest.NewRequest("GET", "/b", nil)
+	r2.RemoteAddr = "10.0.0.1:5678"
+	if def.Select(backends, r1) != def.Select(backends, r2) {
+		t.Errorf("requests from the same client IP selected different backends")
+	}
+}
+
+func TestBalancerRetry(t *testing.T) {
+	servers, backends := newTestBackends(t, 2)
+	servers[0].Close()
+	b := &Balancer{
+		Backends:   backends,
+		MaxFails:   1,
+		MaxRetries: 1,
+	}
+	defer b.Close()
+	c := &http.Client{Transport: b}
+
+	// The first request goes to the dead backend and is retried.
+	if body, _ := getBody(t, c, "GET", "http://example.com/"); body != "1" {
+		t.Errorf("GET body = %q; want response from backend 1", body)
+	}
+	if backends[0].Healthy() {
+		t.Errorf("backend 0 is healthy after a failed request with MaxFails = 1")
+	}
+	if !backends[1].Healthy() {
+		t.Errorf("backend 1 is unhealthy")
+	}
+
+	// Requests with a body are not retried.
+	b2 := &Balancer{
+		Backends:   []*Backend{NewBackend(backends[0].URL), backends[1]},
+		MaxRetries: 1,
+	}
+	defer b2.Close()
+	res, err := (&http.Client{Transport: b2}).Post("http://example.com/", "text/plain", strings.NewReader("body"))
+	if err == nil {
+		res.Body.Close()
+		t.Errorf("POST to dead backend succeeded; want it not to be retried")
+	}
+
+	// With every backend down, RoundTrip reports ErrNoHealthyBackend.
+	b3 := &Balancer{Backends: []*Backend{backends[0]}}
+	defer b3.Close()
+	if _, err := b3.RoundTrip(httptest.NewRequest("GET", "http://example.com/", nil)); !errors.Is(err, ErrNoHealthyBackend) {
+		t.Errorf("RoundTrip with no healthy backends: err = %v; want ErrNoHealthyBackend", err)
+	}
+}
+
+func TestBalancerPassiveRecovery(t *testing.T) {
+	servers, backends := newTestBackends(t, 1)
+	b := &Balancer{
+		Backends:    backends,
+		MaxFails:    2,
+		FailTimeout: 50 * time.Millisecond,
+	}
+	defer b.Close()
+	be := backends[0]
+	b.noteFailure(be)
+	if !be.Healthy() {
+		t.Fatalf("backend is unhealthy after 1 failure with MaxFails = 2")
+	}
+	b.noteFailure(be)
+	if be.Healthy() {
+		t.Fatalf("backend is healthy after 2 failures with MaxFails = 2")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !be.Healthy() {
+		t.Fatalf("backend is unhealthy after FailTimeout")
+	}
+	if body, _ := getBody(t, &http.Client{Transport: b}, "GET", servers[0].URL); body != "0" {
+		t.Errorf("body = %q; want %q", body, "0")
+	}
+}
+
+func TestBalancerHealthCheck(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	check := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/base/healthz" {
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		io.WriteString(w, "checked")
+	}))
+	defer check.Close()
+	u, _ := url.Parse(check.URL + "/base")
+	_, others := newTestBackends(t, 1)
+	backends := []*Backend{NewBackend(u), others[0]}
+	b := &Balancer{
+		Backends:    backends,
+		HealthCheck: &HealthCheck{Path: "/healthz", Interval: time.Hour},
+	}
+	defer b.Close()
+	c := &http.Client{Transport: b}
+
+	// The first request starts health checks, which run once right away.
+	getBody(t, c, "GET", "http://example.com/")
+	for deadline := time.Now().Add(5 * time.Second); backends[0].Healthy(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("backend is still healthy after a failed health check")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		if body, _ := getBody(t, c, "GET", "http://example.com/"); body != "0" {
+			t.Errorf("request %d: body = %q; want response from the healthy backend", i, body)
+		}
+	}
+
+	down.Store(false)
+	b.checkHealth(context.Background())
+	if !backends[0].Healthy() {
+		t.Fatalf("backend is unhealthy after a successful health check")
+	}
+	if body, _ := getBody(t, c, "GET", "http://example.com/"); body != "checked" {
+		t.Errorf("body = %q; want response from the recovered backend", body)
+	}
+}
+
+func TestBalancerHealthCheckLoop(t *testing.T) {
+	var checks atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			checks.Add(1)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	b := &Balancer{
+		Backends:    []*Backend{NewBackend(u)},
+		HealthCheck: &HealthCheck{Path: "/healthz", Interval: time.Millisecond},
+	}
+	getBody(t, &http.Client{Transport: b}, "GET", ts.URL)
+	for checks.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+	// A check canceled by Close may still reach the server.
+	time.Sleep(10 * time.Millisecond)
+	n := checks.Load()
+	time.Sleep(20 * time.Millisecond)
+	if got := checks.Load(); got != n {
+		t.Errorf("%d health checks ran after Close", got-n)
+	}
+}
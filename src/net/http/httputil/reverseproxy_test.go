@@ -336,6 +336,84 @@ func TestXForwardedFor(t *testing.T) {
 	}
 }
 
+func TestReverseProxyRewrite(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range []string{"X-Client-Hop", "Forwarded"} {
+			if v := r.Header.Get(h); v != "" {
+				t.Errorf("backend got %s header %q; want it removed", h, v)
+			}
+		}
+		if got, want := r.Header.Get("X-Forwarded-Host"), "some-name"; got != want {
+			t.Errorf("X-Forwarded-Host = %q; want %q", got, want)
+		}
+		if got, want := r.Header.Get("X-Forwarded-For"), "127.0.0.1"; got != want {
+			t.Errorf("X-Forwarded-For = %q; want %q", got, want)
+		}
+		if got, want := r.Header.Get("X-Forwarded-Proto"), "http"; got != want {
+			t.Errorf("X-Forwarded-Proto = %q; want %q", got, want)
+		}
+		if got, want := r.Header.Get(fakeHopHeader), "added by Rewrite"; got != want {
+			t.Errorf("%s = %q; want %q", fakeHopHeader, got, want)
+		}
+		if got, want := r.URL.Path, "/base/dir"; got != want {
+			t.Errorf("backend path = %q; want %q", got, want)
+		}
+		if r.Host == "some-name" {
+			t.Errorf("Host = %q; want the backend's host", r.Host)
+		}
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL + "/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyHandler := &ReverseProxy{
+		Rewrite: func(r *ProxyRequest) {
+			if got, want := r.In.Header.Get("X-Client-Hop"), "v"; got != want {
+				t.Errorf("inbound X-Client-Hop = %q; want %q", got, want)
+			}
+			if v := r.Out.Header.Get("X-Client-Hop"); v != "" {
+				t.Errorf("outbound X-Client-Hop = %q before Rewrite; want it removed", v)
+			}
+			r.SetURL(backendURL)
+			r.SetXForwarded()
+			// Headers added by Rewrite are preserved, even hop-by-hop ones.
+			r.Out.Header.Set(fakeHopHeader, "added by Rewrite")
+		},
+	}
+	frontend := httptest.NewServer(proxyHandler)
+	defer frontend.Close()
+
+	req, _ := http.NewRequest("GET", frontend.URL+"/dir", nil)
+	req.Host = "some-name"
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "v")
+	req.Header.Set("Forwarded", "for=1.2.3.4")
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Forwarded-Host", "spoofed")
+	res, err := frontend.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("status = %v; want 200", res.Status)
+	}
+}
+
+func TestReverseProxyRewriteAndDirector(t *testing.T) {
+	proxyHandler := &ReverseProxy{
+		Director: func(*http.Request) {},
+		Rewrite:  func(*ProxyRequest) {},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	rec := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status with both Director and Rewrite = %v; want %v", rec.Code, http.StatusBadGateway)
+	}
+}
+
 // Issue 38079: don't append to X-Forwarded-For if it's present but nil
 func TestXForwardedFor_Omit(t *testing.T) {
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,215 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qpack implements the QPACK field compression format used by
+// HTTP/3, as described in RFC 9204.
+//
+// Only the static table is supported. Encoded field sections never
+// refer to the dynamic table, and decoding fails for field sections
+// that do; an HTTP/3 endpoint using this package advertises a
+// SETTINGS_QPACK_MAX_TABLE_CAPACITY of zero, which forbids its peer
+// from using the dynamic table.
+package qpack
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// A HeaderField is a name-value pair. Names are lowercase.
+type HeaderField struct {
+	Name, Value string
+}
+
+// Size returns the size of the field as defined by RFC 9114, Section 4.2.2.
+func (f HeaderField) Size() int64 {
+	return int64(len(f.Name)) + int64(len(f.Value)) + 32
+}
+
+var (
+	errTruncated    = errors.New("qpack: truncated field section")
+	errDynamicTable = errors.New("qpack: field section refers to the dynamic table")
+	errTooLarge     = errors.New("qpack: field section exceeds size limit")
+)
+
+// AppendFieldSection appends the encoding of fields to dst.
+func AppendFieldSection(dst []byte, fields []HeaderField) []byte {
+	staticIndexOnce.Do(initStaticIndex)
+	// Required Insert Count and Delta Base are both zero.
+	// See RFC 9204, Section 4.5.1.
+	dst = append(dst, 0, 0)
+	for _, f := range fields {
+		if i, ok := staticFieldIndex[f]; ok {
+			// Indexed Field Line, static table: 1Txxxxxx
+			dst = appendInt(dst, 0xc0, 6, uint64(i))
+			continue
+		}
+		if i, ok := staticNameIndex[f.Name]; ok {
+			// Literal Field Line With Name Reference, static table: 01NTxxxx
+			dst = appendInt(dst, 0x50, 4, uint64(i))
+			dst = appendString(dst, 0x00, 7, f.Value)
+			continue
+		}
+		// Literal Field Line With Literal Name: 001NHxxx
+		dst = appendString(dst, 0x20, 3, f.Name)
+		dst = appendString(dst, 0x00, 7, f.Value)
+	}
+	return dst
+}
+
+// appendInt appends v as an integer with an n-bit prefix,
+// combined with the bits in first. See RFC 7541, Section 5.1.
+func appendInt(dst []byte, first byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(dst, first|byte(v))
+	}
+	dst = append(dst, first|byte(max))
+	v -= max
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
+
+// appendString appends s as a string literal whose length has an n-bit
+// prefix, combined with the bits in first. The Huffman encoding is used
+// when it is shorter; the H bit immediately precedes the length prefix.
+func appendString(dst []byte, first byte, n uint, s string) []byte {
+	if hl := hpack.HuffmanEncodeLength(s); hl < uint64(len(s)) {
+		dst = appendInt(dst, first|1<<n, n, hl)
+		return hpack.AppendHuffmanString(dst, s)
+	}
+	dst = appendInt(dst, first, n, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// ParseFieldSection decodes an encoded field section.
+// It returns an error if the total size of the fields exceeds maxSize.
+func ParseFieldSection(b []byte, maxSize int64) ([]HeaderField, error) {
+	ric, b, err := readInt(b, 8)
+	if err != nil {
+		return nil, err
+	}
+	if ric != 0 {
+		return nil, errDynamicTable
+	}
+	if _, b, err = readInt(b, 7); err != nil { // Delta Base
+		return nil, err
+	}
+	var fields []HeaderField
+	var size int64
+	for len(b) > 0 {
+		var f HeaderField
+		switch c := b[0]; {
+		case c&0x80 != 0:
+			// Indexed Field Line: 1Txxxxxx
+			if c&0x40 == 0 {
+				return nil, errDynamicTable
+			}
+			var i uint64
+			if i, b, err = readInt(b, 6); err != nil {
+				return nil, err
+			}
+			if f, err = staticField(i); err != nil {
+				return nil, err
+			}
+		case c&0x40 != 0:
+			// Literal Field Line With Name Reference: 01NTxxxx
+			if c&0x10 == 0 {
+				return nil, errDynamicTable
+			}
+			var i uint64
+			if i, b, err = readInt(b, 4); err != nil {
+				return nil, err
+			}
+			if f, err = staticField(i); err != nil {
+				return nil, err
+			}
+			if f.Value, b, err = readString(b, 7); err != nil {
+				return nil, err
+			}
+		case c&0x20 != 0:
+			// Literal Field Line With Literal Name: 001NHxxx
+			if f.Name, b, err = readString(b, 3); err != nil {
+				return nil, err
+			}
+			if f.Value, b, err = readString(b, 7); err != nil {
+				return nil, err
+			}
+		default:
+			// Post-Base forms refer to the dynamic table.
+			return nil, errDynamicTable
+		}
+		size += f.Size()
+		if size > maxSize {
+			return nil, errTooLarge
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func staticField(i uint64) (HeaderField, error) {
+	if i >= uint64(len(staticTable)) {
+		return HeaderField{}, fmt.Errorf("qpack: invalid static table index %v", i)
+	}
+	return staticTable[i], nil
+}
+
+// readInt reads an integer with an n-bit prefix from b.
+func readInt(b []byte, n uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errTruncated
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, nil
+	}
+	for shift := uint(0); ; shift += 7 {
+		if len(b) == 0 {
+			return 0, nil, errTruncated
+		}
+		if shift > 56 {
+			return 0, nil, errors.New("qpack: integer overflow")
+		}
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+}
+
+// readString reads a string literal whose length has an n-bit prefix,
+// preceded by the H bit.
+func readString(b []byte, n uint) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, errTruncated
+	}
+	huffman := b[0]&(1<<n) != 0
+	length, b, err := readInt(b, n)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(b)) {
+		return "", nil, errTruncated
+	}
+	s := b[:length]
+	b = b[length:]
+	if !huffman {
+		return string(s), b, nil
+	}
+	v, err := hpack.HuffmanDecodeToString(s)
+	if err != nil {
+		return "", nil, fmt.Errorf("qpack: %w", err)
+	}
+	return v, b, nil
+}
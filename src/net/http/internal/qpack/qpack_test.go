@@ -0,0 +1,103 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStaticTable(t *testing.T) {
+	if got := len(staticTable); got != 99 {
+		t.Fatalf("static table has %v entries, want 99", got)
+	}
+	for _, test := range []struct {
+		i int
+		f HeaderField
+	}{
+		{0, HeaderField{":authority", ""}},
+		{17, HeaderField{":method", "GET"}},
+		{25, HeaderField{":status", "200"}},
+		{63, HeaderField{":status", "100"}},
+		{98, HeaderField{"x-frame-options", "sameorigin"}},
+	} {
+		if got := staticTable[test.i]; got != test.f {
+			t.Errorf("staticTable[%v] = %v, want %v", test.i, got, test.f)
+		}
+	}
+}
+
+func TestParseFieldSectionRFCExample(t *testing.T) {
+	// RFC 9204, Appendix B.1: Literal Field Line With Name Reference.
+	b, _ := hex.DecodeString("0000510b2f696e6465782e68746d6c")
+	got, err := ParseFieldSection(b, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{{":path", "/index.html"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFieldSection = %v, want %v", got, want)
+	}
+}
+
+func TestFieldSectionRoundTrip(t *testing.T) {
+	fields := []HeaderField{
+		{":method", "GET"},                                // static table match
+		{":scheme", "https"},                              // static table match
+		{":authority", "www.example.com"},                 // static name reference
+		{":path", "/sample/path?q=1"},                     // static name reference
+		{"x-custom", "custom-value"},                      // literal name
+		{"x-empty", ""},                                   // literal name, empty value
+		{"user-agent", strings.Repeat("long value ", 40)}, // multi-byte length
+		{"x-binary", "\x00\x01\xff"},                      // not Huffman-compressible
+	}
+	b := AppendFieldSection(nil, fields)
+	got, err := ParseFieldSection(b, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("round trip:\n got %q\nwant %q", got, fields)
+	}
+	if enc := AppendFieldSection(nil, fields[:1]); !reflect.DeepEqual(enc, []byte{0, 0, 0xc0 | 17}) {
+		t.Errorf("encoding of :method GET = %x, want 0000d1", enc)
+	}
+
+	var size int64
+	for _, f := range fields {
+		size += f.Size()
+	}
+	if _, err := ParseFieldSection(b, size); err != nil {
+		t.Errorf("ParseFieldSection with limit equal to size: %v", err)
+	}
+	if _, err := ParseFieldSection(b, size-1); err == nil {
+		t.Errorf("ParseFieldSection with limit below size succeeded")
+	}
+}
+
+func TestParseFieldSectionErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		enc  string
+	}{
+		{"empty", ""},
+		{"required insert count", "0100"},
+		{"dynamic indexed", "000080"},
+		{"dynamic name reference", "000040"},
+		{"post-base indexed", "000010"},
+		{"post-base name reference", "000000"},
+		{"static index out of range", "0000ff24"}, // index 63+36 = 99
+		{"truncated string", "0000510b2f"},
+		{"truncated integer", "0000ff"},
+		{"bad huffman", "000051ff"},
+	} {
+		b, _ := hex.DecodeString(test.enc)
+		if _, err := ParseFieldSection(b, 1<<10); err == nil {
+			t.Errorf("%v: ParseFieldSection(%v) succeeded, want error", test.name, test.enc)
+		}
+	}
+}
@@ -7,7 +7,10 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"net"
 	"sync"
 	"time"
 )
@@ -25,8 +28,12 @@ var http2goAwayTimeout = 1 * time.Second
 const http2NextProtoTLS = "h2"
 
 type http2Transport struct {
+	DialTLS           func(network, addr string, cfg *tls.Config) (net.Conn, error)
+	AllowHTTP         bool
 	MaxHeaderListSize uint32
 	ConnPool          any
+
+	t1 *Transport
 }
 
 func (*http2Transport) RoundTrip(*Request) (*Response, error) { panic(noHTTP2) }
@@ -62,6 +69,19 @@ func http2NewPriorityWriteScheduler(any) http2WriteScheduler { panic(noHTTP2) }
 
 func http2ConfigureServer(s *Server, conf *http2Server) error { panic(noHTTP2) }
 
+func configureHTTP2Server(*HTTP2Config, *http2Server) {}
+
+func configureHTTP2Transport(*HTTP2Config, *http2Transport) {}
+
+type http2ServeConnOpts struct {
+	Context          context.Context
+	BaseConfig       *Server
+	Handler          Handler
+	SawClientPreface bool
+}
+
+func (*http2Server) ServeConn(net.Conn, *http2ServeConnOpts) { panic(noHTTP2) }
+
 var http2ErrNoCachedConn = http2noCachedConnError{}
 
 type http2noCachedConnError struct{}
@@ -0,0 +1,142 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func getTestTree() *routingNode {
+	root := &routingNode{}
+	for _, p := range []string{
+		"/a",
+		"/a/b",
+		"/a/{x}",
+		"/g/h/i",
+		"/g/{x}/j",
+		"/a/b/{x...}",
+		"/a/b/{y}",
+		"/a/b/{$}",
+		"GET /a",
+		"GET /a/{x}",
+		"POST /a/{x}",
+		"HEAD /headwins",
+		"GET /headwins",
+		"GET /headwins/{x...}",
+		"host1.com/a",
+		"host1.com/h/{x}",
+		"host2.com/a",
+	} {
+		pat, err := parsePattern(p)
+		if err != nil {
+			panic(err)
+		}
+		root.addPattern(pat, nil)
+	}
+	return root
+}
+
+func TestRoutingFirstSegment(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+	}{
+		{"/a/b/c", []string{"a", "b", "c"}},
+		{"/a/b/", []string{"a", "b", "/"}},
+		{"/", []string{"/"}},
+		{"/a/%62/c", []string{"a", "b", "c"}},
+		{"/a%2Fb%2fc", []string{"a/b/c"}},
+	} {
+		var got []string
+		rest := test.in
+		for len(rest) > 0 {
+			var seg string
+			seg, rest = firstSegment(rest)
+			got = append(got, seg)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestRoutingNodeMatch(t *testing.T) {
+	tree := getTestTree()
+
+	for _, test := range []struct {
+		host, method, path string
+		wantPat            string // "" for nil (no match)
+		wantMatches        []string
+	}{
+		{"", "GET", "/a", "GET /a", nil},
+		{"", "POST", "/a", "/a", nil},
+		{"", "HEAD", "/a", "GET /a", nil},
+		{"", "GET", "/a/", "", nil},
+		{"", "GET", "/b", "", nil},
+		{"", "PUT", "/a/b", "/a/b", nil},
+		{"", "GET", "/a/b", "GET /a/{x}", []string{"b"}}, // method is matched before path
+		{"", "GET", "/a/c", "GET /a/{x}", []string{"c"}},
+		{"", "POST", "/a/c", "POST /a/{x}", []string{"c"}},
+		{"", "PUT", "/a/c", "/a/{x}", []string{"c"}},
+		{"", "GET", "/a/b/", "/a/b/{$}", nil},
+		{"", "GET", "/a/b/c", "/a/b/{y}", []string{"c"}},
+		{"", "GET", "/a/b/c/d", "/a/b/{x...}", []string{"c/d"}},
+		{"", "GET", "/g/h/i", "/g/h/i", nil},
+		{"", "GET", "/g/h/j", "/g/{x}/j", []string{"h"}},
+		{"", "HEAD", "/headwins", "HEAD /headwins", nil},
+		{"", "GET", "/headwins", "GET /headwins", nil},
+		{"", "HEAD", "/headwins/x/y", "GET /headwins/{x...}", []string{"x/y"}},
+		{"host1.com", "GET", "/a", "host1.com/a", nil},
+		{"host1.com", "PUT", "/a/b", "/a/b", nil},
+		{"host1.com", "GET", "/h/x", "host1.com/h/{x}", []string{"x"}},
+		{"host2.com", "POST", "/a", "host2.com/a", nil},
+		{"host3.com", "GET", "/a", "GET /a", nil},
+		// Wildcard matches are unescaped, segment by segment.
+		{"", "GET", "/a/x%2Fy", "GET /a/{x}", []string{"x/y"}},
+		{"", "GET", "/a/b/c%2Fd/e%25", "/a/b/{x...}", []string{"c/d/e%"}},
+	} {
+		n, gotMatches := tree.match(test.host, test.method, test.path)
+		got := ""
+		if n != nil {
+			got = n.pattern.String()
+		}
+		if got != test.wantPat {
+			t.Errorf("%s %s %s: got pattern %q, want %q", test.method, test.host, test.path, got, test.wantPat)
+			continue
+		}
+		if !reflect.DeepEqual(gotMatches, test.wantMatches) {
+			t.Errorf("%s %s %s: got matches %q, want %q", test.method, test.host, test.path, gotMatches, test.wantMatches)
+		}
+	}
+}
+
+func TestMatchingMethods(t *testing.T) {
+	tree := getTestTree()
+	for _, test := range []struct {
+		host, path string
+		want       string
+	}{
+		{"", "/a", "GET,HEAD"},
+		{"", "/a/c", "GET,HEAD,POST"},
+		{"", "/headwins", "GET,HEAD"},
+		{"", "/headwins/x", "GET,HEAD"},
+		{"", "/b", ""},
+		{"host1.com", "/a", "GET,HEAD"},
+	} {
+		ms := map[string]bool{}
+		tree.matchingMethods(test.host, test.path, ms)
+		var keys []string
+		for k := range ms {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if got := strings.Join(keys, ","); got != test.want {
+			t.Errorf("%s%s: got %q, want %q", test.host, test.path, got, test.want)
+		}
+	}
+}
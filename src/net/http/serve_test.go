@@ -481,6 +481,196 @@ func TestMuxRedirectLeadingSlashes(t *testing.T) {
 	}
 }
 
+func TestServeMuxPathValue(t *testing.T) {
+	setParallel(t)
+	for _, test := range []struct {
+		pattern string
+		method  string
+		path    string
+		want    map[string]string
+	}{
+		{
+			pattern: "/{a}/is/{b}/{c...}",
+			path:    "/now/is/the/time/for/all",
+			want: map[string]string{
+				"a": "now",
+				"b": "the",
+				"c": "time/for/all",
+				"d": "",
+			},
+		},
+		{
+			pattern: "/names/{name}/{other...}",
+			path:    "/names/%2fjohn/address",
+			want: map[string]string{
+				"name":  "/john",
+				"other": "address",
+			},
+		},
+		{
+			pattern: "/names/{name}/{other...}",
+			path:    "/names/john%2Fdoe/there/is%2F/more",
+			want: map[string]string{
+				"name":  "john/doe",
+				"other": "there/is//more",
+			},
+		},
+		{
+			pattern: "GET /items/{id}",
+			method:  "HEAD",
+			path:    "/items/123",
+			want: map[string]string{
+				"id": "123",
+			},
+		},
+	} {
+		mux := NewServeMux()
+		mux.HandleFunc(test.pattern, func(w ResponseWriter, r *Request) {
+			for name, want := range test.want {
+				if got := r.PathValue(name); got != want {
+					t.Errorf("%q, %q: got %q, want %q", test.pattern, name, got, want)
+				}
+			}
+			w.WriteHeader(StatusNoContent)
+		})
+		method := test.method
+		if method == "" {
+			method = "GET"
+		}
+		req := httptest.NewRequest(method, test.path, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != StatusNoContent {
+			t.Errorf("%q, %s %s: got status %d, want %d", test.pattern, method, test.path, rr.Code, StatusNoContent)
+		}
+	}
+}
+
+func TestSetPathValue(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/a/{b}/c/{d...}", func(_ ResponseWriter, r *Request) {
+		kvs := map[string]string{
+			"b": "X",
+			"d": "Y",
+			"a": "Z",
+		}
+		for k, v := range kvs {
+			r.SetPathValue(k, v)
+		}
+		for k, w := range kvs {
+			if g := r.PathValue(k); g != w {
+				t.Errorf("got %q, want %q", g, w)
+			}
+		}
+		r2 := r.Clone(r.Context())
+		r2.SetPathValue("b", "changed")
+		if g := r.PathValue("b"); g != "X" {
+			t.Errorf("SetPathValue on clone changed original: got %q, want %q", g, "X")
+		}
+	})
+	req := httptest.NewRequest("GET", "/a/b/c/d/e", nil)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestServeMuxMethodNotAllowed(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w ResponseWriter, r *Request) {})
+	mux.HandleFunc("DELETE /items/{id}", func(w ResponseWriter, r *Request) {})
+	mux.HandleFunc("POST /items/", func(w ResponseWriter, r *Request) {})
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		allow        string
+	}{
+		{"GET", "/items/1", StatusOK, ""},
+		{"HEAD", "/items/1", StatusOK, ""},
+		{"PUT", "/items/1", StatusMethodNotAllowed, "DELETE, GET, HEAD, POST"},
+		{"GET", "/items", StatusMethodNotAllowed, "POST"},
+		{"GET", "/other", StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != test.code {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, rr.Code, test.code)
+		}
+		if got := rr.Header().Get("Allow"); got != test.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", test.method, test.path, got, test.allow)
+		}
+	}
+}
+
+func TestServeMuxRegisterPanics(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		patterns []string
+		want     string
+	}{
+		{"invalid", []string{"/{a"}, "bad wildcard segment"},
+		{"duplicate", []string{"/a/{x}", "/a/{y}"}, "matches the same requests as"},
+		{"overlap", []string{"/a/{x}", "/{y}/b"}, "both match some paths"},
+		{"methods", []string{"GET /", "/index.html"}, "matches more methods than"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mux := NewServeMux()
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatal("registration did not panic")
+				}
+				if got := fmt.Sprint(r); !strings.Contains(got, test.want) {
+					t.Errorf("got panic %q, want it to contain %q", got, test.want)
+				}
+			}()
+			for _, p := range test.patterns {
+				mux.HandleFunc(p, func(ResponseWriter, *Request) {})
+			}
+		})
+	}
+}
+
+func TestServeMuxPrecedence(t *testing.T) {
+	setParallel(t)
+	mux := NewServeMux()
+	for _, p := range []string{
+		"/",
+		"/{$}",
+		"GET /items/{id}",
+		"GET /items/new",
+		"/items/{id}/{rest...}",
+		"api.example.com/items/{id}",
+	} {
+		p := p
+		mux.HandleFunc(p, func(w ResponseWriter, r *Request) {
+			io.WriteString(w, p)
+		})
+	}
+	for _, test := range []struct {
+		host, path string
+		want       string
+	}{
+		{"", "/", "/{$}"},
+		{"", "/other", "/"},
+		{"", "/items/3", "GET /items/{id}"},
+		{"", "/items/new", "GET /items/new"},
+		{"", "/items/3/photos/1", "/items/{id}/{rest...}"},
+		{"api.example.com", "/items/3", "api.example.com/items/{id}"},
+		{"api.example.com", "/items/new", "api.example.com/items/{id}"},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.host != "" {
+			req.Host = test.host
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if got := rr.Body.String(); got != test.want {
+			t.Errorf("%s%s: matched %q, want %q", test.host, test.path, got, test.want)
+		}
+	}
+}
+
 // Test that the special cased "/route" redirect
 // implicitly created by a registered "/route/"
 // properly sets the query string in the redirect URL.
@@ -6746,6 +6936,23 @@ func TestEarlyHints(t *testing.T) {
 		t.Errorf("unexpected response; got %q; should start by %q", got, expected)
 	}
 }
+
+func TestEarlyHintsHTTP10(t *testing.T) {
+	ht := newHandlerTest(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Add("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(StatusEarlyHints)
+		w.Write([]byte("stuff"))
+	}))
+
+	got := ht.rawResponse("GET / HTTP/1.0\nHost: golang.org")
+	if !strings.HasPrefix(got, "HTTP/1.0 200 OK\r\n") {
+		t.Errorf("response to HTTP/1.0 request = %q; want it to start with the final response", got)
+	}
+	if strings.Contains(got, "103") {
+		t.Errorf("response to HTTP/1.0 request = %q; should not contain a 103 response", got)
+	}
+}
+
 func TestProcessing(t *testing.T) {
 	ht := newHandlerTest(HandlerFunc(func(w ResponseWriter, r *Request) {
 		w.WriteHeader(StatusProcessing)
@@ -6758,3 +6965,262 @@ func TestProcessing(t *testing.T) {
 		t.Errorf("unexpected response; got %q; should start by %q", got, expected)
 	}
 }
+
+func TestServerUnencryptedHTTP2(t *testing.T) {
+	CondSkipHTTP2(t)
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "%s tls=%v", r.Proto, r.TLS != nil)
+	}))
+	var serverProtos Protocols
+	serverProtos.SetHTTP1(true)
+	serverProtos.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &serverProtos
+	ts.Start()
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		name           string
+		http1, h2c     bool
+		wantBody       string
+		wantProtoMajor int
+	}{
+		{"HTTP1", true, false, "HTTP/1.1 tls=false", 1},
+		{"UnencryptedHTTP2", false, true, "HTTP/2.0 tls=false", 2},
+		{"both", true, true, "HTTP/1.1 tls=false", 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Protocols
+			p.SetHTTP1(tt.http1)
+			p.SetUnencryptedHTTP2(tt.h2c)
+			tr := &Transport{Protocols: &p}
+			defer tr.CloseIdleConnections()
+			c := &Client{Transport: tr}
+			// Make two requests, to check that the connection is reused.
+			for i := 0; i < 2; i++ {
+				res, err := c.Get(ts.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := string(body); got != tt.wantBody {
+					t.Errorf("body = %q, want %q", got, tt.wantBody)
+				}
+				if res.ProtoMajor != tt.wantProtoMajor {
+					t.Errorf("response ProtoMajor = %d, want %d", res.ProtoMajor, tt.wantProtoMajor)
+				}
+			}
+		})
+	}
+}
+
+func TestServerUnencryptedHTTP2Only(t *testing.T) {
+	CondSkipHTTP2(t)
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	var p Protocols
+	p.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &p
+	ts.Start()
+	defer ts.Close()
+
+	tr := &Transport{Protocols: &p}
+	defer tr.CloseIdleConnections()
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if got, want := string(body), "HTTP/2.0"; got != want {
+		t.Errorf("unencrypted HTTP/2 request: body = %q, want %q", got, want)
+	}
+
+	tr1 := &Transport{}
+	defer tr1.CloseIdleConnections()
+	if res, err := (&Client{Transport: tr1}).Get(ts.URL); err == nil {
+		res.Body.Close()
+		t.Errorf("HTTP/1 request to server without HTTP/1 succeeded")
+	}
+}
+
+// The deprecated "Upgrade: h2c" mechanism is not supported, so such
+// requests are served with HTTP/1.1.
+func TestServerUnencryptedHTTP2IgnoresUpgrade(t *testing.T) {
+	CondSkipHTTP2(t)
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "%s %s upgrade=%q", r.Proto, r.URL.Path, r.Header.Get("Upgrade"))
+	}))
+	var p Protocols
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &p
+	ts.Start()
+	defer ts.Close()
+
+	c, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(c, "GET /upgraded HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\n\r\n")
+	res, err := ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != StatusOK {
+		t.Errorf("response to upgrade request: %v, want 200 OK", res.Status)
+	}
+	if want := `HTTP/1.1 /upgraded upgrade="h2c"`; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+// ConnState hooks see the connection accepted by the Server for the
+// whole life of an unencrypted HTTP/2 connection.
+func TestServerUnencryptedHTTP2ConnState(t *testing.T) {
+	CondSkipHTTP2(t)
+	defer afterTest(t)
+	var (
+		mu     sync.Mutex
+		conns  = make(map[net.Conn]bool)
+		states []ConnState
+		closed = make(chan struct{})
+	)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	var p Protocols
+	p.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &p
+	ts.Config.ConnState = func(c net.Conn, state ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		conns[c] = true
+		states = append(states, state)
+		if state == StateClosed {
+			close(closed)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	tr := &Transport{Protocols: &p}
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	tr.CloseIdleConnections()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for StateClosed")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(conns) != 1 {
+		t.Errorf("ConnState called with %d connections, want 1; states: %v", len(conns), states)
+	}
+	if len(states) == 0 || states[0] != StateNew {
+		t.Errorf("states = %v, want StateNew first", states)
+	}
+}
+
+// Frame types and flags used by readTestFrame callers.
+const (
+	testFrameSettings = 0x4
+	testFramePing     = 0x6
+
+	testFlagAck = 0x1
+)
+
+// testFrame is an HTTP/2 frame read by readTestFrame.
+type testFrame struct {
+	typ, flags byte
+	stream     uint32
+	payload    []byte
+}
+
+// readTestFrame reads a single HTTP/2 frame from r.
+func readTestFrame(r io.Reader) (testFrame, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return testFrame{}, err
+	}
+	f := testFrame{
+		typ:     hdr[3],
+		flags:   hdr[4],
+		stream:  (uint32(hdr[5])<<24 | uint32(hdr[6])<<16 | uint32(hdr[7])<<8 | uint32(hdr[8])) &^ (1 << 31),
+		payload: make([]byte, int(hdr[0])<<16|int(hdr[1])<<8|int(hdr[2])),
+	}
+	_, err := io.ReadFull(r, f.payload)
+	return f, err
+}
+
+// settings returns the parameters in a SETTINGS frame.
+func (f testFrame) settings() map[uint16]uint32 {
+	m := make(map[uint16]uint32)
+	for p := f.payload; len(p) >= 6; p = p[6:] {
+		m[uint16(p[0])<<8|uint16(p[1])] = uint32(p[2])<<24 | uint32(p[3])<<16 | uint32(p[4])<<8 | uint32(p[5])
+	}
+	return m
+}
+
+func TestServerHTTP2Config(t *testing.T) {
+	CondSkipHTTP2(t)
+	defer afterTest(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	var p Protocols
+	p.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &p
+	ts.Config.HTTP2 = &HTTP2Config{
+		MaxConcurrentStreams:      7,
+		MaxDecoderHeaderTableSize: 8192,
+		MaxReadFrameSize:          1 << 20,
+		MaxReceiveBufferPerStream: 2 << 20,
+	}
+	ts.Start()
+	defer ts.Close()
+
+	c, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(c, "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	c.Write([]byte{0, 0, 0, testFrameSettings, 0, 0, 0, 0, 0})
+
+	br := bufio.NewReader(c)
+	f, err := readTestFrame(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.typ != testFrameSettings {
+		t.Fatalf("first frame type = %v, want SETTINGS", f.typ)
+	}
+	got := f.settings()
+	for id, want := range map[uint16]uint32{
+		0x1: 8192,    // SETTINGS_HEADER_TABLE_SIZE
+		0x3: 7,       // SETTINGS_MAX_CONCURRENT_STREAMS
+		0x4: 2 << 20, // SETTINGS_INITIAL_WINDOW_SIZE
+		0x5: 1 << 20, // SETTINGS_MAX_FRAME_SIZE
+	} {
+		if got[id] != want {
+			t.Errorf("setting %#x = %v, want %v", id, got[id], want)
+		}
+	}
+}
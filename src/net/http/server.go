@@ -151,7 +151,10 @@ type ResponseWriter interface {
 	// one 2xx-5xx header. 1xx headers are sent immediately, but 2xx-5xx
 	// headers may be buffered. Use the Flusher interface to send
 	// buffered data. The header map is cleared when 2xx-5xx headers are
-	// sent, but not with 1xx headers.
+	// sent, but not with 1xx headers, so headers set for an informational
+	// response such as 103 (Early Hints) are also sent with the final one.
+	// 1xx headers are not sent to HTTP/1.0 clients. Clients can observe
+	// them with httptrace.ClientTrace.Got1xxResponse.
 	//
 	// The server will automatically send a 100 (Continue) header
 	// on the first read from the request body if the request has
@@ -395,11 +398,11 @@ func (cw *chunkWriter) Write(p []byte) (n int, err error) {
 	return
 }
 
-func (cw *chunkWriter) flush() {
+func (cw *chunkWriter) flush() error {
 	if !cw.wroteHeader {
 		cw.writeHeader(nil)
 	}
-	cw.res.conn.bufw.Flush()
+	return cw.res.conn.bufw.Flush()
 }
 
 func (cw *chunkWriter) close() {
@@ -429,6 +432,7 @@ type response struct {
 	wroteContinue    bool               // 100 Continue response was written
 	wants10KeepAlive bool               // HTTP/1.0 w/ Connection "keep-alive"
 	wantsClose       bool               // HTTP request has Connection "close"
+	fullDuplex       bool               // handler may read and write concurrently; see EnableFullDuplex
 
 	// canWriteContinue is a boolean value accessed as an atomic int32
 	// that says whether or not a 100 Continue header can be written
@@ -641,8 +645,9 @@ type connReader struct {
 	byteBuf [1]byte
 	cond    *sync.Cond
 	inRead  bool
-	aborted bool  // set true before conn.rwc deadline is set to past
-	remain  int64 // bytes remaining
+	aborted bool   // set true before conn.rwc deadline is set to past
+	remain  int64  // bytes remaining
+	unread  []byte // bytes already read from conn.rwc, returned first
 }
 
 func (cr *connReader) lock() {
@@ -775,6 +780,13 @@ func (cr *connReader) Read(p []byte) (n int, err error) {
 		cr.unlock()
 		return 1, nil
 	}
+	if len(cr.unread) > 0 {
+		n = copy(p, cr.unread)
+		cr.unread = cr.unread[n:]
+		cr.remain -= int64(n)
+		cr.unlock()
+		return n, nil
+	}
 	cr.inRead = true
 	cr.unlock()
 	n, err = cr.conn.rwc.Read(p)
@@ -1152,7 +1164,13 @@ func (w *response) WriteHeader(code int) {
 			w.writeContinueMu.Unlock()
 		}
 
-		writeStatusLine(w.conn.bufw, w.req.ProtoAtLeast(1, 1), code, w.statusBuf[:])
+		// RFC 9110, Section 15.2: "A server MUST NOT send a 1xx
+		// response to an HTTP/1.0 client."
+		if !w.req.ProtoAtLeast(1, 1) {
+			return
+		}
+
+		writeStatusLine(w.conn.bufw, true, code, w.statusBuf[:])
 
 		// Per RFC 8297 we must not clear the current header map
 		w.handlerHeader.WriteSubset(w.conn.bufw, excludedHeadersNoBody)
@@ -1359,7 +1377,7 @@ func (cw *chunkWriter) writeHeader(p []byte) {
 	// TODO(bradfitz): where does RFC 2616 say that? See Issue 15527
 	// about HTTP/1.x Handlers concurrently reading and writing, like
 	// HTTP/2 handlers can do. Maybe this code should be relaxed?
-	if w.req.ContentLength != 0 && !w.closeAfterReply {
+	if w.req.ContentLength != 0 && !w.closeAfterReply && !w.fullDuplex {
 		var discard, tooBig bool
 
 		switch bdy := w.req.Body.(type) {
@@ -1694,11 +1712,19 @@ func (w *response) closedRequestBodyEarly() bool {
 }
 
 func (w *response) Flush() {
+	w.FlushError()
+}
+
+func (w *response) FlushError() error {
 	if !w.wroteHeader {
 		w.WriteHeader(StatusOK)
 	}
-	w.w.Flush()
-	w.cw.flush()
+	err := w.w.Flush()
+	e2 := w.cw.flush()
+	if err == nil {
+		err = e2
+	}
+	return err
 }
 
 func (c *conn) finalFlush() {
@@ -1884,6 +1910,9 @@ func (c *conn) serve(ctx context.Context) {
 		c.tlsState = new(tls.ConnectionState)
 		*c.tlsState = tlsConn.ConnectionState()
 		if proto := c.tlsState.NegotiatedProtocol; validNextProto(proto) {
+			if proto == http2NextProtoTLS && !c.server.protocols().HTTP2() {
+				return
+			}
 			if fn := c.server.TLSNextProto[proto]; fn != nil {
 				h := initALPNRequest{ctx, tlsConn, serverHandler{c.server}}
 				// Mark freshly created HTTP/2 as active and prevent any server state hooks
@@ -1896,8 +1925,6 @@ func (c *conn) serve(ctx context.Context) {
 		}
 	}
 
-	// HTTP/1.x from here on.
-
 	ctx, cancelCtx := context.WithCancel(ctx)
 	c.cancelCtx = cancelCtx
 	defer cancelCtx()
@@ -1906,6 +1933,16 @@ func (c *conn) serve(ctx context.Context) {
 	c.bufr = newBufioReader(c.r)
 	c.bufw = newBufioWriterSize(checkConnErrorWriter{c}, 4<<10)
 
+	protos := c.server.protocols()
+	if c.tlsState == nil && protos.UnencryptedHTTP2() && c.maybeServeUnencryptedHTTP2(ctx) {
+		return
+	}
+	if !protos.HTTP1() {
+		return
+	}
+
+	// HTTP/1.x from here on.
+
 	for {
 		w, err := c.readRequest(ctx)
 		if c.r.remain != c.server.initialReadLimitSize() {
@@ -2034,6 +2071,19 @@ func (w *response) sendExpectationFailed() {
 	w.finishRequest()
 }
 
+func (w *response) SetReadDeadline(deadline time.Time) error {
+	return w.conn.rwc.SetReadDeadline(deadline)
+}
+
+func (w *response) SetWriteDeadline(deadline time.Time) error {
+	return w.conn.rwc.SetWriteDeadline(deadline)
+}
+
+func (w *response) EnableFullDuplex() error {
+	w.fullDuplex = true
+	return nil
+}
+
 // Hijack implements the Hijacker.Hijack method. Our response is both a ResponseWriter
 // and a Hijacker.
 func (w *response) Hijack() (rwc net.Conn, buf *bufio.ReadWriter, err error) {
@@ -2254,46 +2304,122 @@ func RedirectHandler(url string, code int) Handler {
 // patterns and calls the handler for the pattern that
 // most closely matches the URL.
 //
-// Patterns name fixed, rooted paths, like "/favicon.ico",
-// or rooted subtrees, like "/images/" (note the trailing slash).
-// Longer patterns take precedence over shorter ones, so that
-// if there are handlers registered for both "/images/"
-// and "/images/thumbnails/", the latter handler will be
-// called for paths beginning "/images/thumbnails/" and the
-// former will receive requests for any other paths in the
-// "/images/" subtree.
-//
-// Note that since a pattern ending in a slash names a rooted subtree,
-// the pattern "/" matches all paths not matched by other registered
-// patterns, not just the URL with Path == "/".
-//
-// If a subtree has been registered and a request is received naming the
-// subtree root without its trailing slash, ServeMux redirects that
-// request to the subtree root (adding the trailing slash). This behavior can
-// be overridden with a separate registration for the path without
-// the trailing slash. For example, registering "/images/" causes ServeMux
+// # Patterns
+//
+// Patterns can match the method, host and path of a request.
+// Some examples:
+//
+//   - "/index.html" matches the path "/index.html" for any host and method.
+//   - "GET /static/" matches a GET request whose path begins with "/static/".
+//   - "example.com/" matches any request to the host "example.com".
+//   - "example.com/{$}" matches requests with host "example.com" and path "/".
+//   - "/b/{bucket}/o/{objectname...}" matches paths whose first segment is "b"
+//     and whose third segment is "o". The name "bucket" denotes the second
+//     segment and "objectname" denotes the remainder of the path.
+//
+// In general, a pattern looks like
+//
+//	[METHOD ][HOST]/[PATH]
+//
+// All three parts are optional; "/" is a valid pattern.
+// If METHOD is present, it must be followed by at least one space or tab.
+//
+// Literal (that is, non-wildcard) parts of a pattern match
+// the corresponding parts of a request case-sensitively.
+//
+// A pattern with no method matches every method. A pattern
+// with the method GET matches both GET and HEAD requests.
+// Otherwise, the method must match exactly.
+//
+// A pattern with no host matches every host.
+// A pattern with a host matches URLs on that host only.
+//
+// A path can include wildcard segments of the form {NAME} or {NAME...}.
+// For example, "/b/{bucket}/o/{objectname...}".
+// The wildcard name must be a valid Go identifier.
+// Wildcards must be full path segments: they must be preceded by a slash and followed by
+// either a slash or the end of the string.
+// For example, "/b_{bucket}" is not a valid pattern.
+//
+// Normally a wildcard matches only a single path segment,
+// ending at the next literal slash (not %2F) in the request URL.
+// But if the "..." is present, then the wildcard matches the remainder of the URL path, including slashes.
+// (Therefore it is invalid for a "..." wildcard to appear anywhere but at the end of a pattern.)
+// The match for a wildcard can be obtained by calling Request.PathValue with the wildcard's name.
+// A trailing slash in a path acts as an anonymous "..." wildcard.
+//
+// The special wildcard {$} matches only the end of the URL.
+// For example, the pattern "/{$}" matches only the path "/",
+// whereas the pattern "/" matches every path.
+//
+// For matching, both pattern paths and incoming request paths are unescaped segment by segment.
+// So, for example, the path "/a%2Fb/100%25" is treated as having two segments, "a/b" and "100%".
+// The pattern "/a%2fb/" matches it, but the pattern "/a/b/" does not.
+//
+// # Precedence
+//
+// If two or more patterns match a request, then the most specific pattern takes precedence.
+// A pattern P1 is more specific than P2 if P1 matches a strict subset of P2’s requests;
+// that is, if P2 matches all the requests of P1 and more.
+// If neither is more specific, then the patterns conflict.
+// There is one exception to this rule, for backwards compatibility:
+// if two patterns would otherwise conflict and one has a host while the other does not,
+// then the pattern with the host takes precedence.
+// If a pattern passed to ServeMux.Handle or ServeMux.HandleFunc conflicts with
+// another pattern that is already registered, those functions panic.
+//
+// As an example of the general rule, "/images/thumbnails/" is more specific than "/images/",
+// so both can be registered.
+// The former matches paths beginning with "/images/thumbnails/"
+// and the latter will match any other path in the "/images/" subtree.
+//
+// As another example, consider the patterns "GET /" and "/index.html":
+// both match a GET request for "/index.html", but the former pattern
+// matches all other GET and HEAD requests, while the latter matches any
+// request for "/index.html" that uses a different method.
+// The patterns conflict.
+//
+// # Trailing-slash redirection
+//
+// Consider a ServeMux with a handler for a subtree, registered using a trailing slash or "..." wildcard.
+// If the ServeMux receives a request for the subtree root without a trailing slash,
+// it redirects the request by adding the trailing slash.
+// This behavior can be overridden with a separate registration for the path without
+// the trailing slash or "..." wildcard. For example, registering "/images/" causes ServeMux
 // to redirect a request for "/images" to "/images/", unless "/images" has
 // been registered separately.
 //
-// Patterns may optionally begin with a host name, restricting matches to
-// URLs on that host only. Host-specific patterns take precedence over
-// general patterns, so that a handler might register for the two patterns
-// "/codesearch" and "codesearch.google.com/" without also taking over
-// requests for "http://www.google.com/".
+// # Request sanitizing
 //
 // ServeMux also takes care of sanitizing the URL request path and the Host
 // header, stripping the port number and redirecting any request containing . or
-// .. elements or repeated slashes to an equivalent, cleaner URL.
+// .. segments or repeated slashes to an equivalent, cleaner URL.
+//
+// # Compatibility
+//
+// The pattern syntax and matching behavior of ServeMux changed significantly
+// in Go 1.20. To restore the old behavior, set the GODEBUG environment variable
+// to "httpmuxgo119=1". This setting is read once, at program startup; changes
+// during execution will be ignored.
+//
+// The backwards-incompatible changes include:
+//   - Wildcards are just ordinary literal path segments in 1.19.
+//     For example, the pattern "/{x}" will match only that path in 1.19,
+//     but will match any one-segment path in 1.20.
+//   - In 1.19, no pattern was rejected, unless it was empty or conflicted with an existing pattern.
+//     In 1.20, syntactically invalid patterns will cause Handle and HandleFunc to panic.
+//     For example, in 1.19, the patterns "/{"  and "/a{x}" match themselves,
+//     but in 1.20 they are invalid and will cause a panic when registered.
+//   - In 1.20, each segment of a pattern is unescaped; this was not done in 1.19.
+//     For example, in 1.20 the pattern "/%61" matches the path "/a" ("%61" being the URL escape sequence for "a"),
+//     but in 1.19 it would match only the path "/%2561" (where "%25" is the escape for the percent sign).
+//   - When matching patterns to paths, in 1.20 each segment of the path is unescaped; in 1.19, the entire path is unescaped.
+//     This change mostly affects how paths with %2F escapes adjacent to slashes are treated.
 type ServeMux struct {
-	mu    sync.RWMutex
-	m     map[string]muxEntry
-	es    []muxEntry // slice of entries sorted from longest to shortest.
-	hosts bool       // whether any patterns contain hostnames
-}
-
-type muxEntry struct {
-	h       Handler
-	pattern string
+	mu       sync.RWMutex
+	tree     routingNode
+	patterns []*pattern
+	mux119   serveMux119 // used only when GODEBUG=httpmuxgo119=1
 }
 
 // NewServeMux allocates and returns a new ServeMux.
@@ -2339,66 +2465,6 @@ func stripHostPort(h string) string {
 	return host
 }
 
-// Find a handler on a handler map given a path string.
-// Most-specific (longest) pattern wins.
-func (mux *ServeMux) match(path string) (h Handler, pattern string) {
-	// Check for exact match first.
-	v, ok := mux.m[path]
-	if ok {
-		return v.h, v.pattern
-	}
-
-	// Check for longest valid match.  mux.es contains all patterns
-	// that end in / sorted from longest to shortest.
-	for _, e := range mux.es {
-		if strings.HasPrefix(path, e.pattern) {
-			return e.h, e.pattern
-		}
-	}
-	return nil, ""
-}
-
-// redirectToPathSlash determines if the given path needs appending "/" to it.
-// This occurs when a handler for path + "/" was already registered, but
-// not for path itself. If the path needs appending to, it creates a new
-// URL, setting the path to u.Path + "/" and returning true to indicate so.
-func (mux *ServeMux) redirectToPathSlash(host, path string, u *url.URL) (*url.URL, bool) {
-	mux.mu.RLock()
-	shouldRedirect := mux.shouldRedirectRLocked(host, path)
-	mux.mu.RUnlock()
-	if !shouldRedirect {
-		return u, false
-	}
-	path = path + "/"
-	u = &url.URL{Path: path, RawQuery: u.RawQuery}
-	return u, true
-}
-
-// shouldRedirectRLocked reports whether the given path and host should be redirected to
-// path+"/". This should happen if a handler is registered for path+"/" but
-// not path -- see comments at ServeMux.
-func (mux *ServeMux) shouldRedirectRLocked(host, path string) bool {
-	p := []string{path, host + path}
-
-	for _, c := range p {
-		if _, exist := mux.m[c]; exist {
-			return false
-		}
-	}
-
-	n := len(path)
-	if n == 0 {
-		return false
-	}
-	for _, c := range p {
-		if _, exist := mux.m[c+"/"]; exist {
-			return path[n-1] != '/'
-		}
-	}
-
-	return false
-}
-
 // Handler returns the handler to use for the given request,
 // consulting r.Method, r.Host, and r.URL.Path. It always returns
 // a non-nil handler. If the path is not in its canonical form, the
@@ -2410,61 +2476,147 @@ func (mux *ServeMux) shouldRedirectRLocked(host, path string) bool {
 //
 // Handler also returns the registered pattern that matches the
 // request or, in the case of internally-generated redirects,
-// the pattern that will match after following the redirect.
+// the path that will match after following the redirect.
 //
 // If there is no registered handler that applies to the request,
 // Handler returns a “page not found” handler and an empty pattern.
 func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	if use119 {
+		return mux.mux119.findHandler(r)
+	}
+	h, pattern, _, _ = mux.findHandler(r)
+	return
+}
 
+// findHandler finds a handler for a request.
+// If there is a matching handler, it returns it and the pattern that matched.
+// Otherwise it returns a Redirect or NotFound handler with the path that would match
+// after the redirect.
+func (mux *ServeMux) findHandler(r *Request) (h Handler, patStr string, _ *pattern, matches []string) {
+	var n *routingNode
+	host := r.URL.Host
+	escapedPath := r.URL.EscapedPath()
+	path := escapedPath
 	// CONNECT requests are not canonicalized.
 	if r.Method == "CONNECT" {
 		// If r.URL.Path is /tree and its handler is not registered,
 		// the /tree -> /tree/ redirect applies to CONNECT requests
 		// but the path canonicalization does not.
-		if u, ok := mux.redirectToPathSlash(r.URL.Host, r.URL.Path, r.URL); ok {
-			return RedirectHandler(u.String(), StatusMovedPermanently), u.Path
+		_, _, u := mux.matchOrRedirect(host, r.Method, path, r.URL)
+		if u != nil {
+			return RedirectHandler(u.String(), StatusMovedPermanently), u.Path, nil, nil
 		}
-
-		return mux.handler(r.Host, r.URL.Path)
+		// Redo the match, this time with r.Host instead of r.URL.Host.
+		// Pass a nil URL to skip the trailing-slash redirect logic.
+		n, matches, _ = mux.matchOrRedirect(r.Host, r.Method, path, nil)
+	} else {
+		// All other requests have any port stripped and path cleaned
+		// before passing to mux.handler.
+		host = stripHostPort(r.Host)
+		path = cleanPath(path)
+
+		// If the given path is /tree and its handler is not registered,
+		// redirect for /tree/.
+		var u *url.URL
+		n, matches, u = mux.matchOrRedirect(host, r.Method, path, r.URL)
+		if u != nil {
+			return RedirectHandler(u.String(), StatusMovedPermanently), u.Path, nil, nil
+		}
+		if path != escapedPath {
+			// Redirect to cleaned path.
+			patStr := ""
+			if n != nil {
+				patStr = n.pattern.String()
+			}
+			u := &url.URL{Path: path, RawQuery: r.URL.RawQuery}
+			return RedirectHandler(u.String(), StatusMovedPermanently), patStr, nil, nil
+		}
+	}
+	if n == nil {
+		// We didn't find a match with the request method. To distinguish between
+		// Not Found and Method Not Allowed, see if there is another pattern that
+		// matches except for the method.
+		allowedMethods := mux.matchingMethods(host, path)
+		if len(allowedMethods) > 0 {
+			return HandlerFunc(func(w ResponseWriter, r *Request) {
+				w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+				Error(w, StatusText(StatusMethodNotAllowed), StatusMethodNotAllowed)
+			}), "", nil, nil
+		}
+		return NotFoundHandler(), "", nil, nil
 	}
+	return n.handler, n.pattern.String(), n.pattern, matches
+}
 
-	// All other requests have any port stripped and path cleaned
-	// before passing to mux.handler.
-	host := stripHostPort(r.Host)
-	path := cleanPath(r.URL.Path)
+// matchOrRedirect looks up a node in the tree that matches the host, method and path.
+//
+// If the url argument is non-nil, matchOrRedirect also determines whether a
+// trailing-slash redirect should occur. If it should, it returns the
+// redirect URL (with the path with a trailing slash).
+func (mux *ServeMux) matchOrRedirect(host, method, path string, u *url.URL) (_ *routingNode, matches []string, redirectTo *url.URL) {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
 
-	// If the given path is /tree and its handler is not registered,
-	// redirect for /tree/.
-	if u, ok := mux.redirectToPathSlash(host, path, r.URL); ok {
-		return RedirectHandler(u.String(), StatusMovedPermanently), u.Path
+	n, matches := mux.tree.match(host, method, path)
+	// If we have an exact match, or we were asked not to try trailing-slash redirection,
+	// or the URL already has a trailing slash, then we're done.
+	if !exactMatch(n, path) && u != nil && !strings.HasSuffix(path, "/") {
+		// If there is an exact match with a trailing slash, then redirect.
+		path += "/"
+		n2, _ := mux.tree.match(host, method, path)
+		if exactMatch(n2, path) {
+			return nil, nil, &url.URL{Path: cleanPath(u.Path) + "/", RawQuery: u.RawQuery}
+		}
 	}
+	return n, matches, nil
+}
 
-	if path != r.URL.Path {
-		_, pattern = mux.handler(host, path)
-		u := &url.URL{Path: path, RawQuery: r.URL.RawQuery}
-		return RedirectHandler(u.String(), StatusMovedPermanently), pattern
+// exactMatch reports whether the node's pattern exactly matches the path.
+// A pattern ending in a multi wildcard matches exactly only if the
+// wildcard matches the empty string.
+func exactMatch(n *routingNode, path string) bool {
+	if n == nil {
+		return false
 	}
+	// We can't directly implement the definition (empty match for multi
+	// wildcard) because we don't record a match for anonymous multis.
 
-	return mux.handler(host, r.URL.Path)
+	// If there is no multi, the match is exact.
+	if !n.pattern.lastSegment().multi {
+		return true
+	}
+
+	// If the path doesn't end in a trailing slash, then the multi match
+	// is non-empty.
+	if len(path) > 0 && path[len(path)-1] != '/' {
+		return false
+	}
+	// Only patterns ending in {$} or a multi wildcard can
+	// match a path with a trailing slash.
+	// For the match to be exact, the number of pattern
+	// segments should be the same as the number of slashes in the path.
+	// E.g. "/a/b/{$}" and "/a/b/{...}" exactly match "/a/b/", but "/a/" does not.
+	return len(n.pattern.segments) == strings.Count(path, "/")
 }
 
-// handler is the main implementation of Handler.
-// The path is known to be in canonical form, except for CONNECT methods.
-func (mux *ServeMux) handler(host, path string) (h Handler, pattern string) {
+// matchingMethods returns a sorted list of all methods that would match with the given host and path.
+func (mux *ServeMux) matchingMethods(host, path string) []string {
+	// Hold the read lock for the entire method so that the two matches are done
+	// on the same set of registered patterns.
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
-
-	// Host-specific pattern takes precedence over generic ones
-	if mux.hosts {
-		h, pattern = mux.match(host + path)
-	}
-	if h == nil {
-		h, pattern = mux.match(path)
+	ms := map[string]bool{}
+	mux.tree.matchingMethods(host, path, ms)
+	// matchOrRedirect will try appending a trailing slash if there is no match.
+	if !strings.HasSuffix(path, "/") {
+		mux.tree.matchingMethods(host, path+"/", ms)
 	}
-	if h == nil {
-		h, pattern = NotFoundHandler(), ""
+	methods := make([]string, 0, len(ms))
+	for m := range ms {
+		methods = append(methods, m)
 	}
-	return
+	sort.Strings(methods)
+	return methods
 }
 
 // ServeHTTP dispatches the request to the handler whose
@@ -2477,73 +2629,111 @@ func (mux *ServeMux) ServeHTTP(w ResponseWriter, r *Request) {
 		w.WriteHeader(StatusBadRequest)
 		return
 	}
-	h, _ := mux.Handler(r)
+	var h Handler
+	if use119 {
+		h, _ = mux.mux119.findHandler(r)
+	} else {
+		h, _, r.pat, r.matches = mux.findHandler(r)
+	}
 	h.ServeHTTP(w, r)
 }
 
+// The four functions below all call ServeMux.register so that callerLocation
+// always refers to user code.
+
 // Handle registers the handler for the given pattern.
-// If a handler already exists for pattern, Handle panics.
+// If the given pattern conflicts with one that is already registered,
+// Handle panics.
 func (mux *ServeMux) Handle(pattern string, handler Handler) {
-	mux.mu.Lock()
-	defer mux.mu.Unlock()
-
-	if pattern == "" {
-		panic("http: invalid pattern")
-	}
-	if handler == nil {
-		panic("http: nil handler")
-	}
-	if _, exist := mux.m[pattern]; exist {
-		panic("http: multiple registrations for " + pattern)
+	if use119 {
+		mux.mux119.handle(pattern, handler)
+	} else {
+		mux.register(pattern, handler)
 	}
+}
 
-	if mux.m == nil {
-		mux.m = make(map[string]muxEntry)
+// HandleFunc registers the handler function for the given pattern.
+// If the given pattern conflicts with one that is already registered,
+// HandleFunc panics.
+func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+	if use119 {
+		mux.mux119.handleFunc(pattern, handler)
+	} else {
+		mux.register(pattern, HandlerFunc(handler))
 	}
-	e := muxEntry{h: handler, pattern: pattern}
-	mux.m[pattern] = e
-	if pattern[len(pattern)-1] == '/' {
-		mux.es = appendSorted(mux.es, e)
+}
+
+// Handle registers the handler for the given pattern in DefaultServeMux.
+// The documentation for ServeMux explains how patterns are matched.
+func Handle(pattern string, handler Handler) {
+	if use119 {
+		DefaultServeMux.mux119.handle(pattern, handler)
+	} else {
+		DefaultServeMux.register(pattern, handler)
 	}
+}
 
-	if pattern[0] != '/' {
-		mux.hosts = true
+// HandleFunc registers the handler function for the given pattern in DefaultServeMux.
+// The documentation for ServeMux explains how patterns are matched.
+func HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+	if use119 {
+		DefaultServeMux.mux119.handleFunc(pattern, handler)
+	} else {
+		DefaultServeMux.register(pattern, HandlerFunc(handler))
 	}
 }
 
-func appendSorted(es []muxEntry, e muxEntry) []muxEntry {
-	n := len(es)
-	i := sort.Search(n, func(i int) bool {
-		return len(es[i].pattern) < len(e.pattern)
-	})
-	if i == n {
-		return append(es, e)
+func (mux *ServeMux) register(pattern string, handler Handler) {
+	if err := mux.registerErr(pattern, handler); err != nil {
+		panic(err)
 	}
-	// we now know that i points at where we want to insert
-	es = append(es, muxEntry{}) // try to grow the slice in place, any entry works.
-	copy(es[i+1:], es[i:])      // Move shorter entries down
-	es[i] = e
-	return es
 }
 
-// HandleFunc registers the handler function for the given pattern.
-func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
+func (mux *ServeMux) registerErr(patstr string, handler Handler) error {
+	if patstr == "" {
+		return errors.New("http: invalid pattern")
+	}
 	if handler == nil {
-		panic("http: nil handler")
+		return errors.New("http: nil handler")
+	}
+	if f, ok := handler.(HandlerFunc); ok && f == nil {
+		return errors.New("http: nil handler")
 	}
-	mux.Handle(pattern, HandlerFunc(handler))
-}
 
-// Handle registers the handler for the given pattern
-// in the DefaultServeMux.
-// The documentation for ServeMux explains how patterns are matched.
-func Handle(pattern string, handler Handler) { DefaultServeMux.Handle(pattern, handler) }
+	pat, err := parsePattern(patstr)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", patstr, err)
+	}
 
-// HandleFunc registers the handler function for the given pattern
-// in the DefaultServeMux.
-// The documentation for ServeMux explains how patterns are matched.
-func HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
-	DefaultServeMux.HandleFunc(pattern, handler)
+	// Get the caller's location, for better conflict error messages.
+	// Skip register and whatever calls it.
+	pat.loc = callerLocation()
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	// Check for conflict.
+	for _, pat2 := range mux.patterns {
+		if pat.conflictsWith(pat2) {
+			d := describeConflict(pat, pat2)
+			return fmt.Errorf("pattern %q (registered at %s) conflicts with pattern %q (registered at %s):\n%s",
+				pat, pat.loc, pat2, pat2.loc, d)
+		}
+	}
+	mux.tree.addPattern(pat, handler)
+	mux.patterns = append(mux.patterns, pat)
+	return nil
+}
+
+// callerLocation returns the source location of the user code that
+// called one of the registration functions.
+func callerLocation() string {
+	// Skip callerLocation, registerErr, register and the exported
+	// function that called register.
+	_, file, line, ok := runtime.Caller(4)
+	if !ok {
+		return "unknown location"
+	}
+	return fmt.Sprintf("%s:%d", file, line)
 }
 
 // Serve accepts incoming HTTP connections on the listener l,
@@ -2648,6 +2838,25 @@ type Server struct {
 	// automatically.
 	TLSNextProto map[string]func(*Server, *tls.Conn, Handler)
 
+	// Protocols is the set of protocols accepted by the server.
+	//
+	// If Protocols includes UnencryptedHTTP2, the server accepts
+	// unencrypted HTTP/2 connections from clients with prior knowledge
+	// that the server supports it. The HTTP/1.1 "Upgrade: h2c"
+	// mechanism, which RFC 9113 deprecates, is not supported. The
+	// server can serve both HTTP/1 and unencrypted HTTP/2 on the same
+	// address and port. Unencrypted HTTP/2 is only supported by the
+	// bundled HTTP/2 implementation, which is not used if TLSNextProto
+	// is non-nil.
+	//
+	// If Protocols is nil, the default is HTTP/1 and HTTP/2.
+	Protocols *Protocols
+
+	// HTTP2 configures HTTP/2 connections. It is only used by the
+	// bundled HTTP/2 implementation, which is not used if
+	// TLSNextProto is non-nil. If nil, default values are used.
+	HTTP2 *HTTP2Config
+
 	// ConnState specifies an optional callback function that is
 	// called when a client connection changes state. See the
 	// ConnState type and associated constants for details.
@@ -2673,18 +2882,31 @@ type Server struct {
 	// value.
 	ConnContext func(ctx context.Context, c net.Conn) context.Context
 
+	// Compression optionally enables the compression of response
+	// bodies, as configured by the CompressionConfig, for all requests
+	// to the server. If nil, responses are not compressed.
+	// See also CompressHandler.
+	Compression *CompressionConfig
+
 	inShutdown atomicBool // true when server is in shutdown
 
 	disableKeepAlives int32     // accessed atomically.
 	nextProtoOnce     sync.Once // guards setupHTTP2_* init
 	nextProtoErr      error     // result of http2.ConfigureServer if used
 
+	// h2cServer, if non-nil, serves unencrypted HTTP/2 connections.
+	// It is set by onceSetNextProtoDefaults.
+	h2cServer *http2Server
+
 	mu         sync.Mutex
 	listeners  map[*net.Listener]struct{}
 	activeConn map[*conn]struct{}
+	http3Conns map[*http3ServerConn]struct{}
 	doneChan   chan struct{}
 	onShutdown []func()
 
+	http3AltSvc atomic.Pointer[string] // Alt-Svc value while serving HTTP/3
+
 	listenerGroup sync.WaitGroup
 }
 
@@ -2741,6 +2963,10 @@ func (srv *Server) Close() error {
 		c.rwc.Close()
 		delete(srv.activeConn, c)
 	}
+	for sc := range srv.http3Conns {
+		sc.close()
+		delete(srv.http3Conns, sc)
+	}
 	return err
 }
 
@@ -2846,6 +3072,13 @@ func (s *Server) closeIdleConns() bool {
 		c.rwc.Close()
 		delete(s.activeConn, c)
 	}
+	for sc := range s.http3Conns {
+		if !sc.closeIfIdle() {
+			quiescent = false
+			continue
+		}
+		delete(s.http3Conns, sc)
+	}
 	return quiescent
 }
 
@@ -2926,6 +3159,12 @@ func (sh serverHandler) ServeHTTP(rw ResponseWriter, req *Request) {
 		handler = globalOptionsHandler{}
 	}
 
+	if req.TLS != nil && req.ProtoMajor < 3 {
+		if altSvc := sh.srv.http3AltSvc.Load(); altSvc != nil {
+			rw.Header().Set("Alt-Svc", *altSvc)
+		}
+	}
+
 	if req.URL != nil && strings.Contains(req.URL.RawQuery, ";") {
 		var allowQuerySemicolonsInUse int32
 		req = req.WithContext(context.WithValue(req.Context(), silenceSemWarnContextKey, func() {
@@ -2938,6 +3177,10 @@ func (sh serverHandler) ServeHTTP(rw ResponseWriter, req *Request) {
 		}()
 	}
 
+	if c := sh.srv.Compression; c != nil {
+		serveCompressed(handler, c, rw, req)
+		return
+	}
 	handler.ServeHTTP(rw, req)
 }
 
@@ -2998,6 +3241,11 @@ var testHookServerServe func(*Server, net.Listener) // used if non-nil
 // shouldDoServeHTTP2 reports whether Server.Serve should configure
 // automatic HTTP/2. (which sets up the srv.TLSNextProto map)
 func (srv *Server) shouldConfigureHTTP2ForServe() bool {
+	if srv.protocols().UnencryptedHTTP2() {
+		// The user explicitly asked for HTTP/2 on
+		// unencrypted connections.
+		return true
+	}
 	if srv.TLSConfig == nil {
 		// Compatibility with Go 1.6:
 		// If there's no TLSConfig, it's possible that the user just
@@ -3118,9 +3366,13 @@ func (srv *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
 	}
 
 	config := cloneTLSConfig(srv.TLSConfig)
-	if !strSliceContains(config.NextProtos, "http/1.1") {
+	p := srv.protocols()
+	if !strSliceContains(config.NextProtos, "http/1.1") && p.HTTP1() {
 		config.NextProtos = append(config.NextProtos, "http/1.1")
 	}
+	if !p.HTTP2() {
+		config.NextProtos = removeNextProto(config.NextProtos, http2NextProtoTLS)
+	}
 
 	configHasCert := len(config.Certificates) > 0 || config.GetCertificate != nil
 	if !configHasCert || certFile != "" || keyFile != "" {
@@ -3320,6 +3572,28 @@ func (srv *Server) onceSetNextProtoDefaults_Serve() {
 	}
 }
 
+// protocols returns the set of protocols accepted by the server.
+func (srv *Server) protocols() Protocols {
+	if srv.Protocols != nil {
+		return *srv.Protocols
+	}
+	var p Protocols
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	return p
+}
+
+// removeNextProto returns a copy of protos without proto.
+func removeNextProto(protos []string, proto string) []string {
+	var ps []string
+	for _, p := range protos {
+		if p != proto {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
 // onceSetNextProtoDefaults configures HTTP/2, if the user hasn't
 // configured otherwise. (by setting srv.TLSNextProto non-nil)
 // It must only be called via srv.nextProtoOnce (use srv.setupHTTP2_*).
@@ -3327,13 +3601,20 @@ func (srv *Server) onceSetNextProtoDefaults() {
 	if omitBundledHTTP2 || godebug.Get("http2server") == "0" {
 		return
 	}
+	if p := srv.protocols(); !p.HTTP2() && !p.UnencryptedHTTP2() {
+		return
+	}
 	// Enable HTTP/2 by default if the user hasn't otherwise
 	// configured their TLSNextProto map.
 	if srv.TLSNextProto == nil {
 		conf := &http2Server{
 			NewWriteScheduler: func() http2WriteScheduler { return http2NewPriorityWriteScheduler(nil) },
 		}
+		configureHTTP2Server(srv.HTTP2, conf)
 		srv.nextProtoErr = http2ConfigureServer(srv, conf)
+		if srv.nextProtoErr == nil && srv.protocols().UnencryptedHTTP2() {
+			srv.h2cServer = conf
+		}
 	}
 }
 
@@ -3521,12 +3802,61 @@ func (globalOptionsHandler) ServeHTTP(w ResponseWriter, r *Request) {
 	}
 }
 
+// h2cPreface is the string that begins an HTTP/2 connection. Its
+// first line is a valid HTTP/1 request line, so no HTTP/1 request is
+// shorter than it. See RFC 9113, Section 3.4.
+const (
+	h2cPrefaceLine = "PRI * HTTP/2.0"
+	h2cPreface     = h2cPrefaceLine + "\r\n\r\nSM\r\n\r\n"
+)
+
+// maybeServeUnencryptedHTTP2 serves unencrypted HTTP/2 on c if the
+// client began the connection with the HTTP/2 connection preface, as
+// it does when it has prior knowledge that the server supports it.
+// It reports whether it served the connection.
+func (c *conn) maybeServeUnencryptedHTTP2(ctx context.Context) bool {
+	h2 := c.server.h2cServer
+	if h2 == nil {
+		return false
+	}
+	if d := c.server.readHeaderTimeout(); d > 0 {
+		c.rwc.SetReadDeadline(time.Now().Add(d))
+	}
+	c.r.setReadLimit(c.server.initialReadLimitSize())
+	// Read exactly the bytes of the preface, bypassing c.bufr, so that
+	// the HTTP/2 server can read the rest of the connection from
+	// c.rwc itself. Read the first line before the whole preface,
+	// since an HTTP/1 request may be shorter than the preface.
+	buf := make([]byte, len(h2cPreface))
+	n, err := io.ReadFull(c.r, buf[:len(h2cPrefaceLine)])
+	if err == nil && string(buf[:n]) == h2cPrefaceLine {
+		var m int
+		m, err = io.ReadFull(c.r, buf[n:])
+		n += m
+	}
+	c.r.setInfiniteReadLimit()
+	c.rwc.SetReadDeadline(time.Time{})
+	if string(buf[:n]) != h2cPreface {
+		// Let the HTTP/1 server read the bytes again.
+		c.r.unread = buf[:n]
+		return false
+	}
+	c.setState(c.rwc, StateActive, skipHooks)
+	h2.ServeConn(c.rwc, &http2ServeConnOpts{
+		Context:          ctx,
+		Handler:          initALPNRequest{ctx, c.rwc, serverHandler{c.server}},
+		BaseConfig:       c.server,
+		SawClientPreface: true,
+	})
+	return true
+}
+
 // initALPNRequest is an HTTP handler that initializes certain
 // uninitialized fields in its *Request. Such partially-initialized
 // Requests come from ALPN protocol handlers.
 type initALPNRequest struct {
 	ctx context.Context
-	c   *tls.Conn
+	c   net.Conn // a *tls.Conn, unless serving unencrypted HTTP/2
 	h   serverHandler
 }
 
@@ -3537,9 +3867,9 @@ type initALPNRequest struct {
 func (h initALPNRequest) BaseContext() context.Context { return h.ctx }
 
 func (h initALPNRequest) ServeHTTP(rw ResponseWriter, req *Request) {
-	if req.TLS == nil {
+	if tc, ok := h.c.(*tls.Conn); ok && req.TLS == nil {
 		req.TLS = &tls.ConnectionState{}
-		*req.TLS = h.c.ConnectionState()
+		*req.TLS = tc.ConnectionState()
 	}
 	if req.Body == nil {
 		req.Body = NoBody
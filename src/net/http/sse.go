@@ -0,0 +1,543 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Server-Sent Events, as specified by
+// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Event is a Server-Sent Event, a message in a text/event-stream.
+type Event struct {
+	// ID is the event's ID. A client sends the ID of the last event
+	// it received in the Last-Event-ID header field when it
+	// reconnects, so that the server can resume the stream.
+	//
+	// When writing, an empty ID is not sent. When reading, ID is the
+	// most recent ID in the stream, which may have been set by an
+	// earlier event, as browsers report it.
+	ID string
+
+	// Type is the event's type. An empty Type means "message".
+	Type string
+
+	// Data is the event's payload. It may contain newlines.
+	Data string
+
+	// Retry, if positive, is the time a client should wait before
+	// reconnecting after the stream ends. It is rounded down to a
+	// whole number of milliseconds.
+	Retry time.Duration
+}
+
+// An EventWriter writes Server-Sent Events to the response of a
+// handler, flushing each event to the client as it is written. It
+// flushes through HTTP/2 and through ResponseWriters that have an
+// Unwrap method, as ResponseController does.
+//
+// Once an EventWriter is created, the handler must write to the
+// response only through it. Its methods may be called concurrently.
+//
+// The stream ends when the handler returns. The handler must close
+// the EventWriter before it returns, typically with a deferred call to
+// Close, so that no heartbeat is written to the response afterwards.
+// Handlers should also return when the request's context is canceled,
+// which happens when the client disconnects. Once the context is done,
+// the EventWriter is closed, but asynchronously, so this does not
+// replace the call to Close. A Server's WriteTimeout applies to the
+// whole stream; ResponseController.SetWriteDeadline can extend it.
+type EventWriter struct {
+	w  ResponseWriter
+	rc *ResponseController
+
+	mu        sync.Mutex
+	err       error // sticky write error
+	closed    bool
+	heartbeat time.Duration
+	timer     *time.Timer
+	stopClose func() bool // stops closing ew when the request's context is done
+}
+
+var errEventWriterClosed = errors.New("http: EventWriter closed")
+
+// NewEventWriter returns an EventWriter writing to w, the response to
+// r, sends the response header to the client, and flushes it. The
+// handler must call Close before returning.
+//
+// It sets the Content-Type header to "text/event-stream" and, unless
+// the handler has set it, the Cache-Control header to "no-cache".
+func NewEventWriter(w ResponseWriter, r *Request) *EventWriter {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	if _, ok := h["Cache-Control"]; !ok {
+		h.Set("Cache-Control", "no-cache")
+	}
+	h.Del("Content-Length")
+	w.WriteHeader(StatusOK)
+	ew := &EventWriter{w: w, rc: NewResponseController(w)}
+	ew.mu.Lock()
+	ew.flushLocked()
+	ew.stopClose = context.AfterFunc(r.Context(), func() { ew.Close() })
+	ew.mu.Unlock()
+	return ew
+}
+
+// Send writes ev to the client and flushes it. It returns an error if
+// ev.ID or ev.Type contains a newline, or if writing to the client
+// has failed, typically because the client disconnected.
+func (ew *EventWriter) Send(ev *Event) error {
+	if strings.ContainsAny(ev.Type, "\r\n") {
+		return errors.New("http: newline in event type")
+	}
+	if strings.ContainsAny(ev.ID, "\r\n\x00") {
+		return errors.New("http: newline or NUL in event ID")
+	}
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: ")
+		b.WriteString(ev.ID)
+		b.WriteByte('\n')
+	}
+	if ev.Type != "" {
+		b.WriteString("event: ")
+		b.WriteString(ev.Type)
+		b.WriteByte('\n')
+	}
+	if ms := ev.Retry.Milliseconds(); ms > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", ms)
+	}
+	// Every event has at least one data line, so that clients
+	// dispatch events with empty data.
+	data := strings.ReplaceAll(ev.Data, "\r\n", "\n")
+	for {
+		line, rest, more := strings.Cut(data, "\n")
+		if i := strings.IndexByte(line, '\r'); i >= 0 {
+			line, rest, more = line[:i], data[i+1:], true
+		}
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+		if !more {
+			break
+		}
+		data = rest
+	}
+	b.WriteByte('\n')
+	return ew.write(b.String())
+}
+
+// SendComment writes a comment to the client and flushes it. Clients
+// ignore comments; they are typically used to keep idle connections
+// open. Newlines in text start new comment lines.
+func (ew *EventWriter) SendComment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n") {
+		b.WriteString(":")
+		if line != "" {
+			b.WriteString(" ")
+			b.WriteString(line)
+		}
+		b.WriteByte('\n')
+	}
+	return ew.write(b.String())
+}
+
+// Heartbeat makes ew write an empty comment whenever nothing has been
+// written for the given interval, so that proxies and clients do not
+// close the connection as idle. A non-positive interval disables it.
+// Heartbeats stop when ew is closed, which the handler must do before
+// it returns.
+func (ew *EventWriter) Heartbeat(interval time.Duration) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.heartbeat = interval
+	if ew.closed || ew.err != nil {
+		return
+	}
+	if interval <= 0 {
+		if ew.timer != nil {
+			ew.timer.Stop()
+		}
+		return
+	}
+	if ew.timer == nil {
+		ew.timer = time.AfterFunc(interval, ew.sendHeartbeat)
+	} else {
+		ew.timer.Reset(interval)
+	}
+}
+
+func (ew *EventWriter) sendHeartbeat() {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if ew.closed || ew.err != nil || ew.heartbeat <= 0 {
+		return
+	}
+	ew.writeLocked(":\n")
+}
+
+// Close stops heartbeats and makes later writes fail. Once Close has
+// returned, ew does not write to the response. It does not end the
+// response, which happens when the handler returns.
+func (ew *EventWriter) Close() error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	ew.closed = true
+	if ew.timer != nil {
+		ew.timer.Stop()
+	}
+	if ew.stopClose != nil {
+		ew.stopClose()
+	}
+	return nil
+}
+
+func (ew *EventWriter) write(s string) error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if ew.closed {
+		return errEventWriterClosed
+	}
+	return ew.writeLocked(s)
+}
+
+// writeLocked writes s and flushes it, and restarts the heartbeat
+// timer. ew.mu must be held.
+func (ew *EventWriter) writeLocked(s string) error {
+	if ew.err != nil {
+		return ew.err
+	}
+	if _, err := io.WriteString(ew.w, s); err != nil {
+		ew.err = err
+	} else {
+		ew.flushLocked()
+	}
+	if ew.err != nil {
+		if ew.timer != nil {
+			ew.timer.Stop()
+		}
+		return ew.err
+	}
+	if ew.timer != nil && ew.heartbeat > 0 {
+		ew.timer.Reset(ew.heartbeat)
+	}
+	return nil
+}
+
+// flushLocked flushes the response. ResponseWriters that cannot be
+// flushed still work, but deliver events late. ew.mu must be held.
+func (ew *EventWriter) flushLocked() {
+	if err := ew.rc.Flush(); err != nil && !errors.Is(err, ErrNotSupported) {
+		ew.err = err
+	}
+}
+
+// An EventReader parses Server-Sent Events from a text/event-stream,
+// such as the body of a response.
+type EventReader struct {
+	br      *bufio.Reader
+	started bool // the leading byte order mark has been skipped
+	sawCR   bool // the last line ended with '\r', which may precede '\n'
+	line    []byte
+	lastID  string
+	retry   time.Duration
+}
+
+// NewEventReader returns an EventReader that reads from r.
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{br: bufio.NewReader(r)}
+}
+
+// Next returns the next event in the stream. At the end of the
+// stream, it returns io.EOF, discarding any incomplete event.
+//
+// Events with no data lines are not returned, as browsers do not
+// dispatch them, but their id and retry fields take effect.
+func (er *EventReader) Next() (*Event, error) {
+	if !er.started {
+		er.started = true
+		// Only wait for more bytes if the stream may start with one.
+		if b, err := er.br.Peek(1); err == nil && b[0] == 0xef {
+			if b, err := er.br.Peek(3); err == nil && string(b) == "\ufeff" {
+				er.br.Discard(3)
+			}
+		}
+	}
+	var (
+		ev      Event
+		data    strings.Builder
+		hasData bool
+	)
+	for {
+		line, err := er.readLine()
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		if len(line) == 0 {
+			// A blank line dispatches the event.
+			if !hasData {
+				ev = Event{}
+				continue
+			}
+			ev.ID = er.lastID
+			ev.Data = data.String()
+			return &ev, nil
+		}
+		if line[0] == ':' {
+			continue
+		}
+		field, value, _ := strings.Cut(string(line), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Type = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				er.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				er.retry = time.Duration(ms) * time.Millisecond
+				ev.Retry = er.retry
+			}
+		}
+	}
+}
+
+// LastEventID returns the most recent event ID read from the stream.
+func (er *EventReader) LastEventID() string {
+	return er.lastID
+}
+
+// Retry returns the most recent reconnection time read from the
+// stream, or zero if there has been none.
+func (er *EventReader) Retry() time.Duration {
+	return er.retry
+}
+
+// readLine returns the next line, which may end with "\r\n", "\n" or
+// "\r". The line is valid until the next call. It returns
+// io.ErrUnexpectedEOF at the end of an unterminated line.
+func (er *EventReader) readLine() ([]byte, error) {
+	er.line = er.line[:0]
+	for {
+		c, err := er.br.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(er.line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if er.sawCR {
+			er.sawCR = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\r':
+			er.sawCR = true
+			return er.line, nil
+		case '\n':
+			return er.line, nil
+		}
+		er.line = append(er.line, c)
+	}
+}
+
+// defaultEventRetry is the time an EventSource waits before
+// reconnecting, until the server sends a retry field.
+const defaultEventRetry = 3 * time.Second
+
+// An EventSource reads Server-Sent Events from a server, reconnecting
+// when the stream ends or fails, as a browser's EventSource does.
+// When it reconnects, it sends the ID of the last event it received
+// in the Last-Event-ID header field so that the server can resume the
+// stream.
+type EventSource struct {
+	client *Client
+	req    *Request
+
+	lastID string
+	retry  time.Duration
+	err    error // permanent error
+
+	mu     sync.Mutex
+	closed bool
+	closec chan struct{}
+	res    *Response
+	er     *EventReader
+}
+
+var errEventSourceClosed = errors.New("http: EventSource closed")
+
+// NewEventSource returns an EventSource that sends req with client to
+// connect, and again with the same method, URL and header to
+// reconnect. The request must not have a body. If client is nil,
+// DefaultClient is used. If req has a Last-Event-ID header field, it
+// is the initial last event ID.
+//
+// Canceling the request's context, or calling Close, stops the
+// EventSource.
+func NewEventSource(client *Client, req *Request) *EventSource {
+	if client == nil {
+		client = DefaultClient
+	}
+	return &EventSource{
+		client: client,
+		req:    req,
+		lastID: req.Header.Get("Last-Event-ID"),
+		retry:  defaultEventRetry,
+		closec: make(chan struct{}),
+	}
+}
+
+// Next returns the next event, connecting or reconnecting to the
+// server as needed. Network errors and the end of a stream cause
+// a reconnection after the server's requested delay. If the server
+// responds with 204 No Content, Next returns io.EOF. Other responses
+// without status 200 or without the text/event-stream media type
+// make Next return an error. Once Next has returned an error, it
+// returns the same error in later calls.
+func (es *EventSource) Next() (*Event, error) {
+	for es.err == nil {
+		er, err := es.reader()
+		if err != nil {
+			es.err = err
+			break
+		}
+		if er == nil {
+			// The connection attempt failed; try again.
+			es.wait()
+			continue
+		}
+		ev, err := er.Next()
+		if r := er.Retry(); r > 0 {
+			es.retry = r
+		}
+		es.lastID = er.LastEventID()
+		if err == nil {
+			return ev, nil
+		}
+		es.mu.Lock()
+		es.res.Body.Close()
+		es.res, es.er = nil, nil
+		es.mu.Unlock()
+		es.wait()
+	}
+	return nil, es.err
+}
+
+// LastEventID returns the ID of the last event received, which is
+// sent when reconnecting.
+func (es *EventSource) LastEventID() string {
+	return es.lastID
+}
+
+// reader returns the EventReader for the current connection, first
+// connecting if needed. It returns a nil reader and a nil error if a
+// connection attempt failed but should be retried.
+func (es *EventSource) reader() (*EventReader, error) {
+	es.mu.Lock()
+	closed, er := es.closed, es.er
+	es.mu.Unlock()
+	if closed {
+		return nil, errEventSourceClosed
+	}
+	if er != nil {
+		return er, nil
+	}
+	if err := es.req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	req := es.req.Clone(es.req.Context())
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if es.lastID != "" {
+		req.Header.Set("Last-Event-ID", es.lastID)
+	} else {
+		req.Header.Del("Last-Event-ID")
+	}
+	res, err := es.client.Do(req)
+	if err != nil {
+		if ctxErr := es.req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, nil
+	}
+	if res.StatusCode == StatusNoContent {
+		res.Body.Close()
+		return nil, io.EOF
+	}
+	if res.StatusCode != StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("http: event stream response has status %q", res.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt != "text/event-stream" {
+		res.Body.Close()
+		return nil, fmt.Errorf("http: event stream response has Content-Type %q", res.Header.Get("Content-Type"))
+	}
+
+	er = NewEventReader(res.Body)
+	er.lastID = es.lastID
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		res.Body.Close()
+		return nil, errEventSourceClosed
+	}
+	es.res, es.er = res, er
+	return er, nil
+}
+
+// wait waits for the reconnection delay, or until es is closed or its
+// request's context is done.
+func (es *EventSource) wait() {
+	t := time.NewTimer(es.retry)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-es.closec:
+	case <-es.req.Context().Done():
+	}
+}
+
+// Close closes the current connection, if any, and stops es from
+// reconnecting. It may be called concurrently with Next, which then
+// returns an error.
+func (es *EventSource) Close() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		return nil
+	}
+	es.closed = true
+	close(es.closec)
+	if es.res != nil {
+		return es.res.Body.Close()
+	}
+	return nil
+}
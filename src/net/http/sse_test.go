@@ -0,0 +1,361 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	. "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventReader(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		stream string
+		want   []Event
+	}{{
+		name:   "simple",
+		stream: "data: hello\n\n",
+		want:   []Event{{Data: "hello"}},
+	}, {
+		name:   "fields",
+		stream: "id: 1\nevent: update\nretry: 1500\ndata: a\ndata: b\n\n",
+		want:   []Event{{ID: "1", Type: "update", Data: "a\nb", Retry: 1500 * time.Millisecond}},
+	}, {
+		name:   "line endings",
+		stream: "data: a\r\ndata: b\rdata: c\n\r\ndata: d\r\r",
+		want:   []Event{{Data: "a\nb\nc"}, {Data: "d"}},
+	}, {
+		name:   "byte order mark",
+		stream: "\ufeffdata: x\n\n\ufeffdata: y\n\n",
+		want:   []Event{{Data: "x"}},
+	}, {
+		name:   "comments and unknown fields",
+		stream: ": comment\nfoo: bar\ndata: x\n:\n\n",
+		want:   []Event{{Data: "x"}},
+	}, {
+		name:   "spaces",
+		stream: "data:no space\n\ndata:  two spaces\n\ndata\n\n",
+		want:   []Event{{Data: "no space"}, {Data: " two spaces"}, {Data: ""}},
+	}, {
+		name:   "id persists",
+		stream: "id: 7\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+		want:   []Event{{ID: "7", Data: "a"}, {ID: "7", Data: "b"}, {ID: "", Data: "c"}},
+	}, {
+		name:   "id with NUL is ignored",
+		stream: "id: 1\ndata: a\n\nid: 2\x00\ndata: b\n\n",
+		want:   []Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}},
+	}, {
+		name:   "event without data",
+		stream: "event: x\nid: 3\n\ndata: a\n\n",
+		want:   []Event{{ID: "3", Data: "a"}},
+	}, {
+		name:   "invalid retry",
+		stream: "retry: 1.5\ndata: a\n\nretry: -1\ndata: b\n\n",
+		want:   []Event{{Data: "a"}, {Data: "b"}},
+	}, {
+		name:   "incomplete event",
+		stream: "data: a\n\ndata: b\n",
+		want:   []Event{{Data: "a"}},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			er := NewEventReader(strings.NewReader(tt.stream))
+			var got []Event
+			for {
+				ev, err := er.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, *ev)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Length", "100")
+	ew := NewEventWriter(rec, httptest.NewRequest("GET", "/", nil))
+	if !rec.Flushed {
+		t.Errorf("NewEventWriter did not flush the header")
+	}
+	for _, ev := range []*Event{
+		{Data: "hello"},
+		{ID: "1", Type: "update", Data: "a\nb\r\nc\rd", Retry: 2500 * time.Millisecond},
+		{},
+	} {
+		if err := ew.Send(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ew.SendComment("one\ntwo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Send(&Event{Type: "a\nb"}); err == nil {
+		t.Errorf("Send with a newline in the type succeeded")
+	}
+	if err := ew.Send(&Event{ID: "a\rb"}); err == nil {
+		t.Errorf("Send with a newline in the ID succeeded")
+	}
+	ew.Close()
+	if err := ew.Send(&Event{Data: "late"}); err == nil {
+		t.Errorf("Send after Close succeeded")
+	}
+
+	const want = "data: hello\n\n" +
+		"id: 1\nevent: update\nretry: 2500\ndata: a\ndata: b\ndata: c\ndata: d\n\n" +
+		"data: \n\n" +
+		": one\n: two\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body = %q\nwant %q", got, want)
+	}
+	h := rec.Result().Header
+	if got := h.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := h.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if got := h.Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q; want none", got)
+	}
+
+	// What is written can be read back.
+	er := NewEventReader(strings.NewReader(want))
+	for _, want := range []Event{
+		{Data: "hello"},
+		{ID: "1", Type: "update", Data: "a\nb\nc\nd", Retry: 2500 * time.Millisecond},
+		{ID: "1"},
+	} {
+		ev, err := er.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *ev != want {
+			t.Errorf("read %q; want %q", *ev, want)
+		}
+	}
+}
+
+func TestEventSource_h1(t *testing.T) { testEventSource(t, h1Mode) }
+func TestEventSource_h2(t *testing.T) { testEventSource(t, h2Mode) }
+func testEventSource(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	sent := make(chan bool)
+	var (
+		mu      sync.Mutex
+		lastIDs []string
+	)
+	cst := newClientServerTest(t, h2, HandlerFunc(func(w ResponseWriter, r *Request) {
+		mu.Lock()
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		conns := len(lastIDs)
+		mu.Unlock()
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		if conns == 3 {
+			// Tell the client to stop reconnecting.
+			w.WriteHeader(StatusNoContent)
+			return
+		}
+		ew := NewEventWriter(w, r)
+		for i := 0; i < 2; i++ {
+			id := fmt.Sprint(conns*10 + i)
+			if err := ew.Send(&Event{ID: id, Data: "event " + id, Retry: time.Millisecond}); err != nil {
+				t.Errorf("Send: %v", err)
+				return
+			}
+			// The event must reach the client while the handler runs.
+			<-sent
+		}
+	}))
+	defer cst.close()
+
+	es := NewEventSource(cst.c, mustNewRequest(t, "GET", cst.ts.URL, nil))
+	defer es.Close()
+	for _, want := range []string{"10", "11", "20", "21"} {
+		ev, err := es.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.ID != want || ev.Data != "event "+want {
+			t.Errorf("event = %+v; want ID %v", ev, want)
+		}
+		sent <- true
+	}
+	if _, err := es.Next(); err != io.EOF {
+		t.Errorf("Next after 204 response: err = %v; want io.EOF", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := lastIDs, []string{"", "11", "21"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Last-Event-ID sent = %q; want %q", got, want)
+	}
+	if got := es.LastEventID(); got != "21" {
+		t.Errorf("LastEventID = %q; want %q", got, "21")
+	}
+}
+
+func mustNewRequest(t *testing.T, method, url string, body io.Reader) *Request {
+	t.Helper()
+	req, err := NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestEventSourceErrors(t *testing.T) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, h1Mode, HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/plain":
+			io.WriteString(w, "data: x\n\n")
+		case "/missing":
+			NotFound(w, r)
+		default:
+			ew := NewEventWriter(w, r)
+			ew.Send(&Event{Data: "x"})
+			<-r.Context().Done()
+		}
+	}))
+	defer cst.close()
+
+	for _, path := range []string{"/plain", "/missing"} {
+		es := NewEventSource(cst.c, mustNewRequest(t, "GET", cst.ts.URL+path, nil))
+		if _, err := es.Next(); err == nil || err == io.EOF {
+			t.Errorf("%s: Next returned err = %v; want an error", path, err)
+		}
+	}
+
+	// Close unblocks a pending Next.
+	es := NewEventSource(cst.c, mustNewRequest(t, "GET", cst.ts.URL+"/stream", nil))
+	if _, err := es.Next(); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, func() { es.Close() })
+	if _, err := es.Next(); err == nil {
+		t.Errorf("Next after Close succeeded")
+	}
+
+	// So does canceling the request's context.
+	ctx, cancel := context.WithCancel(context.Background())
+	req := mustNewRequest(t, "GET", cst.ts.URL+"/stream", nil).WithContext(ctx)
+	es = NewEventSource(cst.c, req)
+	defer es.Close()
+	if _, err := es.Next(); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := es.Next(); err != context.Canceled {
+		t.Errorf("Next after cancel: err = %v; want context.Canceled", err)
+	}
+}
+
+func TestEventWriterHeartbeat_h1(t *testing.T) { testEventWriterHeartbeat(t, h1Mode) }
+func TestEventWriterHeartbeat_h2(t *testing.T) { testEventWriterHeartbeat(t, h2Mode) }
+func testEventWriterHeartbeat(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, h2, HandlerFunc(func(w ResponseWriter, r *Request) {
+		ew := NewEventWriter(w, r)
+		defer ew.Close()
+		ew.Heartbeat(time.Millisecond)
+		<-r.Context().Done()
+	}))
+	defer cst.close()
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	br := bufio.NewReader(res.Body)
+	for i := 0; i < 3; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != ":\n" {
+			t.Fatalf("line %d = %q; want heartbeat comment", i, line)
+		}
+	}
+}
+
+func TestEventWriterClosedWhenRequestDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	ew := NewEventWriter(rec, req)
+	ew.Heartbeat(time.Millisecond)
+	cancel()
+	for ew.SendComment("x") == nil {
+		time.Sleep(time.Millisecond)
+	}
+	n := rec.Body.Len()
+	time.Sleep(20 * time.Millisecond)
+	if got := rec.Body.Len(); got != n {
+		t.Errorf("EventWriter wrote %d bytes after the request's context was done", got-n)
+	}
+}
+
+// Handlers that return with heartbeats armed must not race with the
+// server finishing the response.
+func TestEventWriterHeartbeatHandlerReturns_h1(t *testing.T) {
+	testEventWriterHeartbeatHandlerReturns(t, h1Mode)
+}
+func TestEventWriterHeartbeatHandlerReturns_h2(t *testing.T) {
+	testEventWriterHeartbeatHandlerReturns(t, h2Mode)
+}
+func testEventWriterHeartbeatHandlerReturns(t *testing.T, h2 bool) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, h2, HandlerFunc(func(w ResponseWriter, r *Request) {
+		ew := NewEventWriter(w, r)
+		defer ew.Close()
+		ew.Heartbeat(time.Microsecond)
+		ew.Send(&Event{Data: "x"})
+		time.Sleep(time.Millisecond)
+	}))
+	defer cst.close()
+	for i := 0; i < 20; i++ {
+		res, err := cst.c.Get(cst.ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, res.Body); err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+}
+
+func TestEventWriterNoWriteAfterClose(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	ew := NewEventWriter(rec, req)
+	ew.Heartbeat(time.Microsecond)
+	time.Sleep(time.Millisecond)
+	ew.Close()
+	// Reading the body without synchronization is safe, and reports
+	// a race otherwise, only if no heartbeat follows Close.
+	n := rec.Body.Len()
+	time.Sleep(10 * time.Millisecond)
+	if got := rec.Body.Len(); got != n {
+		t.Errorf("EventWriter wrote %d bytes after Close", got-n)
+	}
+}
@@ -281,6 +281,43 @@ type Transport struct {
 	// To use a custom dialer or TLS config and still attempt HTTP/2
 	// upgrades, set this to true.
 	ForceAttemptHTTP2 bool
+
+	// EnableHTTP3 enables HTTP/3 for https requests to servers which
+	// advertise it with an Alt-Svc header field (RFC 7838) in an earlier
+	// response. The first request to a server is always sent over TCP.
+	// Requests are sent over TCP if the server cannot be reached over
+	// HTTP/3, and HTTP/3 is not used with a proxy or a custom DialTLS
+	// or DialTLSContext function.
+	EnableHTTP3 bool
+
+	// Protocols is the set of protocols supported by the transport.
+	//
+	// If Protocols includes UnencryptedHTTP2 and does not include
+	// HTTP1, the transport uses unencrypted HTTP/2 with prior
+	// knowledge for requests for http:// URLs. Requests sent through
+	// a proxy, and requests that ask for a protocol upgrade, use
+	// HTTP/1 regardless. Unencrypted HTTP/2 is only supported by
+	// the bundled HTTP/2 implementation, which is not used if
+	// TLSNextProto is non-nil.
+	//
+	// If Protocols is non-nil, it overrides ForceAttemptHTTP2: HTTP/2
+	// is configured if Protocols includes HTTP2 or UnencryptedHTTP2,
+	// even if a custom dialer or TLS config is provided.
+	//
+	// If Protocols is nil, the default is HTTP/1, and HTTP/2 if it is
+	// enabled as described for ForceAttemptHTTP2.
+	Protocols *Protocols
+
+	// HTTP2 configures HTTP/2 connections. It is only used by the
+	// bundled HTTP/2 implementation, which is not used if
+	// TLSNextProto is non-nil. If nil, default values are used.
+	HTTP2 *HTTP2Config
+
+	// h2cTransport, if non-nil, sends requests for http:// URLs
+	// with unencrypted HTTP/2. It is set by onceSetNextProtoDefaults.
+	h2cTransport *http2Transport
+
+	h3 http3ClientPool // HTTP/3 connections and alternative services
 }
 
 // A cancelKey is the key of the reqCanceler map.
@@ -326,12 +363,21 @@ func (t *Transport) Clone() *Transport {
 		GetProxyConnectHeader:  t.GetProxyConnectHeader,
 		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
 		ForceAttemptHTTP2:      t.ForceAttemptHTTP2,
+		EnableHTTP3:            t.EnableHTTP3,
 		WriteBufferSize:        t.WriteBufferSize,
 		ReadBufferSize:         t.ReadBufferSize,
 	}
 	if t.TLSClientConfig != nil {
 		t2.TLSClientConfig = t.TLSClientConfig.Clone()
 	}
+	if t.Protocols != nil {
+		p := *t.Protocols
+		t2.Protocols = &p
+	}
+	if t.HTTP2 != nil {
+		c := *t.HTTP2
+		t2.HTTP2 = &c
+	}
 	if !t.tlsNextProtoWasNil {
 		npm := map[string]func(authority string, c *tls.Conn) RoundTripper{}
 		for k, v := range t.TLSNextProto {
@@ -352,6 +398,17 @@ type h2Transport interface {
 	CloseIdleConnections()
 }
 
+// protocols returns the set of protocols supported by the transport.
+func (t *Transport) protocols() Protocols {
+	if t.Protocols != nil {
+		return *t.Protocols
+	}
+	var p Protocols
+	p.SetHTTP1(true)
+	p.SetHTTP2(t.h2transport != nil)
+	return p
+}
+
 func (t *Transport) hasCustomTLSDialer() bool {
 	return t.DialTLS != nil || t.DialTLSContext != nil
 }
@@ -384,7 +441,10 @@ func (t *Transport) onceSetNextProtoDefaults() {
 		// Transport.
 		return
 	}
-	if !t.ForceAttemptHTTP2 && (t.TLSClientConfig != nil || t.Dial != nil || t.DialContext != nil || t.hasCustomTLSDialer()) {
+	if p := t.Protocols; p != nil && !p.HTTP2() && !p.UnencryptedHTTP2() {
+		return
+	}
+	if !t.ForceAttemptHTTP2 && t.Protocols == nil && (t.TLSClientConfig != nil || t.Dial != nil || t.DialContext != nil || t.hasCustomTLSDialer()) {
 		// Be conservative and don't automatically enable
 		// http2 if they've specified a custom TLS config or
 		// custom dialers. Let them opt-in themselves via
@@ -402,6 +462,7 @@ func (t *Transport) onceSetNextProtoDefaults() {
 		return
 	}
 	t.h2transport = t2
+	configureHTTP2Transport(t.HTTP2, t2)
 
 	// Auto-configure the http2.Transport's MaxHeaderListSize from
 	// the http.Transport's MaxResponseHeaderBytes. They don't
@@ -417,6 +478,21 @@ func (t *Transport) onceSetNextProtoDefaults() {
 			t2.MaxHeaderListSize = uint32(limit1)
 		}
 	}
+
+	if p := t.protocols(); p.UnencryptedHTTP2() && !p.HTTP1() {
+		// Unencrypted HTTP/2 uses a separate http2Transport, which
+		// dials connections itself, so that its connection pool
+		// manages them as it does for HTTP/2 over TLS.
+		t.h2cTransport = &http2Transport{
+			t1:                t,
+			AllowHTTP:         true,
+			MaxHeaderListSize: t2.MaxHeaderListSize,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.dial(context.Background(), network, addr)
+			},
+		}
+		configureHTTP2Transport(t.HTTP2, t.h2cTransport)
+	}
 }
 
 // ProxyFromEnvironment returns the URL of the proxy to use for a
@@ -536,8 +612,28 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 	cancelKey := cancelKey{origReq}
 	req = setupRewindBody(req)
 
+	if t.EnableHTTP3 && scheme == "https" {
+		resp, err := t.roundTripHTTP3(req)
+		if err == nil {
+			resp.Request = origReq
+			return resp, nil
+		}
+		var fallback http3FallbackError
+		if err != errHTTP3Unavailable && !errors.As(err, &fallback) {
+			return nil, err
+		}
+		// Send the request over TCP instead.
+		req, err = rewindBody(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if altRT := t.alternateRoundTripper(req); altRT != nil {
 		if resp, err := altRT.RoundTrip(req); err != ErrSkipAltProtocol {
+			if err == nil {
+				t.recordAltSvc(req, resp)
+			}
 			return resp, err
 		}
 		var err error
@@ -575,6 +671,16 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 			return nil, err
 		}
 
+		if t2 := t.h2cTransport; t2 != nil && cm.targetScheme == "http" && cm.proxyURL == nil && !cm.onlyH1 {
+			t.setReqCanceler(cancelKey, nil) // not cancelable with CancelRequest
+			resp, err := t2.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Request = origReq
+			return resp, nil
+		}
+
 		// Get the cached or newly-created connection to either the
 		// host (for http or https), the http proxy, or the http proxy
 		// pre-CONNECTed to https server. In any case, we'll be ready
@@ -595,6 +701,7 @@ func (t *Transport) roundTrip(req *Request) (*Response, error) {
 			resp, err = pconn.roundTrip(treq)
 		}
 		if err == nil {
+			t.recordAltSvc(req, resp)
 			resp.Request = origReq
 			return resp, nil
 		}
@@ -777,6 +884,10 @@ func (t *Transport) CloseIdleConnections() {
 	if t2 := t.h2transport; t2 != nil {
 		t2.CloseIdleConnections()
 	}
+	if t2 := t.h2cTransport; t2 != nil {
+		t2.CloseIdleConnections()
+	}
+	t.h3.closeIdleConnections()
 }
 
 // CancelRequest cancels an in-flight request by closing its connection.
@@ -1521,6 +1632,13 @@ func (pconn *persistConn) addTLS(ctx context.Context, name string, trace *httptr
 	}
 	if pconn.cacheKey.onlyH1 {
 		cfg.NextProtos = nil
+	} else if p := pconn.t.Protocols; p != nil {
+		if !p.HTTP2() {
+			cfg.NextProtos = removeNextProto(cfg.NextProtos, "h2")
+		}
+		if !p.HTTP1() {
+			cfg.NextProtos = removeNextProto(cfg.NextProtos, "http/1.1")
+		}
 	}
 	plainConn := pconn.conn
 	tlsConn := tls.Client(plainConn, cfg)
@@ -5922,6 +5922,9 @@ func TestTransportClone(t *testing.T) {
 		GetProxyConnectHeader:  func(context.Context, *url.URL, string) (Header, error) { return nil, nil },
 		MaxResponseHeaderBytes: 1,
 		ForceAttemptHTTP2:      true,
+		EnableHTTP3:            true,
+		Protocols:              &Protocols{},
+		HTTP2:                  &HTTP2Config{},
 		TLSNextProto: map[string]func(authority string, c *tls.Conn) RoundTripper{
 			"foo": func(authority string, c *tls.Conn) RoundTripper { panic("") },
 		},
@@ -6566,3 +6569,71 @@ func TestHandlerAbortRacesBodyRead(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestTransportHTTP2Config(t *testing.T) {
+	CondSkipHTTP2(t)
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	var p Protocols
+	p.SetUnencryptedHTTP2(true)
+	tr := &Transport{
+		Protocols: &p,
+		HTTP2: &HTTP2Config{
+			MaxDecoderHeaderTableSize: 8192,
+			MaxReadFrameSize:          1 << 20,
+			SendPingTimeout:           50 * time.Millisecond,
+		},
+	}
+	defer tr.CloseIdleConnections()
+	errc := make(chan error, 1)
+	go func() {
+		res, err := (&Client{Transport: tr}).Get("http://" + ln.Addr().String())
+		if err == nil {
+			res.Body.Close()
+		}
+		errc <- err
+	}()
+
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	br := bufio.NewReader(c)
+	preface := make([]byte, len("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+	if _, err := io.ReadFull(br, preface); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readTestFrame(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.typ != testFrameSettings {
+		t.Fatalf("first frame type = %v, want SETTINGS", f.typ)
+	}
+	got := f.settings()
+	for id, want := range map[uint16]uint32{
+		0x1: 8192,    // SETTINGS_HEADER_TABLE_SIZE
+		0x5: 1 << 20, // SETTINGS_MAX_FRAME_SIZE
+	} {
+		if got[id] != want {
+			t.Errorf("setting %#x = %v, want %v", id, got[id], want)
+		}
+	}
+
+	// With no frames from the server, the transport sends
+	// a health check PING.
+	for {
+		f, err := readTestFrame(br)
+		if err != nil {
+			t.Fatalf("transport sent no PING before %v", err)
+		}
+		if f.typ == testFramePing && f.flags&testFlagAck == 0 {
+			break
+		}
+	}
+	c.Close()
+	<-errc
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// DialOptions configures Dial.
+type DialOptions struct {
+	// Client is used to send the handshake request.
+	// If nil, http.DefaultClient is used.
+	//
+	// As when reading a response body, the client's Timeout limits
+	// the lifetime of the whole connection. Use the context passed
+	// to Dial to limit the time taken by the handshake alone.
+	Client *http.Client
+
+	// Header holds additional header fields for the handshake request.
+	Header http.Header
+
+	// Subprotocols lists the application protocols supported by the
+	// client, in order of preference.
+	Subprotocols []string
+
+	// EnableCompression offers the permessage-deflate extension
+	// to the server.
+	EnableCompression bool
+}
+
+// Dial opens a WebSocket connection to the server at the given URL,
+// whose scheme is "ws" or "wss". It also accepts the equivalent
+// "http" and "https" schemes.
+//
+// The context bounds the opening handshake. Once Dial returns,
+// canceling the context has no effect on the connection.
+//
+// If the server replies to the handshake with an HTTP response that
+// does not establish a connection, Dial returns that response along with
+// an error wrapping ErrBadHandshake. The response body is truncated to
+// a short prefix, and need not be closed.
+func Dial(ctx context.Context, urlStr string, opts *DialOptions) (*Conn, *http.Response, error) {
+	if opts == nil {
+		opts = &DialOptions{}
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, nil, fmt.Errorf("websocket: unsupported URL scheme %q", u.Scheme)
+	}
+	u.Fragment = ""
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// The request's context must outlive the handshake.
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+
+	// Capture the connection, to support deadlines.
+	var conn net.Conn
+	reqCtx = httptrace.WithClientTrace(reqCtx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { conn = info.Conn },
+	})
+	req, err := http.NewRequestWithContext(reqCtx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, vv := range opts.Header {
+		req.Header[k] = append([]string(nil), vv...)
+	}
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(b[:])
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(opts.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ", "))
+	}
+	if opts.EnableCompression {
+		req.Header.Set("Sec-WebSocket-Extensions", deflateExtension)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, nil, err
+	}
+	fail := func(msg string) (*Conn, *http.Response, error) {
+		prefix, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(prefix))
+		return nil, resp, fmt.Errorf("%w: %v", ErrBadHandshake, msg)
+	}
+	if !stop() {
+		// The context was canceled after the response arrived.
+		resp.Body.Close()
+		return nil, nil, ctx.Err()
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fail("unexpected response status " + resp.Status)
+	}
+	if !httpguts.HeaderValuesContainsToken(resp.Header["Upgrade"], "websocket") ||
+		!httpguts.HeaderValuesContainsToken(resp.Header["Connection"], "upgrade") {
+		return fail("response does not upgrade to WebSocket")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return fail("mismatched 'Sec-WebSocket-Accept'")
+	}
+	if conn == nil {
+		return fail("response was not received over a network connection")
+	}
+	// The response body holds any data read past the response.
+	t := &netTransport{r: resp.Body, conn: conn}
+
+	subprotocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	if subprotocol != "" && !contains(opts.Subprotocols, subprotocol) {
+		t.Close()
+		return nil, resp, fmt.Errorf("%w: server selected unoffered subprotocol %q", ErrBadHandshake, subprotocol)
+	}
+	exts, valid := parseExtensions(resp.Header)
+	p, accepted, compress := checkDeflateResponse(exts)
+	if !valid || !accepted || compress && !opts.EnableCompression {
+		t.Close()
+		return nil, resp, fmt.Errorf("%w: server selected unsupported extensions", ErrBadHandshake)
+	}
+	var deflate *deflateParams
+	if compress {
+		deflate = &p
+	}
+	return newConn(t, nil, false, subprotocol, deflate), resp, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// The permessage-deflate extension compresses the payload of each message
+// with DEFLATE. See RFC 7692.
+const deflateExtension = "permessage-deflate"
+
+// deflateTail is removed from the end of each compressed message,
+// and restored before decompressing it. See RFC 7692, Section 7.2.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// deflateFinal follows a restored deflateTail, to make the decompressor
+// see the end of the stream: it is an empty final stored block.
+var deflateFinal = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+// maxWindow is the size of the sliding window used by compress/flate.
+const maxWindow = 1 << 15
+
+// deflateParams are the negotiated parameters of permessage-deflate.
+type deflateParams struct {
+	serverNoContextTakeover bool
+	clientNoContextTakeover bool
+}
+
+// An extension is one element of a Sec-WebSocket-Extensions header field.
+type extension struct {
+	name   string
+	params []extensionParam
+}
+
+type extensionParam struct {
+	name, value string
+	hasValue    bool
+}
+
+// parseExtensions parses the Sec-WebSocket-Extensions header fields in h.
+// See RFC 6455, Section 9.1. It reports false if a field is malformed.
+func parseExtensions(h http.Header) ([]extension, bool) {
+	var exts []extension
+	for _, v := range h.Values("Sec-WebSocket-Extensions") {
+		for _, elem := range splitQuoted(v, ',') {
+			parts := splitQuoted(elem, ';')
+			ext := extension{name: textproto.TrimString(parts[0])}
+			if !isToken(ext.name) {
+				return nil, false
+			}
+			for _, p := range parts[1:] {
+				name, value, hasValue := strings.Cut(p, "=")
+				param := extensionParam{
+					name:     textproto.TrimString(name),
+					value:    textproto.TrimString(value),
+					hasValue: hasValue,
+				}
+				if len(param.value) >= 2 && param.value[0] == '"' && param.value[len(param.value)-1] == '"' {
+					param.value = param.value[1 : len(param.value)-1]
+				}
+				if !isToken(param.name) || hasValue && !isToken(param.value) {
+					return nil, false
+				}
+				ext.params = append(ext.params, param)
+			}
+			exts = append(exts, ext)
+		}
+	}
+	return exts, true
+}
+
+// splitQuoted splits s around each instance of sep that is not inside
+// a quoted string.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && quoted:
+			i++
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptDeflate chooses the first permessage-deflate offer in exts
+// that the server can accept, and returns its parameters and the
+// extension to send in response.
+func acceptDeflate(exts []extension) (p deflateParams, resp string, ok bool) {
+offers:
+	for _, ext := range exts {
+		if ext.name != deflateExtension {
+			continue
+		}
+		var seen []string
+		p = deflateParams{}
+		for _, param := range ext.params {
+			for _, name := range seen {
+				if name == param.name {
+					continue offers
+				}
+			}
+			seen = append(seen, param.name)
+			switch param.name {
+			case "server_no_context_takeover":
+				if param.hasValue {
+					continue offers
+				}
+				p.serverNoContextTakeover = true
+			case "client_no_context_takeover":
+				if param.hasValue {
+					continue offers
+				}
+				p.clientNoContextTakeover = true
+			case "server_max_window_bits":
+				// compress/flate always uses a 32KB window,
+				// so the server cannot honor a smaller one.
+				if bits, ok := windowBits(param); !ok || bits != 15 {
+					continue offers
+				}
+			case "client_max_window_bits":
+				// The client may use any window size, and the
+				// server accepts anything it uses.
+				if param.hasValue {
+					if _, ok := windowBits(param); !ok {
+						continue offers
+					}
+				}
+			default:
+				continue offers
+			}
+		}
+		resp = deflateExtension
+		if p.serverNoContextTakeover {
+			resp += "; server_no_context_takeover"
+		}
+		if p.clientNoContextTakeover {
+			resp += "; client_no_context_takeover"
+		}
+		return p, resp, true
+	}
+	return deflateParams{}, "", false
+}
+
+// checkDeflateResponse checks the extensions accepted by a server
+// in response to a client offering permessage-deflate without parameters.
+func checkDeflateResponse(exts []extension) (p deflateParams, ok, compress bool) {
+	for _, ext := range exts {
+		if ext.name != deflateExtension || compress {
+			return p, false, false
+		}
+		compress = true
+		var seen []string
+		for _, param := range ext.params {
+			for _, name := range seen {
+				if name == param.name {
+					return p, false, false
+				}
+			}
+			seen = append(seen, param.name)
+			switch param.name {
+			case "server_no_context_takeover":
+				p.serverNoContextTakeover = true
+			case "client_no_context_takeover":
+				p.clientNoContextTakeover = true
+			case "server_max_window_bits":
+				// Any window the server uses fits in ours.
+				if _, ok := windowBits(param); !ok {
+					return p, false, false
+				}
+			default:
+				// The client did not offer client_max_window_bits,
+				// so the server may not send it.
+				return p, false, false
+			}
+			if param.name != "server_max_window_bits" && param.hasValue {
+				return p, false, false
+			}
+		}
+	}
+	return p, true, compress
+}
+
+func windowBits(param extensionParam) (int, bool) {
+	if !param.hasValue {
+		return 0, false
+	}
+	bits, err := strconv.Atoi(param.value)
+	if err != nil || bits < 8 || bits > 15 || param.value[0] == '0' {
+		return 0, false
+	}
+	return bits, true
+}
+
+// A compressor compresses outgoing messages.
+type compressor struct {
+	fw        *flate.Writer
+	tw        truncWriter
+	noContext bool // reset the compressor after each message
+}
+
+func newCompressor(noContext bool) *compressor {
+	c := &compressor{noContext: noContext}
+	c.fw, _ = flate.NewWriter(&c.tw, flate.BestSpeed)
+	return c
+}
+
+// finish completes the current message, writing its remaining
+// compressed data to the underlying writer.
+func (c *compressor) finish() error {
+	if err := c.fw.Flush(); err != nil {
+		return err
+	}
+	if !bytes.Equal(c.tw.tail[:c.tw.n], deflateTail) {
+		panic("websocket: unexpected deflate flush output")
+	}
+	c.tw.n = 0
+	if c.noContext {
+		c.fw.Reset(&c.tw)
+	}
+	return nil
+}
+
+// A truncWriter writes all but the last four bytes written to it,
+// which a flush of the compressor sets to deflateTail.
+type truncWriter struct {
+	w    io.Writer
+	tail [4]byte
+	n    int
+}
+
+func (t *truncWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if t.n+len(p) <= len(t.tail) {
+		t.n += copy(t.tail[t.n:], p)
+		return n, nil
+	}
+	if len(p) >= len(t.tail) {
+		if _, err := t.w.Write(t.tail[:t.n]); err != nil {
+			return 0, err
+		}
+		if _, err := t.w.Write(p[:len(p)-len(t.tail)]); err != nil {
+			return 0, err
+		}
+		t.n = copy(t.tail[:], p[len(p)-len(t.tail):])
+		return n, nil
+	}
+	// Some of the held bytes are no longer among the last four.
+	over := t.n + len(p) - len(t.tail)
+	if _, err := t.w.Write(t.tail[:over]); err != nil {
+		return 0, err
+	}
+	copy(t.tail[:], t.tail[over:t.n])
+	copy(t.tail[t.n-over:], p)
+	t.n = len(t.tail)
+	return n, nil
+}
+
+// A decompressor decompresses incoming messages.
+type decompressor struct {
+	fr        io.ReadCloser
+	window    []byte // recent output, for context takeover
+	noContext bool   // the peer resets its compressor after each message
+}
+
+// reset prepares d to decompress a message read from r.
+func (d *decompressor) reset(r io.Reader) io.Reader {
+	src := io.MultiReader(r, bytes.NewReader(deflateTail), bytes.NewReader(deflateFinal))
+	var dict []byte
+	if !d.noContext {
+		dict = d.window
+	}
+	if d.fr == nil {
+		d.fr = flate.NewReaderDict(src, dict)
+	} else {
+		d.fr.(flate.Resetter).Reset(src, dict)
+	}
+	return d.fr
+}
+
+// record notes decompressed output p, which later messages may refer to.
+func (d *decompressor) record(p []byte) {
+	if d.noContext {
+		return
+	}
+	if len(p) >= maxWindow {
+		d.window = append(d.window[:0], p[len(p)-maxWindow:]...)
+		return
+	}
+	if keep := maxWindow - len(p); len(d.window) > keep {
+		d.window = append(d.window[:0], d.window[len(d.window)-keep:]...)
+	}
+	d.window = append(d.window, p...)
+}
@@ -0,0 +1,750 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultReadLimit is the default maximum size of a message read.
+	defaultReadLimit = 32 << 20
+
+	// writeFrameSize is the payload size at which a message
+	// being written is sent as a frame.
+	writeFrameSize = 16 << 10
+
+	// closeTimeout is how long Close waits for the peer
+	// to respond to a Close frame.
+	closeTimeout = 5 * time.Second
+)
+
+// A transport carries frames between the endpoints of a Conn.
+type transport interface {
+	io.Reader
+
+	// Write writes b and sends it to the peer without buffering.
+	Write(b []byte) (int, error)
+
+	Close() error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// A Conn is a WebSocket connection.
+//
+// A Conn supports one concurrent reader and one concurrent writer of
+// messages. Ping, Close, and the deadline and limit setters may be
+// called concurrently with all other methods.
+type Conn struct {
+	t           transport
+	br          *bufio.Reader
+	isServer    bool
+	subprotocol string
+	closeOnce   sync.Once
+	closed      chan struct{} // closed when the transport is closed
+
+	// Reading, guarded by readMu.
+	readMu     sync.Mutex
+	readErr    error       // sticky
+	frame      frameHeader // the last data frame header read
+	frameLeft  int64       // unread payload of the current data frame
+	maskPos    int
+	reader     *messageReader // the current message reader, if any
+	decomp     *decompressor  // non-nil if compression is in use
+	controlBuf [maxControlPayload]byte
+
+	// Writing. msgMu is held while a message is being written,
+	// and writeMu while a frame is being written.
+	msgMu    chan struct{} // 1-element semaphore
+	writeMu  sync.Mutex
+	writeErr error // sticky; guarded by writeMu
+	writeBuf []byte
+	comp     *compressor // non-nil if compression is in use
+
+	mu         sync.Mutex
+	closeSent  bool
+	closeRecvd chan struct{} // closed when a Close frame is received
+	pings      map[uint64]chan struct{}
+	nextPingID uint64
+	readLimit  int64
+}
+
+// newConn returns a Conn using t.
+// If br is non-nil, it is used to read buffered data from t.
+func newConn(t transport, br *bufio.Reader, isServer bool, subprotocol string, deflate *deflateParams) *Conn {
+	if br == nil {
+		br = bufio.NewReader(t)
+	}
+	c := &Conn{
+		t:           t,
+		br:          br,
+		isServer:    isServer,
+		subprotocol: subprotocol,
+		closed:      make(chan struct{}),
+		closeRecvd:  make(chan struct{}),
+		msgMu:       make(chan struct{}, 1),
+		pings:       make(map[uint64]chan struct{}),
+		readLimit:   defaultReadLimit,
+	}
+	c.frame.fin = true // no message is being read
+	if deflate != nil {
+		sendNoContext, recvNoContext := deflate.clientNoContextTakeover, deflate.serverNoContextTakeover
+		if isServer {
+			sendNoContext, recvNoContext = recvNoContext, sendNoContext
+		}
+		c.comp = newCompressor(sendNoContext)
+		c.decomp = &decompressor{noContext: recvNoContext}
+	}
+	return c
+}
+
+// Subprotocol returns the application protocol negotiated during the
+// handshake, or "" if none was.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// SetReadLimit sets the maximum size in bytes of a message read from the
+// peer. If a message exceeds the limit, the connection is closed with
+// StatusMessageTooBig and reads return ErrReadLimit.
+// The default limit is 32 MiB; a limit of zero or less means no limit.
+func (c *Conn) SetReadLimit(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readLimit = n
+}
+
+func (c *Conn) limit() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readLimit
+}
+
+// SetReadDeadline sets the deadline for future reads from the peer.
+// After a read times out, the Conn is unusable.
+// A zero value for t means reads will not time out.
+// It returns an error if the underlying connection does not support
+// deadlines.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.t.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future writes to the peer.
+// After a write times out, the Conn is unusable.
+// A zero value for t means writes will not time out.
+// It returns an error if the underlying connection does not support
+// deadlines.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.t.SetWriteDeadline(t)
+}
+
+// NextReader returns the type of the next data message received from the
+// peer and a reader for its payload. The reader is valid until the next
+// call to NextReader; any unread data is then discarded.
+//
+// Control frames received while waiting for or reading a message are
+// processed automatically: pings are answered, and a Close frame causes
+// reads to return a *CloseError after the closing handshake completes.
+func (c *Conn) NextReader() (MessageType, io.Reader, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if r := c.reader; r != nil {
+		// Discard the rest of the previous message. A compressed
+		// message is decompressed, since later messages may refer
+		// to its contents.
+		var buf [512]byte
+		for r.err == nil && !r.done {
+			r.read(buf[:])
+		}
+		r.done = true
+		c.reader = nil
+	}
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	if !c.nextDataFrame(true) {
+		return 0, nil, c.readErr
+	}
+	typ := MessageType(c.frame.op)
+	r := &messageReader{
+		c:     c,
+		text:  typ == TextMessage,
+		limit: c.limit(),
+	}
+	r.r = payloadReader{c}
+	if c.frame.rsv1 {
+		r.r = c.decomp.reset(r.r)
+		r.decomp = c.decomp
+	}
+	c.reader = r
+	return typ, r, nil
+}
+
+// ReadMessage reads the next data message received from the peer.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	typ, r, err := c.NextReader()
+	if err != nil {
+		return 0, nil, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return typ, b, nil
+}
+
+// nextDataFrame reads frames until the start of a data frame, processing
+// control frames. If first is set, the frame must begin a message;
+// otherwise it must continue one. It reports whether it found a frame.
+// It requires readMu.
+func (c *Conn) nextDataFrame(first bool) bool {
+	for c.readErr == nil {
+		h, err := readFrameHeader(c.br)
+		if err != nil {
+			// The connection ends with a Close frame, not EOF.
+			c.fail(unexpectedEOF(err))
+			return false
+		}
+		if h.masked != c.isServer {
+			c.fail(&protocolError{StatusProtocolError, "incorrectly masked frame"})
+			return false
+		}
+		if h.rsv1 && (c.decomp == nil || h.op != opText && h.op != opBinary) {
+			c.fail(&protocolError{StatusProtocolError, "reserved bit set in frame"})
+			return false
+		}
+		if h.op.isControl() {
+			c.handleControl(h)
+			continue
+		}
+		if (h.op == opContinuation) == first {
+			if first {
+				c.fail(&protocolError{StatusProtocolError, "continuation frame without a message"})
+			} else {
+				c.fail(&protocolError{StatusProtocolError, "new message before the end of the last"})
+			}
+			return false
+		}
+		c.frame = h
+		c.frameLeft = h.length
+		c.maskPos = 0
+		return true
+	}
+	return false
+}
+
+// handleControl processes a control frame.
+// It requires readMu.
+func (c *Conn) handleControl(h frameHeader) {
+	payload := c.controlBuf[:h.length]
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.fail(unexpectedEOF(err))
+		return
+	}
+	if h.masked {
+		maskBytes(h.mask, 0, payload)
+	}
+	switch h.op {
+	case opPing:
+		c.writeControl(opPong, payload)
+	case opPong:
+		if len(payload) == 8 {
+			id := binary.BigEndian.Uint64(payload)
+			c.mu.Lock()
+			if ch, ok := c.pings[id]; ok {
+				close(ch)
+				delete(c.pings, id)
+			}
+			c.mu.Unlock()
+		}
+	case opClose:
+		ce := &CloseError{Code: StatusNoStatusReceived}
+		switch {
+		case len(payload) == 1:
+			c.fail(&protocolError{StatusProtocolError, "invalid close frame"})
+			return
+		case len(payload) >= 2:
+			ce.Code = StatusCode(binary.BigEndian.Uint16(payload))
+			ce.Reason = string(payload[2:])
+			if !ce.Code.validWire() {
+				c.fail(&protocolError{StatusProtocolError, "invalid close status code"})
+				return
+			}
+			if !utf8.ValidString(ce.Reason) {
+				c.fail(&protocolError{StatusInvalidFramePayloadData, "invalid UTF-8 in close reason"})
+				return
+			}
+		}
+		c.readErr = ce
+		close(c.closeRecvd)
+		// Echo the status code to complete the closing handshake.
+		// See RFC 6455, Section 5.5.1.
+		code := ce.Code
+		if code == StatusNoStatusReceived {
+			code = 0
+		}
+		c.sendClose(code, "")
+		c.closeTransport()
+	}
+}
+
+// fail records err as the read error and, if it is a protocol error,
+// fails the connection with the appropriate status code.
+// It requires readMu.
+func (c *Conn) fail(err error) {
+	if c.readErr != nil {
+		return
+	}
+	c.readErr = err
+	var pe *protocolError
+	switch {
+	case errors.As(err, &pe):
+		c.sendClose(pe.code, "")
+	case err == ErrReadLimit:
+		c.sendClose(StatusMessageTooBig, "")
+	default:
+		select {
+		case <-c.closed:
+			// Reads fail after the connection is closed locally.
+			c.readErr = ErrClosed
+		default:
+		}
+	}
+	c.closeTransport()
+}
+
+// A payloadReader reads the payload of the current message, crossing frame
+// boundaries and processing interleaved control frames.
+type payloadReader struct {
+	c *Conn
+}
+
+func (pr payloadReader) Read(p []byte) (int, error) {
+	c := pr.c
+	for c.frameLeft == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if c.frame.fin {
+			return 0, io.EOF
+		}
+		if !c.nextDataFrame(false) {
+			return 0, c.readErr
+		}
+	}
+	if int64(len(p)) > c.frameLeft {
+		p = p[:c.frameLeft]
+	}
+	n, err := c.br.Read(p)
+	c.frameLeft -= int64(n)
+	if c.frame.masked {
+		c.maskPos = maskBytes(c.frame.mask, c.maskPos, p[:n])
+	}
+	if err != nil {
+		c.fail(unexpectedEOF(err))
+		if n == 0 {
+			return 0, c.readErr
+		}
+	}
+	return n, nil
+}
+
+// A messageReader reads a message returned by NextReader.
+type messageReader struct {
+	c      *Conn
+	r      io.Reader
+	decomp *decompressor // non-nil if the message is compressed
+	text   bool
+	limit  int64
+	n      int64 // bytes read so far
+	utf8   [utf8.UTFMax]byte
+	nutf8  int // incomplete UTF-8 sequence at the end of the last read
+	done   bool
+	err    error
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	r.c.readMu.Lock()
+	defer r.c.readMu.Unlock()
+	return r.read(p)
+}
+
+// read reads from the message. It requires readMu.
+func (r *messageReader) read(p []byte) (int, error) {
+	c := r.c
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.done {
+		return 0, io.EOF
+	}
+	n, err := r.r.Read(p)
+	if r.decomp != nil && err != nil && err != io.EOF && c.readErr == nil {
+		// A decompression error.
+		c.fail(&protocolError{StatusInvalidFramePayloadData, "invalid compressed data"})
+		err = c.readErr
+	}
+	if r.decomp != nil {
+		r.decomp.record(p[:n])
+	}
+	r.n += int64(n)
+	if r.limit > 0 && r.n > r.limit {
+		c.fail(ErrReadLimit)
+		r.err = ErrReadLimit
+		return 0, r.err
+	}
+	if r.text && !r.validUTF8(p[:n], err == io.EOF) {
+		c.fail(&protocolError{StatusInvalidFramePayloadData, "invalid UTF-8 in text message"})
+		r.err = c.readErr
+		return 0, r.err
+	}
+	if err == io.EOF {
+		r.done = true
+		if c.reader == r {
+			c.reader = nil
+		}
+	} else if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// validUTF8 reports whether p, following the data previously read,
+// is valid UTF-8 so far. If eof is set, p ends the message.
+func (r *messageReader) validUTF8(p []byte, eof bool) bool {
+	if r.nutf8 > 0 {
+		// Complete the sequence left over from the last read.
+		for len(p) > 0 && r.nutf8 < len(r.utf8) && !utf8.FullRune(r.utf8[:r.nutf8]) {
+			r.utf8[r.nutf8] = p[0]
+			r.nutf8++
+			p = p[1:]
+		}
+		if !utf8.FullRune(r.utf8[:r.nutf8]) {
+			return !eof
+		}
+		if !utf8.Valid(r.utf8[:r.nutf8]) {
+			return false
+		}
+		r.nutf8 = 0
+	}
+	// Hold back an incomplete sequence at the end of p.
+	i := len(p)
+	for j := len(p) - 1; j >= 0 && j >= len(p)-utf8.UTFMax; j-- {
+		if utf8.RuneStart(p[j]) {
+			if !utf8.FullRune(p[j:]) {
+				i = j
+			}
+			break
+		}
+	}
+	if !utf8.Valid(p[:i]) {
+		return false
+	}
+	r.nutf8 = copy(r.utf8[:], p[i:])
+	return !eof || r.nutf8 == 0
+}
+
+// NextWriter returns a writer for a new data message of type typ.
+// The message is sent when the writer is closed, and fragmented into
+// multiple frames if it is large. Only one message may be written at a
+// time: NextWriter waits until the writer of the previous message is
+// closed.
+func (c *Conn) NextWriter(typ MessageType) (io.WriteCloser, error) {
+	if typ != TextMessage && typ != BinaryMessage {
+		return nil, errors.New("websocket: invalid message type")
+	}
+	select {
+	case c.msgMu <- struct{}{}:
+	case <-c.closed:
+		return nil, ErrClosed
+	}
+	w := &messageWriter{
+		c:  c,
+		op: opcode(typ),
+	}
+	if c.comp != nil {
+		w.compress = true
+		c.comp.tw.w = payloadWriter{w}
+	}
+	return w, nil
+}
+
+// WriteMessage writes a data message of type typ.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	w, err := c.NextWriter(typ)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// A messageWriter writes a message returned by NextWriter.
+type messageWriter struct {
+	c        *Conn
+	op       opcode // of the next frame
+	compress bool
+	buf      []byte // payload not yet sent
+	closed   bool
+	err      error
+}
+
+// A payloadWriter adds compressed data to a message.
+type payloadWriter struct {
+	w *messageWriter
+}
+
+func (pw payloadWriter) Write(p []byte) (int, error) {
+	return pw.w.writePayload(p)
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("websocket: write to closed message writer")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.compress {
+		n, err := w.c.comp.fw.Write(p)
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		return n, err
+	}
+	return w.writePayload(p)
+}
+
+func (w *messageWriter) writePayload(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := writeFrameSize - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		if len(w.buf) == writeFrameSize {
+			if err := w.flushFrame(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flushFrame sends the buffered payload as a frame.
+func (w *messageWriter) flushFrame(fin bool) error {
+	h := frameHeader{
+		fin:  fin,
+		op:   w.op,
+		rsv1: w.compress && w.op != opContinuation,
+	}
+	w.op = opContinuation
+	err := w.c.writeFrame(h, w.buf)
+	w.buf = w.buf[:0]
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// Close sends the end of the message.
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer func() { <-w.c.msgMu }()
+	if w.err != nil {
+		return w.err
+	}
+	if w.compress {
+		if err := w.c.comp.finish(); err != nil {
+			return err
+		}
+	}
+	return w.flushFrame(true)
+}
+
+// writeFrame sends a frame with the given header and payload.
+// It modifies payload if the frame is masked.
+func (c *Conn) writeFrame(h frameHeader, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	h.length = int64(len(payload))
+	if !c.isServer {
+		// Clients mask every frame with a fresh random key.
+		// See RFC 6455, Section 5.3.
+		h.masked = true
+		if _, err := io.ReadFull(rand.Reader, h.mask[:]); err != nil {
+			return err
+		}
+	}
+	b := appendFrameHeader(c.writeBuf[:0], h)
+	start := len(b)
+	b = append(b, payload...)
+	if h.masked {
+		maskBytes(h.mask, 0, b[start:])
+	}
+	c.writeBuf = b
+	if _, err := c.t.Write(b); err != nil {
+		select {
+		case <-c.closed:
+			err = ErrClosed
+		default:
+		}
+		c.writeErr = err
+		return err
+	}
+	if h.op == opClose {
+		c.writeErr = ErrClosed
+	}
+	return nil
+}
+
+// writeControl sends a control frame.
+func (c *Conn) writeControl(op opcode, payload []byte) error {
+	var buf [maxControlPayload]byte
+	n := copy(buf[:], payload)
+	return c.writeFrame(frameHeader{fin: true, op: op}, buf[:n])
+}
+
+// sendClose sends a Close frame, unless one has already been sent.
+// A code of 0 sends a frame without a status code.
+func (c *Conn) sendClose(code StatusCode, reason string) error {
+	c.mu.Lock()
+	sent := c.closeSent
+	c.closeSent = true
+	c.mu.Unlock()
+	if sent {
+		return nil
+	}
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+	}
+	return c.writeControl(opClose, payload)
+}
+
+// Ping sends a Ping frame and waits for the peer to respond with a Pong.
+// Pongs are processed by reads, so another goroutine must be reading
+// from the Conn for Ping to return.
+func (c *Conn) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	id := c.nextPingID
+	c.nextPingID++
+	pong := make(chan struct{})
+	c.pings[id] = pong
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pings, id)
+		c.mu.Unlock()
+	}()
+
+	var payload [8]byte
+	binary.BigEndian.PutUint64(payload[:], id)
+	if err := c.writeControl(opPing, payload[:]); err != nil {
+		return err
+	}
+	select {
+	case <-pong:
+		return nil
+	case <-c.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close performs the closing handshake with StatusNormalClosure
+// and closes the connection.
+func (c *Conn) Close() error {
+	return c.CloseWithStatus(StatusNormalClosure, "")
+}
+
+// CloseWithStatus performs the closing handshake with the given status
+// code and reason, which must be at most 123 bytes long.
+//
+// It sends a Close frame and waits for the peer's Close frame in response,
+// discarding any data messages received meanwhile, before closing the
+// underlying connection. If the peer does not respond within a few
+// seconds, the connection is closed anyway.
+func (c *Conn) CloseWithStatus(code StatusCode, reason string) error {
+	if !code.validWire() {
+		return errors.New("websocket: invalid close status code")
+	}
+	if len(reason) > maxControlPayload-2 {
+		return errors.New("websocket: close reason too long")
+	}
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	c.mu.Lock()
+	sent := c.closeSent
+	c.mu.Unlock()
+	if sent {
+		// The peer has started the closing handshake, or the
+		// connection has failed.
+		c.closeTransport()
+		return nil
+	}
+	err := c.sendClose(code, reason)
+	if err != nil {
+		c.closeTransport()
+		return err
+	}
+
+	timer := time.AfterFunc(closeTimeout, c.closeTransport)
+	defer timer.Stop()
+	if c.readMu.TryLock() {
+		// No one is reading: read until the peer's Close frame.
+		for c.readErr == nil {
+			if c.frameLeft > 0 {
+				if _, err := io.CopyN(io.Discard, payloadReader{c}, c.frameLeft); err != nil {
+					c.fail(err)
+				}
+				continue
+			}
+			c.nextDataFrame(c.frame.fin)
+		}
+		c.reader = nil
+		c.readMu.Unlock()
+	} else {
+		select {
+		case <-c.closeRecvd:
+		case <-c.closed:
+		}
+	}
+	c.closeTransport()
+	return nil
+}
+
+// closeTransport closes the underlying connection.
+func (c *Conn) closeTransport() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.t.Close()
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/websocket"
+	"strings"
+)
+
+func Example() {
+	// An echo server.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			typ, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(typ, msg); err != nil {
+				return
+			}
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	c, _, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		log.Fatal(err)
+	}
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s\n", msg)
+	// Output: hello
+}
+
+func ExampleAccept_subprotocols() {
+	http.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:      []string{"chat.v2", "chat.v1"},
+			EnableCompression: true,
+		})
+		if err != nil {
+			// Accept has already replied to the request.
+			log.Print(err)
+			return
+		}
+		defer c.Close()
+		switch c.Subprotocol() {
+		case "chat.v2", "chat.v1":
+			// ...
+		default:
+			c.CloseWithStatus(websocket.StatusPolicyViolation, "unsupported subprotocol")
+		}
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// An opcode is the type of a frame. See RFC 6455, Section 5.2.
+type opcode byte
+
+const (
+	opContinuation opcode = 0x0
+	opText         opcode = 0x1
+	opBinary       opcode = 0x2
+	opClose        opcode = 0x8
+	opPing         opcode = 0x9
+	opPong         opcode = 0xa
+)
+
+func (op opcode) isControl() bool { return op&0x8 != 0 }
+
+const (
+	finalBit = 1 << 7
+	rsv1Bit  = 1 << 6 // set on compressed messages; see RFC 7692
+	rsv2Bit  = 1 << 5
+	rsv3Bit  = 1 << 4
+	maskBit  = 1 << 7
+
+	maxControlPayload = 125
+	maxFrameHeaderLen = 2 + 8 + 4
+)
+
+// A frameHeader is the decoded header of a frame.
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	op     opcode
+	masked bool
+	mask   [4]byte
+	length int64
+}
+
+// readFrameHeader reads a frame header from r, checking the frame
+// against the rules that do not depend on connection state.
+func readFrameHeader(r io.Reader) (frameHeader, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return frameHeader{}, err
+	}
+	h := frameHeader{
+		fin:    b[0]&finalBit != 0,
+		rsv1:   b[0]&rsv1Bit != 0,
+		op:     opcode(b[0] & 0xf),
+		masked: b[1]&maskBit != 0,
+		length: int64(b[1] &^ maskBit),
+	}
+	if b[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return h, &protocolError{StatusProtocolError, "reserved bits set in frame"}
+	}
+	switch h.op {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		// Control frames are not fragmented, and carry short payloads.
+		// See RFC 6455, Section 5.5.
+		if !h.fin {
+			return h, &protocolError{StatusProtocolError, "fragmented control frame"}
+		}
+		if h.length > maxControlPayload {
+			return h, &protocolError{StatusProtocolError, "control frame payload too large"}
+		}
+	default:
+		return h, &protocolError{StatusProtocolError, "unknown opcode"}
+	}
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(r, b[:8]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		n := binary.BigEndian.Uint64(b[:8])
+		if n>>63 != 0 {
+			return h, &protocolError{StatusProtocolError, "invalid frame length"}
+		}
+		h.length = int64(n)
+	}
+	if h.masked {
+		if _, err := io.ReadFull(r, h.mask[:]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+	}
+	return h, nil
+}
+
+// appendFrameHeader appends the encoding of h to b.
+func appendFrameHeader(b []byte, h frameHeader) []byte {
+	b0 := byte(h.op)
+	if h.fin {
+		b0 |= finalBit
+	}
+	if h.rsv1 {
+		b0 |= rsv1Bit
+	}
+	var b1 byte
+	if h.masked {
+		b1 |= maskBit
+	}
+	switch {
+	case h.length <= 125:
+		b = append(b, b0, b1|byte(h.length))
+	case h.length <= 0xffff:
+		b = append(b, b0, b1|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(h.length))
+	default:
+		b = append(b, b0, b1|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(h.length))
+	}
+	if h.masked {
+		b = append(b, h.mask[:]...)
+	}
+	return b
+}
+
+// maskBytes applies the masking key to b, starting at position pos
+// of the key, and returns the position following b.
+// Masking and unmasking are the same operation. See RFC 6455, Section 5.3.
+func maskBytes(key [4]byte, pos int, b []byte) int {
+	for i := range b {
+		b[i] ^= key[pos&3]
+		pos++
+	}
+	return pos & 3
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,297 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrameHeaderRoundTrip(t *testing.T) {
+	for _, h := range []frameHeader{
+		{fin: true, op: opText, length: 0},
+		{fin: true, op: opBinary, length: 125},
+		{fin: false, rsv1: true, op: opText, length: 126},
+		{fin: true, op: opContinuation, length: 0xffff},
+		{fin: true, op: opBinary, length: 0x10000},
+		{fin: true, op: opBinary, length: 1 << 40},
+		{fin: true, op: opPing, masked: true, mask: [4]byte{1, 2, 3, 4}, length: 125},
+		{fin: true, op: opClose, masked: true, mask: [4]byte{0xff, 0, 0xff, 0}, length: 2},
+	} {
+		b := appendFrameHeader(nil, h)
+		if len(b) > maxFrameHeaderLen {
+			t.Errorf("%+v: encoded in %v bytes, more than %v", h, len(b), maxFrameHeaderLen)
+		}
+		got, err := readFrameHeader(bytes.NewReader(b))
+		if err != nil {
+			t.Errorf("%+v: readFrameHeader(%x): %v", h, b, err)
+			continue
+		}
+		if got != h {
+			t.Errorf("readFrameHeader(appendFrameHeader(%+v)) = %+v", h, got)
+		}
+	}
+}
+
+func TestReadFrameHeaderErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"empty", nil, io.EOF},
+		{"short", []byte{0x81}, io.ErrUnexpectedEOF},
+		{"short length", []byte{0x82, 126, 0}, io.ErrUnexpectedEOF},
+		{"short mask", []byte{0x82, 0x81, 1, 2}, io.ErrUnexpectedEOF},
+		{"rsv2", []byte{0xa1, 0}, nil},
+		{"rsv3", []byte{0x91, 0}, nil},
+		{"unknown opcode", []byte{0x83, 0}, nil},
+		{"fragmented ping", []byte{0x09, 0}, nil},
+		{"long close", []byte{0x88, 126, 0, 126}, nil},
+		{"negative length", []byte{0x82, 127, 0x80, 0, 0, 0, 0, 0, 0, 0}, nil},
+	} {
+		_, err := readFrameHeader(bytes.NewReader(test.b))
+		if test.err != nil {
+			if err != test.err {
+				t.Errorf("%v: got error %v, want %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if pe, ok := err.(*protocolError); !ok || pe.code != StatusProtocolError {
+			t.Errorf("%v: got error %v, want protocol error", test.name, err)
+		}
+	}
+}
+
+func TestMaskBytes(t *testing.T) {
+	key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	// The example from RFC 6455, Section 5.7.
+	masked := []byte{0x7f, 0x9f, 0x4d, 0x51, 0x58}
+	b := append([]byte(nil), masked...)
+	if pos := maskBytes(key, 0, b[:2]); pos != 2 {
+		t.Fatalf("maskBytes returned position %v, want 2", pos)
+	}
+	maskBytes(key, 2, b[2:])
+	if string(b) != "Hello" {
+		t.Errorf("unmasked %x to %q, want %q", masked, b, "Hello")
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example from RFC 6455, Section 1.3.
+	const key, want = "dGhlIHNhbXBsZSBub25jZQ==", "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got := acceptKey(key); got != want {
+		t.Errorf("acceptKey(%q) = %q, want %q", key, got, want)
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	for _, test := range []struct {
+		in   []string
+		want []extension
+		ok   bool
+	}{{
+		in: []string{"permessage-deflate"},
+		want: []extension{
+			{name: "permessage-deflate"},
+		},
+		ok: true,
+	}, {
+		in: []string{`permessage-deflate; client_max_window_bits; server_max_window_bits="10", foo`, "bar"},
+		want: []extension{
+			{name: "permessage-deflate", params: []extensionParam{
+				{name: "client_max_window_bits"},
+				{name: "server_max_window_bits", value: "10", hasValue: true},
+			}},
+			{name: "foo"},
+			{name: "bar"},
+		},
+		ok: true,
+	}, {
+		in: []string{"permessage-deflate; a=b=c"},
+	}, {
+		in: []string{"; x"},
+	}, {
+		in: []string{"ext; =1"},
+	}} {
+		h := http.Header{"Sec-Websocket-Extensions": test.in}
+		got, ok := parseExtensions(h)
+		if ok != test.ok || ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseExtensions(%q) = %+v, %v; want %+v, %v", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestAcceptDeflate(t *testing.T) {
+	for _, test := range []struct {
+		offer string
+		want  string
+		p     deflateParams
+	}{
+		{"permessage-deflate", "permessage-deflate", deflateParams{}},
+		{"permessage-deflate; client_max_window_bits", "permessage-deflate", deflateParams{}},
+		{"permessage-deflate; client_max_window_bits=10", "permessage-deflate", deflateParams{}},
+		{
+			"permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+			"permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+			deflateParams{serverNoContextTakeover: true, clientNoContextTakeover: true},
+		},
+		// The server's window cannot be reduced, so the next offer is chosen.
+		{"permessage-deflate; server_max_window_bits=10, permessage-deflate", "permessage-deflate", deflateParams{}},
+		{"permessage-deflate; server_max_window_bits=15", "permessage-deflate", deflateParams{}},
+		{"permessage-deflate; server_max_window_bits=10", "", deflateParams{}},
+		{"permessage-deflate; client_no_context_takeover; client_no_context_takeover", "", deflateParams{}},
+		{"permessage-deflate; unknown", "", deflateParams{}},
+		{"x-webkit-deflate-frame", "", deflateParams{}},
+	} {
+		exts, _ := parseExtensions(http.Header{"Sec-Websocket-Extensions": {test.offer}})
+		p, resp, ok := acceptDeflate(exts)
+		if ok != (test.want != "") || resp != test.want || p != test.p {
+			t.Errorf("acceptDeflate(%q) = %+v, %q, %v; want %+v, %q", test.offer, p, resp, ok, test.p, test.want)
+		}
+	}
+}
+
+func TestCheckDeflateResponse(t *testing.T) {
+	for _, test := range []struct {
+		resp     string
+		ok       bool
+		compress bool
+	}{
+		{"", true, false},
+		{"permessage-deflate", true, true},
+		{"permessage-deflate; server_no_context_takeover; server_max_window_bits=9", true, true},
+		{"permessage-deflate; client_max_window_bits=9", false, false},
+		{"permessage-deflate, permessage-deflate", false, false},
+		{"other-extension", false, false},
+	} {
+		h := http.Header{}
+		if test.resp != "" {
+			h.Set("Sec-WebSocket-Extensions", test.resp)
+		}
+		exts, _ := parseExtensions(h)
+		_, ok, compress := checkDeflateResponse(exts)
+		if ok != test.ok || compress != test.compress {
+			t.Errorf("checkDeflateResponse(%q) = %v, %v; want %v, %v", test.resp, ok, compress, test.ok, test.compress)
+		}
+	}
+}
+
+func TestTruncWriter(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	for _, sizes := range [][]int{
+		{20},
+		{1, 1, 1, 1, 16},
+		{3, 2, 1, 14},
+		{4, 4, 4, 4, 4},
+		{5, 15},
+		{0, 19, 1},
+	} {
+		var buf bytes.Buffer
+		tw := truncWriter{w: &buf}
+		s := data
+		for _, n := range sizes {
+			if _, err := tw.Write([]byte(s[:n])); err != nil {
+				t.Fatal(err)
+			}
+			s = s[n:]
+		}
+		if got, want := buf.String()+string(tw.tail[:tw.n]), data; got != want {
+			t.Errorf("writes of %v: output %q + tail %q, want %q", sizes, buf.String(), tw.tail[:tw.n], data)
+		}
+		if tw.n != len(tw.tail) {
+			t.Errorf("writes of %v: held back %v bytes, want %v", sizes, tw.n, len(tw.tail))
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, noContext := range []bool{false, true} {
+		c := newCompressor(noContext)
+		d := &decompressor{noContext: noContext}
+		var text strings.Builder
+		for i := 0; text.Len() < 1000; i++ {
+			fmt.Fprintf(&text, "%x,", i*i)
+		}
+		msgs := []string{
+			text.String(),
+			text.String(),
+			strings.Repeat("abcdefgh", 10000),
+			"",
+			"hello, world",
+			text.String(),
+		}
+		var sizes []int
+		for _, m := range msgs {
+			var buf bytes.Buffer
+			c.tw.w = &buf
+			io.WriteString(c.fw, m)
+			if err := c.finish(); err != nil {
+				t.Fatal(err)
+			}
+			sizes = append(sizes, buf.Len())
+			got, err := io.ReadAll(d.reset(&buf))
+			if err != nil {
+				t.Fatalf("noContext=%v: decompressing %v bytes: %v", noContext, len(m), err)
+			}
+			d.record(got)
+			if string(got) != m {
+				t.Fatalf("noContext=%v: decompressed %v bytes, want %v", noContext, len(got), len(m))
+			}
+		}
+		// With context takeover, a repeated message is compressed
+		// by reference to the earlier one.
+		if smaller := sizes[1] < sizes[0]; smaller == noContext {
+			t.Errorf("noContext=%v: compressed sizes %v", noContext, sizes)
+		}
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	d := &decompressor{}
+	// A block type of 3 is invalid.
+	_, err := io.ReadAll(d.reset(bytes.NewReader([]byte{0x07})))
+	if _, ok := err.(flate.CorruptInputError); !ok {
+		t.Errorf("decompressing invalid data: got error %v, want CorruptInputError", err)
+	}
+}
+
+func TestValidUTF8(t *testing.T) {
+	for _, test := range []struct {
+		s     string
+		valid bool
+	}{
+		{"", true},
+		{"hello", true},
+		{"héllo, 世界 😀", true},
+		{"�", true},
+		{"abc\xff", false},
+		{"\xc3", false},
+		{"\xe4\xb8", false},
+		{"\xed\xa0\x80", false}, // surrogate
+		{"\xf0\x9f\x98", false},
+		{"\xc0\xaf", false}, // overlong
+	} {
+		// Split the message at every point, to check sequences
+		// that span reads.
+		for i := 0; i <= len(test.s); i++ {
+			for j := i; j <= len(test.s); j++ {
+				r := &messageReader{}
+				valid := r.validUTF8([]byte(test.s[:i]), false) &&
+					r.validUTF8([]byte(test.s[i:j]), false) &&
+					r.validUTF8([]byte(test.s[j:]), true)
+				if valid != test.valid {
+					t.Errorf("validUTF8(%q split at %v, %v) = %v, want %v", test.s, i, j, valid, test.valid)
+				}
+			}
+		}
+	}
+}
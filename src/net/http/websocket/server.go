@@ -0,0 +1,190 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/internal/ascii"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// keyGUID is appended to the client's key to compute the server's
+// Sec-WebSocket-Accept header. See RFC 6455, Section 4.2.2.
+const keyGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// AcceptOptions configures Accept.
+type AcceptOptions struct {
+	// Subprotocols lists the application protocols supported by the
+	// server, in order of preference. The first one that the client
+	// also offers is selected.
+	Subprotocols []string
+
+	// CheckOrigin reports whether to accept a request with the given
+	// Origin header, which browsers send with every WebSocket handshake.
+	// If CheckOrigin is nil, a request with an Origin header is accepted
+	// only if the origin's host is the request's Host, which prevents
+	// cross-site WebSocket hijacking.
+	CheckOrigin func(r *http.Request) bool
+
+	// EnableCompression enables the permessage-deflate extension
+	// if the client offers it.
+	EnableCompression bool
+}
+
+// Accept completes the opening handshake of a WebSocket connection
+// requested by r, and returns the connection.
+//
+// The handshake is an HTTP/1.1 GET request asking to upgrade the
+// connection, which is hijacked from the server. HTTP/2 requests are
+// rejected, as extended CONNECT (RFC 8441) is not supported.
+//
+// Header fields set in w.Header() before calling Accept are included in
+// the handshake response. If the handshake is not valid, Accept replies
+// to the request with an HTTP error and returns an error.
+func Accept(w http.ResponseWriter, r *http.Request, opts *AcceptOptions) (*Conn, error) {
+	if opts == nil {
+		opts = &AcceptOptions{}
+	}
+	if r.ProtoMajor != 1 {
+		return nil, handshakeError(w, http.StatusBadRequest, "request is not a WebSocket handshake")
+	}
+	if r.Method != "GET" {
+		return nil, handshakeError(w, http.StatusMethodNotAllowed, "handshake request method is not GET")
+	}
+	if !httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade") {
+		return nil, handshakeError(w, http.StatusBadRequest, "'Connection' header does not contain 'upgrade'")
+	}
+	if !httpguts.HeaderValuesContainsToken(r.Header["Upgrade"], "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "'Upgrade' header does not contain 'websocket'")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "unsupported 'Sec-WebSocket-Version'")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, handshakeError(w, http.StatusBadRequest, "invalid 'Sec-WebSocket-Key'")
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, handshakeError(w, http.StatusForbidden, "request origin not allowed")
+	}
+
+	h := w.Header()
+	subprotocol := selectSubprotocol(r, opts.Subprotocols)
+	if subprotocol != "" {
+		h.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	var deflate *deflateParams
+	if opts.EnableCompression {
+		if exts, ok := parseExtensions(r.Header); ok {
+			if p, ext, ok := acceptDeflate(exts); ok {
+				deflate = &p
+				h.Set("Sec-WebSocket-Extensions", ext)
+			}
+		}
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, handshakeError(w, http.StatusInternalServerError, "cannot hijack connection: "+err.Error())
+	}
+	// Clear any deadlines set by the Server.
+	conn.SetDeadline(time.Time{})
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", acceptKey(key))
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	h.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t := &netTransport{r: brw.Reader, conn: conn}
+	return newConn(t, brw.Reader, true, subprotocol, deflate), nil
+}
+
+// handshakeError replies to a failed handshake request, and returns
+// the error to return from Accept.
+func handshakeError(w http.ResponseWriter, code int, msg string) error {
+	http.Error(w, http.StatusText(code), code)
+	return fmt.Errorf("%w: %v", ErrBadHandshake, msg)
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key)
+	io.WriteString(h, keyGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sameOrigin reports whether r has no Origin header field,
+// or one whose host is the same as the request's.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header["Origin"]
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin[0])
+	if err != nil {
+		return false
+	}
+	return ascii.EqualFold(u.Host, r.Host)
+}
+
+// subprotocols returns the protocols listed in h's
+// Sec-WebSocket-Protocol header fields.
+func subprotocols(h http.Header) []string {
+	var protos []string
+	for _, v := range h.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if p = textproto.TrimString(p); p != "" {
+				protos = append(protos, p)
+			}
+		}
+	}
+	return protos
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	offered := subprotocols(r.Header)
+	for _, s := range supported {
+		for _, o := range offered {
+			if s == o {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// A netTransport carries a WebSocket connection over a network
+// connection, such as one hijacked from an HTTP/1.1 server.
+type netTransport struct {
+	r    io.Reader // reads from conn, after any buffered data
+	conn net.Conn
+}
+
+func (t *netTransport) Read(b []byte) (int, error)         { return t.r.Read(b) }
+func (t *netTransport) Write(b []byte) (int, error)        { return t.conn.Write(b) }
+func (t *netTransport) Close() error                       { return t.conn.Close() }
+func (t *netTransport) SetReadDeadline(d time.Time) error  { return t.conn.SetReadDeadline(d) }
+func (t *netTransport) SetWriteDeadline(d time.Time) error { return t.conn.SetWriteDeadline(d) }
@@ -0,0 +1,115 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package websocket implements the WebSocket protocol defined in RFC 6455.
+//
+// A server upgrades an HTTP request to a WebSocket connection by calling
+// Accept from an http.Handler. A client opens a connection with Dial,
+// which sends the opening handshake with an http.Client.
+//
+// Connections are established with an HTTP/1.1 Upgrade request.
+// Bootstrapping WebSockets with HTTP/2 extended CONNECT, as defined in
+// RFC 8441, is not supported. The permessage-deflate extension defined
+// in RFC 7692 compresses messages when both endpoints enable it.
+//
+// A Conn exchanges messages, each of which is either UTF-8 text or
+// binary data. Ping frames are answered automatically, and the closing
+// handshake is performed by Close.
+package websocket
+
+import (
+	"errors"
+	"strconv"
+)
+
+// A MessageType is the type of a WebSocket data message.
+type MessageType int
+
+const (
+	// TextMessage is a message containing UTF-8 encoded text.
+	TextMessage MessageType = MessageType(opText)
+
+	// BinaryMessage is a message containing binary data.
+	BinaryMessage MessageType = MessageType(opBinary)
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case TextMessage:
+		return "TextMessage"
+	case BinaryMessage:
+		return "BinaryMessage"
+	}
+	return "MessageType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// A StatusCode is a status code sent in a Close frame,
+// indicating the reason a connection was closed.
+// See RFC 6455, Section 7.4.
+type StatusCode int
+
+const (
+	StatusNormalClosure           StatusCode = 1000
+	StatusGoingAway               StatusCode = 1001
+	StatusProtocolError           StatusCode = 1002
+	StatusUnsupportedData         StatusCode = 1003
+	StatusNoStatusReceived        StatusCode = 1005 // never sent in a Close frame
+	StatusAbnormalClosure         StatusCode = 1006 // never sent in a Close frame
+	StatusInvalidFramePayloadData StatusCode = 1007
+	StatusPolicyViolation         StatusCode = 1008
+	StatusMessageTooBig           StatusCode = 1009
+	StatusMandatoryExtension      StatusCode = 1010
+	StatusInternalError           StatusCode = 1011
+)
+
+// validWire reports whether code may appear in a Close frame.
+func (code StatusCode) validWire() bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		// Registered with IANA, or reserved for private use.
+		return true
+	}
+	return false
+}
+
+// A CloseError is returned by reads from a Conn after the peer has sent
+// a Close frame. Code is StatusNoStatusReceived if the frame contained
+// no status code.
+type CloseError struct {
+	Code   StatusCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	s := "websocket: connection closed with status " + strconv.Itoa(int(e.Code))
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+var (
+	// ErrClosed is returned by operations on a Conn after Close is called,
+	// or after the connection has failed.
+	ErrClosed = errors.New("websocket: use of closed connection")
+
+	// ErrReadLimit is returned when reading a message larger than
+	// the Conn's read limit. See Conn.SetReadLimit.
+	ErrReadLimit = errors.New("websocket: message exceeds read limit")
+
+	// ErrBadHandshake is returned by Dial and Accept when the opening
+	// handshake is not valid.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+)
+
+// A protocolError is a violation of the WebSocket protocol by the peer.
+// The connection is failed with code.
+type protocolError struct {
+	code StatusCode
+	msg  string
+}
+
+func (e *protocolError) Error() string { return "websocket: " + e.msg }
@@ -0,0 +1,461 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsTest struct {
+	t     *testing.T
+	ts    *httptest.Server
+	url   string
+	opts  *DialOptions
+	errc  chan error // results of the server function
+	accpt *AcceptOptions
+}
+
+// newWSTest starts a server that accepts WebSocket connections with aopts
+// and calls serve for each one.
+func newWSTest(t *testing.T, aopts *AcceptOptions, serve func(*Conn) error) *wsTest {
+	wt := &wsTest{
+		t:     t,
+		errc:  make(chan error, 10),
+		accpt: aopts,
+	}
+	wt.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Accept(w, r, wt.accpt)
+		if err != nil {
+			wt.errc <- err
+			return
+		}
+		err = serve(c)
+		c.Close()
+		wt.errc <- err
+	}))
+	wt.opts = &DialOptions{Client: wt.ts.Client()}
+	wt.url = "ws" + strings.TrimPrefix(wt.ts.URL, "http")
+	t.Cleanup(wt.ts.Close)
+	return wt
+}
+
+func (wt *wsTest) dial() *Conn {
+	wt.t.Helper()
+	c, resp, err := Dial(context.Background(), wt.url, wt.opts)
+	if err != nil {
+		wt.t.Fatalf("Dial: %v (response %v)", err, resp)
+	}
+	return c
+}
+
+// serverErr returns the result of a server function.
+func (wt *wsTest) serverErr() error {
+	wt.t.Helper()
+	select {
+	case err := <-wt.errc:
+		return err
+	case <-time.After(10 * time.Second):
+		wt.t.Fatal("timeout waiting for server")
+		return nil
+	}
+}
+
+func echo(c *Conn) error {
+	for {
+		typ, r, err := c.NextReader()
+		if err != nil {
+			return err
+		}
+		w, err := c.NextWriter(typ)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "compressed"
+		}
+		t.Run(name, func(t *testing.T) {
+			testEcho(t, compress)
+		})
+	}
+}
+
+func testEcho(t *testing.T, compress bool) {
+	wt := newWSTest(t, &AcceptOptions{EnableCompression: compress}, echo)
+	wt.opts.EnableCompression = compress
+	c := wt.dial()
+	if got := c.comp != nil; got != compress {
+		t.Fatalf("compression negotiated = %v, want %v", got, compress)
+	}
+	large := bytes.Repeat([]byte("0123456789abcdef"), 10000) // several frames
+	msgs := []struct {
+		typ  MessageType
+		data []byte
+	}{
+		{TextMessage, []byte("hello")},
+		{TextMessage, []byte("")},
+		{BinaryMessage, []byte{0, 1, 2, 0xff}},
+		{TextMessage, large},
+		{TextMessage, []byte("hello")}, // refers to earlier messages when compressed
+		{BinaryMessage, large},
+		{TextMessage, []byte("héllo, 世界")},
+	}
+	for _, m := range msgs {
+		if err := c.WriteMessage(m.typ, m.data); err != nil {
+			t.Fatal(err)
+		}
+		typ, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != m.typ || !bytes.Equal(data, m.data) {
+			t.Fatalf("echo of %v message of %v bytes: got %v message of %v bytes", m.typ, len(m.data), typ, len(data))
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	var ce *CloseError
+	if err := wt.serverErr(); !errors.As(err, &ce) || ce.Code != StatusNormalClosure {
+		t.Fatalf("server read error = %v, want CloseError with StatusNormalClosure", err)
+	}
+}
+
+func TestStreamingWriter(t *testing.T) {
+	wt := newWSTest(t, nil, echo)
+	c := wt.dial()
+	defer c.Close()
+	w, err := c.NextWriter(BinaryMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	for i := 0; i < 100; i++ {
+		chunk := bytes.Repeat([]byte{byte(i)}, 1000)
+		want = append(want, chunk...)
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A partly read message is discarded by the next call to NextReader.
+	if err := c.WriteMessage(TextMessage, []byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	_, r, err := c.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, want[:10]) {
+		t.Fatalf("first read = %v, %v; want %v", buf, err, want[:10])
+	}
+	typ, data, err := c.ReadMessage()
+	if err != nil || typ != TextMessage || string(data) != "next" {
+		t.Fatalf("ReadMessage = %v, %q, %v; want TextMessage, %q", typ, data, err, "next")
+	}
+	if n, err := r.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("read from discarded message = %v, %v; want 0, EOF", n, err)
+	}
+}
+
+func TestSubprotocol(t *testing.T) {
+	wt := newWSTest(t, &AcceptOptions{Subprotocols: []string{"v2", "v1"}}, func(c *Conn) error {
+		return c.WriteMessage(TextMessage, []byte(c.Subprotocol()))
+	})
+	for _, test := range []struct {
+		offer []string
+		want  string
+	}{
+		{[]string{"v1", "v2"}, "v2"},
+		{[]string{"v1"}, "v1"},
+		{[]string{"v3"}, ""},
+		{nil, ""},
+	} {
+		wt.opts.Subprotocols = test.offer
+		c := wt.dial()
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Subprotocol() != test.want || string(data) != test.want {
+			t.Errorf("offering %q: client selected %q, server selected %q; want %q", test.offer, c.Subprotocol(), data, test.want)
+		}
+		c.Close()
+		wt.serverErr()
+	}
+}
+
+func TestPing(t *testing.T) {
+	wt := newWSTest(t, nil, func(c *Conn) error {
+		// Pongs are processed by a concurrent reader.
+		go c.ReadMessage()
+		if err := c.Ping(context.Background()); err != nil {
+			return err
+		}
+		return c.WriteMessage(TextMessage, []byte("pinged"))
+	})
+	c := wt.dial()
+	// The server's ping is answered while reading.
+	_, data, err := c.ReadMessage()
+	if err != nil || string(data) != "pinged" {
+		t.Fatalf("ReadMessage = %q, %v", data, err)
+	}
+	c.Close()
+	if err := wt.serverErr(); err != nil {
+		t.Fatalf("server: %v", err)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	wt := newWSTest(t, nil, echo)
+	c := wt.dial()
+	defer c.Close()
+	// No one reads from c, so the pong is not seen.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Ping(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Ping = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestCloseFromServer(t *testing.T) {
+	wt := newWSTest(t, nil, func(c *Conn) error {
+		if err := c.WriteMessage(TextMessage, []byte("bye")); err != nil {
+			return err
+		}
+		return c.CloseWithStatus(StatusGoingAway, "shutting down")
+	})
+	c := wt.dial()
+	if _, data, err := c.ReadMessage(); err != nil || string(data) != "bye" {
+		t.Fatalf("ReadMessage = %q, %v", data, err)
+	}
+	_, _, err := c.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != StatusGoingAway || ce.Reason != "shutting down" {
+		t.Fatalf("ReadMessage error = %v, want CloseError with StatusGoingAway", err)
+	}
+	if err := wt.serverErr(); err != nil {
+		t.Fatalf("server CloseWithStatus: %v", err)
+	}
+	if err := c.WriteMessage(TextMessage, []byte("late")); err != ErrClosed {
+		t.Errorf("WriteMessage after close = %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseWithConcurrentReader(t *testing.T) {
+	wt := newWSTest(t, nil, echo)
+	c := wt.dial()
+	readErr := make(chan error)
+	go func() {
+		_, _, err := c.ReadMessage()
+		readErr <- err
+	}()
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	var ce *CloseError
+	if err := <-readErr; !errors.As(err, &ce) || ce.Code != StatusNormalClosure {
+		t.Fatalf("concurrent ReadMessage = %v, want CloseError with StatusNormalClosure", err)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	wt := newWSTest(t, &AcceptOptions{EnableCompression: true}, func(c *Conn) error {
+		c.SetReadLimit(1000)
+		if _, _, err := c.ReadMessage(); err != nil {
+			return err
+		}
+		_, _, err := c.ReadMessage()
+		return err
+	})
+	wt.opts.EnableCompression = true
+	c := wt.dial()
+	if err := c.WriteMessage(BinaryMessage, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	// The limit applies to the decompressed size.
+	if err := c.WriteMessage(BinaryMessage, make([]byte, 1001)); err != nil {
+		t.Fatal(err)
+	}
+	if err := wt.serverErr(); err != ErrReadLimit {
+		t.Fatalf("server read error = %v, want ErrReadLimit", err)
+	}
+	_, _, err := c.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != StatusMessageTooBig {
+		t.Fatalf("client read error = %v, want CloseError with StatusMessageTooBig", err)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	wt := newWSTest(t, nil, echo)
+	c := wt.dial()
+	if err := c.WriteMessage(TextMessage, []byte("abc\xff")); err != nil {
+		t.Fatal(err)
+	}
+	var pe *protocolError
+	if err := wt.serverErr(); !errors.As(err, &pe) {
+		t.Fatalf("server read error = %v, want protocol error", err)
+	}
+	_, _, err := c.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != StatusInvalidFramePayloadData {
+		t.Fatalf("client read error = %v, want CloseError with StatusInvalidFramePayloadData", err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	wt := newWSTest(t, nil, echo)
+	c := wt.dial()
+	defer c.Close()
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadMessage = %v, want timeout", err)
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	wt := newWSTest(t, nil, echo)
+	for _, test := range []struct {
+		name   string
+		method string
+		header http.Header
+		code   int
+	}{{
+		name:   "not an upgrade",
+		method: "GET",
+		header: http.Header{},
+		code:   http.StatusBadRequest,
+	}, {
+		name:   "bad method",
+		method: "POST",
+		header: http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}},
+		code:   http.StatusMethodNotAllowed,
+	}, {
+		name:   "bad version",
+		method: "GET",
+		header: http.Header{
+			"Connection":            {"Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"8"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		},
+		code: http.StatusUpgradeRequired,
+	}, {
+		name:   "bad key",
+		method: "GET",
+		header: http.Header{
+			"Connection":            {"keep-alive, Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"short"},
+		},
+		code: http.StatusBadRequest,
+	}, {
+		name:   "cross origin",
+		method: "GET",
+		header: http.Header{
+			"Connection":            {"Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+			"Origin":                {"https://evil.example"},
+		},
+		code: http.StatusForbidden,
+	}} {
+		req, _ := http.NewRequest(test.method, wt.ts.URL, nil)
+		req.Header = test.header
+		resp, err := wt.ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.code {
+			t.Errorf("%v: status %v, want %v", test.name, resp.StatusCode, test.code)
+		}
+		if err := wt.serverErr(); !errors.Is(err, ErrBadHandshake) {
+			t.Errorf("%v: Accept error = %v, want ErrBadHandshake", test.name, err)
+		}
+	}
+}
+
+func TestDialNotWebSocket(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no websockets here", http.StatusNotFound)
+	}))
+	defer ts.Close()
+	_, resp, err := Dial(context.Background(), ts.URL, nil)
+	if !errors.Is(err, ErrBadHandshake) {
+		t.Fatalf("Dial error = %v, want ErrBadHandshake", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNotFound || string(body) != "no websockets here\n" {
+		t.Errorf("Dial response = %v, %q", resp.Status, body)
+	}
+}
+
+func TestAcceptHTTP2(t *testing.T) {
+	errc := make(chan error, 1)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := Accept(w, r, nil)
+		errc <- err
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("response = %v %v, want HTTP/2.0 400", resp.Proto, resp.Status)
+	}
+	if err := <-errc; !errors.Is(err, ErrBadHandshake) {
+		t.Errorf("Accept error = %v, want ErrBadHandshake", err)
+	}
+}
+
+func TestDialCanceled(t *testing.T) {
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer ts.Close()
+	defer close(block)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := Dial(ctx, ts.URL, nil); err != context.DeadlineExceeded {
+		t.Fatalf("Dial = %v, want DeadlineExceeded", err)
+	}
+}
@@ -148,6 +148,18 @@ type Resolver struct {
 	// If nil, the default dialer is used.
 	Dial func(ctx context.Context, network, address string) (Conn, error)
 
+	// Transport optionally specifies how Go's built-in DNS resolver
+	// sends queries, in place of UDP and TCP exchanges with the name
+	// servers in the system configuration, such as resolv.conf. This
+	// allows the use of encrypted protocols like DNS over TLS and DNS
+	// over HTTPS; see package net/securedns. The search list and the
+	// timeout and attempts options of the system configuration still
+	// apply. Setting Transport implies PreferGo.
+	//
+	// A Transport that needs to resolve names itself, for example to
+	// connect to a server given by host name, must not use this Resolver.
+	Transport DNSTransport
+
 	// lookupGroup merges LookupIPAddr calls together for lookups for the same
 	// host. The lookupGroup key is the LookupIPAddr.host argument.
 	// The return values are ([]IPAddr, error).
@@ -157,9 +169,32 @@ type Resolver struct {
 	// TODO(bradfitz): Timeout time.Duration?
 }
 
-func (r *Resolver) preferGo() bool     { return r != nil && r.PreferGo }
+func (r *Resolver) preferGo() bool     { return r != nil && (r.PreferGo || r.Transport != nil) }
 func (r *Resolver) strictErrors() bool { return r != nil && r.StrictErrors }
 
+func (r *Resolver) transport() DNSTransport {
+	if r == nil {
+		return nil
+	}
+	return r.Transport
+}
+
+// A DNSTransport exchanges DNS messages with a name server on behalf
+// of a Resolver.
+//
+// If a DNSTransport has a String method, its result is reported as
+// the server in DNSErrors.
+type DNSTransport interface {
+	// Exchange sends query, a DNS message in the wire format of
+	// RFC 1035 section 4, and returns the server's response in the
+	// same format. It must not modify or retain query. The response
+	// must have the ID and question of the query.
+	//
+	// The Resolver sets a deadline on ctx for each exchange, from
+	// the timeout option of the system configuration.
+	Exchange(ctx context.Context, query []byte) (response []byte, err error)
+}
+
 func (r *Resolver) getLookupGroup() *singleflight.Group {
 	if r == nil {
 		return &DefaultResolver.lookupGroup
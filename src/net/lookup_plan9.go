@@ -193,7 +193,7 @@ func (r *Resolver) preferGoOverPlan9() bool {
 	// DNS cache) and they don't want to actually hit the network.
 	// Once we add support for looking the default DNS servers
 	// from plan9, though, then we can relax this.
-	return order != hostLookupCgo && r != nil && r.Dial != nil
+	return order != hostLookupCgo && r != nil && (r.Dial != nil || r.Transport != nil)
 }
 
 func (r *Resolver) lookupIP(ctx context.Context, network, host string) (addrs []IPAddr, err error) {
@@ -0,0 +1,110 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package securedns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// dnsMessageType is the media type of DNS messages in DNS over HTTPS.
+const dnsMessageType = "application/dns-message"
+
+// An HTTPSTransport is a net.DNSTransport that sends queries to a server
+// using DNS over HTTPS, as specified by RFC 8484. Connections are
+// reused as the Client's Transport allows.
+type HTTPSTransport struct {
+	// URL is the URL of the server's DNS query endpoint, such as
+	// "https://dns.example/dns-query".
+	URL string
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// UseGET makes the transport send queries with GET requests
+	// instead of POST requests. GET responses are more easily cached
+	// by HTTP caches.
+	UseGET bool
+}
+
+// Exchange implements the net.DNSTransport interface.
+func (t *HTTPSTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, errShortMessage
+	}
+	if len(query) > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	// RFC 8484 section 4.1: use ID 0 so that responses can be cached.
+	// The original ID is restored in the response.
+	id := messageID(query)
+	query = append([]byte(nil), query...)
+	setMessageID(query, 0)
+
+	var (
+		req *http.Request
+		err error
+	)
+	if t.UseGET {
+		var u *url.URL
+		if u, err = url.Parse(t.URL); err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("dns", base64.RawURLEncoding.EncodeToString(query))
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "POST", t.URL, bytes.NewReader(query))
+		if err == nil {
+			req.Header.Set("Content-Type", dnsMessageType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageType)
+
+	c := t.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("securedns: %s responded with status %q", t.URL, res.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt != dnsMessageType {
+		return nil, fmt.Errorf("securedns: %s responded with Content-Type %q", t.URL, res.Header.Get("Content-Type"))
+	}
+	resp, err := io.ReadAll(io.LimitReader(res.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	if len(resp) > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	if len(resp) < 2 {
+		return nil, errShortMessage
+	}
+	if messageID(resp) == 0 {
+		setMessageID(resp, id)
+	}
+	return resp, nil
+}
+
+// String returns the URL of t, for errors reported by net.Resolver.
+func (t *HTTPSTransport) String() string {
+	return t.URL
+}
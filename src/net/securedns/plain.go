@@ -0,0 +1,86 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package securedns
+
+import (
+	"context"
+	"net"
+)
+
+// A PlainTransport is a net.DNSTransport that sends queries in
+// cleartext over UDP, and over TCP when a response is truncated, as
+// net.Resolver does without a Transport. It is meant to be the
+// Fallback of a Failover that allows cleartext queries.
+type PlainTransport struct {
+	// Address is the address of the server, of the form "host:port".
+	// The host should be an IP address.
+	Address string
+
+	// Dialer is used to make connections.
+	// If nil, the zero Dialer is used.
+	Dialer *net.Dialer
+}
+
+// Exchange implements the net.DNSTransport interface.
+func (t *PlainTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, errShortMessage
+	}
+	if len(query) > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	d := t.Dialer
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	c, err := d.DialContext(ctx, "udp", t.Address)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := packetRoundTrip(ctx, c, query)
+	c.Close()
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	if resp[2]&0x02 == 0 { // not truncated; see RFC 1035 section 4.1.1
+		return resp, nil
+	}
+
+	if c, err = d.DialContext(ctx, "tcp", t.Address); err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	resp, err = roundTrip(ctx, c, query)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	return resp, nil
+}
+
+// packetRoundTrip sends query on c and returns the first response
+// with the same ID, ignoring others, which may be forgeries.
+func packetRoundTrip(ctx context.Context, c net.Conn, query []byte) ([]byte, error) {
+	defer watchContext(ctx, c)()
+	if _, err := c.Write(query); err != nil {
+		return nil, err
+	}
+	b := make([]byte, maxMessageSize)
+	for {
+		n, err := c.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		// The header is 12 bytes long.
+		if n >= 12 && messageID(b) == messageID(query) {
+			return b[:n:n], nil
+		}
+	}
+}
+
+// String returns the address of t, for errors reported by
+// net.Resolver.
+func (t *PlainTransport) String() string {
+	return "udp://" + t.Address
+}
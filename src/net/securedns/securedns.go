@@ -0,0 +1,213 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package securedns implements transports for the DNS resolver of
+// package net that encrypt queries: DNS over TLS (RFC 7858) and DNS
+// over HTTPS (RFC 8484).
+//
+// A transport is used by setting the Transport field of a
+// net.Resolver:
+//
+//	r := &net.Resolver{
+//		Transport: &securedns.TLSTransport{
+//			Address: "192.0.2.53:853",
+//			Config:  &tls.Config{ServerName: "dns.example"},
+//		},
+//	}
+//	addrs, err := r.LookupHost(ctx, "golang.org")
+//
+// Failover combines several transports, and determines whether
+// queries may fall back to cleartext DNS when no encrypted server can
+// be reached.
+//
+// A transport must not depend on the Resolver that uses it. In
+// particular, a server whose address is a host name is resolved with
+// net.DefaultResolver, so a transport given by host name cannot be
+// installed in net.DefaultResolver.
+package securedns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMessageSize is the largest DNS message a transport accepts.
+const maxMessageSize = 65535
+
+var (
+	errMessageTooLarge = errors.New("securedns: DNS message too large")
+	errShortMessage    = errors.New("securedns: DNS message too short")
+)
+
+// messageID returns the ID of the DNS message m.
+func messageID(m []byte) uint16 {
+	return uint16(m[0])<<8 | uint16(m[1])
+}
+
+// setMessageID sets the ID of the DNS message m.
+func setMessageID(m []byte, id uint16) {
+	m[0], m[1] = byte(id>>8), byte(id)
+}
+
+// DefaultRetryAfter is the default value of Failover.RetryAfter.
+const DefaultRetryAfter = 30 * time.Second
+
+// A Failover is a net.DNSTransport that sends each query with the first
+// of several transports that succeeds. Transports that failed recently
+// are tried after the others. If the query's context has a deadline,
+// each transport, and then Fallback, is given an equal share of the
+// time left, so that a transport that does not respond leaves time
+// for the others.
+//
+// Whether queries may be sent in cleartext is decided by Fallback. If
+// it is nil, queries that no transport could answer fail, as in the
+// strict usage profile of RFC 8310. A Fallback that sends queries in
+// cleartext, such as a PlainTransport, gives the opportunistic profile.
+type Failover struct {
+	// Transports are the transports to use, in order of preference.
+	Transports []net.DNSTransport
+
+	// Fallback, if non-nil, is used when every one of Transports fails.
+	Fallback net.DNSTransport
+
+	// RetryAfter is how long a transport that failed is tried only
+	// after the others. If zero, DefaultRetryAfter is used.
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	failedAt map[int]time.Time // by index in Transports
+}
+
+// Exchange implements the net.DNSTransport interface.
+func (f *Failover) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	order := f.order()
+	attempts := len(order)
+	if f.Fallback != nil {
+		attempts++
+	}
+	var lastErr error
+	for n, i := range order {
+		resp, err := exchangeShare(ctx, f.Transports[i], query, attempts-n)
+		if err == nil {
+			f.setFailed(i, false)
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			// Don't blame the transport.
+			return nil, err
+		}
+		f.setFailed(i, true)
+	}
+	if f.Fallback != nil {
+		return f.Fallback.Exchange(ctx, query)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("securedns: no transports")
+	}
+	return nil, lastErr
+}
+
+// exchangeShare sends query with t. If ctx has a deadline, t is given
+// an equal share of the time left among itself and the n-1 transports
+// to be tried after it.
+func exchangeShare(ctx context.Context, t net.DNSTransport, query []byte, n int) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok && n > 1 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(n))
+		defer cancel()
+	}
+	return t.Exchange(ctx, query)
+}
+
+// order returns the indexes of f.Transports, with those that failed
+// recently moved to the end.
+func (f *Failover) order() []int {
+	retryAfter := f.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	now := time.Now()
+	var healthy, failed []int
+	f.mu.Lock()
+	for i := range f.Transports {
+		if at, ok := f.failedAt[i]; ok && now.Sub(at) < retryAfter {
+			failed = append(failed, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	f.mu.Unlock()
+	return append(healthy, failed...)
+}
+
+// setFailed records whether f.Transports[i] failed.
+func (f *Failover) setFailed(i int, failed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !failed {
+		delete(f.failedAt, i)
+		return
+	}
+	if f.failedAt == nil {
+		f.failedAt = make(map[int]time.Time)
+	}
+	f.failedAt[i] = time.Now()
+}
+
+// String returns the names of the transports in f, for errors
+// reported by net.Resolver.
+func (f *Failover) String() string {
+	var names []string
+	for _, t := range f.Transports {
+		names = append(names, transportName(t))
+	}
+	if f.Fallback != nil {
+		names = append(names, transportName(f.Fallback))
+	}
+	return strings.Join(names, ",")
+}
+
+func transportName(t net.DNSTransport) string {
+	if s, ok := t.(interface{ String() string }); ok {
+		return s.String()
+	}
+	return "?"
+}
+
+// watchContext makes I/O on c fail once ctx is done, until the returned
+// function is called. It also applies the deadline of ctx to c.
+func watchContext(ctx context.Context, c net.Conn) (stop func()) {
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopc, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			c.SetDeadline(time.Unix(1, 0))
+		case <-stopc:
+		}
+	}()
+	return func() {
+		close(stopc)
+		<-done
+	}
+}
+
+// ctxErr returns the error of ctx if it is done, and err otherwise,
+// so that I/O errors caused by watchContext are reported as such.
+func ctxErr(ctx context.Context, err error) error {
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,462 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package securedns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const testName = "www.example.test."
+
+// answer returns the response of a test server to query: an A record
+// for testName, no records for its other types, and a name error for
+// other names. It returns nil for invalid queries.
+func answer(query []byte, truncated bool) []byte {
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil || len(q.Questions) != 1 {
+		return nil
+	}
+	r := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.ID,
+			Response:           true,
+			RecursionAvailable: true,
+			Truncated:          truncated,
+		},
+		Questions: q.Questions,
+	}
+	switch {
+	case truncated:
+	case q.Questions[0].Name.String() != testName:
+		r.RCode = dnsmessage.RCodeNameError
+	case q.Questions[0].Type == dnsmessage.TypeA:
+		r.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{
+				Name:  q.Questions[0].Name,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+				TTL:   60,
+			},
+			Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}}
+	}
+	b, err := r.Pack()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func lookup(t *testing.T, tr net.DNSTransport) {
+	t.Helper()
+	r := &net.Resolver{Transport: tr}
+	addrs, err := r.LookupHost(context.Background(), testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.1"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("LookupHost = %v; want %v", addrs, want)
+	}
+}
+
+// testCertificate returns the certificate of httptest's TLS servers,
+// which is valid for "example.com" and 127.0.0.1, and a pool that
+// trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	return ts.TLS.Certificates[0], pool
+}
+
+// A dotServer is a DNS over TLS server on the loopback interface.
+type dotServer struct {
+	addr  string
+	pool  *x509.CertPool
+	conns atomic.Int32 // connections accepted
+	alpn  atomic.Value // negotiated protocol of the last connection
+
+	// oneQuery makes the server close connections after one query.
+	oneQuery bool
+}
+
+func newDoTServer(t *testing.T, oneQuery bool) *dotServer {
+	cert, pool := testCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"dot"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dotServer{addr: l.Addr().String(), pool: pool, oneQuery: oneQuery}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		l.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(c.(*tls.Conn))
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *dotServer) serve(c *tls.Conn) {
+	defer c.Close()
+	if c.Handshake() != nil {
+		return
+	}
+	s.alpn.Store(c.ConnectionState().NegotiatedProtocol)
+	for {
+		var l [2]byte
+		if _, err := io.ReadFull(c, l[:]); err != nil {
+			return
+		}
+		query := make([]byte, int(l[0])<<8|int(l[1]))
+		if _, err := io.ReadFull(c, query); err != nil {
+			return
+		}
+		resp := answer(query, false)
+		if _, err := c.Write(append([]byte{byte(len(resp) >> 8), byte(len(resp))}, resp...)); err != nil {
+			return
+		}
+		if s.oneQuery {
+			return
+		}
+	}
+}
+
+func TestTLSTransport(t *testing.T) {
+	s := newDoTServer(t, false)
+	tr := &TLSTransport{
+		Address: s.addr,
+		Config:  &tls.Config{ServerName: "example.com", RootCAs: s.pool},
+	}
+	defer tr.CloseIdleConnections()
+	lookup(t, tr)
+	if got := s.alpn.Load(); got != "dot" {
+		t.Errorf("negotiated protocol = %q; want %q", got, "dot")
+	}
+
+	// Connections are reused. An address lookup makes two queries in
+	// parallel, so up to two connections are open.
+	n := s.conns.Load()
+	if n == 0 || n > 2 {
+		t.Fatalf("%d connections for one lookup", n)
+	}
+	for i := 0; i < 3; i++ {
+		lookup(t, tr)
+	}
+	if got := s.conns.Load(); got != n {
+		t.Errorf("%d connections after more lookups; want %d", got, n)
+	}
+
+	// The server's certificate is verified.
+	bad := &TLSTransport{Address: s.addr, Config: &tls.Config{ServerName: "other.test", RootCAs: s.pool}}
+	if _, err := (&net.Resolver{Transport: bad}).LookupHost(context.Background(), testName); err == nil {
+		t.Errorf("lookup with the wrong server name succeeded")
+	}
+}
+
+func TestTLSTransportServerClosesConn(t *testing.T) {
+	s := newDoTServer(t, true)
+	tr := &TLSTransport{
+		Address: s.addr,
+		Config:  &tls.Config{RootCAs: s.pool},
+	}
+	defer tr.CloseIdleConnections()
+	for i := 0; i < 3; i++ {
+		// The first exchange on each reused connection fails,
+		// and is retried on a new one.
+		lookup(t, tr)
+	}
+}
+
+func TestTLSTransportIdleTimeout(t *testing.T) {
+	s := newDoTServer(t, false)
+	tr := &TLSTransport{
+		Address:     s.addr,
+		Config:      &tls.Config{RootCAs: s.pool},
+		IdleTimeout: time.Nanosecond,
+	}
+	defer tr.CloseIdleConnections()
+	q := query(t, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := tr.Exchange(context.Background(), q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.conns.Load(); got != 2 {
+		t.Errorf("%d connections with an idle timeout of 1ns; want 2", got)
+	}
+}
+
+// query returns an A query for testName with the given ID.
+func query(t *testing.T, id uint16) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(testName),
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	})
+	q, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func newDoHServer(t *testing.T) (*httptest.Server, *[]string) {
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q []byte
+		var err error
+		switch r.Method {
+		case "GET":
+			q, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		case "POST":
+			if r.Header.Get("Content-Type") != dnsMessageType {
+				err = errors.New("bad Content-Type")
+			} else {
+				q, err = io.ReadAll(r.Body)
+			}
+		}
+		if err != nil || len(q) < 2 || messageID(q) != 0 || r.Header.Get("Accept") != dnsMessageType {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(answer(q, false))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &methods
+}
+
+func TestHTTPSTransport(t *testing.T) {
+	ts, methods := newDoHServer(t)
+	for _, get := range []bool{false, true} {
+		tr := &HTTPSTransport{URL: ts.URL + "/dns-query", Client: ts.Client(), UseGET: get}
+		lookup(t, tr)
+
+		// The ID is restored in the response.
+		resp, err := tr.Exchange(context.Background(), query(t, 1234))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := messageID(resp); id != 1234 {
+			t.Errorf("response ID = %d; want 1234", id)
+		}
+	}
+	for i, m := range *methods {
+		if want := []string{"POST", "GET"}[i/3]; m != want {
+			t.Errorf("request %d used %s; want %s", i, m, want)
+		}
+	}
+
+	tr := &HTTPSTransport{URL: ts.URL + "/dns-query?dns=bad", Client: ts.Client(), UseGET: true}
+	if _, err := tr.Exchange(context.Background(), []byte("no")); err == nil {
+		t.Errorf("Exchange of a short message succeeded")
+	}
+	notFound := httptest.NewTLSServer(http.NotFoundHandler())
+	defer notFound.Close()
+	tr = &HTTPSTransport{URL: notFound.URL, Client: notFound.Client()}
+	if _, err := tr.Exchange(context.Background(), query(t, 1)); err == nil {
+		t.Errorf("Exchange with a 404 response succeeded")
+	}
+}
+
+// countingTransport counts exchanges, and fails them if err is set.
+type countingTransport struct {
+	net.DNSTransport
+	err   error
+	calls atomic.Int32
+}
+
+func (t *countingTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	t.calls.Add(1)
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.DNSTransport.Exchange(ctx, query)
+}
+
+func TestFailover(t *testing.T) {
+	ts, _ := newDoHServer(t)
+	doh := &HTTPSTransport{URL: ts.URL, Client: ts.Client()}
+	down := &countingTransport{err: errors.New("down")}
+	up := &countingTransport{DNSTransport: doh}
+	f := &Failover{Transports: []net.DNSTransport{down, up}}
+	q := query(t, 1)
+	if _, err := f.Exchange(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls.Load() != 1 || up.calls.Load() != 1 {
+		t.Errorf("calls = %d, %d; want 1, 1", down.calls.Load(), up.calls.Load())
+	}
+	// The failed transport is skipped until RetryAfter passes.
+	if _, err := f.Exchange(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls.Load() != 1 || up.calls.Load() != 2 {
+		t.Errorf("calls = %d, %d; want 1, 2", down.calls.Load(), up.calls.Load())
+	}
+	f.RetryAfter = time.Nanosecond
+	if _, err := f.Exchange(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls.Load() != 2 {
+		t.Errorf("failed transport was not retried after RetryAfter")
+	}
+
+	// Without a Fallback, queries fail when every transport fails.
+	up.err = errors.New("also down")
+	if _, err := f.Exchange(context.Background(), q); err == nil {
+		t.Errorf("Exchange with every transport down succeeded")
+	}
+	// With one, they are sent with it.
+	f.Fallback = &countingTransport{DNSTransport: doh}
+	if _, err := f.Exchange(context.Background(), q); err != nil {
+		t.Errorf("Exchange with a Fallback: %v", err)
+	}
+	if got, want := f.String(), "?,?,?"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
+
+// hangingTransport is a net.DNSTransport that does not respond. Being a
+// func type, it is not comparable.
+type hangingTransport func()
+
+func (hangingTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestFailoverHangingTransport(t *testing.T) {
+	ts, _ := newDoHServer(t)
+	doh := &HTTPSTransport{URL: ts.URL, Client: ts.Client()}
+	q := query(t, 1)
+	for _, f := range []*Failover{
+		{Transports: []net.DNSTransport{hangingTransport(nil), doh}},
+		{Transports: []net.DNSTransport{hangingTransport(nil)}, Fallback: doh},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := f.Exchange(ctx, q)
+		cancel()
+		if err != nil {
+			t.Errorf("Exchange with %d transports and a hanging first one: %v", len(f.Transports), err)
+		}
+	}
+}
+
+func TestPlainTransport(t *testing.T) {
+	// Serve over UDP, truncating responses, and over TCP on the same port.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Skipf("listening on TCP port of %v: %v", pc.LocalAddr(), err)
+	}
+	defer l.Close()
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			// A response with another ID is ignored.
+			q := append([]byte(nil), b[:n]...)
+			setMessageID(q, messageID(q)+1)
+			pc.WriteTo(answer(q, false), addr)
+			pc.WriteTo(answer(b[:n], true), addr)
+		}
+	}()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				var l [2]byte
+				if _, err := io.ReadFull(c, l[:]); err != nil {
+					return
+				}
+				q := make([]byte, int(l[0])<<8|int(l[1]))
+				if _, err := io.ReadFull(c, q); err != nil {
+					return
+				}
+				resp := answer(q, false)
+				c.Write(append([]byte{byte(len(resp) >> 8), byte(len(resp))}, resp...))
+			}()
+		}
+	}()
+	lookup(t, &PlainTransport{Address: pc.LocalAddr().String()})
+}
+
+func TestTransportContext(t *testing.T) {
+	// A server that never responds.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	tr := &TLSTransport{Address: l.Addr().String()}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := tr.Exchange(ctx, query(t, 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Exchange with canceled context: err = %v; want context.Canceled", err)
+	}
+}
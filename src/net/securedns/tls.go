@@ -0,0 +1,200 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package securedns
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout is the default value of TLSTransport.IdleTimeout.
+const DefaultIdleTimeout = 30 * time.Second
+
+// maxIdleConns is the number of idle connections a TLSTransport keeps.
+const maxIdleConns = 4
+
+// A TLSTransport is a net.DNSTransport that sends queries to a server
+// using DNS over TLS, as specified by RFC 7858. Connections are kept
+// open between queries and reused, as the RFC recommends.
+type TLSTransport struct {
+	// Address is the address of the server, of the form "host:port".
+	// The port for DNS over TLS is usually 853.
+	Address string
+
+	// Config is the TLS configuration. If nil, the zero configuration
+	// is used. If Config.ServerName is empty, the host of Address is
+	// used to verify the server's certificate; to authenticate a
+	// server given by IP address by its name, set ServerName.
+	Config *tls.Config
+
+	// Dialer is used to make TCP connections.
+	// If nil, the zero Dialer is used.
+	Dialer *net.Dialer
+
+	// IdleTimeout is how long an unused connection is kept open.
+	// If zero, DefaultIdleTimeout is used. If negative, connections
+	// are not reused.
+	IdleTimeout time.Duration
+
+	mu   sync.Mutex
+	idle []idleConn // most recently used last
+}
+
+type idleConn struct {
+	c     *tls.Conn
+	since time.Time
+}
+
+// Exchange implements the net.DNSTransport interface.
+func (t *TLSTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	for {
+		c, reused := t.getIdle()
+		if c == nil {
+			var err error
+			if c, err = t.dial(ctx); err != nil {
+				return nil, ctxErr(ctx, err)
+			}
+		}
+		resp, err := roundTrip(ctx, c, query)
+		if err == nil {
+			t.putIdle(c)
+			return resp, nil
+		}
+		c.Close()
+		// The server may have closed an idle connection.
+		// Retry once with a new connection.
+		if !reused || ctx.Err() != nil {
+			return nil, ctxErr(ctx, err)
+		}
+	}
+}
+
+func (t *TLSTransport) dial(ctx context.Context) (*tls.Conn, error) {
+	d := t.Dialer
+	if d == nil {
+		d = new(net.Dialer)
+	}
+	nc, err := d.DialContext(ctx, "tcp", t.Address)
+	if err != nil {
+		return nil, err
+	}
+	var config *tls.Config
+	if t.Config == nil {
+		config = new(tls.Config)
+	} else {
+		config = t.Config.Clone()
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(t.Address)
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	if config.NextProtos == nil {
+		// The ALPN protocol ID of RFC 7858.
+		config.NextProtos = []string{"dot"}
+	}
+	c := tls.Client(nc, config)
+	if err := c.HandshakeContext(ctx); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// roundTrip sends query on c, framed as in RFC 1035 section 4.2.2, and
+// reads the response.
+func roundTrip(ctx context.Context, c net.Conn, query []byte) ([]byte, error) {
+	defer watchContext(ctx, c)()
+	b := make([]byte, 2+len(query))
+	b[0], b[1] = byte(len(query)>>8), byte(len(query))
+	copy(b[2:], query)
+	if _, err := c.Write(b); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, int(b[0])<<8|int(b[1]))
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 {
+		return nil, errShortMessage
+	}
+	return resp, nil
+}
+
+func (t *TLSTransport) idleTimeout() time.Duration {
+	if t.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return t.IdleTimeout
+}
+
+// getIdle returns the most recently used idle connection, if any,
+// closing those that have been idle too long.
+func (t *TLSTransport) getIdle() (c *tls.Conn, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeExpiredLocked(time.Now())
+	if n := len(t.idle); n > 0 {
+		c = t.idle[n-1].c
+		t.idle = t.idle[:n-1]
+		return c, true
+	}
+	return nil, false
+}
+
+func (t *TLSTransport) putIdle(c *tls.Conn) {
+	if t.idleTimeout() < 0 {
+		c.Close()
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.idle) >= maxIdleConns {
+		t.idle[0].c.Close()
+		t.idle = append(t.idle[:0], t.idle[1:]...)
+	}
+	t.idle = append(t.idle, idleConn{c, time.Now()})
+}
+
+// closeExpiredLocked closes the connections that have been idle for
+// longer than the idle timeout at time now. t.mu must be held.
+func (t *TLSTransport) closeExpiredLocked(now time.Time) {
+	timeout := t.idleTimeout()
+	i := 0
+	for i < len(t.idle) && now.Sub(t.idle[i].since) >= timeout {
+		t.idle[i].c.Close()
+		i++
+	}
+	t.idle = append(t.idle[:0], t.idle[i:]...)
+}
+
+// CloseIdleConnections closes the connections that are not in use.
+func (t *TLSTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, ic := range t.idle {
+		ic.c.Close()
+	}
+	t.idle = nil
+}
+
+// String returns a description of the server of t, for errors
+// reported by net.Resolver.
+func (t *TLSTransport) String() string {
+	return "tls://" + t.Address
+}
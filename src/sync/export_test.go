@@ -4,6 +4,8 @@
 
 package sync
 
+import "unsafe"
+
 // Export for testing.
 var Runtime_Semacquire = runtime_Semacquire
 var Runtime_Semrelease = runtime_Semrelease
@@ -55,3 +57,16 @@ func (c *poolChain) PopHead() (any, bool) {
 func (c *poolChain) PopTail() (any, bool) {
 	return c.popTail()
 }
+
+// NewMapOfBadHash returns a MapOf whose hash function keeps only the
+// bits of the real hash that are set in mask, so that distinct keys
+// share trie paths or collide outright.
+func NewMapOfBadHash[K comparable, V any](mask uintptr) *MapOf[K, V] {
+	m := new(MapOf[K, V])
+	m.init()
+	hash := m.keyHash
+	m.keyHash = func(p unsafe.Pointer, seed uintptr) uintptr {
+		return hash(p, seed) & mask
+	}
+	return m
+}
@@ -0,0 +1,325 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+// mapOfAdapter implements mapInterface for a MapOf with keys of type K.
+type mapOfAdapter[K comparable] struct {
+	m sync.MapOf[K, any]
+}
+
+func (a *mapOfAdapter[K]) Load(key any) (any, bool) { return a.m.Load(key.(K)) }
+func (a *mapOfAdapter[K]) Store(key, value any)     { a.m.Store(key.(K), value) }
+func (a *mapOfAdapter[K]) Delete(key any)           { a.m.Delete(key.(K)) }
+
+func (a *mapOfAdapter[K]) LoadOrStore(key, value any) (actual any, loaded bool) {
+	return a.m.LoadOrStore(key.(K), value)
+}
+
+func (a *mapOfAdapter[K]) LoadAndDelete(key any) (value any, loaded bool) {
+	return a.m.LoadAndDelete(key.(K))
+}
+
+func (a *mapOfAdapter[K]) Range(f func(key, value any) bool) {
+	a.m.Range(func(k K, v any) bool { return f(k, v) })
+}
+
+func applyMapOf(calls []mapCall) ([]mapResult, map[any]any) {
+	return applyCalls(new(mapOfAdapter[string]), calls)
+}
+
+func TestMapOfMatchesRWMutex(t *testing.T) {
+	if err := quick.CheckEqual(applyMapOf, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// mapOfKinds returns MapOfs that exercise the different shapes the trie
+// can take: well-distributed hashes, hashes that share long prefixes,
+// and hashes that collide completely.
+func mapOfKinds() map[string]func() *sync.MapOf[string, int] {
+	return map[string]func() *sync.MapOf[string, int]{
+		"Default":   func() *sync.MapOf[string, int] { return new(sync.MapOf[string, int]) },
+		"SharedTop": func() *sync.MapOf[string, int] { return sync.NewMapOfBadHash[string, int](0xff) },
+		"Collision": func() *sync.MapOf[string, int] { return sync.NewMapOfBadHash[string, int](0) },
+	}
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	return keys
+}
+
+func TestMapOf(t *testing.T) {
+	for name, newMap := range mapOfKinds() {
+		t.Run(name, func(t *testing.T) {
+			m := newMap()
+			keys := testKeys(256)
+
+			for i, k := range keys {
+				if v, ok := m.Load(k); ok {
+					t.Fatalf("Load(%q) = %d, true before store", k, v)
+				}
+				if v, loaded := m.LoadOrStore(k, i); loaded {
+					t.Fatalf("LoadOrStore(%q) = %d, true, want %d, false", k, v, i)
+				}
+				if v, loaded := m.LoadOrStore(k, -1); !loaded || v != i {
+					t.Fatalf("LoadOrStore(%q) = %d, %v, want %d, true", k, v, loaded, i)
+				}
+			}
+			for i, k := range keys {
+				if v, ok := m.Load(k); !ok || v != i {
+					t.Fatalf("Load(%q) = %d, %v, want %d, true", k, v, ok, i)
+				}
+			}
+
+			for i, k := range keys {
+				if old, loaded := m.Swap(k, i+1); !loaded || old != i {
+					t.Fatalf("Swap(%q) = %d, %v, want %d, true", k, old, loaded, i)
+				}
+			}
+			for i, k := range keys {
+				if m.CompareAndSwap(k, i, -1) {
+					t.Fatalf("CompareAndSwap(%q, %d, -1) succeeded with stale old value", k, i)
+				}
+				if !m.CompareAndSwap(k, i+1, i) {
+					t.Fatalf("CompareAndSwap(%q, %d, %d) failed", k, i+1, i)
+				}
+			}
+
+			seen := make(map[string]bool)
+			m.Range(func(k string, v int) bool {
+				if seen[k] {
+					t.Fatalf("Range visited %q twice", k)
+				}
+				seen[k] = true
+				if want, _ := strconv.Atoi(k); v != want {
+					t.Fatalf("Range yielded %q: %d, want %d", k, v, want)
+				}
+				return true
+			})
+			if len(seen) != len(keys) {
+				t.Fatalf("Range visited %d keys, want %d", len(seen), len(keys))
+			}
+
+			for i, k := range keys {
+				if i%2 == 0 {
+					if m.CompareAndDelete(k, -1) {
+						t.Fatalf("CompareAndDelete(%q, -1) succeeded with wrong value", k)
+					}
+					if !m.CompareAndDelete(k, i) {
+						t.Fatalf("CompareAndDelete(%q, %d) failed", k, i)
+					}
+				} else {
+					if v, loaded := m.LoadAndDelete(k); !loaded || v != i {
+						t.Fatalf("LoadAndDelete(%q) = %d, %v, want %d, true", k, v, loaded, i)
+					}
+				}
+				if v, ok := m.Load(k); ok {
+					t.Fatalf("Load(%q) = %d, true after delete", k, v)
+				}
+				if m.CompareAndDelete(k, 0) {
+					t.Fatalf("CompareAndDelete(%q, 0) of missing key succeeded", k)
+				}
+				if m.CompareAndSwap(k, 0, 1) {
+					t.Fatalf("CompareAndSwap(%q, 0, 1) of missing key succeeded", k)
+				}
+			}
+			m.Range(func(k string, v int) bool {
+				t.Fatalf("Range of empty map yielded %q: %d", k, v)
+				return false
+			})
+		})
+	}
+}
+
+func TestMapOfClear(t *testing.T) {
+	var m sync.MapOf[int, string]
+	for i := 0; i < 100; i++ {
+		m.Store(i, strconv.Itoa(i))
+	}
+	m.Clear()
+	m.Range(func(k int, v string) bool {
+		t.Fatalf("Range after Clear yielded %d: %q", k, v)
+		return false
+	})
+	m.Store(1, "one")
+	if v, ok := m.Load(1); !ok || v != "one" {
+		t.Errorf("Load(1) after Clear and Store = %q, %v, want %q, true", v, ok, "one")
+	}
+}
+
+func TestMapOfRangeStop(t *testing.T) {
+	var m sync.MapOf[int, int]
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	n := 0
+	m.Range(func(int, int) bool {
+		n++
+		if n == 10 {
+			return false
+		}
+		return true
+	})
+	if n != 10 {
+		t.Errorf("Range called f %d times, want 10", n)
+	}
+}
+
+func TestMapOfNotComparable(t *testing.T) {
+	var m sync.MapOf[string, []int]
+	m.Store("a", []int{1})
+	if v, ok := m.Load("a"); !ok || len(v) != 1 {
+		t.Errorf("Load(%q) = %v, %v, want [1], true", "a", v, ok)
+	}
+	for _, f := range []func(){
+		func() { m.CompareAndSwap("a", nil, nil) },
+		func() { m.CompareAndDelete("a", nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("compare operation on non-comparable value type did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestMapOfConcurrent(t *testing.T) {
+	for name, newMap := range mapOfKinds() {
+		t.Run(name, func(t *testing.T) {
+			m := newMap()
+			procs := runtime.GOMAXPROCS(0)
+			keys := testKeys(128)
+			if name == "Collision" {
+				// Every operation walks the whole overflow chain.
+				keys = keys[:32]
+			}
+			iters := 1000
+			if testing.Short() {
+				iters = 100
+			}
+
+			// Each goroutine owns a disjoint set of keys and repeatedly
+			// inserts and deletes them, checking that no other goroutine
+			// disturbs its entries.
+			var wg sync.WaitGroup
+			for g := 0; g < procs; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < iters; i++ {
+						for _, k := range keys {
+							k := fmt.Sprintf("%d/%s", g, k)
+							if _, loaded := m.LoadOrStore(k, i); loaded {
+								t.Errorf("LoadOrStore(%q) found an entry already present", k)
+								return
+							}
+							if !m.CompareAndSwap(k, i, i+1) {
+								t.Errorf("CompareAndSwap(%q, %d, %d) failed", k, i, i+1)
+								return
+							}
+						}
+						for _, k := range keys {
+							k := fmt.Sprintf("%d/%s", g, k)
+							if v, ok := m.Load(k); !ok || v != i+1 {
+								t.Errorf("Load(%q) = %d, %v, want %d, true", k, v, ok, i+1)
+								return
+							}
+							if !m.CompareAndDelete(k, i+1) {
+								t.Errorf("CompareAndDelete(%q, %d) failed", k, i+1)
+								return
+							}
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			m.Range(func(k string, v int) bool {
+				t.Errorf("map not empty after concurrent test: %q: %d", k, v)
+				return true
+			})
+		})
+	}
+}
+
+func TestMapOfConcurrentSwap(t *testing.T) {
+	// All goroutines fight over the same keys; the sum of the values
+	// swapped out plus the final values must account for every value
+	// swapped in.
+	var m sync.MapOf[int, int]
+	const nkeys = 16
+	for k := 0; k < nkeys; k++ {
+		m.Store(k, 0)
+	}
+	procs := runtime.GOMAXPROCS(0)
+	iters := 10000
+	if testing.Short() {
+		iters = 1000
+	}
+	sums := make([]int, procs)
+	var wg sync.WaitGroup
+	for g := 0; g < procs; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 1; i <= iters; i++ {
+				old, loaded := m.Swap(i%nkeys, 1)
+				if !loaded {
+					t.Errorf("Swap(%d) did not find the key", i%nkeys)
+					return
+				}
+				sums[g] += old
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, s := range sums {
+		total += s
+	}
+	m.Range(func(_, v int) bool {
+		total += v
+		return true
+	})
+	if want := procs * iters; total != want {
+		t.Errorf("total of swapped values = %d, want %d", total, want)
+	}
+}
+
+func ExampleMapOf() {
+	var m sync.MapOf[string, int]
+	m.Store("apples", 3)
+	m.Store("pears", 5)
+
+	if m.CompareAndSwap("apples", 3, 4) {
+		fmt.Println("apples updated")
+	}
+	if !m.CompareAndDelete("pears", 4) {
+		fmt.Println("pears unchanged")
+	}
+	v, _ := m.Load("apples")
+	fmt.Println("apples:", v)
+	// Output:
+	// apples updated
+	// pears unchanged
+	// apples: 4
+}
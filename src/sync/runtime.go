@@ -55,3 +55,9 @@ func runtime_canSpin(i int) bool
 func runtime_doSpin()
 
 func runtime_nanotime() int64
+
+// runtime_mapTypeFuncs returns the runtime's hash function for the key
+// type of m and its equality function for the element type of m, which
+// must be a map. The equality function is nil if the element type is
+// not comparable.
+func runtime_mapTypeFuncs(m any) (hash func(unsafe.Pointer, uintptr) uintptr, equal func(unsafe.Pointer, unsafe.Pointer) bool)